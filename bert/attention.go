@@ -5,7 +5,6 @@ import (
 	"log"
 	"math"
 
-	"github.com/sugarme/gotch"
 	"github.com/sugarme/gotch/nn"
 	"github.com/sugarme/gotch/ts"
 
@@ -23,9 +22,17 @@ type BertSelfAttention struct {
 	Query             *nn.Linear
 	Key               *nn.Linear
 	Value             *nn.Linear
+	Position          PositionStrategy // position encoding of self-attention, see `PositionEmbeddingType`
+	AttentionWindow   int64            // sliding window size of self-attention, 0 for full attention
+	QueryLoRA         *util.LoRA       // optional LoRA adapters of projections, see `AddLoRA`
+	KeyLoRA           *util.LoRA
+	ValueLoRA         *util.LoRA
 }
 
 // NewBertSelfAttention creates a new `BertSelfAttention`
+//
+// Its position strategy is selected by `PositionEmbeddingType` of config. E.g. with "relative_key"
+// or "relative_key_query", it has a `distance_embedding` of relative positions.
 func NewBertSelfAttention(p *nn.Path, config *BertConfig) *BertSelfAttention {
 	if config.HiddenSize%config.NumAttentionHeads != 0 {
 		log.Fatal("Hidden size is not a multiple of the number of attention heads.")
@@ -40,6 +47,20 @@ func NewBertSelfAttention(p *nn.Path, config *BertConfig) *BertSelfAttention {
 	attentionHeadSize := int64(config.HiddenSize) / config.NumAttentionHeads
 	outputAttentions := config.OutputAttentions
 
+	position, err := NewPositionStrategy(p, config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if config.AttentionWindow > 0 {
+		if config.IsDecoder {
+			log.Fatal("Sliding window attention is not supported by decoder.")
+		}
+		switch position.Type() {
+		case PositionEmbeddingRelativeKey, PositionEmbeddingRelativeKeyQuery, PositionEmbeddingAlibi:
+			log.Fatalf("Sliding window attention does not support %q position embeddings.\n", position.Type())
+		}
+	}
+
 	return &BertSelfAttention{
 		NumAttentionHeads: config.NumAttentionHeads,
 		AttentionHeadSize: attentionHeadSize,
@@ -48,6 +69,8 @@ func NewBertSelfAttention(p *nn.Path, config *BertConfig) *BertSelfAttention {
 		Query:             query,
 		Key:               key,
 		Value:             value,
+		Position:          position,
+		AttentionWindow:   config.AttentionWindow,
 	}
 
 }
@@ -72,55 +95,108 @@ func (bsa *BertSelfAttention) flatten(x *ts.Tensor, bs, dimPerHead int64) (retVa
 //
 // NOTE. mask, encoderHiddenStates, encoderMask are  optional tensors
 // for `None` value, `ts.None` can be used.
+//
+// If `encoderHiddenStates` is defined, it works as cross-attention: queries are
+// projected from `hiddenStates`, keys and values from `encoderHiddenStates` and
+// `encoderMask` is applied instead of `mask`.
 func (bsa *BertSelfAttention) ForwardT(hiddenStates, mask, encoderHiddenStates, encoderMask *ts.Tensor, train bool) (retVal, retValOpt *ts.Tensor) {
+	context, weights, present := bsa.ForwardCachedT(hiddenStates, mask, encoderHiddenStates, encoderMask, nil, train)
+	present.Drop()
 
-	key := bsa.Key.Forward(hiddenStates)
-	value := bsa.Value.Forward(hiddenStates)
+	return context, weights
+}
 
-	if encoderHiddenStates.MustDefined() {
-		key = bsa.Key.Forward(encoderHiddenStates)
-		value = bsa.Value.Forward(encoderHiddenStates)
+// ForwardCachedT forwards pass with cached keys and values of previous steps (incremental decoding).
+//
+// Params:
+//   - `past`: optional keys and values from previous forward pass, `nil` if none.
+//     For self-attention, keys and values of `hiddenStates` are appended to them. For cross-attention,
+//     they are reused as is (encoder hidden states are not projected again).
+//
+// Returns context, attention weights (if `OutputAttentions`) and keys and values to pass to next step.
+// NOTE. `past` is consumed: its tensors are either dropped or moved to returned cache.
+func (bsa *BertSelfAttention) ForwardCachedT(hiddenStates, mask, encoderHiddenStates, encoderMask *ts.Tensor, past *AttentionCache, train bool) (retVal, retValOpt *ts.Tensor, present *AttentionCache) {
+
+	isCrossAttention := encoderHiddenStates.MustDefined()
+	attnMask := mask
+	if isCrossAttention {
+		attnMask = encoderMask
 	}
 
+	s := util.NewScope()
+	defer s.Close()
+
 	bs := hiddenStates.MustSize()[0]
 
-	hiddenStatesQ := hiddenStates.Apply(bsa.Query)
-	query := bsa.splitHeads(hiddenStatesQ, bs, bsa.AttentionHeadSize)
+	var (
+		keyLayer, valueLayer *ts.Tensor
+		pastLen              int64
+	)
+	switch {
+	case isCrossAttention && past != nil:
+		keyLayer, valueLayer = past.Key, past.Value
+
+	case isCrossAttention:
+		keyLayer = s.Track(bsa.splitHeads(s.Track(util.ApplyLoRA(bsa.Key, bsa.KeyLoRA, encoderHiddenStates, train)), bs, bsa.AttentionHeadSize))
+		valueLayer = s.Track(bsa.splitHeads(s.Track(util.ApplyLoRA(bsa.Value, bsa.ValueLoRA, encoderHiddenStates, train)), bs, bsa.AttentionHeadSize))
+
+	default:
+		// Cached keys are already position encoded.
+		pastLen = past.SeqLen()
+		keyLayer = s.Track(bsa.splitHeads(s.Track(util.ApplyLoRA(bsa.Key, bsa.KeyLoRA, hiddenStates, train)), bs, bsa.AttentionHeadSize))
+		keyLayer = s.Track(bsa.Position.Encode(keyLayer, pastLen))
+		valueLayer = s.Track(bsa.splitHeads(s.Track(util.ApplyLoRA(bsa.Value, bsa.ValueLoRA, hiddenStates, train)), bs, bsa.AttentionHeadSize))
+
+		if past != nil {
+			keyLayer = s.Track(ts.MustCat([]*ts.Tensor{past.Key, keyLayer}, 2))
+			valueLayer = s.Track(ts.MustCat([]*ts.Tensor{past.Value, valueLayer}, 2))
+			past.Drop()
+		}
+	}
+	present = &AttentionCache{Key: s.Keep(keyLayer), Value: s.Keep(valueLayer)}
 
-	hiddenStatesQ.MustDrop()
-	keyLayer := bsa.splitHeads(key, bs, bsa.AttentionHeadSize)
-	key.MustDrop()
-	valueLayer := bsa.splitHeads(value, bs, bsa.AttentionHeadSize)
-	value.MustDrop()
+	query := s.Track(bsa.splitHeads(s.Track(util.ApplyLoRA(bsa.Query, bsa.QueryLoRA, hiddenStates, train)), bs, bsa.AttentionHeadSize))
+	if !isCrossAttention {
+		query = s.Track(bsa.Position.Encode(query, pastLen))
+	}
 
 	size := math.Sqrt(float64(bsa.AttentionHeadSize))
-	queryLayer := query.MustDivScalar(ts.FloatScalar(size), true)
+	queryLayer := s.Track(query.MustDivScalar(ts.FloatScalar(size), false))
 
-	// Calculate score
-	var scores *ts.Tensor
-	if mask.MustDefined() {
-		keyLayerT := keyLayer.MustTranspose(-1, -2, true)
-		keyLayerT.MustAdd_(mask)
-		scores = queryLayer.MustMatmul(keyLayerT, true)
-	} else {
-		keyLayerT := keyLayer.MustTranspose(-1, -2, true)
-		scores = queryLayer.MustMatmul(keyLayerT, true)
+	if bsa.AttentionWindow > 0 && !isCrossAttention {
+		contextLayer, weights := bsa.slidingWindowAttention(queryLayer, keyLayer, valueLayer, attnMask, train)
+		s.TrackAll(contextLayer, weights)
+		context := s.Track(bsa.flatten(contextLayer, bs, bsa.AttentionHeadSize))
+		if !bsa.OutputAttentions {
+			return s.Keep(context), ts.None, present
+		}
+
+		return s.Keep(context), s.Keep(weights), present
 	}
 
-	weights := scores.MustSoftmax(-1, gotch.Float, true).ApplyT(bsa.Dropout, train)
+	// Calculate score
+	keyLayerT := s.Track(keyLayer.MustTranspose(-1, -2, false))
+	scores := s.Track(queryLayer.MustMatmul(keyLayerT, false))
+	if !isCrossAttention {
+		if bias := bsa.Position.ScoreBias(queryLayer, keyLayer); bias != nil {
+			scores.MustAdd_(s.Track(bias))
+		}
+	}
+	if attnMask.MustDefined() {
+		scores.MustAdd_(attnMask)
+	}
 
-	weightsMul := weights.MustMatmul(valueLayer, false)
+	probs := s.Track(util.Softmax(scores, -1))
+	weights := s.Track(probs.ApplyT(bsa.Dropout, train))
 
-	context := bsa.flatten(weightsMul, bs, bsa.AttentionHeadSize)
-	weightsMul.MustDrop()
+	weightsMul := s.Track(weights.MustMatmul(valueLayer, false))
+	context := s.Track(bsa.flatten(weightsMul, bs, bsa.AttentionHeadSize))
 
 	if !bsa.OutputAttentions {
-		weights.MustDrop()
-		return context, ts.None
-	} else {
-		return context, weights
+		return s.Keep(context), ts.None, present
 	}
 
+	return s.Keep(context), s.Keep(weights), present
 }
 
 // BertSelfOutput:
@@ -149,7 +225,7 @@ func NewBertSelfOutput(p *nn.Path, config *BertConfig, changeNameOpt ...bool) *B
 	}
 	layerNormConfig.Eps = 1e-12
 
-	layerNorm := nn.NewLayerNorm(p.Sub("LayerNorm"), []int64{config.HiddenSize}, layerNormConfig)
+	layerNorm := util.NewLayerNorm(p.Sub("LayerNorm"), []int64{config.HiddenSize}, layerNormConfig)
 	dropout := util.NewDropout(config.HiddenDropoutProb)
 
 	return &BertSelfOutput{linear, layerNorm, dropout}
@@ -157,16 +233,14 @@ func NewBertSelfOutput(p *nn.Path, config *BertConfig, changeNameOpt ...bool) *B
 
 func (bso *BertSelfOutput) ForwardT(hiddenStates *ts.Tensor, inputTensor *ts.Tensor, train bool) (retVal *ts.Tensor) {
 
-	state1 := hiddenStates.Apply(bso.Linear)
-	state2 := state1.ApplyT(bso.Dropout, train)
-	state3 := inputTensor.MustAdd(state2, false)
+	s := util.NewScope()
+	defer s.Close()
 
-	retVal = state3.Apply(bso.LayerNorm)
-	state1.MustDrop()
-	state2.MustDrop()
-	state3.MustDrop()
+	state1 := s.Track(hiddenStates.Apply(bso.Linear))
+	state2 := s.Track(state1.ApplyT(bso.Dropout, train))
+	state3 := s.Track(inputTensor.MustAdd(state2, false))
 
-	return retVal
+	return s.Keep(s.Track(util.ApplyLayerNorm(bso.LayerNorm, state3)))
 }
 
 // BertAttention:
@@ -189,11 +263,23 @@ func NewBertAttention(p *nn.Path, config *BertConfig, changeNameOpt ...bool) *Be
 }
 
 func (ba *BertAttention) ForwardT(hiddenStates, mask, encoderHiddenStates, encoderMask *ts.Tensor, train bool) (retVal, RetValOpt *ts.Tensor) {
+	output, attentionWeights, present := ba.ForwardCachedT(hiddenStates, mask, encoderHiddenStates, encoderMask, nil, train)
+	present.Drop()
+
+	return output, attentionWeights
+}
+
+// ForwardCachedT forwards pass with cached keys and values. See `BertSelfAttention.ForwardCachedT`.
+func (ba *BertAttention) ForwardCachedT(hiddenStates, mask, encoderHiddenStates, encoderMask *ts.Tensor, past *AttentionCache, train bool) (retVal, RetValOpt *ts.Tensor, present *AttentionCache) {
 
-	selfOutput, attentionWeights := ba.Bsa.ForwardT(hiddenStates, mask, encoderHiddenStates, encoderMask, train)
-	selfOutput = ba.Output.ForwardT(selfOutput, hiddenStates, train)
+	s := util.NewScope()
+	defer s.Close()
 
-	return selfOutput, attentionWeights
+	selfOutput, attentionWeights, present := ba.Bsa.ForwardCachedT(hiddenStates, mask, encoderHiddenStates, encoderMask, past, train)
+	s.Track(selfOutput)
+	output := s.Track(ba.Output.ForwardT(selfOutput, hiddenStates, train))
+
+	return s.Keep(output), attentionWeights, present
 }
 
 // BertIntermedate:
@@ -202,28 +288,34 @@ func (ba *BertAttention) ForwardT(hiddenStates, mask, encoderHiddenStates, encod
 type BertIntermediate struct {
 	Lin        *nn.Linear
 	Activation util.ActivationFn // interface
+	LoRA       *util.LoRA        // optional LoRA adapter of `Lin`, see `AddLoRA`
 }
 
 func NewBertIntermediate(p *nn.Path, config *BertConfig) *BertIntermediate {
 	lconfig := nn.DefaultLinearConfig()
 	lin := nn.NewLinear(p.Sub("dense"), config.HiddenSize, config.IntermediateSize, lconfig)
 
-	actFn, ok := util.ActivationFnMap[config.HiddenAct]
-	if !ok {
-		log.Fatalf("Unsupported activation function - %v\n", config.HiddenAct)
+	actFn, err := util.GetActivation(config.HiddenAct)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	return &BertIntermediate{lin, actFn}
+	return &BertIntermediate{Lin: lin, Activation: actFn}
 }
 
 func (bi *BertIntermediate) Forward(hiddenStates *ts.Tensor) (retVal *ts.Tensor) {
+	return bi.ForwardT(hiddenStates, false)
+}
 
-	states := hiddenStates.Apply(bi.Lin)
+// ForwardT forwards pass through the layer. `train` turns on dropout of LoRA adapter if any.
+func (bi *BertIntermediate) ForwardT(hiddenStates *ts.Tensor, train bool) (retVal *ts.Tensor) {
 
-	retVal = bi.Activation.Fwd(states)
-	states.MustDrop()
+	s := util.NewScope()
+	defer s.Close()
 
-	return retVal
+	states := s.Track(util.ApplyLoRA(bi.Lin, bi.LoRA, hiddenStates, train))
+
+	return s.Keep(s.Track(bi.Activation.Fwd(states)))
 }
 
 // BertOutput:
@@ -233,6 +325,7 @@ type BertOutput struct {
 	Lin       *nn.Linear
 	LayerNorm *nn.LayerNorm
 	Dropout   *util.Dropout
+	LoRA      *util.LoRA // optional LoRA adapter of `Lin`, see `AddLoRA`
 }
 
 func NewBertOutput(p *nn.Path, config *BertConfig, changeNameOpt ...bool) *BertOutput {
@@ -250,24 +343,21 @@ func NewBertOutput(p *nn.Path, config *BertConfig, changeNameOpt ...bool) *BertO
 		layerNormConfig.BsName = "beta"
 	}
 	layerNormConfig.Eps = 1e-12
-	layerNorm := nn.NewLayerNorm(p.Sub("LayerNorm"), []int64{config.HiddenSize}, layerNormConfig)
+	layerNorm := util.NewLayerNorm(p.Sub("LayerNorm"), []int64{config.HiddenSize}, layerNormConfig)
 
 	dropout := util.NewDropout(config.HiddenDropoutProb)
 
-	return &BertOutput{lin, layerNorm, dropout}
+	return &BertOutput{Lin: lin, LayerNorm: layerNorm, Dropout: dropout}
 }
 
 func (bo *BertOutput) ForwardT(hiddenStates, inputTensor *ts.Tensor, train bool) (retVal *ts.Tensor) {
 
-	state1 := hiddenStates.Apply(bo.Lin)
-	state2 := state1.ApplyT(bo.Dropout, train)
-	state3 := inputTensor.MustAdd(state2, false)
-
-	retVal = state3.Apply(bo.LayerNorm)
+	s := util.NewScope()
+	defer s.Close()
 
-	state1.MustDrop()
-	state2.MustDrop()
-	state3.MustDrop()
+	state1 := s.Track(util.ApplyLoRA(bo.Lin, bo.LoRA, hiddenStates, train))
+	state2 := s.Track(state1.ApplyT(bo.Dropout, train))
+	state3 := s.Track(inputTensor.MustAdd(state2, false))
 
-	return retVal
+	return s.Keep(s.Track(util.ApplyLayerNorm(bo.LayerNorm, state3)))
 }
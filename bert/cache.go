@@ -0,0 +1,115 @@
+package bert
+
+import (
+	"github.com/sugarme/gotch/ts"
+)
+
+// Key/value cache for incremental decoding:
+// =========================================
+//
+// When `BertModel` is used as a decoder (`IsDecoder`), generating a token only
+// needs attention of the new token(s) over previous ones. Projected keys and values
+// of previous steps are kept in a `Cache` and passed to the next forward pass
+// so that each step costs linear instead of quadratic time in generated length.
+
+// AttentionCache holds projected keys and values of an attention layer.
+// Both are of shape (batch size, num heads, seq length, head size).
+type AttentionCache struct {
+	Key   *ts.Tensor
+	Value *ts.Tensor
+}
+
+// Drop drops cached tensors.
+func (c *AttentionCache) Drop() {
+	if c == nil {
+		return
+	}
+	c.Key.MustDrop()
+	c.Value.MustDrop()
+}
+
+// SeqLen returns number of cached positions.
+func (c *AttentionCache) SeqLen() int64 {
+	if c == nil {
+		return 0
+	}
+	return c.Key.MustSize()[2]
+}
+
+// indexSelect returns a new cache with batch items selected by `index` and drops the current one.
+func (c *AttentionCache) indexSelect(index *ts.Tensor) *AttentionCache {
+	if c == nil {
+		return nil
+	}
+	out := &AttentionCache{
+		Key:   c.Key.MustIndexSelect(0, index, false),
+		Value: c.Value.MustIndexSelect(0, index, false),
+	}
+	c.Drop()
+
+	return out
+}
+
+// LayerCache holds caches of a `BertLayer`: self-attention and, for decoder, cross-attention
+// over encoder hidden states.
+type LayerCache struct {
+	Self  *AttentionCache
+	Cross *AttentionCache
+}
+
+// Drop drops cached tensors.
+func (c *LayerCache) Drop() {
+	if c == nil {
+		return
+	}
+	c.Self.Drop()
+	c.Cross.Drop()
+}
+
+// Cache holds past keys and values of all layers of a `BertEncoder`.
+type Cache struct {
+	Layers []LayerCache
+}
+
+// SeqLen returns number of cached positions (i.e. length of decoded prefix).
+func (c *Cache) SeqLen() int64 {
+	if c == nil || len(c.Layers) == 0 {
+		return 0
+	}
+	return c.Layers[0].Self.SeqLen()
+}
+
+// Layer returns cache of i-th layer or `nil` if cache is empty.
+func (c *Cache) Layer(i int) *LayerCache {
+	if c == nil || i >= len(c.Layers) {
+		return nil
+	}
+	return &c.Layers[i]
+}
+
+// Drop drops all cached tensors.
+func (c *Cache) Drop() {
+	if c == nil {
+		return
+	}
+	for i := range c.Layers {
+		c.Layers[i].Drop()
+	}
+}
+
+// Reorder selects batch items of cache by `index` (e.g. surviving beams in beam search)
+// and returns new cache. The current cache is dropped.
+func (c *Cache) Reorder(index *ts.Tensor) *Cache {
+	if c == nil {
+		return nil
+	}
+	out := &Cache{Layers: make([]LayerCache, len(c.Layers))}
+	for i, l := range c.Layers {
+		out.Layers[i] = LayerCache{
+			Self:  l.Self.indexSelect(index),
+			Cross: l.Cross.indexSelect(index),
+		}
+	}
+
+	return out
+}
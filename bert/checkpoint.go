@@ -0,0 +1,273 @@
+package bert
+
+import (
+	"fmt"
+
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/util"
+)
+
+// Gradient checkpointing:
+// =======================
+//
+// When `GradientCheckpointing` is on, `BertEncoder` does not keep activations of its layers
+// for the backward pass during training. Layers are run without gradient tracking and only
+// their inputs are kept (checkpoints). The encoder output is a leaf tensor, so the backward
+// pass of a loss stops at the encoder output. `BackwardCheckpoints` then recomputes each layer
+// from its checkpoint, last layer first, and back-propagates through it, then through embeddings.
+//
+// A training step is therefore:
+//
+//	output, err := model.ForwardT(..., true)
+//	loss := ...
+//	loss.MustBackward()
+//	err = model.BackwardCheckpoints()
+//	opt.Step()
+//
+// Memory of activations is reduced from all layers to a single layer at a time at the cost
+// of an extra forward pass of the encoder.
+//
+// Dropout layers of encoder layers record their masks in training (see `util.Dropout`) and
+// the recomputation replays masks of the forward pass, so gradients are exact with dropout too.
+// Masks are kept until `BackwardCheckpoints`. Encoder hidden states of a decoder are treated
+// as constants: no gradient flows to them.
+
+// Checkpointed is implemented by models supporting gradient checkpointing.
+type Checkpointed interface {
+	// BackwardCheckpoints completes the backward pass through checkpointed layers.
+	// It must be called after backward pass of the loss.
+	BackwardCheckpoints() error
+}
+
+// encoderCheckpoint holds what is needed to recompute encoder layers in the backward pass.
+type encoderCheckpoint struct {
+	input               *ts.Tensor   // encoder input attached to graph of embeddings
+	inputs              []*ts.Tensor // detached input of each layer
+	output              *ts.Tensor   // encoder output (leaf tensor requiring grad)
+	mask                *ts.Tensor
+	encoderHiddenStates *ts.Tensor
+	encoderMask         *ts.Tensor
+	train               bool
+	dropoutPos          [][]int         // positions of dropout masks of each layer before its forward pass
+	recording           []*util.Dropout // dropouts which started recording masks for this checkpoint
+}
+
+func (c *encoderCheckpoint) drop() {
+	for _, x := range append([]*ts.Tensor{c.input, c.output, c.mask, c.encoderHiddenStates, c.encoderMask}, c.inputs...) {
+		dropTensor(x)
+	}
+	for _, d := range c.recording {
+		d.StopRecording()
+	}
+}
+
+// dropouts returns dropout layers of encoder layer, including those of LoRA adapters.
+func (bl *BertLayer) dropouts() []*util.Dropout {
+	attentions := []*BertAttention{bl.Attention}
+	if bl.CrossAttention != nil {
+		attentions = append(attentions, bl.CrossAttention)
+	}
+
+	var dropouts []*util.Dropout
+	var loras []*util.LoRA
+	for _, attention := range attentions {
+		dropouts = append(dropouts, attention.Bsa.Dropout, attention.Output.Dropout)
+		loras = append(loras, attention.Bsa.QueryLoRA, attention.Bsa.KeyLoRA, attention.Bsa.ValueLoRA)
+	}
+	dropouts = append(dropouts, bl.Output.Dropout)
+	loras = append(loras, bl.Intermediate.LoRA, bl.Output.LoRA)
+	for _, lora := range loras {
+		if lora != nil {
+			dropouts = append(dropouts, lora.Dropout)
+		}
+	}
+
+	return dropouts
+}
+
+// recordDropouts makes dropouts of `layer` record their masks and saves their positions so that
+// the layer can be recomputed with the same masks.
+func (c *encoderCheckpoint) recordDropouts(layer *BertLayer) {
+	var pos []int
+	for _, d := range layer.dropouts() {
+		if !d.Recording() {
+			d.Record()
+			c.recording = append(c.recording, d)
+		}
+		pos = append(pos, d.Pos())
+	}
+	c.dropoutPos = append(c.dropoutPos, pos)
+}
+
+// shallowCloneOpt returns a shallow clone of tensor or `ts.None` if it is not defined.
+func shallowCloneOpt(x *ts.Tensor) *ts.Tensor {
+	if !x.MustDefined() {
+		return ts.None
+	}
+
+	return x.MustShallowClone()
+}
+
+// gradEnabled returns whether gradient tracking is on.
+func gradEnabled() bool {
+	enabled := ts.MustGradSetEnabled(true)
+	ts.MustGradSetEnabled(enabled)
+
+	return enabled
+}
+
+// forwardCheckpointed forwards pass through encoder layers without keeping their activations.
+// NOTE. `hiddenStates` is consumed (kept in checkpoint until `BackwardCheckpoints`).
+func (be *BertEncoder) forwardCheckpointed(hiddenStates, mask, encoderHiddenStates, encoderMask *ts.Tensor, train bool) (retVal *ts.Tensor, retValOpt1, retValOpt2 []*ts.Tensor) {
+	// Drop checkpoint of a previous step which was not back-propagated.
+	if be.checkpoint != nil {
+		be.checkpoint.drop()
+	}
+
+	ckpt := &encoderCheckpoint{
+		input:       hiddenStates,
+		mask:        shallowCloneOpt(mask),
+		encoderMask: shallowCloneOpt(encoderMask),
+		train:       train,
+	}
+	ckpt.encoderHiddenStates = ts.None
+	if encoderHiddenStates.MustDefined() {
+		ckpt.encoderHiddenStates = encoderHiddenStates.MustDetach(false)
+	}
+
+	var allHiddenStates, allAttentions []*ts.Tensor
+	hiddenState := hiddenStates.MustDetach(false)
+	ts.NoGrad(func() {
+		for i := range be.Layers {
+			layer := &be.Layers[i]
+			ckpt.inputs = append(ckpt.inputs, hiddenState)
+			if train {
+				ckpt.recordDropouts(layer)
+			}
+			if be.OutputHiddenStates {
+				allHiddenStates = append(allHiddenStates, hiddenState.MustShallowClone())
+			}
+
+			stateTmp, attnWeightsTmp, crossAttnWeightsTmp, present := layer.ForwardCachedT(hiddenState, ckpt.mask, ckpt.encoderHiddenStates, ckpt.encoderMask, nil, train)
+			present.Drop()
+			dropTensor(crossAttnWeightsTmp)
+			if be.OutputAttentions {
+				allAttentions = append(allAttentions, attnWeightsTmp)
+			} else {
+				dropTensor(attnWeightsTmp)
+			}
+			hiddenState = stateTmp
+		}
+	})
+
+	// Encoder output becomes a leaf so that its gradient is available after backward pass of the loss.
+	ckpt.output = hiddenState.MustSetRequiresGrad(true, false)
+	be.checkpoint = ckpt
+
+	return hiddenState, allHiddenStates, allAttentions
+}
+
+// BackwardCheckpoints completes the backward pass through encoder layers which were checkpointed
+// in the last forward pass. It is a no-op if there is no checkpoint.
+func (be *BertEncoder) BackwardCheckpoints() error {
+	ckpt := be.checkpoint
+	if ckpt == nil {
+		return nil
+	}
+	be.checkpoint = nil
+	defer ckpt.drop()
+
+	grad := ckpt.output.MustGrad(false)
+	if !grad.MustDefined() {
+		err := fmt.Errorf("BackwardCheckpoints() failed: encoder output has no gradient. Backward pass of the loss must be run first.")
+		return err
+	}
+
+	for i := len(be.Layers) - 1; i >= 0; i-- {
+		nextGrad, err := be.backwardLayer(i, ckpt, grad)
+		grad.MustDrop()
+		if err != nil {
+			return err
+		}
+		grad = nextGrad
+	}
+
+	// Backward through embeddings (or whatever produced encoder input).
+	if ckpt.input.MustRequiresGrad() {
+		s := util.NewScope()
+		surrogate := s.Track(s.Track(ckpt.input.MustMul(grad, false)).MustSum(ckpt.input.DType(), false))
+		surrogate.MustBackward()
+		s.Close()
+	}
+	grad.MustDrop()
+
+	return nil
+}
+
+// backwardLayer recomputes i-th layer from its checkpoint and back-propagates `grad` (gradient of
+// layer output) through it. It returns gradient of layer input.
+func (be *BertEncoder) backwardLayer(i int, ckpt *encoderCheckpoint, grad *ts.Tensor) (*ts.Tensor, error) {
+	s := util.NewScope()
+	defer s.Close()
+
+	input := s.Track(ckpt.inputs[i].MustSetRequiresGrad(true, false))
+	if ckpt.train {
+		for j, d := range be.Layers[i].dropouts() {
+			d.Seek(ckpt.dropoutPos[i][j])
+		}
+	}
+	output, attnWeights, crossAttnWeights, present := be.Layers[i].ForwardCachedT(input, ckpt.mask, ckpt.encoderHiddenStates, ckpt.encoderMask, nil, ckpt.train)
+	present.Drop()
+	s.TrackAll(output, attnWeights, crossAttnWeights)
+
+	// Vector-Jacobian product: gradient of sum(output * grad) w.r.t. parameters and input.
+	surrogate := s.Track(s.Track(output.MustMul(grad, false)).MustSum(output.DType(), false))
+	if err := surrogate.Backward(); err != nil {
+		err = fmt.Errorf("BackwardCheckpoints() failed at layer %v: %w", i, err)
+		return nil, err
+	}
+
+	return input.MustGrad(false), nil
+}
+
+// BackwardCheckpoints completes the backward pass through checkpointed encoder layers.
+// See `BertEncoder.BackwardCheckpoints`.
+func (b *BertModel) BackwardCheckpoints() error {
+	return b.Encoder.BackwardCheckpoints()
+}
+
+// BackwardCheckpoints completes the backward pass through checkpointed encoder layers.
+func (mlm *BertForMaskedLM) BackwardCheckpoints() error {
+	return mlm.bert.BackwardCheckpoints()
+}
+
+// BackwardCheckpoints completes the backward pass through checkpointed encoder layers.
+func (nsp *BertForNextSentencePrediction) BackwardCheckpoints() error {
+	return nsp.bert.BackwardCheckpoints()
+}
+
+// BackwardCheckpoints completes the backward pass through checkpointed encoder layers.
+func (pt *BertForPreTraining) BackwardCheckpoints() error {
+	return pt.bert.BackwardCheckpoints()
+}
+
+// BackwardCheckpoints completes the backward pass through checkpointed encoder layers.
+func (bsc *BertForSequenceClassification) BackwardCheckpoints() error {
+	return bsc.bert.BackwardCheckpoints()
+}
+
+// BackwardCheckpoints completes the backward pass through checkpointed encoder layers.
+func (mc *BertForMultipleChoice) BackwardCheckpoints() error {
+	return mc.bert.BackwardCheckpoints()
+}
+
+// BackwardCheckpoints completes the backward pass through checkpointed encoder layers.
+func (tc *BertForTokenClassification) BackwardCheckpoints() error {
+	return tc.bert.BackwardCheckpoints()
+}
+
+// BackwardCheckpoints completes the backward pass through checkpointed encoder layers.
+func (qa *BertForQuestionAnswering) BackwardCheckpoints() error {
+	return qa.bert.BackwardCheckpoints()
+}
@@ -0,0 +1,90 @@
+//go:build unix
+
+package bert_test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/ts"
+)
+
+// checkpointMemoryEnv selects the run ("checkpointed" or "full") of a child process of
+// `TestBertEncoder_GradientCheckpointingMemory`.
+const checkpointMemoryEnv = "BERT_CHECKPOINT_MEMORY"
+
+// peakMemoryPrefix prefixes peak memory reported by a child process.
+const peakMemoryPrefix = "peak memory (KB): "
+
+func maxRSS(t *testing.T) int64 {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		t.Fatal(err)
+	}
+
+	return int64(usage.Maxrss)
+}
+
+// peakMemory runs a training step in a child process and returns growth of its peak resident
+// memory. Peak memory of the test process only grows, so each run needs a fresh process.
+func peakMemory(t *testing.T, run string) int64 {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestBertEncoder_GradientCheckpointingMemory$")
+	cmd.Env = append(os.Environ(), checkpointMemoryEnv+"="+run)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v run failed: %v\n%s", run, err, out)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, peakMemoryPrefix) {
+			continue
+		}
+		var kb int64
+		if _, err := fmt.Sscan(strings.TrimPrefix(line, peakMemoryPrefix), &kb); err != nil {
+			t.Fatal(err)
+		}
+		return kb
+	}
+	t.Fatalf("%v run did not report peak memory:\n%s", run, out)
+
+	return 0
+}
+
+func TestBertEncoder_GradientCheckpointingMemory(t *testing.T) {
+	if run := os.Getenv(checkpointMemoryEnv); run != "" {
+		vs, model := newCheckpointModel(64, 8, 8, 0)
+
+		// Attention scores dominate activations of long sequences.
+		var batchSize, seqLen int64 = 4, 512
+		inputIds := ts.MustOnes([]int64{batchSize, seqLen}, gotch.Int64, gotch.CPU)
+		mask := ts.MustOnes([]int64{batchSize, seqLen}, gotch.Int64, gotch.CPU)
+
+		start := maxRSS(t)
+		model.Encoder.GradientCheckpointing = run == "checkpointed"
+		trainStep(t, vs, model, inputIds, mask)
+		fmt.Printf("%v%v\n", peakMemoryPrefix, maxRSS(t)-start)
+
+		inputIds.MustDrop()
+		mask.MustDrop()
+		return
+	}
+	if testing.Short() {
+		t.Skip("skipping memory test in short mode")
+	}
+
+	checkpointed := peakMemory(t, "checkpointed")
+	full := peakMemory(t, "full")
+	if full <= checkpointed {
+		t.Errorf("Want peak memory of checkpointed run lower than: %v KB\n", full)
+		t.Errorf("Got peak memory of checkpointed run: %v KB\n", checkpointed)
+	}
+}
@@ -0,0 +1,154 @@
+package bert_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/nn"
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/bert"
+	"github.com/yinziyang/transformer/util"
+)
+
+func newCheckpointModel(hiddenSize, numLayers, numHeads int64, dropout float64) (*nn.VarStore, *bert.BertModel) {
+	config := bert.NewConfig(map[string]interface{}{
+		"VocabSize":         int64(50),
+		"HiddenSize":        hiddenSize,
+		"NumHiddenLayers":   numLayers,
+		"NumAttentionHeads": numHeads,
+		"IntermediateSize":  4 * hiddenSize,
+	})
+	config.HiddenDropoutProb = dropout
+	config.AttentionProbsDropoutProb = dropout
+
+	vs := nn.NewVarStore(gotch.CPU)
+	model := bert.NewBertModel(vs.Root(), config, false)
+
+	return vs, model
+}
+
+// trainStep runs forward and backward pass and returns gradients of all variables.
+func trainStep(t *testing.T, vs *nn.VarStore, model *bert.BertModel, inputIds, mask *ts.Tensor) map[string][]float64 {
+	for _, x := range vs.TrainableVariables() {
+		x.ZeroGrad()
+	}
+
+	output, err := model.ForwardT(inputIds, mask, ts.None, ts.None, ts.None, ts.None, ts.None, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum1 := output.LastHiddenState.MustSum(gotch.Float, false)
+	sum2 := output.PooledOutput.MustSum(gotch.Float, false)
+	loss := sum1.MustAdd(sum2, false)
+	loss.MustBackward()
+	if err := model.BackwardCheckpoints(); err != nil {
+		t.Fatal(err)
+	}
+	loss.MustDrop()
+	sum1.MustDrop()
+	sum2.MustDrop()
+	output.Drop()
+
+	grads := make(map[string][]float64)
+	for name, x := range vs.Variables() {
+		grad := x.MustGrad(false)
+		if grad.MustDefined() {
+			grads[name] = grad.Float64Values()
+		}
+		grad.MustDrop()
+	}
+
+	return grads
+}
+
+// compareGrads checks gradients with checkpointing `got` against gradients without checkpointing `want`.
+func compareGrads(t *testing.T, want, got map[string][]float64) {
+	if len(got) != len(want) || len(want) == 0 {
+		t.Fatalf("Want gradients of %v variables, got %v\n", len(want), len(got))
+	}
+	for name, wantGrad := range want {
+		gotGrad, ok := got[name]
+		if !ok {
+			t.Errorf("Want gradient of %q with checkpointing\n", name)
+			continue
+		}
+		for i := range wantGrad {
+			if math.Abs(wantGrad[i]-gotGrad[i]) > 1e-4+1e-4*math.Abs(wantGrad[i]) {
+				t.Errorf("Variable %q - want grad[%v]: %v\n", name, i, wantGrad[i])
+				t.Errorf("Variable %q - got grad[%v]: %v\n", name, i, gotGrad[i])
+				break
+			}
+		}
+	}
+}
+
+func TestBertEncoder_GradientCheckpointing(t *testing.T) {
+	vs, model := newCheckpointModel(16, 3, 2, 0)
+
+	inputIds := ts.MustOfSlice([]int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 0}).MustView([]int64{2, 6}, true)
+	mask := ts.MustOfSlice([]int64{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0}).MustView([]int64{2, 6}, true)
+
+	model.Encoder.GradientCheckpointing = false
+	want := trainStep(t, vs, model, inputIds, mask)
+
+	model.Encoder.GradientCheckpointing = true
+	got := trainStep(t, vs, model, inputIds, mask)
+
+	compareGrads(t, want, got)
+
+	// Backward pass of checkpoints without backward pass of the loss must fail.
+	output, err := model.ForwardT(inputIds, mask, ts.None, ts.None, ts.None, ts.None, ts.None, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output.Drop()
+	if err := model.BackwardCheckpoints(); err == nil {
+		t.Errorf("Want error when loss was not back-propagated\n")
+	}
+
+	inputIds.MustDrop()
+	mask.MustDrop()
+}
+
+func TestBertEncoder_GradientCheckpointingDropout(t *testing.T) {
+	vs, model := newCheckpointModel(16, 3, 2, 0.3)
+
+	inputIds := ts.MustOfSlice([]int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 0}).MustView([]int64{2, 6}, true)
+	mask := ts.MustOfSlice([]int64{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0}).MustView([]int64{2, 6}, true)
+
+	// Dropouts record masks of the pass without checkpointing and replay them in the pass with
+	// checkpointing, so gradients match only if recomputed layers apply masks of the forward pass.
+	dropouts := []*util.Dropout{model.Embeddings.Dropout}
+	for _, layer := range model.Encoder.Layers {
+		dropouts = append(dropouts, layer.Attention.Bsa.Dropout, layer.Attention.Output.Dropout, layer.Output.Dropout)
+	}
+	for _, d := range dropouts {
+		d.Record()
+	}
+
+	model.Encoder.GradientCheckpointing = false
+	want := trainStep(t, vs, model, inputIds, mask)
+
+	for _, d := range dropouts {
+		d.Seek(0)
+	}
+	model.Encoder.GradientCheckpointing = true
+	got := trainStep(t, vs, model, inputIds, mask)
+
+	compareGrads(t, want, got)
+
+	// Dropouts which record masks only for checkpointing stop recording after backward pass.
+	for _, d := range dropouts {
+		d.StopRecording()
+	}
+	trainStep(t, vs, model, inputIds, mask)
+	for i, d := range dropouts[1:] {
+		if d.Recording() {
+			t.Errorf("Want dropout %v of encoder not recording after backward pass\n", i)
+		}
+	}
+	inputIds.MustDrop()
+	mask.MustDrop()
+}
@@ -8,6 +8,10 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+
+	"github.com/sugarme/gotch"
+
+	"github.com/yinziyang/transformer/util"
 )
 
 // BertConfig defines the BERT model architecture (i.e., number of layers,
@@ -27,9 +31,19 @@ type BertConfig struct {
 	OutputAttentions          bool             `json:"output_attentions"`
 	OutputHiddenStates        bool             `json:"output_hidden_states"`
 	IsDecoder                 bool             `json:"is_decoder"`
-	Id2Label                  map[int64]string `json:"id_2_label"`
-	Label2Id                  map[string]int64 `json:"label_2_id"`
+	Id2Label                  map[int64]string `json:"id2label"`
+	Label2Id                  map[string]int64 `json:"label2id"`
 	NumLabels                 int64            `json:"num_labels"`
+	GradientCheckpointing     bool             `json:"gradient_checkpointing"`
+	PositionEmbeddingType     string           `json:"position_embedding_type"`
+	RopeTheta                 float64          `json:"rope_theta"`
+	AttentionWindow           int64            `json:"attention_window"`
+	ProblemType               string           `json:"problem_type"`
+
+	// DType is the dtype of model variables and computation: "float32" (default), "float16" or
+	// "bfloat16". It is an option of this package, not read from HuggingFace configuration files
+	// whose `torch_dtype` is the dtype of saved weights. LayerNorm and softmax run in float32.
+	DType string `json:"-"`
 }
 
 // NewBertConfig initiates BertConfig with given input parameters or default values.
@@ -48,7 +62,11 @@ func NewConfig(customParams map[string]interface{}) *BertConfig {
 		"InitializerRange":         float32(0.02),
 		"LayerNormEps":             1e-12, // not applied yet
 		"PadTokenId":               0,     // not applied yet
-		"GradientCheckpointing":    false, // not applied yet
+		"GradientCheckpointing":    false,
+		"PositionEmbeddingType":    PositionEmbeddingAbsolute,
+		"RopeTheta":                float64(10000),
+		"AttentionWindow":          int64(0), // 0 for full attention
+		"DType":                    "float32",
 	}
 
 	params := defaultValues
@@ -87,6 +105,10 @@ func ConfigFromFile(filename string) (*BertConfig, error) {
 		fmt.Println(err)
 		log.Fatalf("Could not parse configuration to BertConfiguration.\n")
 	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
 	return &config, nil
 }
 
@@ -102,9 +124,79 @@ func (c *BertConfig) Load(modelNameOrPath string, params map[string]interface{})
 	// Update custom parameters
 	c.updateParams(params)
 
+	return c.validate()
+}
+
+// validate checks that configuration can be used to build a model.
+// Missing `hidden_act` and `position_embedding_type` default to "gelu" and "absolute"
+// as in HuggingFace BertConfig.
+func (c *BertConfig) validate() error {
+	if c.HiddenAct == "" {
+		c.HiddenAct = "gelu"
+	}
+	if _, err := util.GetActivation(c.HiddenAct); err != nil {
+		err = fmt.Errorf("Invalid hidden_act in BertConfig: %w", err)
+		return err
+	}
+
+	if c.PositionEmbeddingType == "" {
+		c.PositionEmbeddingType = PositionEmbeddingAbsolute
+	}
+	if _, err := getPositionStrategy(c.PositionEmbeddingType); err != nil {
+		err = fmt.Errorf("Invalid position_embedding_type in BertConfig: %w", err)
+		return err
+	}
+
+	if c.AttentionWindow < 0 || c.AttentionWindow%2 != 0 {
+		err := fmt.Errorf("Invalid attention_window in BertConfig: must be 0 (full attention) or a positive even number, got %v.", c.AttentionWindow)
+		return err
+	}
+
+	switch c.ProblemType {
+	case "", ProblemTypeRegression, ProblemTypeSingleLabel, ProblemTypeMultiLabel:
+	default:
+		err := fmt.Errorf("Invalid problem_type in BertConfig: %q.", c.ProblemType)
+		return err
+	}
+
+	if _, err := util.ParseDType(c.DType); err != nil {
+		err = fmt.Errorf("Invalid DType in BertConfig: %w", err)
+		return err
+	}
+
 	return nil
 }
 
+// ModelDType returns dtype of model variables, float32 if `DType` is empty or invalid.
+// Models are built in this dtype with `util.WithDType`, e.g. by `Load`: models must not be loaded
+// concurrently. See `util.ConvertVarStore` to convert a float32 model instead.
+func (c *BertConfig) ModelDType() gotch.DType {
+	dtype, err := util.ParseDType(c.DType)
+	if err != nil {
+		return gotch.Float
+	}
+
+	return dtype
+}
+
+// IsAbsolutePosition returns whether learned absolute position embeddings are added to
+// input embeddings.
+func (c *BertConfig) IsAbsolutePosition() bool {
+	return c.PositionEmbeddingType == "" || c.PositionEmbeddingType == PositionEmbeddingAbsolute
+}
+
+// HasPositionEmbeddings returns whether embeddings have learned position embeddings. They are
+// kept for relative positions to load HuggingFace checkpoints but are not added to input embeddings.
+// Other strategies (e.g. rotary, ALiBi) have none, so sequence length is not capped by `MaxPositionEmbeddings`.
+func (c *BertConfig) HasPositionEmbeddings() bool {
+	switch c.PositionEmbeddingType {
+	case "", PositionEmbeddingAbsolute, PositionEmbeddingRelativeKey, PositionEmbeddingRelativeKeyQuery:
+		return true
+	default:
+		return false
+	}
+}
+
 func (c *BertConfig) fromFile(filename string) error {
 	filePath, err := filepath.Abs(filename)
 	if err != nil {
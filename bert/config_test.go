@@ -1,10 +1,16 @@
 package bert_test
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
+	"github.com/sugarme/gotch/nn"
+	"github.com/sugarme/gotch/ts"
+
 	"github.com/yinziyang/transformer/bert"
+	"github.com/yinziyang/transformer/util"
 )
 
 // No custom params
@@ -48,3 +54,117 @@ func TestNewBertConfig_Custom(t *testing.T) {
 		t.Errorf("Got: '%v'\n", gotVocabSize)
 	}
 }
+
+func writeConfig(t *testing.T, content string) string {
+	file := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+// Unknown activation fails at load time.
+func TestBertConfig_LoadUnknownActivation(t *testing.T) {
+	file := writeConfig(t, `{"hidden_act": "gelu_unknown", "hidden_size": 8}`)
+
+	config := new(bert.BertConfig)
+	if err := config.Load(file, nil); err == nil {
+		t.Errorf("Want error for unknown hidden_act\n")
+	}
+
+	if _, err := bert.ConfigFromFile(file); err == nil {
+		t.Errorf("Want error for unknown hidden_act from ConfigFromFile\n")
+	}
+}
+
+func TestBertConfig_LoadActivations(t *testing.T) {
+	for _, act := range []string{"gelu", "gelu_new", "gelu_fast", "gelu_pytorch_tanh", "quick_gelu", "silu", "relu", "tanh", "swish", "mish"} {
+		file := writeConfig(t, `{"hidden_act": "`+act+`"}`)
+		config := new(bert.BertConfig)
+		if err := config.Load(file, nil); err != nil {
+			t.Errorf("Activation %q - got error: %v\n", act, err)
+		}
+	}
+
+	// Missing hidden_act defaults to gelu.
+	config := new(bert.BertConfig)
+	if err := config.Load(writeConfig(t, `{"hidden_size": 8}`), nil); err != nil {
+		t.Fatal(err)
+	}
+	if config.HiddenAct != "gelu" {
+		t.Errorf("Want default hidden_act: %q\n", "gelu")
+		t.Errorf("Got default hidden_act: %q\n", config.HiddenAct)
+	}
+}
+
+// Custom activation can be registered and used by name.
+func TestBertConfig_LoadCustomActivation(t *testing.T) {
+	file := writeConfig(t, `{"hidden_act": "custom_relu"}`)
+
+	config := new(bert.BertConfig)
+	if err := config.Load(file, nil); err == nil {
+		t.Fatalf("Want error before custom_relu is registered\n")
+	}
+
+	err := util.RegisterActivation("custom_relu", util.NewFuncActivation("custom_relu", func(x *ts.Tensor) *ts.Tensor {
+		return x.MustRelu(false)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config = new(bert.BertConfig)
+	if err := config.Load(file, nil); err != nil {
+		t.Errorf("Want custom_relu registered, got error: %v\n", err)
+	}
+
+	act, err := util.GetActivation("custom_relu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if act.Name() != "custom_relu" {
+		t.Errorf("Want activation name: %q\n", "custom_relu")
+		t.Errorf("Got activation name: %q\n", act.Name())
+	}
+}
+
+func TestBertConfig_LoadPositionEmbeddingType(t *testing.T) {
+	config := new(bert.BertConfig)
+	if err := config.Load(writeConfig(t, `{"position_embedding_type": "relative_key"}`), nil); err != nil {
+		t.Fatal(err)
+	}
+	if config.PositionEmbeddingType != bert.PositionEmbeddingRelativeKey {
+		t.Errorf("Want position_embedding_type: %q\n", bert.PositionEmbeddingRelativeKey)
+		t.Errorf("Got position_embedding_type: %q\n", config.PositionEmbeddingType)
+	}
+
+	config = new(bert.BertConfig)
+	if err := config.Load(writeConfig(t, `{"position_embedding_type": "relative_unknown"}`), nil); err == nil {
+		t.Errorf("Want error for unknown position_embedding_type\n")
+	}
+}
+
+func TestBertConfig_LoadCustomPositionStrategy(t *testing.T) {
+	file := writeConfig(t, `{"position_embedding_type": "no_position"}`)
+
+	config := new(bert.BertConfig)
+	if err := config.Load(file, nil); err == nil {
+		t.Fatalf("Want error before no_position is registered\n")
+	}
+
+	err := bert.RegisterPositionStrategy("no_position", func(p *nn.Path, config *bert.BertConfig) bert.PositionStrategy {
+		return bert.NewAbsolutePosition()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config = new(bert.BertConfig)
+	if err := config.Load(file, nil); err != nil {
+		t.Errorf("Want no_position registered, got error: %v\n", err)
+	}
+	if config.IsAbsolutePosition() || config.HasPositionEmbeddings() {
+		t.Errorf("Want no position embeddings in embeddings for custom strategy\n")
+	}
+}
@@ -21,6 +21,10 @@ type BertEmbeddings struct {
 	TokenTypeEmbeddings *nn.Embedding
 	LayerNorm           *nn.LayerNorm
 	Dropout             *util.Dropout
+
+	// Position embeddings are only added if type is "absolute". Other position strategies
+	// are applied in attention, see `PositionStrategy`.
+	PositionEmbeddingType string
 }
 
 // NewBertEmbeddings builds a new BertEmbeddings
@@ -35,8 +39,12 @@ func NewBertEmbeddings(p *nn.Path, config *BertConfig, changeNameOpt ...bool) *B
 	wEmbedPath := p.Sub("word_embeddings")
 	wordEmbeddings := nn.NewEmbedding(wEmbedPath, config.VocabSize, config.HiddenSize, embeddingConfig)
 
-	posEmbedPath := p.Sub("position_embeddings")
-	positionEmbeddings := nn.NewEmbedding(posEmbedPath, config.MaxPositionEmbeddings, config.HiddenSize, embeddingConfig)
+	// NOTE. position embeddings are nil if positions are only encoded in attention (e.g. rotary).
+	var positionEmbeddings *nn.Embedding
+	if config.HasPositionEmbeddings() {
+		posEmbedPath := p.Sub("position_embeddings")
+		positionEmbeddings = nn.NewEmbedding(posEmbedPath, config.MaxPositionEmbeddings, config.HiddenSize, embeddingConfig)
+	}
 
 	ttEmbedPath := p.Sub("token_type_embeddings")
 	tokenTypeEmbeddings := nn.NewEmbedding(ttEmbedPath, config.TypeVocabSize, config.HiddenSize, embeddingConfig)
@@ -49,11 +57,23 @@ func NewBertEmbeddings(p *nn.Path, config *BertConfig, changeNameOpt ...bool) *B
 	layerNormConfig.Eps = 1e-12
 
 	lnPath := p.Sub("LayerNorm")
-	layerNorm := nn.NewLayerNorm(lnPath, []int64{config.HiddenSize}, layerNormConfig)
+	layerNorm := util.NewLayerNorm(lnPath, []int64{config.HiddenSize}, layerNormConfig)
 
 	dropout := util.NewDropout(config.HiddenDropoutProb)
 
-	return &BertEmbeddings{wordEmbeddings, positionEmbeddings, tokenTypeEmbeddings, layerNorm, dropout}
+	positionEmbeddingType := config.PositionEmbeddingType
+	if config.IsAbsolutePosition() {
+		positionEmbeddingType = PositionEmbeddingAbsolute
+	}
+
+	return &BertEmbeddings{
+		WordEmbeddings:        wordEmbeddings,
+		PositionEmbeddings:    positionEmbeddings,
+		TokenTypeEmbeddings:   tokenTypeEmbeddings,
+		LayerNorm:             layerNorm,
+		Dropout:               dropout,
+		PositionEmbeddingType: positionEmbeddingType,
+	}
 }
 
 // ForwardT implements BertEmbedding interface, passes throught the embedding layer
@@ -83,38 +103,40 @@ func (be *BertEmbeddings) ForwardT(inputIds, tokenTypeIds, positionIds, inputEmb
 		}
 	}
 
+	s := util.NewScope()
+	defer s.Close()
+
 	seqLength := inputEmbeddings.MustSize()[1]
 
-	var posIds *ts.Tensor
-	if positionIds.MustDefined() {
-		posIds = positionIds
-	} else {
-		tmp1 := ts.MustArange(ts.IntScalar(seqLength), gotch.Int64, inputEmbeddings.MustDevice())
-		tmp2 := tmp1.MustUnsqueeze(0, true)
-		posIds = tmp2.MustExpand(inputShape, true, true)
+	// NOTE. only tensors created here are tracked, caller's tensors are left untouched.
+	if inputEmbeddings != inputEmbeds {
+		s.Track(inputEmbeddings)
 	}
 
-	var tokTypeIds *ts.Tensor
-	if tokenTypeIds.MustDefined() {
-		tokTypeIds = tokenTypeIds
+	tokTypeIds := tokenTypeIds
+	if !tokenTypeIds.MustDefined() {
+		tokTypeIds = s.Track(ts.MustZeros(inputShape, gotch.Int64, inputEmbeddings.MustDevice()))
+	}
+	tokEmbeddings := s.Track(tokTypeIds.Apply(be.TokenTypeEmbeddings))
+
+	// Other position strategies are applied in attention.
+	var input *ts.Tensor
+	if be.PositionEmbeddingType == PositionEmbeddingAbsolute {
+		posIds := positionIds
+		if !positionIds.MustDefined() {
+			tmp1 := s.Track(ts.MustArange(ts.IntScalar(seqLength), gotch.Int64, inputEmbeddings.MustDevice()))
+			tmp2 := s.Track(tmp1.MustUnsqueeze(0, false))
+			posIds = s.Track(tmp2.MustExpand(inputShape, true, false))
+		}
+		posEmbeddings := s.Track(posIds.Apply(be.PositionEmbeddings))
+		input = s.Track(inputEmbeddings.MustAdd(posEmbeddings, false))
+		input.MustAdd_(tokEmbeddings)
 	} else {
-		tokTypeIds = ts.MustZeros(inputShape, gotch.Int64, inputEmbeddings.MustDevice())
+		input = s.Track(inputEmbeddings.MustAdd(tokEmbeddings, false))
 	}
 
-	posEmbeddings := posIds.Apply(be.PositionEmbeddings)
-	posIds.MustDrop()
-	tokEmbeddings := tokTypeIds.Apply(be.TokenTypeEmbeddings)
-	tokTypeIds.MustDrop()
-
-	input := inputEmbeddings.MustAdd(posEmbeddings, true)
-	posEmbeddings.MustDrop()
-	input.MustAdd_(tokEmbeddings)
-	tokEmbeddings.MustDrop()
-
-	retTmp1 := input.Apply(be.LayerNorm)
-	input.MustDrop()
-	retVal = retTmp1.ApplyT(be.Dropout, train)
-	retTmp1.MustDrop()
+	retTmp1 := s.Track(util.ApplyLayerNorm(be.LayerNorm, input))
+	retVal = s.Keep(s.Track(retTmp1.ApplyT(be.Dropout, train)))
 
 	return retVal, nil
 }
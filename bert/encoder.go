@@ -5,6 +5,8 @@ import (
 
 	"github.com/sugarme/gotch/nn"
 	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/util"
 )
 
 // `BertLayer`:
@@ -32,10 +34,14 @@ func NewBertLayer(p *nn.Path, config *BertConfig, changeNameOpt ...bool) *BertLa
 		crossAttention *BertAttention
 	)
 
+	// Decoder layer has a separate cross-attention module attending to encoder hidden states.
 	if config.IsDecoder {
 		isDecoder = true
-		attPath := p.Sub("cross_attention")
-		crossAttention = NewBertAttention(attPath, config)
+		// As in HuggingFace, cross-attention does not use relative positions.
+		crossConfig := *config
+		crossConfig.PositionEmbeddingType = PositionEmbeddingAbsolute
+		attPath := p.Sub("crossattention")
+		crossAttention = NewBertAttention(attPath, &crossConfig, changeName)
 	}
 
 	intermediatePath := p.Sub("intermediate")
@@ -47,29 +53,50 @@ func NewBertLayer(p *nn.Path, config *BertConfig, changeNameOpt ...bool) *BertLa
 }
 
 // ForwardT forwards pass through the model.
+//
+// If layer is a decoder layer and `encoderHiddenStates` is defined, output of self-attention
+// is passed through cross-attention with `encoderMask` (extended attention mask of encoder inputs).
 func (bl *BertLayer) ForwardT(hiddenStates, mask, encoderHiddenStates, encoderMask *ts.Tensor, train bool) (retVal, retValOpt1, retValOpt2 *ts.Tensor) {
+	output, attentionWeights, crossAttentionWeights, present := bl.ForwardCachedT(hiddenStates, mask, encoderHiddenStates, encoderMask, nil, train)
+	present.Drop()
+
+	return output, attentionWeights, crossAttentionWeights
+}
+
+// ForwardCachedT forwards pass with cached keys and values of previous steps.
+// It returns layer output, attention weights, cross-attention weights and updated cache.
+// NOTE. `past` is consumed, see `BertSelfAttention.ForwardCachedT`.
+func (bl *BertLayer) ForwardCachedT(hiddenStates, mask, encoderHiddenStates, encoderMask *ts.Tensor, past *LayerCache, train bool) (retVal, retValOpt1, retValOpt2 *ts.Tensor, present *LayerCache) {
 	var (
 		attentionOutput       *ts.Tensor
 		attentionWeights      *ts.Tensor
 		crossAttentionWeights *ts.Tensor
+		pastSelf, pastCross   *AttentionCache
 	)
+	if past != nil {
+		pastSelf, pastCross = past.Self, past.Cross
+	}
+	present = new(LayerCache)
+
+	s := util.NewScope()
+	defer s.Close()
 
 	if bl.IsDecoder && encoderHiddenStates.MustDefined() {
 		var attentionOutputTmp *ts.Tensor
-		attentionOutputTmp, attentionWeights = bl.Attention.ForwardT(hiddenStates, mask, ts.None, ts.None, train)
-		attentionOutput, crossAttentionWeights = bl.CrossAttention.ForwardT(attentionOutputTmp, mask, encoderHiddenStates, encoderMask, train)
-		attentionOutputTmp.MustDrop()
+		attentionOutputTmp, attentionWeights, present.Self = bl.Attention.ForwardCachedT(hiddenStates, mask, ts.None, ts.None, pastSelf, train)
+		s.Track(attentionOutputTmp)
+		attentionOutput, crossAttentionWeights, present.Cross = bl.CrossAttention.ForwardCachedT(attentionOutputTmp, ts.None, encoderHiddenStates, encoderMask, pastCross, train)
 	} else {
-		attentionOutput, attentionWeights = bl.Attention.ForwardT(hiddenStates, mask, ts.None, ts.None, train)
+		attentionOutput, attentionWeights, present.Self = bl.Attention.ForwardCachedT(hiddenStates, mask, ts.None, ts.None, pastSelf, train)
 		crossAttentionWeights = ts.None
+		pastCross.Drop()
 	}
+	s.Track(attentionOutput)
 
-	outputTmp := bl.Intermediate.Forward(attentionOutput)
-	output := bl.Output.ForwardT(outputTmp, attentionOutput, train)
-	attentionOutput.MustDrop()
-	outputTmp.MustDrop()
+	outputTmp := s.Track(bl.Intermediate.ForwardT(attentionOutput, train))
+	output := s.Track(bl.Output.ForwardT(outputTmp, attentionOutput, train))
 
-	return output, attentionWeights, crossAttentionWeights
+	return s.Keep(output), attentionWeights, crossAttentionWeights, present
 }
 
 // `BertEncoder`:
@@ -77,9 +104,12 @@ func (bl *BertLayer) ForwardT(hiddenStates, mask, encoderHiddenStates, encoderMa
 
 // BertEncoder defines an encoder for BERT model
 type BertEncoder struct {
-	OutputAttentions   bool
-	OutputHiddenStates bool
-	Layers             []BertLayer
+	OutputAttentions      bool
+	OutputHiddenStates    bool
+	Layers                []BertLayer
+	GradientCheckpointing bool // recompute layer activations in backward pass, see `BackwardCheckpoints`
+
+	checkpoint *encoderCheckpoint
 }
 
 // NewBertEncoder creates a new BertEncoder.
@@ -104,43 +134,77 @@ func NewBertEncoder(p *nn.Path, config *BertConfig, changeNameOpt ...bool) *Bert
 		layers = append(layers, *NewBertLayer(path.Sub(fmt.Sprintf("%v", lIdx)), config, changeName))
 	}
 
-	return &BertEncoder{outputAttentions, outputHiddenStates, layers}
+	return &BertEncoder{
+		OutputAttentions:      outputAttentions,
+		OutputHiddenStates:    outputHiddenStates,
+		Layers:                layers,
+		GradientCheckpointing: config.GradientCheckpointing,
+	}
 
 }
 
 // ForwardT forwards pass through the model.
-func (be *BertEncoder) ForwardT(hiddenStates, mask, encoderHiddenStates, encoderMask *ts.Tensor, train bool) (retVal *ts.Tensor, retValOpt1, retValOpt2 []ts.Tensor) {
+//
+// It returns output of the last layer, input of each layer if `OutputHiddenStates`
+// and attention weights of each layer if `OutputAttentions`. All returned tensors are
+// distinct. NOTE. `hiddenStates` is consumed.
+func (be *BertEncoder) ForwardT(hiddenStates, mask, encoderHiddenStates, encoderMask *ts.Tensor, train bool) (retVal *ts.Tensor, retValOpt1, retValOpt2 []*ts.Tensor) {
+	hiddenState, allHiddenStates, allAttentions, present := be.ForwardCachedT(hiddenStates, mask, encoderHiddenStates, encoderMask, nil, train)
+	present.Drop()
+
+	return hiddenState, allHiddenStates, allAttentions
+}
+
+// ForwardCachedT forwards pass with cached keys and values of all layers from previous steps.
+// It returns updated cache as the last value.
+// NOTE. `past` is consumed, see `BertSelfAttention.ForwardCachedT`.
+//
+// If `GradientCheckpointing` is on and gradients are tracked in training, layer activations
+// are not kept and `BackwardCheckpoints` must be called after backward pass of the loss.
+// No cache is returned in this case (past keys and values are not used).
+func (be *BertEncoder) ForwardCachedT(hiddenStates, mask, encoderHiddenStates, encoderMask *ts.Tensor, past *Cache, train bool) (retVal *ts.Tensor, retValOpt1, retValOpt2 []*ts.Tensor, present *Cache) {
+	if be.GradientCheckpointing && train && gradEnabled() {
+		past.Drop()
+		hiddenState, allHiddenStates, allAttentions := be.forwardCheckpointed(hiddenStates, mask, encoderHiddenStates, encoderMask, train)
+
+		return hiddenState, allHiddenStates, allAttentions, &Cache{Layers: make([]LayerCache, len(be.Layers))}
+	}
+
 	var (
-		allHiddenStates, allAttentions []ts.Tensor = nil, nil
+		allHiddenStates, allAttentions []*ts.Tensor = nil, nil
 	)
 
 	hiddenState := hiddenStates
 
 	if be.OutputHiddenStates {
-		allHiddenStates = make([]ts.Tensor, 0) // initialize it
+		allHiddenStates = make([]*ts.Tensor, 0) // initialize it
 	}
 	if be.OutputAttentions {
-		allAttentions = make([]ts.Tensor, 0)
+		allAttentions = make([]*ts.Tensor, 0)
 	}
 
-	for _, layer := range be.Layers {
+	present = &Cache{Layers: make([]LayerCache, len(be.Layers))}
+	for i, layer := range be.Layers {
+		stateTmp, attnWeightsTmp, crossAttnWeightsTmp, layerPresent := layer.ForwardCachedT(hiddenState, mask, encoderHiddenStates, encoderMask, past.Layer(i), train)
+		present.Layers[i] = *layerPresent
+
+		// Layer input is kept (and owned) by hidden states output if requested.
 		if allHiddenStates != nil {
-			allHiddenStates = append(allHiddenStates, *hiddenState)
+			allHiddenStates = append(allHiddenStates, hiddenState)
+		} else {
+			hiddenState.MustDrop()
 		}
-
-		stateTmp, attnWeightsTmp, _ := layer.ForwardT(hiddenState, mask, encoderHiddenStates, encoderMask, train)
-		hiddenState.MustDrop()
 		hiddenState = stateTmp
 
 		if allAttentions != nil {
-			allAttentions = append(allAttentions, *attnWeightsTmp)
+			allAttentions = append(allAttentions, attnWeightsTmp)
+		}
+		if crossAttnWeightsTmp.MustDefined() {
+			crossAttnWeightsTmp.MustDrop()
 		}
-
-		// TODO: should we need to delete `stateTmp` and `attnWeightsTmp` after all?
-
 	}
 
-	return hiddenState, allHiddenStates, allAttentions
+	return hiddenState, allHiddenStates, allAttentions, present
 }
 
 // `BertPooler`:
@@ -164,8 +228,11 @@ func NewBertPooler(p *nn.Path, config *BertConfig) *BertPooler {
 // Forward forwards pass through the model.
 func (bp *BertPooler) Forward(hiddenStates *ts.Tensor) (retVal *ts.Tensor) {
 
-	selectTs := hiddenStates.MustSelect(1, 0, false)
-	tmp := selectTs.Apply(bp.Lin)
-	retVal = tmp.MustTanh(true)
-	return retVal
+	s := util.NewScope()
+	defer s.Close()
+
+	selectTs := s.Track(hiddenStates.MustSelect(1, 0, false))
+	tmp := s.Track(selectTs.Apply(bp.Lin))
+
+	return s.Keep(s.Track(tmp.MustTanh(false)))
 }
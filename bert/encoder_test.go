@@ -0,0 +1,135 @@
+package bert_test
+
+import (
+	"testing"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/nn"
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/bert"
+)
+
+func newTinyDecoder(t *testing.T) (*nn.VarStore, *bert.BertModel) {
+	config := bert.NewConfig(map[string]interface{}{
+		"VocabSize":         int64(20),
+		"HiddenSize":        int64(8),
+		"NumHiddenLayers":   int64(2),
+		"NumAttentionHeads": int64(2),
+		"IntermediateSize":  int64(16),
+	})
+	config.IsDecoder = true
+
+	vs := nn.NewVarStore(gotch.CPU)
+	model := bert.NewBertModel(vs.Root(), config, false)
+
+	return vs, model
+}
+
+func TestBertLayer_CrossAttentionWeights(t *testing.T) {
+	vs, _ := newTinyDecoder(t)
+
+	vars := vs.Variables()
+	for _, name := range []string{
+		"encoder.layer.0.crossattention.self.query.weight",
+		"encoder.layer.0.crossattention.self.key.weight",
+		"encoder.layer.0.crossattention.self.value.weight",
+		"encoder.layer.0.crossattention.output.dense.weight",
+		"encoder.layer.0.crossattention.output.LayerNorm.weight",
+	} {
+		if _, ok := vars[name]; !ok {
+			t.Errorf("Missing cross-attention variable: %q\n", name)
+		}
+	}
+}
+
+func TestBertModel_Decoder(t *testing.T) {
+	_, model := newTinyDecoder(t)
+
+	forward := func(ids []int64, encoderStates, encoderMask *ts.Tensor) *ts.Tensor {
+		inputIds := ts.MustOfSlice(ids).MustView([]int64{1, int64(len(ids))}, true)
+		var output *bert.ModelOutput
+		ts.NoGrad(func() {
+			var err error
+			output, err = model.ForwardT(inputIds, ts.None, ts.None, ts.None, ts.None, encoderStates, encoderMask, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+		hiddenState := output.LastHiddenState.MustShallowClone()
+		output.Drop()
+		return hiddenState
+	}
+
+	encoderStates := ts.MustRandn([]int64{1, 3, 8}, gotch.Float, gotch.CPU)
+
+	// Causal mask: changing the last token must not change outputs of previous positions.
+	out1 := forward([]int64{1, 2, 3, 4}, encoderStates, ts.None)
+	out2 := forward([]int64{1, 2, 3, 9}, encoderStates, ts.None)
+	if !out1.MustNarrow(1, 0, 3, false).MustAllclose(out2.MustNarrow(1, 0, 3, false), 1e-5, 1e-6, false, true) {
+		t.Errorf("Want outputs at positions 0..2 unchanged by future token\n")
+	}
+	if out1.MustNarrow(1, 3, 1, false).MustAllclose(out2.MustNarrow(1, 3, 1, false), 1e-5, 1e-6, false, true) {
+		t.Errorf("Want output at position 3 changed by its own token\n")
+	}
+
+	// Cross-attention: decoder output depends on encoder hidden states...
+	otherStates := ts.MustRandn([]int64{1, 3, 8}, gotch.Float, gotch.CPU)
+	out3 := forward([]int64{1, 2, 3, 4}, otherStates, ts.None)
+	if out1.MustAllclose(out3, 1e-5, 1e-6, false, false) {
+		t.Errorf("Want outputs changed by encoder hidden states\n")
+	}
+
+	// ... but not on masked encoder positions.
+	encoderMask := ts.MustOfSlice([]int64{1, 1, 0}).MustView([]int64{1, 3}, true)
+	noise := ts.MustZeros([]int64{1, 3, 8}, gotch.Float, gotch.CPU)
+	noise.MustNarrow(1, 2, 1, false).MustFill_(ts.FloatScalar(5.0))
+	noisyStates := encoderStates.MustAdd(noise, false)
+	out4 := forward([]int64{1, 2, 3, 4}, encoderStates, encoderMask)
+	out5 := forward([]int64{1, 2, 3, 4}, noisyStates, encoderMask)
+	if !out4.MustAllclose(out5, 1e-5, 1e-6, false, false) {
+		t.Errorf("Want outputs unchanged by masked encoder positions\n")
+	}
+}
+
+func TestBertModel_DecoderCache(t *testing.T) {
+	_, model := newTinyDecoder(t)
+
+	encoderStates := ts.MustRandn([]int64{2, 3, 8}, gotch.Float, gotch.CPU)
+	ids := []int64{1, 2, 3, 4, 5, 6, 7, 8}
+	inputIds := ts.MustOfSlice(ids).MustView([]int64{2, 4}, true)
+
+	ts.NoGrad(func() {
+		fullOutput, err := model.ForwardT(inputIds, ts.None, ts.None, ts.None, ts.None, encoderStates, ts.None, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		full := fullOutput.LastHiddenState
+
+		// Decode prefix of 2 tokens then one token at a time.
+		var cache *bert.Cache
+		steps := [][]int64{{0, 2}, {2, 1}, {3, 1}}
+		for _, step := range steps {
+			stepIds := inputIds.MustNarrow(1, step[0], step[1], false)
+			var output *bert.ModelOutput
+			output, cache, err = model.ForwardCachedT(stepIds, ts.None, ts.None, ts.None, ts.None, encoderStates, ts.None, cache, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			want := full.MustNarrow(1, step[0], step[1], false)
+			if !want.MustAllclose(output.LastHiddenState, 1e-5, 1e-5, false, true) {
+				t.Errorf("Step %v - want cached output equal to full forward output\n", step)
+			}
+			output.Drop()
+			stepIds.MustDrop()
+		}
+
+		if cache.SeqLen() != 4 {
+			t.Errorf("Want cache length: 4\n")
+			t.Errorf("Got cache length: %v\n", cache.SeqLen())
+		}
+		cache.Drop()
+		fullOutput.Drop()
+	})
+}
@@ -65,25 +65,29 @@ func ExampleBertForMaskedLM() {
 		}
 	}
 
-	var tensors []ts.Tensor
+	var tensors []*ts.Tensor
 	for _, en := range encodings {
 		var tokInput []int64 = make([]int64, maxLen)
 		for i := 0; i < len(en.Ids); i++ {
 			tokInput[i] = int64(en.Ids[i])
 		}
 
-		tensors = append(tensors, *ts.TensorFrom(tokInput))
+		tensors = append(tensors, ts.TensorFrom(tokInput))
 	}
 
 	inputTensor := ts.MustStack(tensors, 0).MustTo(device, true)
 
-	var output *ts.Tensor
+	var output *bert.ModelOutput
 	ts.NoGrad(func() {
-		output, _, _ = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, ts.None, ts.None, false)
+		output, err = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, ts.None, ts.None, ts.None, false)
 	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer output.Drop()
 
-	index1 := output.MustGet(0).MustGet(4).MustArgmax([]int64{0}, false, false).Int64Values()[0]
-	index2 := output.MustGet(1).MustGet(7).MustArgmax([]int64{0}, false, false).Int64Values()[0]
+	index1 := output.Logits.MustGet(0).MustGet(4).MustArgmax([]int64{0}, false, false).Int64Values()[0]
+	index2 := output.Logits.MustGet(1).MustGet(7).MustArgmax([]int64{0}, false, false).Int64Values()[0]
 
 	got1, ok := tk.IdToToken(int(index1))
 	if !ok {
@@ -141,7 +145,7 @@ func ExampleBertForMaskedLM() {
  *     }
  *   }
  *
- *   var tensors []ts.Tensor
+ *   var tensors []*ts.Tensor
  *   for _, en := range encodings {
  *     var tokInput []int64 = make([]int64, maxLen)
  *     for i := 0; i < len(en.Ids); i++ {
@@ -159,12 +163,12 @@ func ExampleBertForMaskedLM() {
  *   )
  *
  *   ts.NoGrad(func() {
- *     output, allHiddenStates, allAttentions = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, false)
+ *     output, allHiddenStates, allAttentions = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, ts.None, false)
  *   })
  *
- *   fmt.Println(output.MustSize())
- *   fmt.Println(len(allHiddenStates))
- *   fmt.Println(len(allAttentions))
+ *   fmt.Println(output.Logits.MustSize())
+ *   fmt.Println(len(output.HiddenStates))
+ *   fmt.Println(len(output.Attentions))
  *
  *   // Output:
  *   // [2 3]
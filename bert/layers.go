@@ -0,0 +1,50 @@
+package bert
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sugarme/gotch/nn"
+
+	"github.com/yinziyang/transformer/util"
+)
+
+// pathName returns full variable path of model, e.g. "bert" or "roberta".
+func (b *BertModel) pathName() string {
+	return strings.Join(b.path.Paths(), ".")
+}
+
+// LayerPaths returns variable paths of layers of `model` from bottom to top: embeddings, then
+// encoder layers, e.g. "bert.embeddings", "bert.encoder.layer.0", ..., "bert.encoder.layer.11".
+// Pooler and task head layers are not included.
+//
+// Paths select variables with `util.Freeze` and `util.LayerwiseParamGroups`:
+//
+//	// layer-wise learning rate decay
+//	groups := util.LayerwiseParamGroups(vs, 0.01, 0.9, bert.LayerPaths(model))
+func LayerPaths(model HasBaseModel) []string {
+	b := model.BaseModel()
+	prefix := b.pathName()
+	if prefix != "" {
+		prefix += "."
+	}
+
+	paths := []string{prefix + "embeddings"}
+	for i := range b.Encoder.Layers {
+		paths = append(paths, fmt.Sprintf("%vencoder.layer.%v", prefix, i))
+	}
+
+	return paths
+}
+
+// FreezeLayers freezes embeddings and the `numLayers` lower encoder layers of `model`. It returns
+// sorted names of frozen variables.
+func FreezeLayers(vs *nn.VarStore, model HasBaseModel, numLayers int) ([]string, error) {
+	paths := LayerPaths(model)
+	if numLayers < 0 || numLayers > len(paths)-1 {
+		err := fmt.Errorf("FreezeLayers() failed: numLayers must be in [0, %v], got %v.", len(paths)-1, numLayers)
+		return nil, err
+	}
+
+	return util.Freeze(vs, paths[:numLayers+1]...), nil
+}
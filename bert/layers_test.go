@@ -0,0 +1,53 @@
+package bert_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yinziyang/transformer/bert"
+	"github.com/yinziyang/transformer/util"
+)
+
+func TestLayerPaths(t *testing.T) {
+	_, model := newLoRATestModel()
+
+	want := []string{"bert.embeddings", "bert.encoder.layer.0", "bert.encoder.layer.1"}
+	got := bert.LayerPaths(model)
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Want %v\n", want)
+		t.Errorf("Got %v\n", got)
+	}
+}
+
+func TestFreezeLayers(t *testing.T) {
+	vs, model := newLoRATestModel()
+
+	frozen, err := bert.FreezeLayers(vs, model, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frozen) == 0 {
+		t.Fatalf("Want frozen variables, got none\n")
+	}
+
+	for name, x := range vs.Variables() {
+		want := !strings.HasPrefix(name, "bert.embeddings.") && !strings.HasPrefix(name, "bert.encoder.layer.0.")
+		if got := x.MustRequiresGrad(); got != want {
+			t.Errorf("Want %q requires grad %v, got %v\n", name, want, got)
+		}
+	}
+
+	groups := util.ParamGroups(vs, 0.01)
+	for _, group := range groups {
+		for _, name := range group.Names {
+			if strings.HasPrefix(name, "bert.encoder.layer.0.") {
+				t.Errorf("Want frozen %q not to be trained\n", name)
+			}
+		}
+	}
+
+	if _, err := bert.FreezeLayers(vs, model, 3); err == nil {
+		t.Errorf("Want error for too many layers\n")
+	}
+}
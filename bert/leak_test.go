@@ -0,0 +1,57 @@
+package bert_test
+
+import (
+	"testing"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/nn"
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/bert"
+	"github.com/yinziyang/transformer/util"
+)
+
+func TestBertForMaskedLM_NoLeak(t *testing.T) {
+	config := bert.NewConfig(map[string]interface{}{
+		"VocabSize":         int64(20),
+		"HiddenSize":        int64(8),
+		"NumHiddenLayers":   int64(2),
+		"NumAttentionHeads": int64(2),
+		"IntermediateSize":  int64(16),
+	})
+	config.OutputHiddenStates = true
+	config.OutputAttentions = true
+
+	vs := nn.NewVarStore(gotch.CPU)
+	model, err := bert.NewBertForMaskedLM(vs.Root(), config, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inputIds := ts.MustOfSlice([]int64{1, 2, 3, 4, 5, 6, 7, 0}).MustView([]int64{2, 4}, true)
+	mask := ts.MustOfSlice([]int64{1, 1, 1, 1, 1, 1, 1, 0}).MustView([]int64{2, 4}, true)
+
+	forward := func(train bool) {
+		ts.NoGrad(func() {
+			output, err := model.ForwardT(inputIds, mask, ts.None, ts.None, ts.None, ts.None, ts.None, ts.None, train)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output.Drop()
+		})
+	}
+
+	// Warm up so that lazily created tensors are not counted.
+	forward(false)
+	want := util.NumLiveTensors()
+
+	for i := 0; i < 50; i++ {
+		forward(i%2 == 0)
+	}
+
+	got := util.NumLiveTensors()
+	if got > want {
+		t.Errorf("Want live tensors to stay at: %v\n", want)
+		t.Errorf("Got live tensors: %v\n", got)
+	}
+}
@@ -0,0 +1,239 @@
+package bert
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sugarme/gotch/nn"
+
+	"github.com/yinziyang/transformer/util"
+)
+
+// LoRA adapters:
+// ==============
+//
+// Instead of fine-tuning all weights, LoRA adapters (see `util.LoRA`) are added to linear layers
+// of encoder layers and only adapters (and task head layers) are trained. Adapted layers are
+// selected by name, relative to an encoder layer:
+//   - "attention.self.query", "attention.self.key", "attention.self.value": self-attention projections.
+//   - "intermediate.dense": `BertIntermediate` linear.
+//   - "output.dense": `BertOutput` linear.
+//
+// A target module matches a layer if it is equal to the end of its full variable path (as PEFT
+// `target_modules`), e.g. "query" matches "bert.encoder.layer.0.attention.self.query" and
+// "layer.0.attention.self.query" only matches the first layer.
+//
+// Fine-tuning:
+//
+//	model := bert.NewBertForSequenceClassification(vs.Root(), config)
+//	err := pickle.LoadAll(vs, modelFile)
+//	adapted, err := bert.AddLoRA(vs, model, bert.DefaultLoRAConfig())
+//	// train (e.g. with `transformer.Trainer`), then save adapters only:
+//	err = util.SaveLoRA(vs, "adapter.gt")
+//
+// Deployment: adapters are loaded with `util.LoadLoRA` after `AddLoRA` with the same config, then
+// `MergeLoRA` merges them into base weights so that inference runs without adapter overhead.
+
+// LoRAConfig holds options of LoRA adapters.
+type LoRAConfig struct {
+	Rank          int64    // rank of adapter update.
+	Alpha         float64  // scaling of adapter update is alpha / rank.
+	Dropout       float64  // dropout probability of adapter inputs.
+	TargetModules []string // names of adapted linear layers.
+}
+
+// DefaultLoRAConfig returns PEFT default options for BERT: rank 8, alpha 8, no dropout, adapters
+// of query and value projections.
+func DefaultLoRAConfig() *LoRAConfig {
+	return &LoRAConfig{
+		Rank:          8,
+		Alpha:         8,
+		Dropout:       0,
+		TargetModules: []string{"query", "value"},
+	}
+}
+
+// HasBaseModel is implemented by task heads of a `BertModel`.
+type HasBaseModel interface {
+	// BaseModel returns the underlying BERT model.
+	BaseModel() *BertModel
+}
+
+// loraTarget is a linear layer which can be adapted.
+type loraTarget struct {
+	name string      // full variable path
+	path *nn.Path    // variable path
+	lin  *nn.Linear  // adapted layer
+	lora **util.LoRA // adapter field of module
+}
+
+// loraTargets returns linear layers of encoder layers which can be adapted.
+func (b *BertModel) loraTargets() []loraTarget {
+	var targets []loraTarget
+	for i := range b.Encoder.Layers {
+		layer := &b.Encoder.Layers[i]
+		bsa := layer.Attention.Bsa
+		for _, t := range []struct {
+			name string
+			lin  *nn.Linear
+			lora **util.LoRA
+		}{
+			{"attention.self.query", bsa.Query, &bsa.QueryLoRA},
+			{"attention.self.key", bsa.Key, &bsa.KeyLoRA},
+			{"attention.self.value", bsa.Value, &bsa.ValueLoRA},
+			{"intermediate.dense", layer.Intermediate.Lin, &layer.Intermediate.LoRA},
+			{"output.dense", layer.Output.Lin, &layer.Output.LoRA},
+		} {
+			path := b.path.Sub("encoder").Sub("layer").Sub(fmt.Sprint(i))
+			for _, name := range strings.Split(t.name, ".") {
+				path = path.Sub(name)
+			}
+			targets = append(targets, loraTarget{
+				name: strings.Join(path.Paths(), "."),
+				path: path,
+				lin:  t.lin,
+				lora: t.lora,
+			})
+		}
+	}
+
+	return targets
+}
+
+// matchTarget returns whether full name of a layer matches one of target modules.
+func matchTarget(name string, targetModules []string) bool {
+	for _, t := range targetModules {
+		if name == t || strings.HasSuffix(name, "."+t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AddLoRA adds LoRA adapters to linear layers of `model` matching `config.TargetModules` and
+// freezes variables of the base model (embeddings, encoder and pooler). Task head layers (e.g.
+// classifier) remain trainable.
+//
+// Params:
+//   - vs: VarStore of model. Adapter variables are added to it.
+//   - model: `BertModel` or a task head of `bert` or `roberta` package.
+//   - config: adapter options.
+//
+// Returns full names of adapted layers.
+func AddLoRA(vs *nn.VarStore, model HasBaseModel, config *LoRAConfig) ([]string, error) {
+	if config.Rank <= 0 {
+		err := fmt.Errorf("AddLoRA() failed: rank must be positive, got %v.", config.Rank)
+		return nil, err
+	}
+	if config.Dropout < 0 || config.Dropout >= 1 {
+		err := fmt.Errorf("AddLoRA() failed: dropout must be in [0, 1), got %v.", config.Dropout)
+		return nil, err
+	}
+
+	b := model.BaseModel()
+	var adapted []string
+	for _, t := range b.loraTargets() {
+		if !matchTarget(t.name, config.TargetModules) {
+			continue
+		}
+		if *t.lora != nil {
+			err := fmt.Errorf("AddLoRA() failed: %q already has an adapter.", t.name)
+			return nil, err
+		}
+
+		size := t.lin.Ws.MustSize()
+		lora, err := util.NewLoRA(t.path, size[1], size[0], config.Rank, config.Alpha, config.Dropout)
+		if err != nil {
+			err = fmt.Errorf("AddLoRA() failed: %w", err)
+			return nil, err
+		}
+		*t.lora = lora
+		adapted = append(adapted, t.name)
+	}
+	if len(adapted) == 0 {
+		err := fmt.Errorf("AddLoRA() failed: no layer matches target modules %q.", config.TargetModules)
+		return nil, err
+	}
+
+	vars := vs.Variables()
+	for _, name := range util.SelectVariables(vs, b.pathName()) {
+		x := vars[name]
+		x.MustRequiresGrad_(util.IsLoRAVariable(name))
+	}
+
+	return adapted, nil
+}
+
+// MergeLoRA merges adapters of `model` into base weights, then removes adapters and their
+// variables. The model then runs without adapter overhead and its VarStore can be saved as a
+// regular checkpoint.
+//
+// NOTE. Base weights stay frozen.
+func MergeLoRA(model HasBaseModel) error {
+	b := model.BaseModel()
+	var merged bool
+	for _, t := range b.loraTargets() {
+		lora := *t.lora
+		if lora == nil {
+			continue
+		}
+
+		lora.Merge(t.lin)
+		for _, name := range []string{t.name + ".lora_A.weight", t.name + ".lora_B.weight"} {
+			if err := t.path.Remove(name); err != nil {
+				err = fmt.Errorf("MergeLoRA() failed: %w", err)
+				return err
+			}
+		}
+		lora.Drop()
+		*t.lora = nil
+		merged = true
+	}
+	if !merged {
+		err := fmt.Errorf("MergeLoRA() failed: model has no adapter.")
+		return err
+	}
+
+	return nil
+}
+
+// BaseModel returns the model itself.
+func (b *BertModel) BaseModel() *BertModel {
+	return b
+}
+
+// BaseModel returns the underlying BERT model.
+func (mlm *BertForMaskedLM) BaseModel() *BertModel {
+	return mlm.bert
+}
+
+// BaseModel returns the underlying BERT model.
+func (nsp *BertForNextSentencePrediction) BaseModel() *BertModel {
+	return nsp.bert
+}
+
+// BaseModel returns the underlying BERT model.
+func (pt *BertForPreTraining) BaseModel() *BertModel {
+	return pt.bert
+}
+
+// BaseModel returns the underlying BERT model.
+func (bsc *BertForSequenceClassification) BaseModel() *BertModel {
+	return bsc.bert
+}
+
+// BaseModel returns the underlying BERT model.
+func (mc *BertForMultipleChoice) BaseModel() *BertModel {
+	return mc.bert
+}
+
+// BaseModel returns the underlying BERT model.
+func (tc *BertForTokenClassification) BaseModel() *BertModel {
+	return tc.bert
+}
+
+// BaseModel returns the underlying BERT model.
+func (qa *BertForQuestionAnswering) BaseModel() *BertModel {
+	return qa.bert
+}
@@ -0,0 +1,153 @@
+package bert_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/nn"
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/bert"
+	"github.com/yinziyang/transformer/util"
+)
+
+func newLoRATestModel() (*nn.VarStore, *bert.BertForSequenceClassification) {
+	config := bert.NewConfig(map[string]interface{}{
+		"VocabSize":         int64(20),
+		"HiddenSize":        int64(8),
+		"NumHiddenLayers":   int64(2),
+		"NumAttentionHeads": int64(2),
+		"IntermediateSize":  int64(16),
+	})
+	config.Id2Label = map[int64]string{0: "negative", 1: "positive"}
+
+	vs := nn.NewVarStore(gotch.CPU)
+	model := bert.NewBertForSequenceClassification(vs.Root(), config)
+
+	return vs, model
+}
+
+func classify(t *testing.T, model *bert.BertForSequenceClassification, inputIds *ts.Tensor) []float64 {
+	var (
+		output *bert.ModelOutput
+		err    error
+	)
+	ts.NoGrad(func() {
+		output, err = model.ForwardT(inputIds, ts.None, ts.None, ts.None, ts.None, ts.None, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Drop()
+
+	return output.Logits.Float64Values()
+}
+
+func TestAddLoRA(t *testing.T) {
+	vs, model := newLoRATestModel()
+	inputIds := ts.MustOfSlice([]int64{1, 5, 6, 2}).MustView([]int64{1, 4}, true)
+	defer inputIds.MustDrop()
+	want := classify(t, model, inputIds)
+
+	config := bert.DefaultLoRAConfig()
+	config.TargetModules = []string{"query", "value", "layer.1.output.dense"}
+	adapted, err := bert.AddLoRA(vs, model, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantAdapted := []string{
+		"bert.encoder.layer.0.attention.self.query",
+		"bert.encoder.layer.0.attention.self.value",
+		"bert.encoder.layer.1.attention.self.query",
+		"bert.encoder.layer.1.attention.self.value",
+		"bert.encoder.layer.1.output.dense",
+	}
+	if !reflect.DeepEqual(wantAdapted, adapted) {
+		t.Errorf("Want adapted layers: %v\n", wantAdapted)
+		t.Errorf("Got adapted layers: %v\n", adapted)
+	}
+
+	// Only adapters and classifier are trainable.
+	var trainable []string
+	for name, x := range vs.Variables() {
+		if x.MustRequiresGrad() {
+			trainable = append(trainable, name)
+		}
+	}
+	if len(trainable) != 2*len(wantAdapted)+2 {
+		t.Errorf("Want %v trainable variables, got %v: %v\n", 2*len(wantAdapted)+2, len(trainable), trainable)
+	}
+	for _, name := range trainable {
+		if !util.IsLoRAVariable(name) && !strings.HasPrefix(name, "classifier.") {
+			t.Errorf("Want base variable %q frozen\n", name)
+		}
+	}
+
+	// Adapters start as identity.
+	if got := classify(t, model, inputIds); !closeValues(want, got, 1e-6) {
+		t.Errorf("Want logits of base model: %v\n", want)
+		t.Errorf("Got logits: %v\n", got)
+	}
+
+	if _, err := bert.AddLoRA(vs, model, config); err == nil {
+		t.Errorf("Want error for layers already adapted\n")
+	}
+	config.TargetModules = []string{"unknown"}
+	if _, err := bert.AddLoRA(vs, model, config); err == nil {
+		t.Errorf("Want error for target modules matching no layer\n")
+	}
+}
+
+func TestMergeLoRA(t *testing.T) {
+	vs, model := newLoRATestModel()
+	if _, err := bert.AddLoRA(vs, model, bert.DefaultLoRAConfig()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate trained adapters.
+	ts.NoGrad(func() {
+		for name, x := range vs.Variables() {
+			if strings.Contains(name, "lora_B") {
+				noise := ts.MustRandn(x.MustSize(), gotch.Float, gotch.CPU)
+				x.Copy_(noise)
+				noise.MustDrop()
+			}
+		}
+	})
+
+	inputIds := ts.MustOfSlice([]int64{1, 5, 6, 2}).MustView([]int64{1, 4}, true)
+	defer inputIds.MustDrop()
+	want := classify(t, model, inputIds)
+
+	if err := bert.MergeLoRA(model); err != nil {
+		t.Fatal(err)
+	}
+	if got := classify(t, model, inputIds); !closeValues(want, got, 1e-4) {
+		t.Errorf("Want logits of adapted model: %v\n", want)
+		t.Errorf("Got logits of merged model: %v\n", got)
+	}
+	for name := range vs.Variables() {
+		if util.IsLoRAVariable(name) {
+			t.Errorf("Want adapter variable %q removed\n", name)
+		}
+	}
+
+	if err := bert.MergeLoRA(model); err == nil {
+		t.Errorf("Want error for model without adapter\n")
+	}
+}
+
+func closeValues(want, got []float64, tolerance float64) bool {
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if got[i]-want[i] > tolerance || want[i]-got[i] > tolerance {
+			return false
+		}
+	}
+
+	return true
+}
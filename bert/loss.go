@@ -0,0 +1,134 @@
+package bert
+
+import (
+	"fmt"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/util"
+)
+
+// Task losses:
+// ============
+//
+// Task heads compute their loss when labels are given, as HuggingFace models do:
+//   - token classification and masked language modeling: cross-entropy, labels -100 are ignored.
+//   - sequence classification: mean squared error with a single label (regression), cross-entropy
+//     with class ids (single label) or binary cross-entropy with float multi-hot labels (multi label).
+//     It can be forced with `BertConfig.ProblemType`.
+//   - multiple choice: cross-entropy over choices.
+//   - question answering: mean of start and end position cross-entropy. Positions out of sequence
+//     are ignored.
+//
+// Losses of float16 and bfloat16 models are computed in float32.
+
+// IgnoreIndex is the label value ignored by cross-entropy losses.
+const IgnoreIndex int64 = -100
+
+// Problem types of sequence classification (`BertConfig.ProblemType`).
+const (
+	ProblemTypeRegression  = "regression"
+	ProblemTypeSingleLabel = "single_label_classification"
+	ProblemTypeMultiLabel  = "multi_label_classification"
+)
+
+// CrossEntropyLoss returns mean cross-entropy of `logits` of shape (..., num classes) and class ids
+// `labels` of shape (...). Labels equal to `ignoreIndex` do not contribute to the loss.
+func CrossEntropyLoss(logits, labels *ts.Tensor, ignoreIndex int64) *ts.Tensor {
+	s := util.NewScope()
+	defer s.Close()
+
+	size := logits.MustSize()
+	logitsView := s.Track(logits.MustView([]int64{-1, size[len(size)-1]}, false))
+	if util.IsReducedPrecision(logitsView.DType()) {
+		logitsView = s.Track(logitsView.MustTotype(gotch.Float, false))
+	}
+	labelsView := s.Track(labels.MustView([]int64{-1}, false))
+	if labelsView.DType() != gotch.Int64 {
+		labelsView = s.Track(labelsView.MustTotype(gotch.Int64, false))
+	}
+
+	return logitsView.MustCrossEntropyLoss(labelsView, ts.None, 1, ignoreIndex, 0.0, false)
+}
+
+// MSELoss returns mean squared error of `preds` and `targets` with the same number of elements.
+func MSELoss(preds, targets *ts.Tensor) *ts.Tensor {
+	s := util.NewScope()
+	defer s.Close()
+
+	if util.IsReducedPrecision(preds.DType()) {
+		preds = s.Track(preds.MustTotype(gotch.Float, false))
+	}
+	targetsView := s.Track(s.Track(targets.MustTotype(preds.DType(), false)).MustView(preds.MustSize(), false))
+
+	return preds.MustMseLoss(targetsView, 1, false)
+}
+
+// BCEWithLogitsLoss returns mean binary cross-entropy of `logits` and `targets` (0 or 1) of the same shape.
+func BCEWithLogitsLoss(logits, targets *ts.Tensor) *ts.Tensor {
+	s := util.NewScope()
+	defer s.Close()
+
+	if util.IsReducedPrecision(logits.DType()) {
+		logits = s.Track(logits.MustTotype(gotch.Float, false))
+	}
+	targetsTs := s.Track(targets.MustTotype(logits.DType(), false))
+
+	return logits.MustBinaryCrossEntropyWithLogits(targetsTs, ts.None, ts.None, 1, false)
+}
+
+// SequenceClassificationLoss returns loss of sequence classification `logits` of shape (batch size, num labels).
+//
+// If `problemType` is empty, it is regression with a single label, single label classification
+// with integer labels of shape (batch size) and multi label classification otherwise
+// (float labels of shape (batch size, num labels)).
+func SequenceClassificationLoss(logits, labels *ts.Tensor, problemType string) (*ts.Tensor, error) {
+	size := logits.MustSize()
+	numLabels := size[len(size)-1]
+
+	if problemType == "" {
+		switch {
+		case numLabels == 1:
+			problemType = ProblemTypeRegression
+		case labels.DType() == gotch.Int64 || labels.DType() == gotch.Int:
+			problemType = ProblemTypeSingleLabel
+		default:
+			problemType = ProblemTypeMultiLabel
+		}
+	}
+
+	switch problemType {
+	case ProblemTypeRegression:
+		return MSELoss(logits, labels), nil
+	case ProblemTypeSingleLabel:
+		return CrossEntropyLoss(logits, labels, IgnoreIndex), nil
+	case ProblemTypeMultiLabel:
+		return BCEWithLogitsLoss(logits, labels), nil
+	}
+
+	err := fmt.Errorf("Unknown problem type %q.", problemType)
+	return nil, err
+}
+
+// QuestionAnsweringLoss returns mean of start and end cross-entropy of logits of shape (batch size, sequence length)
+// and positions of shape (batch size). Positions out of sequence are clamped to sequence length and ignored.
+func QuestionAnsweringLoss(startLogits, endLogits, startPositions, endPositions *ts.Tensor) *ts.Tensor {
+	s := util.NewScope()
+	defer s.Close()
+
+	ignoredIndex := startLogits.MustSize()[1]
+	loss := func(logits, positions *ts.Tensor) *ts.Tensor {
+		clamped := s.Track(positions.MustClamp(ts.IntScalar(0), ts.IntScalar(ignoredIndex), false))
+		return s.Track(CrossEntropyLoss(logits, clamped, ignoredIndex))
+	}
+
+	total := s.Track(loss(startLogits, startPositions).MustAdd(loss(endLogits, endPositions), false))
+
+	return total.MustDivScalar(ts.IntScalar(2), false)
+}
+
+// hasLabels returns whether optional labels are given.
+func hasLabels(labels *ts.Tensor) bool {
+	return labels != nil && labels.MustDefined()
+}
@@ -0,0 +1,146 @@
+package bert_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/nn"
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/bert"
+)
+
+func logSoftmax(xs []float64) []float64 {
+	var sum float64
+	for _, x := range xs {
+		sum += math.Exp(x)
+	}
+	out := make([]float64, len(xs))
+	for i, x := range xs {
+		out[i] = x - math.Log(sum)
+	}
+
+	return out
+}
+
+func checkLoss(t *testing.T, name string, loss *ts.Tensor, want float64) {
+	got := loss.Float64Values()[0]
+	if math.Abs(got-want) > 1e-5 {
+		t.Errorf("%v - want loss: %v\n", name, want)
+		t.Errorf("%v - got loss: %v\n", name, got)
+	}
+	loss.MustDrop()
+}
+
+func TestTaskLosses(t *testing.T) {
+	rows := [][]float64{{1.0, 2.0, 0.5}, {0.1, -1.0, 0.3}, {2.0, 0.0, -2.0}}
+	var flat []float64
+	for _, row := range rows {
+		flat = append(flat, row...)
+	}
+	logits := ts.MustOfSlice(flat).MustView([]int64{3, 3}, true)
+
+	// Cross-entropy ignores label -100.
+	labels := ts.MustOfSlice([]int64{1, bert.IgnoreIndex, 0})
+	want := -(logSoftmax(rows[0])[1] + logSoftmax(rows[2])[0]) / 2
+	checkLoss(t, "cross-entropy", bert.CrossEntropyLoss(logits, labels, bert.IgnoreIndex), want)
+
+	// Single label classification from integer labels.
+	loss, err := bert.SequenceClassificationLoss(logits, labels, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLoss(t, "single label", loss, want)
+
+	// Multi label classification from float labels.
+	multiHot := []float64{1, 0, 1, 0, 0, 0, 1, 1, 0}
+	targets := ts.MustOfSlice(multiHot).MustView([]int64{3, 3}, true)
+	var bce float64
+	for i, x := range flat {
+		p := 1 / (1 + math.Exp(-x))
+		bce -= multiHot[i]*math.Log(p) + (1-multiHot[i])*math.Log(1-p)
+	}
+	loss, err = bert.SequenceClassificationLoss(logits, targets, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLoss(t, "multi label", loss, bce/9)
+
+	// Regression with a single label.
+	preds := ts.MustOfSlice([]float64{0.5, 1.5, -1.0}).MustView([]int64{3, 1}, true)
+	values := ts.MustOfSlice([]float64{1.0, 1.0, 0.0})
+	loss, err = bert.SequenceClassificationLoss(preds, values, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLoss(t, "regression", loss, (0.25+0.25+1.0)/3)
+
+	if _, err := bert.SequenceClassificationLoss(logits, labels, "unknown"); err == nil {
+		t.Errorf("Want error for unknown problem type\n")
+	}
+
+	// Question answering: out of sequence positions are ignored.
+	starts := ts.MustOfSlice([]int64{2, 0, 7})
+	ends := ts.MustOfSlice([]int64{2, 1, 7})
+	startLoss := -(logSoftmax(rows[0])[2] + logSoftmax(rows[1])[0]) / 2
+	endLoss := -(logSoftmax(rows[0])[2] + logSoftmax(rows[1])[1]) / 2
+	checkLoss(t, "question answering", bert.QuestionAnsweringLoss(logits, logits, starts, ends), (startLoss+endLoss)/2)
+
+	for _, x := range []*ts.Tensor{logits, labels, targets, preds, values, starts, ends} {
+		x.MustDrop()
+	}
+}
+
+func TestBertForTokenClassification_Loss(t *testing.T) {
+	config := bert.NewConfig(map[string]interface{}{
+		"VocabSize":         int64(20),
+		"HiddenSize":        int64(8),
+		"NumHiddenLayers":   int64(1),
+		"NumAttentionHeads": int64(2),
+		"IntermediateSize":  int64(16),
+	})
+	config.Id2Label = map[int64]string{0: "O", 1: "B-PER", 2: "I-PER"}
+
+	vs := nn.NewVarStore(gotch.CPU)
+	model := bert.NewBertForTokenClassification(vs.Root(), config)
+
+	inputIds := ts.MustOfSlice([]int64{1, 5, 6, 2}).MustView([]int64{1, 4}, true)
+	labels := ts.MustOfSlice([]int64{bert.IgnoreIndex, 1, 2, bert.IgnoreIndex}).MustView([]int64{1, 4}, true)
+
+	var (
+		output *bert.ModelOutput
+		err    error
+	)
+	ts.NoGrad(func() {
+		output, err = model.ForwardT(inputIds, ts.None, ts.None, ts.None, ts.None, labels, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Loss over labeled tokens 1 and 2 only.
+	logits := output.Logits.Float64Values()
+	want := -(logSoftmax(logits[3:6])[1] + logSoftmax(logits[6:9])[2]) / 2
+	got := output.Loss.Float64Values()[0]
+	if math.Abs(got-want) > 1e-5 {
+		t.Errorf("Want loss: %v\n", want)
+		t.Errorf("Got loss: %v\n", got)
+	}
+	output.Drop()
+
+	// No labels, no loss.
+	ts.NoGrad(func() {
+		output, err = model.ForwardT(inputIds, ts.None, ts.None, ts.None, ts.None, ts.None, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.Loss != nil {
+		t.Errorf("Want no loss without labels\n")
+	}
+	output.Drop()
+
+	inputIds.MustDrop()
+	labels.MustDrop()
+}
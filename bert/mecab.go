@@ -0,0 +1,434 @@
+package bert
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MeCab-compatible morphological analyzer:
+// =========================================
+//
+// MecabTokenizer segments text into words with a MeCab system dictionary in
+// source (text) format, e.g. IPADIC or UniDic. A dictionary directory contains:
+//   - `*.csv`: lexicon entries `surface,left_id,right_id,cost,features...`
+//   - `matrix.def`: connection costs. First line is `left_size right_size`,
+//     following lines are `right_id left_id cost`.
+//   - `char.def`: character categories and their code point ranges.
+//   - `unk.def`: unknown word entries per character category `category,left_id,right_id,cost,...`
+//
+// All files must be encoded in UTF-8 (e.g. `mecab-ipadic-utf8`).
+
+// mecabEntry is a lexicon or unknown word entry.
+type mecabEntry struct {
+	leftId  int
+	rightId int
+	cost    int
+}
+
+// mecabCharCategory is a character category defined in `char.def`.
+type mecabCharCategory struct {
+	invoke bool // always invoke unknown word processing
+	group  bool // group characters of the same category
+	length int  // make unknown words of length 1..length
+}
+
+// mecabCharRange maps a range of code points to categories.
+type mecabCharRange struct {
+	lo, hi     rune
+	categories []string
+}
+
+// MecabDictionary holds a MeCab system dictionary.
+type MecabDictionary struct {
+	lexicon      map[string][]mecabEntry
+	maxSurface   int // in bytes
+	matrix       []int
+	leftSize     int
+	rightSize    int
+	categories   map[string]mecabCharCategory
+	charRanges   []mecabCharRange
+	unknown      map[string][]mecabEntry
+	defaultCateg string
+}
+
+// LoadMecabDictionary loads MeCab dictionary from a directory of source files.
+func LoadMecabDictionary(dir string) (*MecabDictionary, error) {
+	d := &MecabDictionary{
+		lexicon:      make(map[string][]mecabEntry),
+		categories:   make(map[string]mecabCharCategory),
+		unknown:      make(map[string][]mecabEntry),
+		defaultCateg: "DEFAULT",
+	}
+
+	csvFiles, err := filepath.Glob(filepath.Join(dir, "*.csv"))
+	if err != nil {
+		return nil, err
+	}
+	if len(csvFiles) == 0 {
+		err := fmt.Errorf("LoadMecabDictionary() failed: no lexicon (*.csv) files found in %q.", dir)
+		return nil, err
+	}
+	for _, f := range csvFiles {
+		if err := d.loadEntries(f, d.lexicon, true); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := d.loadMatrix(filepath.Join(dir, "matrix.def")); err != nil {
+		return nil, err
+	}
+	if err := d.loadCharDef(filepath.Join(dir, "char.def")); err != nil {
+		return nil, err
+	}
+	if err := d.loadEntries(filepath.Join(dir, "unk.def"), d.unknown, false); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+func (d *MecabDictionary) loadEntries(filename string, entries map[string][]mecabEntry, isLexicon bool) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("Reading %q failed: %w", filename, err)
+		}
+		if len(record) < 4 {
+			return fmt.Errorf("Reading %q failed: invalid entry %v", filename, record)
+		}
+
+		var vals [3]int
+		for i := 0; i < 3; i++ {
+			vals[i], err = strconv.Atoi(strings.TrimSpace(record[i+1]))
+			if err != nil {
+				return fmt.Errorf("Reading %q failed: invalid entry %v", filename, record)
+			}
+		}
+
+		key := record[0]
+		entries[key] = append(entries[key], mecabEntry{leftId: vals[0], rightId: vals[1], cost: vals[2]})
+		if isLexicon && len(key) > d.maxSurface {
+			d.maxSurface = len(key)
+		}
+	}
+
+	return nil
+}
+
+func (d *MecabDictionary) loadMatrix(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		return fmt.Errorf("Reading %q failed: empty file", filename)
+	}
+	var header []int
+	for _, s := range strings.Fields(scanner.Text()) {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("Reading %q failed: invalid header", filename)
+		}
+		header = append(header, v)
+	}
+	if len(header) != 2 {
+		return fmt.Errorf("Reading %q failed: invalid header", filename)
+	}
+	d.leftSize, d.rightSize = header[0], header[1]
+	d.matrix = make([]int, d.leftSize*d.rightSize)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		var vals [3]int
+		for i, s := range fields {
+			vals[i], err = strconv.Atoi(s)
+			if err != nil {
+				return fmt.Errorf("Reading %q failed: invalid line %q", filename, scanner.Text())
+			}
+		}
+		rightId, leftId, cost := vals[0], vals[1], vals[2]
+		if rightId >= d.leftSize || leftId >= d.rightSize {
+			return fmt.Errorf("Reading %q failed: id out of range at line %q", filename, scanner.Text())
+		}
+		d.matrix[rightId*d.rightSize+leftId] = cost
+	}
+
+	return scanner.Err()
+}
+
+func (d *MecabDictionary) loadCharDef(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if strings.HasPrefix(fields[0], "0x") {
+			// Code point range: `0x3041..0x309F HIRAGANA [COMPAT...]`
+			if len(fields) < 2 {
+				return fmt.Errorf("Reading %q failed: invalid line %q", filename, line)
+			}
+			bounds := strings.Split(fields[0], "..")
+			lo, err := strconv.ParseInt(bounds[0], 0, 32)
+			if err != nil {
+				return fmt.Errorf("Reading %q failed: invalid line %q", filename, line)
+			}
+			hi := lo
+			if len(bounds) == 2 {
+				hi, err = strconv.ParseInt(bounds[1], 0, 32)
+				if err != nil {
+					return fmt.Errorf("Reading %q failed: invalid line %q", filename, line)
+				}
+			}
+			d.charRanges = append(d.charRanges, mecabCharRange{rune(lo), rune(hi), fields[1:]})
+			continue
+		}
+
+		// Category definition: `NAME INVOKE GROUP LENGTH`
+		if len(fields) != 4 {
+			return fmt.Errorf("Reading %q failed: invalid line %q", filename, line)
+		}
+		var vals [3]int
+		for i := 0; i < 3; i++ {
+			vals[i], err = strconv.Atoi(fields[i+1])
+			if err != nil {
+				return fmt.Errorf("Reading %q failed: invalid line %q", filename, line)
+			}
+		}
+		d.categories[fields[0]] = mecabCharCategory{invoke: vals[0] == 1, group: vals[1] == 1, length: vals[2]}
+	}
+
+	return scanner.Err()
+}
+
+// charCategories returns categories of a character. Later ranges in `char.def`
+// override earlier ones as in MeCab.
+func (d *MecabDictionary) charCategories(r rune) []string {
+	var categories []string
+	for _, cr := range d.charRanges {
+		if r >= cr.lo && r <= cr.hi {
+			categories = cr.categories
+		}
+	}
+	if categories == nil {
+		return []string{d.defaultCateg}
+	}
+	return categories
+}
+
+func (d *MecabDictionary) connectionCost(rightId, leftId int) int {
+	if rightId >= d.leftSize || leftId >= d.rightSize {
+		return 0
+	}
+	return d.matrix[rightId*d.rightSize+leftId]
+}
+
+// mecabNode is a node of the lattice.
+type mecabNode struct {
+	start, end int
+	entry      mecabEntry
+	total      int
+	prev       *mecabNode
+}
+
+// MecabTokenizer is a word tokenizer using MeCab dictionary and Viterbi
+// search for minimum cost path. It implements `WordTokenizer` interface.
+type MecabTokenizer struct {
+	dict *MecabDictionary
+}
+
+// NewMecabTokenizer creates MecabTokenizer from dictionary directory.
+func NewMecabTokenizer(dicDir string) (*MecabTokenizer, error) {
+	dict, err := LoadMecabDictionary(dicDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MecabTokenizer{dict}, nil
+}
+
+// NewMecabTokenizerFromDictionary creates MecabTokenizer from a loaded dictionary.
+func NewMecabTokenizerFromDictionary(dict *MecabDictionary) *MecabTokenizer {
+	return &MecabTokenizer{dict}
+}
+
+// skipSpaces returns first position from `pos` which is not a whitespace.
+func skipSpaces(text string, pos int) int {
+	for pos < len(text) {
+		r, size := utf8.DecodeRuneInString(text[pos:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		pos += size
+	}
+	return pos
+}
+
+// Tokenize implements `WordTokenizer` interface.
+func (mt *MecabTokenizer) Tokenize(text string) [][]int {
+	n := len(text)
+	if n == 0 {
+		return nil
+	}
+
+	d := mt.dict
+	// endNodes[i] are nodes to connect with nodes beginning at position i.
+	endNodes := make([][]*mecabNode, n+1)
+	bos := &mecabNode{}
+	endNodes[skipSpaces(text, 0)] = append(endNodes[skipSpaces(text, 0)], bos)
+
+	addNode := func(start, end int, entry mecabEntry) {
+		node := &mecabNode{start: start, end: end, entry: entry, total: math.MaxInt64}
+		for _, prev := range endNodes[start] {
+			total := prev.total + d.connectionCost(prev.entry.rightId, entry.leftId) + entry.cost
+			if total < node.total {
+				node.total = total
+				node.prev = prev
+			}
+		}
+		next := skipSpaces(text, end)
+		endNodes[next] = append(endNodes[next], node)
+	}
+
+	for start := 0; start < n; {
+		_, size := utf8.DecodeRuneInString(text[start:])
+		if len(endNodes[start]) == 0 {
+			start += size
+			continue
+		}
+
+		// 1. Dictionary words
+		found := false
+		for end := start + size; end <= n && end-start <= d.maxSurface; {
+			for _, entry := range d.lexicon[text[start:end]] {
+				addNode(start, end, entry)
+				found = true
+			}
+			if end == n {
+				break
+			}
+			_, s := utf8.DecodeRuneInString(text[end:])
+			end += s
+		}
+
+		// 2. Unknown words
+		r, _ := utf8.DecodeRuneInString(text[start:])
+		categName := d.charCategories(r)[0]
+		categ := d.categories[categName]
+		if categ.invoke || !found {
+			var ends []int
+
+			if categ.group {
+				end := start + size
+				for end < n {
+					next, s := utf8.DecodeRuneInString(text[end:])
+					if unicode.IsSpace(next) || !containsString(d.charCategories(next), categName) {
+						break
+					}
+					end += s
+				}
+				ends = append(ends, end)
+			}
+
+			end := start
+			for i := 0; i < categ.length && end < n; i++ {
+				next, s := utf8.DecodeRuneInString(text[end:])
+				if i > 0 && (unicode.IsSpace(next) || !containsString(d.charCategories(next), categName)) {
+					break
+				}
+				end += s
+				if len(ends) == 0 || ends[0] != end {
+					ends = append(ends, end)
+				}
+			}
+
+			// Always make sure that the lattice is connected.
+			if len(ends) == 0 && !found {
+				ends = append(ends, start+size)
+			}
+
+			for _, end := range ends {
+				entries := d.unknown[categName]
+				if len(entries) == 0 {
+					entries = d.unknown[d.defaultCateg]
+				}
+				if len(entries) == 0 {
+					entries = []mecabEntry{{}}
+				}
+				for _, entry := range entries {
+					addNode(start, end, entry)
+				}
+			}
+		}
+
+		start += size
+	}
+
+	// EOS
+	var last *mecabNode
+	best := math.MaxInt64
+	for _, prev := range endNodes[n] {
+		total := prev.total + d.connectionCost(prev.entry.rightId, 0)
+		if total < best {
+			best = total
+			last = prev
+		}
+	}
+
+	var words [][]int
+	for node := last; node != nil && node != bos; node = node.prev {
+		words = append(words, []int{node.start, node.end})
+	}
+	for i, j := 0, len(words)-1; i < j; i, j = i+1, j-1 {
+		words[i], words[j] = words[j], words[i]
+	}
+
+	return words
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package bert_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/yinziyang/transformer/bert"
+)
+
+// writeTestDictionary writes a tiny MeCab dictionary in source format.
+func writeTestDictionary(t *testing.T) string {
+	dir := t.TempDir()
+	files := map[string]string{
+		"lex.csv": "東京,0,0,100,名詞\n" +
+			"都,0,0,100,名詞\n" +
+			"東京都,0,0,500,名詞\n" +
+			"庁,0,0,100,名詞\n" +
+			"都庁,0,0,100,名詞\n",
+		"matrix.def": "1 1\n0 0 0\n",
+		"char.def": "DEFAULT 0 1 0\n" +
+			"KANJI 0 0 2\n" +
+			"0x4E00..0x9FFF KANJI\n",
+		"unk.def": "DEFAULT,0,0,1000,記号\n" +
+			"KANJI,0,0,1000,名詞\n",
+	}
+	for name, content := range files {
+		err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestMecabTokenizer(t *testing.T) {
+	mt, err := bert.NewMecabTokenizer(writeTestDictionary(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// "東京" + "都庁" (200) beats "東京都" + "庁" (600).
+	// Unknown "abc" is grouped into one word.
+	want := [][]int{{0, 6}, {6, 12}, {13, 16}}
+	got := mt.Tokenize("東京都庁 abc")
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Want: %v\n", want)
+		t.Errorf("Got: %v\n", got)
+	}
+}
+
+func TestCharacterTokenizer(t *testing.T) {
+	ct := bert.NewCharacterTokenizer()
+
+	want := [][]int{{0, 3}, {3, 6}, {7, 8}}
+	got := ct.Tokenize("東京 a")
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Want: %v\n", want)
+		t.Errorf("Got: %v\n", got)
+	}
+}
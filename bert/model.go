@@ -30,6 +30,8 @@ type BertModel struct {
 	Encoder    *BertEncoder
 	Pooler     *BertPooler
 	IsDecoder  bool
+
+	path *nn.Path // variable path of model, see `AddLoRA`
 }
 
 // NewBertModel builds a new `BertModel`.
@@ -51,7 +53,7 @@ func NewBertModel(p *nn.Path, config *BertConfig, changeNameOpt ...bool) *BertMo
 	encoder := NewBertEncoder(p.Sub("encoder"), config, changeName)
 	pooler := NewBertPooler(p.Sub("pooler"), config)
 
-	return &BertModel{embeddings, encoder, pooler, isDecoder}
+	return &BertModel{embeddings, encoder, pooler, isDecoder, p}
 }
 
 // ForwardT forwards pass through the model.
@@ -61,6 +63,7 @@ func NewBertModel(p *nn.Path, config *BertConfig, changeNameOpt ...bool) *BertMo
 //     If None, pre-computed embeddings must be provided (see `inputEmbeds`)
 //   - `mask`: optional mask of shape (batch size, sequence length).
 //     Masked position have value 0, non-masked value 1. If None set to 1.
+//     With sliding window attention (`AttentionWindow`), global tokens have value 2.
 //   - `tokenTypeIds`: optional segment id of shape (batch size, sequence length).
 //     Convention is value of 0 for the first sentence (incl. [SEP]) and 1 for the second sentence. If None set to 0.
 //   - `positionIds`: optional position ids of shape (batch size, sequence length).
@@ -75,12 +78,32 @@ func NewBertModel(p *nn.Path, config *BertConfig, changeNameOpt ...bool) *BertMo
 //     Positions with value 0 will be masked.
 //   - `train`: boolean flag to turn on/off the dropout layers in the model. Should be set to false for inference.
 //
-// Returns:
-//   - `output`: tensor of shape (batch size, sequence length, hidden size)
-//   - `pooledOutput`: tensor of shape (batch size, hidden size)
-//   - `hiddenStates`: slice of tensors of length numHiddenLayers with shape (batch size, sequenceLength, hiddenSize)
-//   - `attentions`: slice of tensors of length numHiddenLayers with shape (batch size, sequenceLength, hiddenSize)
-func (b *BertModel) ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, encoderHiddenStates, encoderMask *ts.Tensor, train bool) (retVal1, retVal2 *ts.Tensor, retValOpt1, retValOpt2 []ts.Tensor, err error) {
+// Returns model output with:
+//   - `LastHiddenState`: tensor of shape (batch size, sequence length, hidden size)
+//   - `PooledOutput`: tensor of shape (batch size, hidden size)
+//   - `HiddenStates`: if `OutputHiddenStates`, slice of tensors of length numHiddenLayers with shape (batch size, sequence length, hidden size)
+//   - `Attentions`: if `OutputAttentions`, slice of tensors of length numHiddenLayers with shape (batch size, num heads, sequence length, sequence length)
+//
+// The output must be freed with `ModelOutput.Drop()`.
+func (b *BertModel) ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, encoderHiddenStates, encoderMask *ts.Tensor, train bool) (*ModelOutput, error) {
+	output, present, err := b.ForwardCachedT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, encoderHiddenStates, encoderMask, nil, train)
+	present.Drop()
+
+	return output, err
+}
+
+// ForwardCachedT forwards pass with keys and values cached from previous steps for
+// incremental (autoregressive) decoding.
+//
+// Params are the same as `ForwardT` with additional:
+//   - `past`: optional cache returned by previous call, `nil` at first step. Inputs then only
+//     contain new token(s) while `mask` (if defined) covers both cached and new positions,
+//     i.e. has shape (batch size, past length + sequence length). If `positionIds` is None,
+//     positions are incremented from past length.
+//
+// Returns the same values as `ForwardT` and updated cache to pass to next step.
+// NOTE. `past` is consumed and must not be used (nor dropped) after the call.
+func (b *BertModel) ForwardCachedT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, encoderHiddenStates, encoderMask *ts.Tensor, past *Cache, train bool) (output *ModelOutput, present *Cache, err error) {
 
 	var (
 		inputShape []int64
@@ -105,67 +128,116 @@ func (b *BertModel) ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmb
 		}
 	}
 
-	var maskTs *ts.Tensor
-	if mask.MustDefined() {
-		maskTs = mask
-	} else {
-		maskTs = ts.MustOnes(inputShape, gotch.Int64, device)
+	s := util.NewScope()
+	defer s.Close()
+
+	pastLen := past.SeqLen()
+
+	maskTs := mask
+	if !mask.MustDefined() {
+		maskTs = s.Track(ts.MustOnes([]int64{inputShape[0], pastLen + inputShape[1]}, gotch.Int64, device))
+	}
+
+	// Mask value 2 marks global tokens of sliding window attention. It is the same as 1 otherwise.
+	if b.Encoder.isSlidingWindow() {
+		if maskTs.Dim() != 2 {
+			err = fmt.Errorf("Sliding window attention needs an attention mask of dimension 2, got %v\n", maskTs.Dim())
+			return
+		}
+	} else if mask.MustDefined() {
+		maskTs = s.Track(maskTs.MustClampMax(ts.IntScalar(1), false))
 	}
 
 	var extendedAttentionMask *ts.Tensor
 	switch maskTs.Dim() {
 	case 3:
-		extendedAttentionMask = maskTs.MustUnsqueeze(1, false) // TODO: check and delete maskTs if not using later
+		extendedAttentionMask = s.Track(maskTs.MustUnsqueeze(1, false))
 	case 2:
+		paddingMask := s.Track(s.Track(maskTs.MustUnsqueeze(1, false)).MustUnsqueeze(1, false))
 		if b.IsDecoder {
-			seqIds := ts.MustArange(ts.IntScalar(inputShape[1]), gotch.Float, device)
-			causalMaskTmp := seqIds.MustUnsqueeze(0, false).MustUnsqueeze(0, true).MustRepeat([]int64{inputShape[0], inputShape[1], 1}, true)
-			causalMask := causalMaskTmp.MustLeTensor(seqIds.MustUnsqueeze(0, true).MustUnsqueeze(1, true), true)
-			extendedAttentionMask = causalMask.MustMatmul(mask.MustUnsqueeze(1, false).MustUnsqueeze(1, true), true)
+			// Causal mask: position i attends to positions j <= i (batch size, 1, seq length, past length + seq length),
+			// combined with padding mask.
+			causal := s.Track(causalMask(inputShape[0], inputShape[1], pastLen, maskTs.DType(), device))
+			extendedAttentionMask = s.Track(causal.MustMul(paddingMask, false))
 		} else {
-			extendedAttentionMask = maskTs.MustUnsqueeze(1, false).MustUnsqueeze(1, true)
+			extendedAttentionMask = paddingMask
 		}
 
 	default:
 		err = fmt.Errorf("Invalid attention mask dimension, must be 2 or 3, got %v\n", maskTs.Dim())
+		return
 	}
 
-	extendedAttnMask := extendedAttentionMask.MustOnesLike(false).MustSub(extendedAttentionMask, true).MustMulScalar(ts.FloatScalar(-10000.0), true)
+	extendedAttnMask := s.Track(additiveMask(s, extendedAttentionMask))
 
 	// NOTE. encoderExtendedAttentionMask is an optional tensor
-	var encoderExtendedAttentionMask *ts.Tensor
+	encoderExtendedAttentionMask := ts.None
 	if b.IsDecoder && encoderHiddenStates.MustDefined() {
 		size := encoderHiddenStates.MustSize()
-		var encoderMaskTs *ts.Tensor
-		if encoderMask.MustDefined() {
-			encoderMaskTs = encoderMask
-		} else {
-			encoderMaskTs = ts.MustOnes([]int64{size[0], size[1]}, gotch.Int64, device)
+		encoderMaskTs := encoderMask
+		if !encoderMask.MustDefined() {
+			encoderMaskTs = s.Track(ts.MustOnes([]int64{size[0], size[1]}, gotch.Int64, device))
 		}
 
+		var encoderExtendedMask *ts.Tensor
 		switch encoderMaskTs.Dim() {
 		case 2:
-			encoderExtendedAttentionMask = encoderMaskTs.MustUnsqueeze(1, true).MustUnsqueeze(1, true)
+			encoderExtendedMask = s.Track(s.Track(encoderMaskTs.MustUnsqueeze(1, false)).MustUnsqueeze(1, false))
 		case 3:
-			encoderExtendedAttentionMask = encoderMaskTs.MustUnsqueeze(1, true)
+			encoderExtendedMask = s.Track(encoderMaskTs.MustUnsqueeze(1, false))
 		default:
 			err = fmt.Errorf("Invalid encoder attention mask dimension, must be 2, or 3 got %v\n", encoderMaskTs.Dim())
 			return
 		}
-	} else {
-		encoderExtendedAttentionMask = ts.None
+		encoderExtendedAttentionMask = s.Track(additiveMask(s, encoderExtendedMask))
 	}
 
-	embeddingOutput, err := b.Embeddings.ForwardT(inputIds, tokenTypeIds, positionIds, inputEmbeds, train)
+	posIds := positionIds
+	if !positionIds.MustDefined() && pastLen > 0 {
+		arange := s.Track(ts.MustArangeStart(ts.IntScalar(pastLen), ts.IntScalar(pastLen+inputShape[1]), gotch.Int64, device))
+		posIds = s.Track(s.Track(arange.MustUnsqueeze(0, false)).MustExpand(inputShape, true, false))
+	}
+
+	embeddingOutput, err := b.Embeddings.ForwardT(inputIds, tokenTypeIds, posIds, inputEmbeds, train)
 	if err != nil {
 		return
 	}
 
-	hiddenState, allHiddenStates, allAttentions := b.Encoder.ForwardT(embeddingOutput, extendedAttnMask, encoderHiddenStates, encoderExtendedAttentionMask, train)
+	// NOTE. encoder consumes embedding output and returns distinct tensors owned by model output.
+	hiddenState, allHiddenStates, allAttentions, present := b.Encoder.ForwardCachedT(embeddingOutput, extendedAttnMask, encoderHiddenStates, encoderExtendedAttentionMask, past, train)
 
 	pooledOutput := b.Pooler.Forward(hiddenState)
 
-	return hiddenState, pooledOutput, allHiddenStates, allAttentions, nil
+	output = &ModelOutput{
+		LastHiddenState: hiddenState,
+		PooledOutput:    pooledOutput,
+		HiddenStates:    allHiddenStates,
+		Attentions:      allAttentions,
+	}
+
+	return output, present, nil
+}
+
+// additiveMask converts a mask of 1 (attended) and 0 (masked) values to a mask to add to
+// attention scores: 0 for attended and -10000 for masked positions.
+func additiveMask(s *util.Scope, mask *ts.Tensor) *ts.Tensor {
+	inverted := s.Track(s.Track(mask.MustOnesLike(false)).MustSub(mask, false))
+
+	return inverted.MustMulScalar(ts.FloatScalar(-10000.0), false)
+}
+
+// causalMask creates a lower triangular mask of shape (batch size, 1, seq length, past length + seq length)
+// where element [i, j] is 1 if j <= past length + i and 0 otherwise.
+func causalMask(batchSize, seqLen, pastLen int64, dtype gotch.DType, device gotch.Device) *ts.Tensor {
+	seqIds := ts.MustArange(ts.IntScalar(pastLen+seqLen), gotch.Int64, device)
+	cols := seqIds.MustUnsqueeze(0, false).MustUnsqueeze(0, true).MustRepeat([]int64{batchSize, seqLen, 1}, true)
+	rows := seqIds.MustNarrow(0, pastLen, seqLen, false).MustUnsqueeze(0, true).MustUnsqueeze(2, true)
+	seqIds.MustDrop()
+
+	mask := cols.MustLeTensor(rows, true).MustTotype(dtype, true)
+	rows.MustDrop()
+
+	return mask.MustUnsqueeze(1, true)
 }
 
 // BertPredictionHeadTransform:
@@ -185,9 +257,9 @@ func NewBertPredictionHeadTransform(p *nn.Path, config *BertConfig, changeNameOp
 		changeName = changeNameOpt[0]
 	}
 	dense := nn.NewLinear(p.Sub("dense"), config.HiddenSize, config.HiddenSize, nn.DefaultLinearConfig())
-	activation, ok := util.ActivationFnMap[config.HiddenAct]
-	if !ok {
-		log.Fatalf("Unsupported activation function - %v\n", config.HiddenAct)
+	activation, err := util.GetActivation(config.HiddenAct)
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	lnConfig := nn.DefaultLayerNormConfig()
@@ -195,20 +267,20 @@ func NewBertPredictionHeadTransform(p *nn.Path, config *BertConfig, changeNameOp
 		lnConfig.WsName = "gamma"
 		lnConfig.BsName = "beta"
 	}
-	layerNorm := nn.NewLayerNorm(p.Sub("LayerNorm"), []int64{config.HiddenSize}, lnConfig)
+	layerNorm := util.NewLayerNorm(p.Sub("LayerNorm"), []int64{config.HiddenSize}, lnConfig)
 
 	return &BertPredictionHeadTransform{dense, activation, layerNorm}
 }
 
 // Forward forwards through the model.
 func (bpht *BertPredictionHeadTransform) Forward(hiddenStates *ts.Tensor) (retVal *ts.Tensor) {
-	tmp1 := hiddenStates.Apply(bpht.Dense)
-	tmp2 := bpht.Activation.Fwd(tmp1)
-	retVal = tmp2.Apply(bpht.LayerNorm)
-	tmp1.MustDrop()
-	tmp2.MustDrop()
+	s := util.NewScope()
+	defer s.Close()
+
+	tmp1 := s.Track(hiddenStates.Apply(bpht.Dense))
+	tmp2 := s.Track(bpht.Activation.Fwd(tmp1))
 
-	return retVal
+	return s.Keep(s.Track(util.ApplyLayerNorm(bpht.LayerNorm, tmp2)))
 }
 
 // BertLMPredictionHead:
@@ -239,12 +311,13 @@ func NewBertLMPredictionHead(p *nn.Path, config *BertConfig) (*BertLMPredictionH
 
 // Forward fowards through the model.
 func (ph *BertLMPredictionHead) Forward(hiddenState *ts.Tensor) *ts.Tensor {
-	fwTensor := ph.Transform.Forward(hiddenState).Apply(ph.Decoder)
+	s := util.NewScope()
+	defer s.Close()
 
-	retVal := fwTensor.MustAdd(ph.Bias, false)
-	fwTensor.MustDrop()
+	transformed := s.Track(ph.Transform.Forward(hiddenState))
+	fwTensor := s.Track(transformed.Apply(ph.Decoder))
 
-	return retVal
+	return s.Keep(s.Track(fwTensor.MustAdd(ph.Bias, false)))
 }
 
 // BertForMaskedLM:
@@ -277,9 +350,11 @@ func NewBertForMaskedLM(p *nn.Path, config *BertConfig, changeNameOpt ...bool) (
 func (mlm *BertForMaskedLM) Load(modelNameOrPath string, config interface{ pretrained.Config }, params map[string]interface{}, device gotch.Device) error {
 	vs := nn.NewVarStore(device)
 	p := vs.Root()
-	mlm.bert = NewBertModel(p.Sub("bert"), config.(*BertConfig))
 	var err error
-	mlm.cls, err = NewBertLMPredictionHead(p.Sub("cls"), config.(*BertConfig))
+	util.WithDType(config.(*BertConfig).ModelDType(), func() {
+		mlm.bert = NewBertModel(p.Sub("bert"), config.(*BertConfig))
+		mlm.cls, err = NewBertLMPredictionHead(p.Sub("cls"), config.(*BertConfig))
+	})
 	if err != nil {
 		return err
 	}
@@ -300,6 +375,7 @@ func (mlm *BertForMaskedLM) Load(modelNameOrPath string, config interface{ pretr
 //     If None, pre-computed embeddings must be provided (see `inputEmbeds`)
 //   - `mask`: optional mask of shape (batch size, sequence length).
 //     Masked position have value 0, non-masked value 1. If None set to 1.
+//     With sliding window attention (`AttentionWindow`), global tokens have value 2.
 //   - `tokenTypeIds`: optional segment id of shape (batch size, sequence length).
 //     Convention is value of 0 for the first sentence (incl. [SEP]) and 1 for the second sentence. If None set to 0.
 //   - `positionIds`: optional position ids of shape (batch size, sequence length).
@@ -312,22 +388,258 @@ func (mlm *BertForMaskedLM) Load(modelNameOrPath string, config interface{ pretr
 //   - `encoderMask`: optional encoder attention mask of shape (batch size, encoder sequence length).
 //     If the model is defined as a decoder and the `encoderHiddenStates` is not None, used to mask encoder values.
 //     Positions with value 0 will be masked.
+//   - `labels`: optional token ids of shape (batch size, sequence length) to compute masked language modeling loss.
+//     Positions with value -100 (non-masked tokens) are ignored.
 //   - `train`: boolean flag to turn on/off the dropout layers in the model. Should be set to false for inference.
 //
-// Returns:
-//   - `output`: tensor of shape (batch size, sequence length, hidden size)
-//   - `hiddenStates`: slice of tensors of length numHiddenLayers with shape (batch size, sequenceLength, hiddenSize)
-//   - `attentions`: slice of tensors of length numHiddenLayers with shape (batch size, sequenceLength, hiddenSize)
-func (mlm *BertForMaskedLM) ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, encoderHiddenStates, encoderMask *ts.Tensor, train bool) (retVal1 *ts.Tensor, optRetVal1, optRetVal2 []ts.Tensor) {
+// Returns model output with:
+//   - `Logits`: prediction scores of shape (batch size, sequence length, vocab size)
+//   - `Loss`: cross-entropy loss if `labels` are given
+//   - `HiddenStates`: optional slice of tensors of length numHiddenLayers with shape (batch size, sequence length, hidden size)
+//   - `Attentions`: optional slice of tensors of length numHiddenLayers with shape (batch size, num heads, sequence length, sequence length)
+func (mlm *BertForMaskedLM) ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, encoderHiddenStates, encoderMask, labels *ts.Tensor, train bool) (*ModelOutput, error) {
+	output, present, err := mlm.ForwardCachedT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, encoderHiddenStates, encoderMask, nil, train)
+	present.Drop()
+	if err != nil {
+		return nil, err
+	}
 
-	hiddenState, _, allHiddenStates, allAttentions, err := mlm.bert.ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, encoderHiddenStates, encoderMask, train)
+	if hasLabels(labels) {
+		output.Loss = CrossEntropyLoss(output.Logits, labels, IgnoreIndex)
+	}
+
+	return output, nil
+}
+
+// ForwardCachedT forwards pass with keys and values cached from previous steps. It is used for
+// autoregressive generation when model is a decoder (`IsDecoder`). See `BertModel.ForwardCachedT`.
+//
+// Returns the same output as `ForwardT` and updated cache.
+func (mlm *BertForMaskedLM) ForwardCachedT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, encoderHiddenStates, encoderMask *ts.Tensor, past *Cache, train bool) (*ModelOutput, *Cache, error) {
+
+	output, present, err := mlm.bert.ForwardCachedT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, encoderHiddenStates, encoderMask, past, train)
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, err
 	}
 
-	predictionScores := mlm.cls.Forward(hiddenState)
+	output.Logits = mlm.cls.Forward(output.LastHiddenState)
+	output.DropBase()
 
-	return predictionScores, allHiddenStates, allAttentions
+	return output, present, nil
+}
+
+// BertOnlyNSPHead:
+// ================
+
+// BertOnlyNSPHead is BERT next sentence prediction head: a linear layer scoring whether
+// the second sentence of a pair follows the first one from the pooled output.
+type BertOnlyNSPHead struct {
+	SeqRelationship *nn.Linear
+}
+
+// NewBertOnlyNSPHead creates BertOnlyNSPHead.
+func NewBertOnlyNSPHead(p *nn.Path, config *BertConfig) *BertOnlyNSPHead {
+	seqRelationship := nn.NewLinear(p.Sub("seq_relationship"), config.HiddenSize, 2, nn.DefaultLinearConfig())
+
+	return &BertOnlyNSPHead{seqRelationship}
+}
+
+// Forward forwards pooled output of shape (batch size, hidden size) through the head.
+// It returns scores of shape (batch size, 2): index 0 if the second sentence follows the
+// first one, 1 if it is a random sentence.
+func (nsp *BertOnlyNSPHead) Forward(pooledOutput *ts.Tensor) *ts.Tensor {
+	return pooledOutput.Apply(nsp.SeqRelationship)
+}
+
+// BertForNextSentencePrediction:
+// ==============================
+
+// BertForNextSentencePrediction is BERT for next sentence prediction. Input should be in
+// the form `[CLS] Sentence A [SEP] Sentence B [SEP]`.
+//
+// It is made of the following blocks:
+//   - `bert`: Base BertModel
+//   - `cls`: next sentence prediction head (`cls.seq_relationship`)
+type BertForNextSentencePrediction struct {
+	bert *BertModel
+	cls  *BertOnlyNSPHead
+}
+
+// NewBertForNextSentencePrediction creates BertForNextSentencePrediction.
+func NewBertForNextSentencePrediction(p *nn.Path, config *BertConfig, changeNameOpt ...bool) *BertForNextSentencePrediction {
+	changeName := true
+	if len(changeNameOpt) > 0 {
+		changeName = changeNameOpt[0]
+	}
+	bert := NewBertModel(p.Sub("bert"), config, changeName)
+	cls := NewBertOnlyNSPHead(p.Sub("cls"), config)
+
+	return &BertForNextSentencePrediction{bert, cls}
+}
+
+// Load loads model from file or model name. It also updates
+// default configuration parameters if provided.
+// This method implements `PretrainedModel` interface.
+func (nsp *BertForNextSentencePrediction) Load(modelNameOrPath string, config interface{ pretrained.Config }, params map[string]interface{}, device gotch.Device) error {
+	vs := nn.NewVarStore(device)
+	p := vs.Root()
+	util.WithDType(config.(*BertConfig).ModelDType(), func() {
+		nsp.bert = NewBertModel(p.Sub("bert"), config.(*BertConfig))
+		nsp.cls = NewBertOnlyNSPHead(p.Sub("cls"), config.(*BertConfig))
+	})
+
+	err := pickle.LoadAll(vs, modelNameOrPath)
+	if err != nil {
+		log.Fatalf("Load model weight error: \n%v", err)
+	}
+
+	return nil
+}
+
+// ForwardT forwards pass through the model.
+//
+// Params:
+//   - `inputIds`: optional input tensor of shape (batch size, sequence length).
+//     If None, pre-computed embeddings must be provided (see `inputEmbeds`)
+//   - `mask`: optional mask of shape (batch size, sequence length).
+//     Masked position have value 0, non-masked value 1. If None set to 1.
+//     With sliding window attention (`AttentionWindow`), global tokens have value 2.
+//   - `tokenTypeIds`: optional segment id of shape (batch size, sequence length).
+//     Convention is value of 0 for the first sentence (incl. [SEP]) and 1 for the second sentence. If None set to 0.
+//   - `positionIds`: optional position ids of shape (batch size, sequence length).
+//     If None, will be incremented from 0.
+//   - `inputEmbeds`: optional pre-computed input embeddings of shape (batch size, sequence length, hidden size).
+//     If None, input ids must be provided (see `inputIds`).
+//   - `labels`: optional labels of shape (batch size) to compute cross-entropy loss: 0 if sentence B
+//     follows sentence A, 1 if sentence B is random.
+//   - `train`: boolean flag to turn on/off the dropout layers in the model. Should be set to false for inference.
+//
+// Returns model output with:
+//   - `Logits`: next sentence scores of shape (batch size, 2)
+//   - `Loss`: cross-entropy loss if `labels` are given
+//   - `HiddenStates`: optional slice of tensors of length numHiddenLayers with shape (batch size, sequence length, hidden size)
+//   - `Attentions`: optional slice of tensors of length numHiddenLayers with shape (batch size, num heads, sequence length, sequence length)
+func (nsp *BertForNextSentencePrediction) ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, labels *ts.Tensor, train bool) (*ModelOutput, error) {
+	output, err := nsp.bert.ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, ts.None, ts.None, train)
+	if err != nil {
+		return nil, err
+	}
+
+	output.Logits = nsp.cls.Forward(output.PooledOutput)
+	output.DropBase()
+
+	if hasLabels(labels) {
+		output.Loss = CrossEntropyLoss(output.Logits, labels, IgnoreIndex)
+	}
+
+	return output, nil
+}
+
+// BertForPreTraining:
+// ===================
+
+// BertForPreTraining is BERT with both pretraining heads: masked language modeling
+// (`cls.predictions`) and next sentence prediction (`cls.seq_relationship`).
+//
+// It is made of the following blocks:
+//   - `bert`: Base BertModel
+//   - `predictions`: masked language modeling head
+//   - `seqRelationship`: next sentence prediction head
+type BertForPreTraining struct {
+	bert            *BertModel
+	predictions     *BertLMPredictionHead
+	seqRelationship *BertOnlyNSPHead
+}
+
+// NewBertForPreTraining creates BertForPreTraining.
+func NewBertForPreTraining(p *nn.Path, config *BertConfig, changeNameOpt ...bool) (*BertForPreTraining, error) {
+	changeName := true
+	if len(changeNameOpt) > 0 {
+		changeName = changeNameOpt[0]
+	}
+	bert := NewBertModel(p.Sub("bert"), config, changeName)
+	predictions, err := NewBertLMPredictionHead(p.Sub("cls"), config)
+	if err != nil {
+		return nil, err
+	}
+	seqRelationship := NewBertOnlyNSPHead(p.Sub("cls"), config)
+
+	return &BertForPreTraining{bert, predictions, seqRelationship}, nil
+}
+
+// Load loads model from file or model name. It also updates
+// default configuration parameters if provided.
+// This method implements `PretrainedModel` interface.
+func (pt *BertForPreTraining) Load(modelNameOrPath string, config interface{ pretrained.Config }, params map[string]interface{}, device gotch.Device) error {
+	vs := nn.NewVarStore(device)
+	p := vs.Root()
+	var err error
+	util.WithDType(config.(*BertConfig).ModelDType(), func() {
+		pt.bert = NewBertModel(p.Sub("bert"), config.(*BertConfig))
+		pt.predictions, err = NewBertLMPredictionHead(p.Sub("cls"), config.(*BertConfig))
+		pt.seqRelationship = NewBertOnlyNSPHead(p.Sub("cls"), config.(*BertConfig))
+	})
+	if err != nil {
+		return err
+	}
+
+	err = pickle.LoadAll(vs, modelNameOrPath)
+	if err != nil {
+		log.Fatalf("Load model weight error: \n%v", err)
+	}
+
+	return nil
+}
+
+// ForwardT forwards pass through the model.
+//
+// Params:
+//   - `inputIds`: optional input tensor of shape (batch size, sequence length).
+//     If None, pre-computed embeddings must be provided (see `inputEmbeds`)
+//   - `mask`: optional mask of shape (batch size, sequence length).
+//     Masked position have value 0, non-masked value 1. If None set to 1.
+//     With sliding window attention (`AttentionWindow`), global tokens have value 2.
+//   - `tokenTypeIds`: optional segment id of shape (batch size, sequence length).
+//     Convention is value of 0 for the first sentence (incl. [SEP]) and 1 for the second sentence. If None set to 0.
+//   - `positionIds`: optional position ids of shape (batch size, sequence length).
+//     If None, will be incremented from 0.
+//   - `inputEmbeds`: optional pre-computed input embeddings of shape (batch size, sequence length, hidden size).
+//     If None, input ids must be provided (see `inputIds`).
+//   - `labels`: optional token ids of shape (batch size, sequence length) to compute masked language modeling loss.
+//     Positions with value -100 (non-masked tokens) are ignored.
+//   - `nextSentenceLabels`: optional labels of shape (batch size) to compute next sentence prediction loss:
+//     0 if sentence B follows sentence A, 1 if sentence B is random.
+//   - `train`: boolean flag to turn on/off the dropout layers in the model. Should be set to false for inference.
+//
+// Returns model output with:
+//   - `Logits`: masked language modeling scores of shape (batch size, sequence length, vocab size)
+//   - `SeqRelationshipLogits`: next sentence scores of shape (batch size, 2)
+//   - `Loss`: sum of masked language modeling and next sentence prediction losses of given labels
+//   - `HiddenStates`: optional slice of tensors of length numHiddenLayers with shape (batch size, sequence length, hidden size)
+//   - `Attentions`: optional slice of tensors of length numHiddenLayers with shape (batch size, num heads, sequence length, sequence length)
+func (pt *BertForPreTraining) ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, labels, nextSentenceLabels *ts.Tensor, train bool) (*ModelOutput, error) {
+	output, err := pt.bert.ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, ts.None, ts.None, train)
+	if err != nil {
+		return nil, err
+	}
+
+	output.Logits = pt.predictions.Forward(output.LastHiddenState)
+	output.SeqRelationshipLogits = pt.seqRelationship.Forward(output.PooledOutput)
+	output.DropBase()
+
+	switch {
+	case hasLabels(labels) && hasLabels(nextSentenceLabels):
+		mlmLoss := CrossEntropyLoss(output.Logits, labels, IgnoreIndex)
+		nspLoss := CrossEntropyLoss(output.SeqRelationshipLogits, nextSentenceLabels, IgnoreIndex)
+		output.Loss = mlmLoss.MustAdd(nspLoss, true)
+		nspLoss.MustDrop()
+	case hasLabels(labels):
+		output.Loss = CrossEntropyLoss(output.Logits, labels, IgnoreIndex)
+	case hasLabels(nextSentenceLabels):
+		output.Loss = CrossEntropyLoss(output.SeqRelationshipLogits, nextSentenceLabels, IgnoreIndex)
+	}
+
+	return output, nil
 }
 
 // BERT for sequence classification:
@@ -340,9 +652,10 @@ func (mlm *BertForMaskedLM) ForwardT(inputIds, mask, tokenTypeIds, positionIds,
 //   - `bert`: Base BertModel
 //   - `classifier`: BERT linear layer for classification
 type BertForSequenceClassification struct {
-	bert       *BertModel
-	dropout    *util.Dropout
-	classifier *nn.Linear
+	bert        *BertModel
+	dropout     *util.Dropout
+	classifier  *nn.Linear
+	problemType string
 }
 
 // NewBertForSequenceClassification creates a new `BertForSequenceClassification`.
@@ -370,9 +683,10 @@ func NewBertForSequenceClassification(p *nn.Path, config *BertConfig, changeName
 	classifier := nn.NewLinear(p.Sub("classifier"), config.HiddenSize, int64(numLabels), nn.DefaultLinearConfig())
 
 	return &BertForSequenceClassification{
-		bert:       bert,
-		dropout:    dropout,
-		classifier: classifier,
+		bert:        bert,
+		dropout:     dropout,
+		classifier:  classifier,
+		problemType: config.ProblemType,
 	}
 }
 
@@ -383,6 +697,7 @@ func NewBertForSequenceClassification(p *nn.Path, config *BertConfig, changeName
 //     If None, pre-computed embeddings must be provided (see `inputEmbeds`)
 //   - `mask`: optional mask of shape (batch size, sequence length).
 //     Masked position have value 0, non-masked value 1. If None set to 1.
+//     With sliding window attention (`AttentionWindow`), global tokens have value 2.
 //   - `tokenTypeIds`: optional segment id of shape (batch size, sequence length).
 //     Convention is value of 0 for the first sentence (incl. [SEP]) and 1 for the second sentence. If None set to 0.
 //   - `positionIds`: optional position ids of shape (batch size, sequence length).
@@ -395,26 +710,38 @@ func NewBertForSequenceClassification(p *nn.Path, config *BertConfig, changeName
 //   - `encoderMask`: optional encoder attention mask of shape (batch size, encoder sequence length).
 //     If the model is defined as a decoder and the `encoderHiddenStates` is not None, used to mask encoder values.
 //     Positions with value 0 will be masked.
+//   - `labels`: optional labels to compute loss: class ids of shape (batch size), float targets of shape
+//     (batch size) for regression (one label) or multi-hot labels of shape (batch size, num labels).
+//     See `SequenceClassificationLoss`.
 //   - `train`: boolean flag to turn on/off the dropout layers in the model. Should be set to false for inference.
 //
-// Returns:
-//   - `output`: tensor of shape (batch size, sequence length, hidden size)
-//   - `pooledOutput`: tensor of shape (batch size, hidden size)
-//   - `hiddenStates`: slice of tensors of length numHiddenLayers with shape (batch size, sequenceLength, hiddenSize)
-//   - `attentions`: slice of tensors of length numHiddenLayers with shape (batch size, sequenceLength, hiddenSize)
-func (bsc *BertForSequenceClassification) ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds *ts.Tensor, train bool) (retVal *ts.Tensor, retValOpt1, retValOpt2 []ts.Tensor) {
-	_, pooledOutput, allHiddenStates, allAttentions, err := bsc.bert.ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, ts.None, ts.None, train)
-
+// Returns model output with:
+//   - `Logits`: tensor of shape (batch size, num labels)
+//   - `Loss`: loss if `labels` are given
+//   - `HiddenStates`: optional slice of tensors of length numHiddenLayers with shape (batch size, sequence length, hidden size)
+//   - `Attentions`: optional slice of tensors of length numHiddenLayers with shape (batch size, num heads, sequence length, sequence length)
+func (bsc *BertForSequenceClassification) ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, labels *ts.Tensor, train bool) (*ModelOutput, error) {
+	output, err := bsc.bert.ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, ts.None, ts.None, train)
 	if err != nil {
-		log.Fatalf("call bert.ForwardT error: %v", err)
+		return nil, err
 	}
 
-	dropoutOutput := pooledOutput.ApplyT(bsc.dropout, train)
+	s := util.NewScope()
+	defer s.Close()
+
+	dropoutOutput := s.Track(output.PooledOutput.ApplyT(bsc.dropout, train))
+	output.Logits = dropoutOutput.Apply(bsc.classifier)
+	output.DropBase()
 
-	output := dropoutOutput.Apply(bsc.classifier)
-	dropoutOutput.MustDrop()
+	if hasLabels(labels) {
+		output.Loss, err = SequenceClassificationLoss(output.Logits, labels, bsc.problemType)
+		if err != nil {
+			output.Drop()
+			return nil, err
+		}
+	}
 
-	return output, allHiddenStates, allAttentions
+	return output, nil
 }
 
 // BERT for multiple choices :
@@ -461,54 +788,61 @@ func NewBertForMultipleChoice(p *nn.Path, config *BertConfig, changeNameOpt ...b
 //     If None, pre-computed embeddings must be provided (see `inputEmbeds`)
 //   - `mask`: optional mask of shape (batch size, sequence length).
 //     Masked position have value 0, non-masked value 1. If None set to 1.
+//     With sliding window attention (`AttentionWindow`), global tokens have value 2.
 //   - `tokenTypeIds`: optional segment id of shape (batch size, sequence length).
 //     Convention is value of 0 for the first sentence (incl. [SEP]) and 1 for the second sentence. If None set to 0.
 //   - `positionIds`: optional position ids of shape (batch size, sequence length).
 //     If None, will be incremented from 0.
+//   - `labels`: optional index of the correct choice of shape (batch size) to compute cross-entropy loss.
 //   - `train`: boolean flag to turn on/off the dropout layers in the model. Should be set to false for inference.
 //
-// Returns:
-//   - `output`: tensor of shape (batch size, sequence length, hidden size)
-//   - `hiddenStates`: slice of tensors of length numHiddenLayers with shape (batch size, sequenceLength, hiddenSize)
-//   - `attentions`: slice of tensors of length numHiddenLayers with shape (batch size, sequenceLength, hiddenSize)
-func (mc *BertForMultipleChoice) ForwardT(inputIds, mask, tokenTypeIds, positionIds *ts.Tensor, train bool) (retVal *ts.Tensor, retValOpt1, retValOpt2 []ts.Tensor) {
+// Returns model output with:
+//   - `Logits`: tensor of shape (batch size, num choices)
+//   - `Loss`: cross-entropy loss if `labels` are given
+//   - `HiddenStates`: optional slice of tensors of length numHiddenLayers with shape (batch size * num choices, sequence length, hidden size)
+//   - `Attentions`: optional slice of tensors of length numHiddenLayers with shape (batch size * num choices, num heads, sequence length, sequence length)
+func (mc *BertForMultipleChoice) ForwardT(inputIds, mask, tokenTypeIds, positionIds, labels *ts.Tensor, train bool) (*ModelOutput, error) {
+	s := util.NewScope()
+	defer s.Close()
+
 	inputIdsSize := inputIds.MustSize()
-	fmt.Printf("inputIdsSize: %v\n", inputIdsSize)
 	numChoices := inputIdsSize[1]
-	inputIdsView := inputIds.MustView([]int64{-1, inputIdsSize[len(inputIdsSize)-1]}, false)
+	inputIdsView := s.Track(inputIds.MustView([]int64{-1, inputIdsSize[len(inputIdsSize)-1]}, false))
 
 	maskView := ts.None
 	if mask.MustDefined() {
 		maskSize := mask.MustSize()
-		maskView = mask.MustView([]int64{-1, maskSize[len(maskSize)-1]}, false)
+		maskView = s.Track(mask.MustView([]int64{-1, maskSize[len(maskSize)-1]}, false))
 	}
 
 	tokenTypeIdsView := ts.None
 	if tokenTypeIds.MustDefined() {
 		tokenTypeIdsSize := tokenTypeIds.MustSize()
-		tokenTypeIdsView = tokenTypeIds.MustView([]int64{-1, tokenTypeIdsSize[len(tokenTypeIdsSize)-1]}, false)
+		tokenTypeIdsView = s.Track(tokenTypeIds.MustView([]int64{-1, tokenTypeIdsSize[len(tokenTypeIdsSize)-1]}, false))
 	}
 
 	positionIdsView := ts.None
 	if positionIds.MustDefined() {
 		positionIdsSize := positionIds.MustSize()
-		positionIdsView = positionIds.MustView([]int64{-1, positionIdsSize[len(positionIdsSize)-1]}, false)
+		positionIdsView = s.Track(positionIds.MustView([]int64{-1, positionIdsSize[len(positionIdsSize)-1]}, false))
 	}
 
-	_, pooledOutput, allHiddenStates, allAttentions, err := mc.bert.ForwardT(inputIdsView, maskView, tokenTypeIdsView, positionIdsView, ts.None, ts.None, ts.None, train)
+	output, err := mc.bert.ForwardT(inputIdsView, maskView, tokenTypeIdsView, positionIdsView, ts.None, ts.None, ts.None, train)
 	if err != nil {
-		log.Fatalf("Call 'BertForMultipleChoice ForwordT' method error: %v\n", err)
+		return nil, err
 	}
 
-	outputDropout := pooledOutput.ApplyT(mc.dropout, train)
-	outputClassifier := outputDropout.Apply(mc.classifier)
+	outputDropout := s.Track(output.PooledOutput.ApplyT(mc.dropout, train))
+	outputClassifier := s.Track(outputDropout.Apply(mc.classifier))
 
-	output := outputClassifier.MustView([]int64{-1, numChoices}, false)
+	output.Logits = outputClassifier.MustView([]int64{-1, numChoices}, false)
+	output.DropBase()
 
-	outputDropout.MustDrop()
-	outputClassifier.MustDrop()
+	if hasLabels(labels) {
+		output.Loss = CrossEntropyLoss(output.Logits, labels, IgnoreIndex)
+	}
 
-	return output, allHiddenStates, allAttentions
+	return output, nil
 }
 
 // BERT for token classification (e.g., NER, POS):
@@ -556,31 +890,41 @@ func NewBertForTokenClassification(p *nn.Path, config *BertConfig, changeNameOpt
 //     If None, pre-computed embeddings must be provided (see `inputEmbeds`)
 //   - `mask`: optional mask of shape (batch size, sequence length).
 //     Masked position have value 0, non-masked value 1. If None set to 1.
+//     With sliding window attention (`AttentionWindow`), global tokens have value 2.
 //   - `tokenTypeIds`: optional segment id of shape (batch size, sequence length).
 //     Convention is value of 0 for the first sentence (incl. [SEP]) and 1 for the second sentence. If None set to 0.
 //   - `positionIds`: optional position ids of shape (batch size, sequence length).
 //     If None, will be incremented from 0.
 //   - `inputEmbeds`: optional pre-computed input embeddings of shape (batch size, sequence length, hidden size).
 //     If None, input ids must be provided (see `inputIds`).
+//   - `labels`: optional label ids of shape (batch size, sequence length) to compute cross-entropy loss.
+//     Positions with value -100 (e.g. special tokens and sub-words) are ignored.
 //   - `train`: boolean flag to turn on/off the dropout layers in the model. Should be set to false for inference.
 //
-// Returns:
-//   - `output`: tensor of shape (batch size, sequence length, hidden size)
-//   - `hiddenStates`: slice of tensors of length numHiddenLayers with shape (batch size, sequenceLength, hiddenSize)
-//   - `attentions`: slice of tensors of length numHiddenLayers with shape (batch size, sequenceLength, hiddenSize)
-func (tc *BertForTokenClassification) ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds *ts.Tensor, train bool) (retVal *ts.Tensor, retValOpt1, retValOpt2 []ts.Tensor) {
-
-	hiddenState, _, allHiddenStates, allAttentions, err := tc.bert.ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, ts.None, ts.None, train)
+// Returns model output with:
+//   - `Logits`: tensor of shape (batch size, sequence length, num labels)
+//   - `Loss`: cross-entropy loss if `labels` are given
+//   - `HiddenStates`: optional slice of tensors of length numHiddenLayers with shape (batch size, sequence length, hidden size)
+//   - `Attentions`: optional slice of tensors of length numHiddenLayers with shape (batch size, num heads, sequence length, sequence length)
+func (tc *BertForTokenClassification) ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, labels *ts.Tensor, train bool) (*ModelOutput, error) {
+
+	output, err := tc.bert.ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, ts.None, ts.None, train)
 	if err != nil {
-		log.Fatalf("Call 'BertForTokenClassification ForwardT' method error: %v\n", err)
+		return nil, err
 	}
 
-	outputDropout := hiddenState.ApplyT(tc.dropout, train)
-	output := outputDropout.Apply(tc.classifier)
+	s := util.NewScope()
+	defer s.Close()
+
+	outputDropout := s.Track(output.LastHiddenState.ApplyT(tc.dropout, train))
+	output.Logits = outputDropout.Apply(tc.classifier)
+	output.DropBase()
 
-	outputDropout.MustDrop()
+	if hasLabels(labels) {
+		output.Loss = CrossEntropyLoss(output.Logits, labels, IgnoreIndex)
+	}
 
-	return output, allHiddenStates, allAttentions
+	return output, nil
 }
 
 // BERT for question answering:
@@ -627,29 +971,43 @@ func NewForBertQuestionAnswering(p *nn.Path, config *BertConfig, changeNameOpt .
 //     If None, pre-computed embeddings must be provided (see `inputEmbeds`)
 //   - `mask`: optional mask of shape (batch size, sequence length).
 //     Masked position have value 0, non-masked value 1. If None set to 1.
+//     With sliding window attention (`AttentionWindow`), global tokens have value 2.
 //   - `tokenTypeIds`: optional segment id of shape (batch size, sequence length).
 //     Convention is value of 0 for the first sentence (incl. [SEP]) and 1 for the second sentence. If None set to 0.
 //   - `positionIds`: optional position ids of shape (batch size, sequence length).
 //     If None, will be incremented from 0.
 //   - `inputEmbeds`: optional pre-computed input embeddings of shape (batch size, sequence length, hidden size).
 //     If None, input ids must be provided (see `inputIds`).
+//   - `startPositions`, `endPositions`: optional token positions of answer spans of shape (batch size)
+//     to compute loss. Positions out of sequence are ignored.
 //   - `train`: boolean flag to turn on/off the dropout layers in the model. Should be set to false for inference.
 //
-// Returns:
-//   - `output`: tensor of shape (batch size, sequence length, hidden size)
-//   - `hiddenStates`: slice of tensors of length numHiddenLayers with shape (batch size, sequenceLength, hiddenSize)
-//   - `attentions`: slice of tensors of length numHiddenLayers with shape (batch size, sequenceLength, hiddenSize)
-func (qa *BertForQuestionAnswering) ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds *ts.Tensor, train bool) (retVal1, retVal2 *ts.Tensor, retValOpt1, retValOpt2 []ts.Tensor) {
-
-	hiddenState, _, allHiddenStates, allAttentions, err := qa.bert.ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, ts.None, ts.None, train)
+// Returns model output with:
+//   - `StartLogits`: start scores of shape (batch size, sequence length)
+//   - `EndLogits`: end scores of shape (batch size, sequence length)
+//   - `Loss`: mean of start and end cross-entropy if positions are given
+//   - `HiddenStates`: optional slice of tensors of length numHiddenLayers with shape (batch size, sequence length, hidden size)
+//   - `Attentions`: optional slice of tensors of length numHiddenLayers with shape (batch size, num heads, sequence length, sequence length)
+func (qa *BertForQuestionAnswering) ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, startPositions, endPositions *ts.Tensor, train bool) (*ModelOutput, error) {
+
+	output, err := qa.bert.ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, ts.None, ts.None, train)
 	if err != nil {
-		log.Fatalf("Call 'BertForTokenClassification ForwardT' method error: %v\n", err)
+		return nil, err
 	}
 
-	sequenceOutput := hiddenState.Apply(qa.qaOutputs)
+	s := util.NewScope()
+	defer s.Close()
+
+	sequenceOutput := s.Track(output.LastHiddenState.Apply(qa.qaOutputs))
 	logits := sequenceOutput.MustSplit(1, -1, false) // -1 : split along last size
-	startLogits := logits[0].MustSqueezeDim(int64(-1), false)
-	endLogits := logits[1].MustSqueezeDim(int64(-1), false)
+	s.TrackAll(logits...)
+	output.StartLogits = logits[0].MustSqueezeDim(int64(-1), false)
+	output.EndLogits = logits[1].MustSqueezeDim(int64(-1), false)
+	output.DropBase()
+
+	if hasLabels(startPositions) && hasLabels(endPositions) {
+		output.Loss = QuestionAnsweringLoss(output.StartLogits, output.EndLogits, startPositions, endPositions)
+	}
 
-	return startLogits, endLogits, allHiddenStates, allAttentions
+	return output, nil
 }
@@ -3,6 +3,7 @@ package bert_test
 import (
 	"fmt"
 	"log"
+	"math"
 	"reflect"
 	"testing"
 
@@ -110,25 +111,29 @@ func TestBertForMaskedLM(t *testing.T) {
 		}
 	}
 
-	var tensors []ts.Tensor
+	var tensors []*ts.Tensor
 	for _, en := range encodings {
 		var tokInput []int64 = make([]int64, maxLen)
 		for i := 0; i < len(en.Ids); i++ {
 			tokInput[i] = int64(en.Ids[i])
 		}
 
-		tensors = append(tensors, *ts.TensorFrom(tokInput))
+		tensors = append(tensors, ts.TensorFrom(tokInput))
 	}
 
 	inputTensor := ts.MustStack(tensors, 0).MustTo(device, true)
 
-	var output *ts.Tensor
+	var output *bert.ModelOutput
 	ts.NoGrad(func() {
-		output, _, _ = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, ts.None, ts.None, false)
+		output, err = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, ts.None, ts.None, ts.None, false)
 	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer output.Drop()
 
-	index1 := output.MustGet(0).MustGet(4).MustArgmax([]int64{0}, false, false).Int64Values()[0]
-	index2 := output.MustGet(1).MustGet(7).MustArgmax([]int64{0}, false, false).Int64Values()[0]
+	index1 := output.Logits.MustGet(0).MustGet(4).MustArgmax([]int64{0}, false, false).Int64Values()[0]
+	index2 := output.Logits.MustGet(1).MustGet(7).MustArgmax([]int64{0}, false, false).Int64Values()[0]
 
 	got1, ok := tk.IdToToken(int(index1))
 	if !ok {
@@ -198,29 +203,30 @@ func TestBertForSequenceClassification(t *testing.T) {
 		}
 	}
 
-	var tensors []ts.Tensor
+	var tensors []*ts.Tensor
 	for _, en := range encodings {
 		var tokInput []int64 = make([]int64, maxLen)
 		for i := 0; i < len(en.Ids); i++ {
 			tokInput[i] = int64(en.Ids[i])
 		}
 
-		tensors = append(tensors, *ts.TensorFrom(tokInput))
+		tensors = append(tensors, ts.TensorFrom(tokInput))
 	}
 
 	inputTensor := ts.MustStack(tensors, 0).MustTo(device, true)
 
-	var (
-		output                         *ts.Tensor
-		allHiddenStates, allAttentions []ts.Tensor
-	)
+	var output *bert.ModelOutput
 
 	ts.NoGrad(func() {
-		output, allHiddenStates, allAttentions = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, false)
+		output, err = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, ts.None, false)
 	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer output.Drop()
 
-	fmt.Printf("output size: %v\n", output.MustSize())
-	gotOuputSize := output.MustSize()
+	fmt.Printf("output size: %v\n", output.Logits.MustSize())
+	gotOuputSize := output.Logits.MustSize()
 	wantOuputSize := []int64{2, 3}
 	if !reflect.DeepEqual(wantOuputSize, gotOuputSize) {
 		t.Errorf("Want: %v\n", wantOuputSize)
@@ -229,14 +235,14 @@ func TestBertForSequenceClassification(t *testing.T) {
 
 	numHiddenLayers := int(config.NumHiddenLayers)
 
-	if !reflect.DeepEqual(numHiddenLayers, len(allHiddenStates)) {
+	if !reflect.DeepEqual(numHiddenLayers, len(output.HiddenStates)) {
 		t.Errorf("Want num of allHiddenStates: %v\n", numHiddenLayers)
-		t.Errorf("Got num of allHiddenStates: %v\n", len(allHiddenStates))
+		t.Errorf("Got num of allHiddenStates: %v\n", len(output.HiddenStates))
 	}
 
-	if !reflect.DeepEqual(numHiddenLayers, len(allAttentions)) {
+	if !reflect.DeepEqual(numHiddenLayers, len(output.Attentions)) {
 		t.Errorf("Want num of allAttentions: %v\n", numHiddenLayers)
-		t.Errorf("Got num of allAttentions: %v\n", len(allAttentions))
+		t.Errorf("Got num of allAttentions: %v\n", len(output.Attentions))
 	}
 }
 
@@ -279,29 +285,30 @@ func TestBertForMultipleChoice(t *testing.T) {
 		}
 	}
 
-	var tensors []ts.Tensor
+	var tensors []*ts.Tensor
 	for _, en := range encodings {
 		var tokInput []int64 = make([]int64, maxLen)
 		for i := 0; i < len(en.Ids); i++ {
 			tokInput[i] = int64(en.Ids[i])
 		}
 
-		tensors = append(tensors, *ts.TensorFrom(tokInput))
+		tensors = append(tensors, ts.TensorFrom(tokInput))
 	}
 
 	inputTensor := ts.MustStack(tensors, 0).MustTo(device, true).MustUnsqueeze(0, true)
 
-	var (
-		output                         *ts.Tensor
-		allHiddenStates, allAttentions []ts.Tensor
-	)
+	var output *bert.ModelOutput
 
 	ts.NoGrad(func() {
-		output, allHiddenStates, allAttentions = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, false)
+		output, err = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, false)
 	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer output.Drop()
 
-	fmt.Printf("output size: %v\n", output.MustSize())
-	gotOuputSize := output.MustSize()
+	fmt.Printf("output size: %v\n", output.Logits.MustSize())
+	gotOuputSize := output.Logits.MustSize()
 	wantOuputSize := []int64{1, 2}
 	if !reflect.DeepEqual(wantOuputSize, gotOuputSize) {
 		t.Errorf("Want: %v\n", wantOuputSize)
@@ -310,14 +317,14 @@ func TestBertForMultipleChoice(t *testing.T) {
 
 	numHiddenLayers := int(config.NumHiddenLayers)
 
-	if !reflect.DeepEqual(numHiddenLayers, len(allHiddenStates)) {
+	if !reflect.DeepEqual(numHiddenLayers, len(output.HiddenStates)) {
 		t.Errorf("Want num of allHiddenStates: %v\n", numHiddenLayers)
-		t.Errorf("Got num of allHiddenStates: %v\n", len(allHiddenStates))
+		t.Errorf("Got num of allHiddenStates: %v\n", len(output.HiddenStates))
 	}
 
-	if !reflect.DeepEqual(numHiddenLayers, len(allAttentions)) {
+	if !reflect.DeepEqual(numHiddenLayers, len(output.Attentions)) {
 		t.Errorf("Want num of allAttentions: %v\n", numHiddenLayers)
-		t.Errorf("Got num of allAttentions: %v\n", len(allAttentions))
+		t.Errorf("Got num of allAttentions: %v\n", len(output.Attentions))
 	}
 }
 
@@ -367,29 +374,30 @@ func TestBertForTokenClassification(t *testing.T) {
 		}
 	}
 
-	var tensors []ts.Tensor
+	var tensors []*ts.Tensor
 	for _, en := range encodings {
 		var tokInput []int64 = make([]int64, maxLen)
 		for i := 0; i < len(en.Ids); i++ {
 			tokInput[i] = int64(en.Ids[i])
 		}
 
-		tensors = append(tensors, *ts.TensorFrom(tokInput))
+		tensors = append(tensors, ts.TensorFrom(tokInput))
 	}
 
 	inputTensor := ts.MustStack(tensors, 0).MustTo(device, true)
 
-	var (
-		output                         *ts.Tensor
-		allHiddenStates, allAttentions []ts.Tensor
-	)
+	var output *bert.ModelOutput
 
 	ts.NoGrad(func() {
-		output, allHiddenStates, allAttentions = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, false)
+		output, err = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, ts.None, false)
 	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer output.Drop()
 
-	fmt.Printf("output size: %v\n", output.MustSize())
-	gotOuputSize := output.MustSize()
+	fmt.Printf("output size: %v\n", output.Logits.MustSize())
+	gotOuputSize := output.Logits.MustSize()
 	wantOuputSize := []int64{2, 11, 4}
 	if !reflect.DeepEqual(wantOuputSize, gotOuputSize) {
 		t.Errorf("Want: %v\n", wantOuputSize)
@@ -398,14 +406,14 @@ func TestBertForTokenClassification(t *testing.T) {
 
 	numHiddenLayers := int(config.NumHiddenLayers)
 
-	if !reflect.DeepEqual(numHiddenLayers, len(allHiddenStates)) {
+	if !reflect.DeepEqual(numHiddenLayers, len(output.HiddenStates)) {
 		t.Errorf("Want num of allHiddenStates: %v\n", numHiddenLayers)
-		t.Errorf("Got num of allHiddenStates: %v\n", len(allHiddenStates))
+		t.Errorf("Got num of allHiddenStates: %v\n", len(output.HiddenStates))
 	}
 
-	if !reflect.DeepEqual(numHiddenLayers, len(allAttentions)) {
+	if !reflect.DeepEqual(numHiddenLayers, len(output.Attentions)) {
 		t.Errorf("Want num of allAttentions: %v\n", numHiddenLayers)
-		t.Errorf("Got num of allAttentions: %v\n", len(allAttentions))
+		t.Errorf("Got num of allAttentions: %v\n", len(output.Attentions))
 	}
 }
 
@@ -448,35 +456,36 @@ func TestBertForQuestionAnswering(t *testing.T) {
 		}
 	}
 
-	var tensors []ts.Tensor
+	var tensors []*ts.Tensor
 	for _, en := range encodings {
 		var tokInput []int64 = make([]int64, maxLen)
 		for i := 0; i < len(en.Ids); i++ {
 			tokInput[i] = int64(en.Ids[i])
 		}
 
-		tensors = append(tensors, *ts.TensorFrom(tokInput))
+		tensors = append(tensors, ts.TensorFrom(tokInput))
 	}
 
 	inputTensor := ts.MustStack(tensors, 0).MustTo(device, true)
 
-	var (
-		startScores, endScores         *ts.Tensor
-		allHiddenStates, allAttentions []ts.Tensor
-	)
+	var output *bert.ModelOutput
 
 	ts.NoGrad(func() {
-		startScores, endScores, allHiddenStates, allAttentions = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, false)
+		output, err = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, ts.None, ts.None, false)
 	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer output.Drop()
 
-	gotStartScoresSize := startScores.MustSize()
+	gotStartScoresSize := output.StartLogits.MustSize()
 	wantStartScoresSize := []int64{2, 11}
 	if !reflect.DeepEqual(wantStartScoresSize, gotStartScoresSize) {
 		t.Errorf("Want: %v\n", wantStartScoresSize)
 		t.Errorf("Got: %v\n", gotStartScoresSize)
 	}
 
-	gotEndScoresSize := endScores.MustSize()
+	gotEndScoresSize := output.EndLogits.MustSize()
 	wantEndScoresSize := []int64{2, 11}
 	if !reflect.DeepEqual(wantEndScoresSize, gotEndScoresSize) {
 		t.Errorf("Want: %v\n", wantEndScoresSize)
@@ -485,13 +494,204 @@ func TestBertForQuestionAnswering(t *testing.T) {
 
 	numHiddenLayers := int(config.NumHiddenLayers)
 
-	if !reflect.DeepEqual(numHiddenLayers, len(allHiddenStates)) {
+	if !reflect.DeepEqual(numHiddenLayers, len(output.HiddenStates)) {
 		t.Errorf("Want num of allHiddenStates: %v\n", numHiddenLayers)
-		t.Errorf("Got num of allHiddenStates: %v\n", len(allHiddenStates))
+		t.Errorf("Got num of allHiddenStates: %v\n", len(output.HiddenStates))
 	}
 
-	if !reflect.DeepEqual(numHiddenLayers, len(allAttentions)) {
+	if !reflect.DeepEqual(numHiddenLayers, len(output.Attentions)) {
 		t.Errorf("Want num of allAttentions: %v\n", numHiddenLayers)
-		t.Errorf("Got num of allAttentions: %v\n", len(allAttentions))
+		t.Errorf("Got num of allAttentions: %v\n", len(output.Attentions))
+	}
+}
+
+func TestBertForPreTraining(t *testing.T) {
+	config := bert.NewConfig(map[string]interface{}{
+		"VocabSize":         int64(20),
+		"HiddenSize":        int64(8),
+		"NumHiddenLayers":   int64(1),
+		"NumAttentionHeads": int64(2),
+		"IntermediateSize":  int64(16),
+	})
+
+	vs := nn.NewVarStore(gotch.CPU)
+	model, err := bert.NewBertForPreTraining(vs.Root(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both heads are loaded from `cls` weights of pretrained checkpoints.
+	variables := vs.Variables()
+	for _, name := range []string{"cls.predictions.bias", "cls.predictions.decoder.weight", "cls.seq_relationship.weight", "cls.seq_relationship.bias"} {
+		if _, ok := variables[name]; !ok {
+			t.Errorf("Want variable %q\n", name)
+		}
+	}
+
+	inputIds := ts.MustOfSlice([]int64{1, 5, 6, 2, 7, 8, 2, 1, 9, 2, 10, 2, 0, 0}).MustView([]int64{2, 7}, true)
+	labels := ts.MustOfSlice([]int64{-100, 11, -100, -100, -100, 12, -100, -100, -100, -100, 13, -100, -100, -100}).MustView([]int64{2, 7}, true)
+	nextSentenceLabels := ts.MustOfSlice([]int64{0, 1})
+
+	var output *bert.ModelOutput
+	ts.NoGrad(func() {
+		output, err = model.ForwardT(inputIds, ts.None, ts.None, ts.None, ts.None, labels, nextSentenceLabels, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantLogits := []int64{2, 7, 20}
+	if got := output.Logits.MustSize(); !reflect.DeepEqual(wantLogits, got) {
+		t.Errorf("Want MLM logits shape: %v\n", wantLogits)
+		t.Errorf("Got MLM logits shape: %v\n", got)
+	}
+	wantNSP := []int64{2, 2}
+	if got := output.SeqRelationshipLogits.MustSize(); !reflect.DeepEqual(wantNSP, got) {
+		t.Errorf("Want NSP logits shape: %v\n", wantNSP)
+		t.Errorf("Got NSP logits shape: %v\n", got)
+	}
+
+	// Loss is the sum of MLM loss over labeled tokens and NSP loss.
+	logits := output.Logits.Float64Values()
+	nsp := output.SeqRelationshipLogits.Float64Values()
+	mlmLoss := -(logSoftmax(logits[1*20 : 2*20])[11] + logSoftmax(logits[5*20 : 6*20])[12] + logSoftmax(logits[10*20 : 11*20])[13]) / 3
+	nspLoss := -(logSoftmax(nsp[0:2])[0] + logSoftmax(nsp[2:4])[1]) / 2
+	want := mlmLoss + nspLoss
+	if got := output.Loss.Float64Values()[0]; math.Abs(got-want) > 1e-5 {
+		t.Errorf("Want loss: %v\n", want)
+		t.Errorf("Got loss: %v\n", got)
 	}
+	output.Drop()
+
+	inputIds.MustDrop()
+	labels.MustDrop()
+	nextSentenceLabels.MustDrop()
+}
+
+func TestBertForNextSentencePrediction(t *testing.T) {
+	config := bert.NewConfig(map[string]interface{}{
+		"VocabSize":         int64(20),
+		"HiddenSize":        int64(8),
+		"NumHiddenLayers":   int64(1),
+		"NumAttentionHeads": int64(2),
+		"IntermediateSize":  int64(16),
+	})
+
+	vs := nn.NewVarStore(gotch.CPU)
+	model := bert.NewBertForNextSentencePrediction(vs.Root(), config)
+
+	inputIds := ts.MustOfSlice([]int64{1, 5, 2, 6, 7, 2}).MustView([]int64{1, 6}, true)
+	tokenTypeIds := ts.MustOfSlice([]int64{0, 0, 0, 1, 1, 1}).MustView([]int64{1, 6}, true)
+	labels := ts.MustOfSlice([]int64{1})
+
+	var (
+		output *bert.ModelOutput
+		err    error
+	)
+	ts.NoGrad(func() {
+		output, err = model.ForwardT(inputIds, ts.None, tokenTypeIds, ts.None, ts.None, labels, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logits := output.Logits.Float64Values()
+	if len(logits) != 2 {
+		t.Fatalf("Want 2 NSP scores, got %v\n", len(logits))
+	}
+	want := -logSoftmax(logits)[1]
+	if got := output.Loss.Float64Values()[0]; math.Abs(got-want) > 1e-5 {
+		t.Errorf("Want loss: %v\n", want)
+		t.Errorf("Got loss: %v\n", got)
+	}
+	output.Drop()
+
+	inputIds.MustDrop()
+	tokenTypeIds.MustDrop()
+	labels.MustDrop()
+}
+
+func TestBertForSequenceClassification_BFloat16(t *testing.T) {
+	config := bert.NewConfig(map[string]interface{}{
+		"VocabSize":         int64(20),
+		"HiddenSize":        int64(8),
+		"NumHiddenLayers":   int64(1),
+		"NumAttentionHeads": int64(2),
+		"IntermediateSize":  int64(16),
+	})
+	config.Id2Label = map[int64]string{0: "negative", 1: "positive"}
+
+	vs := nn.NewVarStore(gotch.CPU)
+	model := bert.NewBertForSequenceClassification(vs.Root(), config)
+
+	var model16 *bert.BertForSequenceClassification
+	vs16, err := util.ConvertVarStore(vs, gotch.BFloat16, func(p *nn.Path) error {
+		model16 = bert.NewBertForSequenceClassification(p, config)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	variables := vs16.Variables()
+	for name, want := range map[string]gotch.DType{
+		"bert.embeddings.word_embeddings.weight":     gotch.BFloat16,
+		"classifier.weight":                          gotch.BFloat16,
+		"bert.embeddings.LayerNorm.gamma":            gotch.Float,
+		"bert.encoder.layer.0.output.LayerNorm.beta": gotch.Float,
+	} {
+		x, ok := variables[name]
+		if !ok {
+			t.Errorf("Want variable %q\n", name)
+			continue
+		}
+		if got := x.DType(); got != want {
+			t.Errorf("Want %v dtype: %v\n", name, want)
+			t.Errorf("Got %v dtype: %v\n", name, got)
+		}
+	}
+
+	inputIds := ts.MustOfSlice([]int64{1, 5, 6, 2, 1, 7, 2, 0}).MustView([]int64{2, 4}, true)
+	mask := ts.MustOfSlice([]int64{1, 1, 1, 1, 1, 1, 1, 0}).MustView([]int64{2, 4}, true)
+	labels := ts.MustOfSlice([]int64{0, 1})
+
+	var output, output16 *bert.ModelOutput
+	ts.NoGrad(func() {
+		output, err = model.ForwardT(inputIds, mask, ts.None, ts.None, ts.None, labels, false)
+		if err != nil {
+			return
+		}
+		output16, err = model16.ForwardT(inputIds, mask, ts.None, ts.None, ts.None, labels, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := output16.Logits.DType(); got != gotch.BFloat16 {
+		t.Errorf("Want logits dtype: %v\n", gotch.BFloat16)
+		t.Errorf("Got logits dtype: %v\n", got)
+	}
+	// Loss is computed in float32.
+	if got := output16.Loss.DType(); got != gotch.Float {
+		t.Errorf("Want loss dtype: %v\n", gotch.Float)
+		t.Errorf("Got loss dtype: %v\n", got)
+	}
+
+	want := output.Logits.Float64Values()
+	logits16 := output16.Logits.MustTotype(gotch.Float, false)
+	got := logits16.Float64Values()
+	logits16.MustDrop()
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 0.05 {
+			t.Errorf("Want logits close to float32 logits: %v\n", want)
+			t.Errorf("Got logits: %v\n", got)
+			break
+		}
+	}
+	output.Drop()
+	output16.Drop()
+
+	inputIds.MustDrop()
+	mask.MustDrop()
+	labels.MustDrop()
 }
@@ -0,0 +1,74 @@
+package bert
+
+import (
+	"github.com/sugarme/gotch/ts"
+)
+
+// ModelOutput holds outputs of BERT models and their task heads.
+//
+// Outputs which are not produced by a model are nil. All tensors are owned by
+// ModelOutput: they are distinct tensors (never aliases of each other), so calling
+// `Drop()` frees all of them exactly once. Callers that need to keep a tensor
+// beyond `Drop()` should take a shallow clone of it.
+//
+// Fields:
+//   - `LastHiddenState`: output of the last layer of shape (batch size, sequence length, hidden size).
+//   - `PooledOutput`: pooler output of shape (batch size, hidden size).
+//   - `HiddenStates`: if `OutputHiddenStates`, input of each encoder layer (the first one being
+//     embedding output) of shape (batch size, sequence length, hidden size).
+//   - `Attentions`: if `OutputAttentions`, attention weights of each encoder layer of shape
+//     (batch size, num attention heads, sequence length, sequence length).
+//   - `Logits`: output of task head, e.g. (batch size, num labels) for sequence classification.
+//   - `SeqRelationshipLogits`: next sentence prediction scores of shape (batch size, 2) of `BertForPreTraining`.
+//   - `StartLogits`, `EndLogits`: question answering scores of shape (batch size, sequence length).
+//   - `Loss`: scalar task loss if labels are given to a task head.
+//
+// Task heads only return their logits, hidden states and attentions. Base model outputs
+// which are not needed by a head (e.g. `LastHiddenState` for classification) are freed.
+type ModelOutput struct {
+	LastHiddenState       *ts.Tensor
+	PooledOutput          *ts.Tensor
+	HiddenStates          []*ts.Tensor
+	Attentions            []*ts.Tensor
+	Logits                *ts.Tensor
+	SeqRelationshipLogits *ts.Tensor
+	StartLogits           *ts.Tensor
+	EndLogits             *ts.Tensor
+	Loss                  *ts.Tensor
+}
+
+// Drop frees all tensors of model output. It is safe to call Drop on nil
+// output or more than once.
+func (o *ModelOutput) Drop() {
+	if o == nil {
+		return
+	}
+
+	for _, x := range []*ts.Tensor{o.LastHiddenState, o.PooledOutput, o.Logits, o.SeqRelationshipLogits, o.StartLogits, o.EndLogits, o.Loss} {
+		dropTensor(x)
+	}
+	for _, x := range o.HiddenStates {
+		dropTensor(x)
+	}
+	for _, x := range o.Attentions {
+		dropTensor(x)
+	}
+
+	*o = ModelOutput{}
+}
+
+// DropBase frees base model outputs (last hidden state and pooled output). It is
+// used by task heads built on top of `BertModel` once their logits are computed.
+func (o *ModelOutput) DropBase() {
+	dropTensor(o.LastHiddenState)
+	dropTensor(o.PooledOutput)
+	o.LastHiddenState = nil
+	o.PooledOutput = nil
+}
+
+// dropTensor drops tensor if it is defined.
+func dropTensor(x *ts.Tensor) {
+	if x != nil && x.MustDefined() {
+		x.MustDrop()
+	}
+}
@@ -0,0 +1,71 @@
+package bert_test
+
+import (
+	"testing"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/nn"
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/bert"
+)
+
+func TestModelOutput(t *testing.T) {
+	config := bert.NewConfig(map[string]interface{}{
+		"VocabSize":         int64(20),
+		"HiddenSize":        int64(8),
+		"NumHiddenLayers":   int64(3),
+		"NumAttentionHeads": int64(2),
+		"IntermediateSize":  int64(16),
+	})
+	config.OutputHiddenStates = true
+	config.OutputAttentions = true
+	config.Id2Label = map[int64]string{0: "O", 1: "B-PER"}
+
+	vs := nn.NewVarStore(gotch.CPU)
+	model := bert.NewBertForTokenClassification(vs.Root(), config, false)
+
+	inputIds := ts.MustOfSlice([]int64{1, 2, 3, 4, 5, 6}).MustView([]int64{2, 3}, true)
+	var (
+		output *bert.ModelOutput
+		err    error
+	)
+	ts.NoGrad(func() {
+		output, err = model.ForwardT(inputIds, ts.None, ts.None, ts.None, ts.None, ts.None, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantLogits := []int64{2, 3, 2}
+	gotLogits := output.Logits.MustSize()
+	if len(gotLogits) != 3 || gotLogits[0] != wantLogits[0] || gotLogits[1] != wantLogits[1] || gotLogits[2] != wantLogits[2] {
+		t.Errorf("Want logits size: %v\n", wantLogits)
+		t.Errorf("Got logits size: %v\n", gotLogits)
+	}
+
+	if len(output.HiddenStates) != 3 || len(output.Attentions) != 3 {
+		t.Errorf("Want 3 hidden states and 3 attentions\n")
+		t.Errorf("Got %v hidden states and %v attentions\n", len(output.HiddenStates), len(output.Attentions))
+	}
+
+	// Hidden states must still be valid after forward pass.
+	for i, x := range output.HiddenStates {
+		size := x.MustSize()
+		if size[0] != 2 || size[1] != 3 || size[2] != 8 {
+			t.Errorf("Hidden state %v - got size: %v\n", i, size)
+		}
+	}
+
+	if output.LastHiddenState != nil || output.PooledOutput != nil {
+		t.Errorf("Want base model outputs freed by task head\n")
+	}
+
+	// Drop can be called more than once.
+	output.Drop()
+	output.Drop()
+	if output.Logits != nil || output.HiddenStates != nil {
+		t.Errorf("Want output reset after Drop\n")
+	}
+	inputIds.MustDrop()
+}
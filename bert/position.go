@@ -0,0 +1,376 @@
+package bert
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/nn"
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/util"
+)
+
+// Position strategies:
+// ====================
+//
+// `PositionEmbeddingType` of config selects how token positions are encoded:
+//   - "absolute": learned position embeddings added to input embeddings (original BERT).
+//     Sequence length is capped by `MaxPositionEmbeddings`.
+//   - "relative_key", "relative_key_query": learned embeddings of query-key distances added
+//     to attention scores (HuggingFace BERT). Distances are capped by `MaxPositionEmbeddings`.
+//   - "rotary": queries and keys rotated by position (RoPE, https://arxiv.org/abs/2104.09864).
+//   - "alibi": attention scores biased by query-key distance (ALiBi, https://arxiv.org/abs/2108.12409).
+//
+// Only "absolute" adds position embeddings in `BertEmbeddings`. Other strategies are applied in
+// self-attention by a `PositionStrategy` of each layer. "rotary" and "alibi" have no parameters
+// and no cap on sequence length. Custom strategies can be added with `RegisterPositionStrategy`.
+
+// PositionStrategy encodes token positions in self-attention.
+type PositionStrategy interface {
+	// Type returns name of strategy as in `PositionEmbeddingType`.
+	Type() string
+
+	// Encode applies position encoding to queries or keys of shape (batch size, num heads, length, head size)
+	// whose first position is `offset` (number of cached positions). It returns a new tensor.
+	Encode(x *ts.Tensor, offset int64) *ts.Tensor
+
+	// ScoreBias returns a tensor added to attention scores of shape (batch size, num heads, query length, key length)
+	// or nil if there is none. `queryLayer` is scaled by 1/sqrt(head size) and queries are the last positions of keys.
+	ScoreBias(queryLayer, keyLayer *ts.Tensor) *ts.Tensor
+}
+
+// PositionStrategyFn creates position strategy of a self-attention module at path `p`.
+type PositionStrategyFn func(p *nn.Path, config *BertConfig) PositionStrategy
+
+// Position embedding types of `PositionEmbeddingType`.
+const (
+	PositionEmbeddingAbsolute         = "absolute"           // learned absolute position embeddings added to input embeddings
+	PositionEmbeddingRelativeKey      = "relative_key"       // relative position scores of queries (Shaw et al.)
+	PositionEmbeddingRelativeKeyQuery = "relative_key_query" // relative position scores of queries and keys (Huang et al.)
+	PositionEmbeddingRotary           = "rotary"             // rotary position embeddings of queries and keys (Su et al.)
+	PositionEmbeddingAlibi            = "alibi"              // linear biases of attention scores (Press et al.)
+)
+
+var (
+	positionMu         sync.RWMutex
+	positionStrategies = map[string]PositionStrategyFn{
+		PositionEmbeddingAbsolute:         func(p *nn.Path, config *BertConfig) PositionStrategy { return NewAbsolutePosition() },
+		PositionEmbeddingRelativeKey:      func(p *nn.Path, config *BertConfig) PositionStrategy { return NewRelativePosition(p, config) },
+		PositionEmbeddingRelativeKeyQuery: func(p *nn.Path, config *BertConfig) PositionStrategy { return NewRelativePosition(p, config) },
+		PositionEmbeddingRotary:           func(p *nn.Path, config *BertConfig) PositionStrategy { return NewRotaryPosition(config) },
+		PositionEmbeddingAlibi:            func(p *nn.Path, config *BertConfig) PositionStrategy { return NewAlibiPosition(config) },
+	}
+)
+
+// RegisterPositionStrategy registers a custom position strategy which can then be selected
+// with `position_embedding_type` in config. An existing strategy with the same name is replaced.
+func RegisterPositionStrategy(name string, fn PositionStrategyFn) error {
+	if name == "" {
+		err := fmt.Errorf("RegisterPositionStrategy() failed: name is empty.")
+		return err
+	}
+	if fn == nil {
+		err := fmt.Errorf("RegisterPositionStrategy() failed: position strategy %q is nil.", name)
+		return err
+	}
+
+	positionMu.Lock()
+	defer positionMu.Unlock()
+	positionStrategies[name] = fn
+
+	return nil
+}
+
+// getPositionStrategy returns constructor of position strategy registered under `name`.
+func getPositionStrategy(name string) (PositionStrategyFn, error) {
+	positionMu.RLock()
+	defer positionMu.RUnlock()
+
+	fn, ok := positionStrategies[name]
+	if !ok {
+		names := make([]string, 0, len(positionStrategies))
+		for k := range positionStrategies {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		err := fmt.Errorf("Unsupported position embedding type %q. Supported types: %v", name, names)
+		return nil, err
+	}
+
+	return fn, nil
+}
+
+// NewPositionStrategy creates position strategy selected by `PositionEmbeddingType` of config
+// for self-attention at path `p`.
+func NewPositionStrategy(p *nn.Path, config *BertConfig) (PositionStrategy, error) {
+	name := config.PositionEmbeddingType
+	if name == "" {
+		name = PositionEmbeddingAbsolute
+	}
+	fn, err := getPositionStrategy(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return fn(p, config), nil
+}
+
+// AbsolutePosition:
+// =================
+
+// AbsolutePosition leaves self-attention unchanged. Positions are added in embeddings.
+type AbsolutePosition struct{}
+
+// NewAbsolutePosition creates a new AbsolutePosition.
+func NewAbsolutePosition() *AbsolutePosition {
+	return &AbsolutePosition{}
+}
+
+func (ap *AbsolutePosition) Type() string {
+	return PositionEmbeddingAbsolute
+}
+
+func (ap *AbsolutePosition) Encode(x *ts.Tensor, offset int64) *ts.Tensor {
+	return x.MustShallowClone()
+}
+
+func (ap *AbsolutePosition) ScoreBias(queryLayer, keyLayer *ts.Tensor) *ts.Tensor {
+	return nil
+}
+
+// RelativePosition:
+// =================
+//
+// With "relative_key" (https://arxiv.org/abs/1803.02155), attention scores get an extra
+// term between each query and embedding of its distance to each key:
+//
+//	score(l, r) += q(l) . D(l - r)
+//
+// With "relative_key_query" (https://arxiv.org/abs/2009.13658), a term between each key
+// and the same distance embedding is added as well:
+//
+//	score(l, r) += k(r) . D(l - r)
+
+// RelativePosition adds scores of learned relative position embeddings.
+//
+// `DistanceEmbedding` (`distance_embedding` in HuggingFace checkpoints) is of shape
+// (2 * MaxPositionEmbeddings - 1, attention head size).
+type RelativePosition struct {
+	PositionEmbeddingType string
+	MaxPositionEmbeddings int64
+	DistanceEmbedding     *nn.Embedding
+}
+
+// NewRelativePosition creates a new RelativePosition with `distance_embedding` at path `p`.
+func NewRelativePosition(p *nn.Path, config *BertConfig) *RelativePosition {
+	headSize := config.HiddenSize / config.NumAttentionHeads
+	distanceEmbedding := nn.NewEmbedding(p.Sub("distance_embedding"), 2*config.MaxPositionEmbeddings-1, headSize, nn.DefaultEmbeddingConfig())
+
+	return &RelativePosition{
+		PositionEmbeddingType: config.PositionEmbeddingType,
+		MaxPositionEmbeddings: config.MaxPositionEmbeddings,
+		DistanceEmbedding:     distanceEmbedding,
+	}
+}
+
+func (rp *RelativePosition) Type() string {
+	return rp.PositionEmbeddingType
+}
+
+func (rp *RelativePosition) Encode(x *ts.Tensor, offset int64) *ts.Tensor {
+	return x.MustShallowClone()
+}
+
+// ScoreBias computes relative position terms of attention scores, scaled as queries.
+func (rp *RelativePosition) ScoreBias(queryLayer, keyLayer *ts.Tensor) *ts.Tensor {
+	s := util.NewScope()
+	defer s.Close()
+
+	qSize := queryLayer.MustSize()
+	bs, numHeads, queryLen, headSize := qSize[0], qSize[1], qSize[2], qSize[3]
+	keyLen := keyLayer.MustSize()[2]
+
+	distance := s.Track(distances(queryLen, keyLen, queryLayer.MustDevice()))
+	distance.MustAddScalar_(ts.IntScalar(rp.MaxPositionEmbeddings - 1))
+
+	// (query length, key length, head size)
+	posEmbedding := s.Track(s.Track(distance.Apply(rp.DistanceEmbedding)).MustTotype(queryLayer.DType(), false))
+
+	// "bhld,lrd->bhlr": (l, b*h, d) x (l, d, r) -> (l, b*h, r)
+	q := s.Track(s.Track(queryLayer.MustPermute([]int64{2, 0, 1, 3}, false)).MustReshape([]int64{queryLen, bs * numHeads, headSize}, false))
+	posT := s.Track(posEmbedding.MustTranspose(1, 2, false))
+	qScores := s.Track(q.MustBmm(posT, false))
+	scores := s.Track(s.Track(qScores.MustView([]int64{queryLen, bs, numHeads, keyLen}, false)).MustPermute([]int64{1, 2, 0, 3}, false))
+
+	if rp.PositionEmbeddingType == PositionEmbeddingRelativeKeyQuery {
+		// "bhrd,lrd->bhlr": (r, b*h, d) x (r, d, l) -> (r, b*h, l)
+		k := s.Track(s.Track(keyLayer.MustPermute([]int64{2, 0, 1, 3}, false)).MustReshape([]int64{keyLen, bs * numHeads, headSize}, false))
+		posP := s.Track(posEmbedding.MustPermute([]int64{1, 2, 0}, false))
+		kScores := s.Track(k.MustBmm(posP, false))
+		kScores = s.Track(s.Track(kScores.MustView([]int64{keyLen, bs, numHeads, queryLen}, false)).MustPermute([]int64{1, 2, 3, 0}, false))
+
+		// Keys are not scaled yet.
+		kScores = s.Track(kScores.MustDivScalar(ts.FloatScalar(math.Sqrt(float64(headSize))), false))
+		scores = s.Track(scores.MustAdd(kScores, false))
+	}
+
+	return s.Keep(s.Track(scores.MustContiguous(false)))
+}
+
+// distances returns query-key distances (l - r) of shape (query length, key length) where
+// queries are the last `queryLen` of `keyLen` positions.
+func distances(queryLen, keyLen int64, device gotch.Device) *ts.Tensor {
+	posL := ts.MustArangeStart(ts.IntScalar(keyLen-queryLen), ts.IntScalar(keyLen), gotch.Int64, device)
+	posR := ts.MustArange(ts.IntScalar(keyLen), gotch.Int64, device)
+	posL = posL.MustView([]int64{-1, 1}, true)
+	posR = posR.MustView([]int64{1, -1}, true)
+	retVal := posL.MustSub(posR, false)
+	posL.MustDrop()
+	posR.MustDrop()
+
+	return retVal
+}
+
+// RotaryPosition:
+// ===============
+
+// RotaryPosition rotates pairs of features of queries and keys by an angle proportional to
+// their position, so that query-key products only depend on relative positions.
+// Features i and i + head size/2 form a pair (GPT-NeoX layout) rotated with frequency
+// base^(-2i/head size).
+type RotaryPosition struct {
+	Base     float64
+	HeadSize int64
+}
+
+// NewRotaryPosition creates a new RotaryPosition. Base is `RopeTheta` of config (10000 by default).
+func NewRotaryPosition(config *BertConfig) *RotaryPosition {
+	headSize := config.HiddenSize / config.NumAttentionHeads
+	if headSize%2 != 0 {
+		log.Fatalf("Rotary position embeddings need an even attention head size, got %v.\n", headSize)
+	}
+	base := config.RopeTheta
+	if base <= 0 {
+		base = 10000
+	}
+
+	return &RotaryPosition{Base: base, HeadSize: headSize}
+}
+
+func (rp *RotaryPosition) Type() string {
+	return PositionEmbeddingRotary
+}
+
+// Encode computes x * cos + rotateHalf(x) * sin.
+func (rp *RotaryPosition) Encode(x *ts.Tensor, offset int64) *ts.Tensor {
+	s := util.NewScope()
+	defer s.Close()
+
+	seqLen := x.MustSize()[2]
+	half := rp.HeadSize / 2
+	device := x.MustDevice()
+
+	invFreq := make([]float64, half)
+	for i := range invFreq {
+		invFreq[i] = math.Pow(rp.Base, -2*float64(i)/float64(rp.HeadSize))
+	}
+	freqTs := s.Track(s.Track(ts.MustOfSlice(invFreq).MustTo(device, true)).MustView([]int64{1, half}, false))
+	pos := s.Track(ts.MustArangeStart(ts.IntScalar(offset), ts.IntScalar(offset+seqLen), gotch.Double, device))
+	angles := s.Track(s.Track(pos.MustView([]int64{seqLen, 1}, false)).MustMul(freqTs, false)) // (length, head size/2)
+	angles = s.Track(ts.MustCat([]*ts.Tensor{angles, angles}, 1))                              // (length, head size)
+	cos := s.Track(s.Track(angles.MustCos(false)).MustTotype(x.DType(), false))
+	sin := s.Track(s.Track(angles.MustSin(false)).MustTotype(x.DType(), false))
+
+	x1 := s.Track(x.MustNarrow(-1, 0, half, false))
+	x2 := s.Track(x.MustNarrow(-1, half, half, false))
+	rotated := s.Track(ts.MustCat([]*ts.Tensor{s.Track(x2.MustNeg(false)), x1}, -1))
+
+	out := s.Track(x.MustMul(cos, false))
+	out.MustAdd_(s.Track(rotated.MustMul(sin, false)))
+
+	return s.Keep(out)
+}
+
+func (rp *RotaryPosition) ScoreBias(queryLayer, keyLayer *ts.Tensor) *ts.Tensor {
+	return nil
+}
+
+// AlibiPosition:
+// ==============
+
+// AlibiPosition adds to attention scores a bias -m * |l - r| linear in query-key distance
+// with a fixed slope m per head. Distance is symmetric so that it also applies to
+// bidirectional encoders. Causal decoders only see keys r <= l, as in the original paper.
+type AlibiPosition struct {
+	Slopes []float64
+}
+
+// NewAlibiPosition creates a new AlibiPosition.
+func NewAlibiPosition(config *BertConfig) *AlibiPosition {
+	return &AlibiPosition{Slopes: alibiSlopes(config.NumAttentionHeads)}
+}
+
+// alibiSlopes returns geometric slopes of heads as in the reference implementation.
+func alibiSlopes(numHeads int64) []float64 {
+	powerOf2Slopes := func(n int64) []float64 {
+		start := math.Pow(2, -math.Pow(2, -(math.Log2(float64(n))-3)))
+		slopes := make([]float64, n)
+		for i := range slopes {
+			slopes[i] = math.Pow(start, float64(i+1))
+		}
+		return slopes
+	}
+
+	if numHeads <= 0 {
+		return nil
+	}
+	closest := int64(math.Pow(2, math.Floor(math.Log2(float64(numHeads)))))
+	slopes := powerOf2Slopes(closest)
+	if closest == numHeads {
+		return slopes
+	}
+
+	// Remaining heads take every other slope of twice as many heads.
+	extra := powerOf2Slopes(2 * closest)
+	for i := int64(0); i < numHeads-closest; i++ {
+		slopes = append(slopes, extra[2*i])
+	}
+
+	return slopes
+}
+
+func (ap *AlibiPosition) Type() string {
+	return PositionEmbeddingAlibi
+}
+
+func (ap *AlibiPosition) Encode(x *ts.Tensor, offset int64) *ts.Tensor {
+	return x.MustShallowClone()
+}
+
+// ScoreBias returns bias of shape (1, num heads, query length, key length).
+func (ap *AlibiPosition) ScoreBias(queryLayer, keyLayer *ts.Tensor) *ts.Tensor {
+	s := util.NewScope()
+	defer s.Close()
+
+	queryLen := queryLayer.MustSize()[2]
+	keyLen := keyLayer.MustSize()[2]
+	device := queryLayer.MustDevice()
+
+	distance := s.Track(s.Track(distances(queryLen, keyLen, device)).MustAbs(false))
+	distance = s.Track(s.Track(distance.MustTotype(queryLayer.DType(), false)).MustUnsqueeze(0, false))
+
+	negSlopes := make([]float64, len(ap.Slopes))
+	for i, m := range ap.Slopes {
+		negSlopes[i] = -m
+	}
+	slopes := s.Track(s.Track(ts.MustOfSlice(negSlopes).MustTo(device, true)).MustTotype(queryLayer.DType(), false))
+	slopes = s.Track(slopes.MustView([]int64{-1, 1, 1}, false))
+
+	bias := s.Track(s.Track(distance.MustMul(slopes, false)).MustUnsqueeze(0, false))
+
+	return s.Keep(bias)
+}
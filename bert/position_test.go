@@ -0,0 +1,314 @@
+package bert_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/nn"
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/bert"
+)
+
+func TestBertSelfAttention_RelativePosition(t *testing.T) {
+	hidden := [][]float64{{0.1, 0.2}, {0.3, -0.1}, {-0.2, 0.4}}
+	var maxPos int64 = 4
+	distance := func(i int) []float64 { return []float64{0.1*float64(i) - 0.3, 0.05 * float64(i)} }
+	dot := func(a, b []float64) float64 { return a[0]*b[0] + a[1]*b[1] }
+
+	for _, posType := range []string{bert.PositionEmbeddingRelativeKey, bert.PositionEmbeddingRelativeKeyQuery} {
+		config := bert.NewConfig(map[string]interface{}{
+			"HiddenSize":            int64(2),
+			"NumAttentionHeads":     int64(1),
+			"MaxPositionEmbeddings": maxPos,
+			"PositionEmbeddingType": posType,
+		})
+		config.OutputAttentions = true
+
+		vs := nn.NewVarStore(gotch.CPU)
+		bsa := bert.NewBertSelfAttention(vs.Root(), config)
+
+		// Identity projections: queries and keys are hidden states.
+		bsa.Query.Ws = ts.MustEye(2, gotch.Float, gotch.CPU)
+		bsa.Query.Bs = ts.MustZeros([]int64{2}, gotch.Float, gotch.CPU)
+		bsa.Key.Ws = ts.MustEye(2, gotch.Float, gotch.CPU)
+		bsa.Key.Bs = ts.MustZeros([]int64{2}, gotch.Float, gotch.CPU)
+		var dist []float32
+		for i := 0; i < int(2*maxPos-1); i++ {
+			d := distance(i)
+			dist = append(dist, float32(d[0]), float32(d[1]))
+		}
+		bsa.Position.(*bert.RelativePosition).DistanceEmbedding.Ws = ts.MustOfSlice(dist).MustView([]int64{2*maxPos - 1, 2}, true)
+
+		var xs []float32
+		for _, h := range hidden {
+			xs = append(xs, float32(h[0]), float32(h[1]))
+		}
+		input := ts.MustOfSlice(xs).MustView([]int64{1, 3, 2}, true)
+
+		var context, weights *ts.Tensor
+		ts.NoGrad(func() {
+			context, weights = bsa.ForwardT(input, ts.None, ts.None, ts.None, false)
+		})
+		got := weights.Float64Values()
+
+		for l := 0; l < 3; l++ {
+			scores := make([]float64, 3)
+			var sum float64
+			for r := 0; r < 3; r++ {
+				d := distance(l - r + int(maxPos) - 1)
+				score := dot(hidden[l], hidden[r]) + dot(hidden[l], d)
+				if posType == bert.PositionEmbeddingRelativeKeyQuery {
+					score += dot(hidden[r], d)
+				}
+				scores[r] = math.Exp(score / math.Sqrt(2))
+				sum += scores[r]
+			}
+			for r := 0; r < 3; r++ {
+				want := scores[r] / sum
+				if math.Abs(got[l*3+r]-want) > 1e-5 {
+					t.Errorf("%v - want prob[%v][%v]: %v\n", posType, l, r, want)
+					t.Errorf("%v - got prob[%v][%v]: %v\n", posType, l, r, got[l*3+r])
+				}
+			}
+		}
+
+		context.MustDrop()
+		weights.MustDrop()
+		input.MustDrop()
+	}
+}
+
+func TestBertModel_RelativePositionWeights(t *testing.T) {
+	config := bert.NewConfig(map[string]interface{}{
+		"VocabSize":             int64(20),
+		"HiddenSize":            int64(8),
+		"NumHiddenLayers":       int64(2),
+		"NumAttentionHeads":     int64(2),
+		"IntermediateSize":      int64(16),
+		"MaxPositionEmbeddings": int64(16),
+		"PositionEmbeddingType": bert.PositionEmbeddingRelativeKeyQuery,
+	})
+
+	vs := nn.NewVarStore(gotch.CPU)
+	model := bert.NewBertModel(vs.Root(), config, false)
+
+	vars := vs.Variables()
+	for _, name := range []string{"encoder.layer.0.attention.self.distance_embedding.weight", "encoder.layer.1.attention.self.distance_embedding.weight"} {
+		x, ok := vars[name]
+		if !ok {
+			t.Errorf("Want variable %q\n", name)
+			continue
+		}
+		size := x.MustSize()
+		if size[0] != 31 || size[1] != 4 {
+			t.Errorf("Want %q of size: [31 4]\n", name)
+			t.Errorf("Got size: %v\n", size)
+		}
+	}
+	if _, ok := vars["embeddings.position_embeddings.weight"]; !ok {
+		t.Errorf("Want absolute position embeddings kept for checkpoint compatibility\n")
+	}
+
+	inputIds := ts.MustOfSlice([]int64{1, 2, 3, 4, 5, 6}).MustView([]int64{2, 3}, true)
+	var (
+		output *bert.ModelOutput
+		err    error
+	)
+	ts.NoGrad(func() {
+		output, err = model.ForwardT(inputIds, ts.None, ts.None, ts.None, ts.None, ts.None, ts.None, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	size := output.LastHiddenState.MustSize()
+	if size[0] != 2 || size[1] != 3 || size[2] != 8 {
+		t.Errorf("Want last hidden state size: [2 3 8]\n")
+		t.Errorf("Got size: %v\n", size)
+	}
+	output.Drop()
+	inputIds.MustDrop()
+}
+
+func TestRotaryPosition(t *testing.T) {
+	config := bert.NewConfig(map[string]interface{}{
+		"HiddenSize":        int64(8),
+		"NumAttentionHeads": int64(2),
+	})
+	rope := bert.NewRotaryPosition(config)
+
+	query := ts.MustRandn([]int64{1, 2, 5, 4}, gotch.Float, gotch.CPU)
+	key := ts.MustRandn([]int64{1, 2, 5, 4}, gotch.Float, gotch.CPU)
+
+	scores := func(offset int64) *ts.Tensor {
+		q := rope.Encode(query, offset)
+		k := rope.Encode(key, offset)
+		kT := k.MustTranspose(-1, -2, true)
+		retVal := q.MustMatmul(kT, true)
+		kT.MustDrop()
+		return retVal
+	}
+
+	// Scores only depend on relative positions.
+	scores0 := scores(0)
+	scores7 := scores(7)
+	if !scores0.MustAllclose(scores7, 1e-4, 1e-5, false, false) {
+		t.Errorf("Want rotary scores invariant to position offset\n")
+	}
+
+	// Position 0 is not rotated, other positions are.
+	encoded := rope.Encode(query, 0)
+	if !encoded.MustNarrow(2, 0, 1, false).MustAllclose(query.MustNarrow(2, 0, 1, false), 1e-5, 1e-6, false, true) {
+		t.Errorf("Want position 0 unchanged by rotation\n")
+	}
+	if encoded.MustNarrow(2, 1, 4, false).MustAllclose(query.MustNarrow(2, 1, 4, false), 1e-5, 1e-6, false, true) {
+		t.Errorf("Want positions 1..4 rotated\n")
+	}
+
+	scores0.MustDrop()
+	scores7.MustDrop()
+	encoded.MustDrop()
+	query.MustDrop()
+	key.MustDrop()
+}
+
+func TestAlibiPosition(t *testing.T) {
+	config := bert.NewConfig(map[string]interface{}{
+		"HiddenSize":        int64(16),
+		"NumAttentionHeads": int64(8),
+	})
+	alibi := bert.NewAlibiPosition(config)
+
+	for i, m := range alibi.Slopes {
+		want := math.Pow(2, -float64(i+1))
+		if math.Abs(m-want) > 1e-12 {
+			t.Errorf("Head %v - want slope: %v\n", i, want)
+			t.Errorf("Head %v - got slope: %v\n", i, m)
+		}
+	}
+
+	// 2 queries at the end of 3 keys.
+	query := ts.MustZeros([]int64{1, 8, 2, 2}, gotch.Float, gotch.CPU)
+	key := ts.MustZeros([]int64{1, 8, 3, 2}, gotch.Float, gotch.CPU)
+	bias := alibi.ScoreBias(query, key)
+
+	size := bias.MustSize()
+	if size[0] != 1 || size[1] != 8 || size[2] != 2 || size[3] != 3 {
+		t.Fatalf("Got bias size: %v\n", size)
+	}
+	got := bias.Float64Values()
+	for h := 0; h < 8; h++ {
+		for l := 0; l < 2; l++ {
+			for r := 0; r < 3; r++ {
+				want := -alibi.Slopes[h] * math.Abs(float64(l+1-r))
+				if math.Abs(got[h*6+l*3+r]-want) > 1e-6 {
+					t.Errorf("Head %v - want bias[%v][%v]: %v\n", h, l, r, want)
+					t.Errorf("Head %v - got bias[%v][%v]: %v\n", h, l, r, got[h*6+l*3+r])
+				}
+			}
+		}
+	}
+
+	if len(bert.NewAlibiPosition(bert.NewConfig(map[string]interface{}{"NumAttentionHeads": int64(12)})).Slopes) != 12 {
+		t.Errorf("Want a slope for each of 12 heads\n")
+	}
+
+	bias.MustDrop()
+	query.MustDrop()
+	key.MustDrop()
+}
+
+func newPositionModel(posType string, isDecoder bool) (*nn.VarStore, *bert.BertModel) {
+	config := bert.NewConfig(map[string]interface{}{
+		"VocabSize":             int64(20),
+		"HiddenSize":            int64(8),
+		"NumHiddenLayers":       int64(2),
+		"NumAttentionHeads":     int64(2),
+		"IntermediateSize":      int64(16),
+		"MaxPositionEmbeddings": int64(8),
+		"PositionEmbeddingType": posType,
+	})
+	config.IsDecoder = isDecoder
+
+	vs := nn.NewVarStore(gotch.CPU)
+	model := bert.NewBertModel(vs.Root(), config, false)
+
+	return vs, model
+}
+
+// Rotary and ALiBi positions are not capped by MaxPositionEmbeddings.
+func TestBertModel_PositionStrategiesLongInput(t *testing.T) {
+	for _, posType := range []string{bert.PositionEmbeddingRotary, bert.PositionEmbeddingAlibi} {
+		vs, model := newPositionModel(posType, false)
+		if _, ok := vs.Variables()["embeddings.position_embeddings.weight"]; ok {
+			t.Errorf("%v - want no learned position embeddings\n", posType)
+		}
+
+		var seqLen int64 = 20
+		inputIds := ts.MustOnes([]int64{1, seqLen}, gotch.Int64, gotch.CPU)
+		var (
+			output *bert.ModelOutput
+			err    error
+		)
+		ts.NoGrad(func() {
+			output, err = model.ForwardT(inputIds, ts.None, ts.None, ts.None, ts.None, ts.None, ts.None, false)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		size := output.LastHiddenState.MustSize()
+		if size[1] != seqLen {
+			t.Errorf("%v - want output length: %v\n", posType, seqLen)
+			t.Errorf("%v - got output length: %v\n", posType, size[1])
+		}
+
+		// Same tokens at different positions get different outputs.
+		first := output.LastHiddenState.MustSelect(1, 0, false)
+		last := output.LastHiddenState.MustSelect(1, seqLen-1, false)
+		if first.MustAllclose(last, 1e-5, 1e-6, false, true) {
+			t.Errorf("%v - want outputs depending on positions\n", posType)
+		}
+		last.MustDrop()
+
+		output.Drop()
+		inputIds.MustDrop()
+	}
+}
+
+// Positions of cached keys and new queries are consistent in incremental decoding.
+func TestBertModel_PositionStrategiesDecoderCache(t *testing.T) {
+	for _, posType := range []string{bert.PositionEmbeddingRelativeKeyQuery, bert.PositionEmbeddingRotary, bert.PositionEmbeddingAlibi} {
+		_, model := newPositionModel(posType, true)
+
+		inputIds := ts.MustOfSlice([]int64{1, 2, 3, 4, 5, 6, 7, 8}).MustView([]int64{2, 4}, true)
+		ts.NoGrad(func() {
+			fullOutput, err := model.ForwardT(inputIds, ts.None, ts.None, ts.None, ts.None, ts.None, ts.None, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var cache *bert.Cache
+			for _, step := range [][]int64{{0, 2}, {2, 1}, {3, 1}} {
+				stepIds := inputIds.MustNarrow(1, step[0], step[1], false)
+				var output *bert.ModelOutput
+				output, cache, err = model.ForwardCachedT(stepIds, ts.None, ts.None, ts.None, ts.None, ts.None, ts.None, cache, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				want := fullOutput.LastHiddenState.MustNarrow(1, step[0], step[1], false)
+				if !want.MustAllclose(output.LastHiddenState, 1e-5, 1e-5, false, true) {
+					t.Errorf("%v - step %v - want cached output equal to full forward output\n", posType, step)
+				}
+				output.Drop()
+				stepIds.MustDrop()
+			}
+			cache.Drop()
+			fullOutput.Drop()
+		})
+		inputIds.MustDrop()
+	}
+}
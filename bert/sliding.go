@@ -0,0 +1,276 @@
+package bert
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/nn"
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/util"
+)
+
+// Sliding window attention:
+// =========================
+//
+// With `AttentionWindow` w > 0, self-attention is local as in Longformer (https://arxiv.org/abs/2004.05150):
+// each token attends to w/2 tokens on each side, so time and memory are linear in sequence length
+// instead of quadratic. Some tokens (e.g. [CLS] or question tokens) can be made global: they attend
+// to all tokens and all tokens attend to them.
+//
+// Global tokens are marked with value 2 in the attention mask of `BertModel.ForwardT` (0 for padding,
+// 1 for local attention) as in HuggingFace Longformer. Global attention reuses query, key and value
+// projections of local attention, so BERT and RoBERTa weights can be used as is.
+//
+// Attention weights (`OutputAttentions`) are of shape (batch size, num heads, seq length, w + 1 + num global)
+// holding weights of the local window followed by weights of global tokens. Weights of global tokens'
+// own rows over all tokens are not returned.
+//
+// To go beyond `MaxPositionEmbeddings` with absolute positions, pretrained position embeddings
+// can be copied to a larger model with `ExtendPositionEmbeddings`.
+
+// slidingWindowAttention computes context of sliding window attention.
+//
+// Params:
+//   - `queryLayer`: queries scaled by 1/sqrt(head size) of shape (batch size, num heads, seq length, head size).
+//   - `keyLayer`, `valueLayer`: of shape (batch size, num heads, seq length, head size).
+//   - `mask`: optional additive mask of shape (batch size, 1, 1, seq length): 0 for local, -10000 for padding
+//     and +10000 for global tokens.
+//
+// Returns context of shape (batch size, num heads, seq length, head size) and attention weights.
+func (bsa *BertSelfAttention) slidingWindowAttention(queryLayer, keyLayer, valueLayer, mask *ts.Tensor, train bool) (retVal, retValOpt *ts.Tensor) {
+	s := util.NewScope()
+	defer s.Close()
+
+	size := queryLayer.MustSize()
+	bs, numHeads, seqLen, headSize := size[0], size[1], size[2], size[3]
+	w := bsa.AttentionWindow / 2
+	device := queryLayer.MustDevice()
+
+	// (batch size, seq length) additive mask.
+	var maskTs *ts.Tensor
+	if mask.MustDefined() {
+		maskTs = s.Track(mask.MustReshape([]int64{bs, seqLen}, false))
+	} else {
+		maskTs = s.Track(ts.MustZeros([]int64{bs, seqLen}, gotch.Float, device))
+	}
+
+	// Local scores over windows of 2w + 1 keys: (batch size, num heads, seq length, 2w + 1)
+	kWindows := s.Track(slidingWindows(s, keyLayer, w))
+	localScores := s.Track(s.Track(s.Track(queryLayer.MustUnsqueeze(3, false)).MustMatmul(kWindows, false)).MustSqueezeDim(3, false))
+
+	// Keys out of sequence, padding and global keys (attended in global columns) are masked.
+	localKeys := s.Track(s.Track(maskTs.MustEq(ts.FloatScalar(0), false)).MustTotype(queryLayer.DType(), false))
+	localKeysPadded := s.Track(localKeys.MustConstantPadNd([]int64{w, w}, false))
+	localKeysWin := s.Track(localKeysPadded.MustUnfold(1, 2*w+1, 1, false)) // (batch size, seq length, 2w + 1)
+	localMask := s.Track(additiveMask(s, localKeysWin))
+	localScores.MustAdd_(s.Track(localMask.MustUnsqueeze(1, false)))
+
+	globalIdx, globalValid, globalWrite := globalIndices(maskTs, device)
+	s.TrackAll(globalIdx, globalValid, globalWrite)
+	numGlobal := globalIdx.MustSize()[1]
+
+	var (
+		scores   *ts.Tensor
+		idxHeads *ts.Tensor
+		vGlobal  *ts.Tensor
+	)
+	if numGlobal > 0 {
+		// Scores of all queries over global keys: (batch size, num heads, seq length, num global)
+		idxHeads = s.Track(s.Track(globalIdx.MustView([]int64{bs, 1, numGlobal, 1}, false)).MustExpand([]int64{bs, numHeads, numGlobal, headSize}, true, false))
+		kGlobal := s.Track(keyLayer.MustGather(2, idxHeads, false, false))
+		vGlobal = s.Track(valueLayer.MustGather(2, idxHeads, false, false))
+		globalScores := s.Track(queryLayer.MustMatmul(s.Track(kGlobal.MustTranspose(-1, -2, false)), false))
+		globalMask := s.Track(additiveMask(s, globalValid))
+		globalScores.MustAdd_(s.Track(globalMask.MustView([]int64{bs, 1, 1, numGlobal}, false)))
+
+		scores = s.Track(ts.MustCat([]*ts.Tensor{localScores, globalScores}, -1))
+	} else {
+		scores = localScores
+	}
+
+	probs := s.Track(util.Softmax(scores, -1))
+	weights := s.Track(probs.ApplyT(bsa.Dropout, train))
+
+	// Context of local windows: (batch size, num heads, seq length, head size)
+	vWindows := s.Track(slidingWindows(s, valueLayer, w))
+	localWeights := s.Track(s.Track(weights.MustNarrow(-1, 0, 2*w+1, false)).MustUnsqueeze(-1, false))
+	context := s.Track(s.Track(vWindows.MustMatmul(localWeights, false)).MustSqueezeDim(-1, false))
+
+	if numGlobal > 0 {
+		globalWeights := s.Track(weights.MustNarrow(-1, 2*w+1, numGlobal, false))
+		context.MustAdd_(s.Track(globalWeights.MustMatmul(vGlobal, false)))
+
+		// Global tokens attend to all (non padding) tokens.
+		qGlobal := s.Track(queryLayer.MustGather(2, idxHeads, false, false))
+		fullScores := s.Track(qGlobal.MustMatmul(s.Track(keyLayer.MustTranspose(-1, -2, false)), false))
+		paddingMask := s.Track(maskTs.MustClampMax(ts.FloatScalar(0), false))
+		fullScores.MustAdd_(s.Track(paddingMask.MustView([]int64{bs, 1, 1, seqLen}, false)))
+		fullProbs := s.Track(util.Softmax(fullScores, -1))
+		fullWeights := s.Track(fullProbs.ApplyT(bsa.Dropout, train))
+		globalContext := s.Track(fullWeights.MustMatmul(valueLayer, false))
+
+		// Rows of items without global tokens are left unchanged.
+		current := s.Track(context.MustGather(2, idxHeads, false, false))
+		write := s.Track(s.Track(globalWrite.MustView([]int64{bs, 1, 1, 1}, false)).MustTotype(context.DType(), false))
+		keep := s.Track(s.Track(write.MustOnesLike(false)).MustSub(write, false))
+		globalContext = s.Track(globalContext.MustMul(write, false))
+		globalContext.MustAdd_(s.Track(current.MustMul(keep, false)))
+
+		context = s.Track(context.MustScatter(2, idxHeads, globalContext, false))
+	}
+
+	return s.Keep(context), s.Keep(weights)
+}
+
+// slidingWindows returns windows of 2w + 1 positions around each position of `x` of shape
+// (batch size, num heads, seq length, head size). Returned tensor is of shape
+// (batch size, num heads, seq length, head size, 2w + 1), out of sequence positions being zeros.
+func slidingWindows(s *util.Scope, x *ts.Tensor, w int64) *ts.Tensor {
+	padded := s.Track(x.MustConstantPadNd([]int64{0, 0, w, w}, false))
+
+	return padded.MustUnfold(2, 2*w+1, 1, false)
+}
+
+// globalIndices returns positions of global tokens (mask value > 0) of each batch item.
+//
+// Returns:
+//   - index of shape (batch size, max num global): positions of global tokens. Items with fewer
+//     global tokens are padded with their first global position (or 0 if none).
+//   - valid of shape (batch size, max num global): 1 for global tokens, 0 for padding.
+//   - write of shape (batch size): 1 if item has global tokens, 0 otherwise.
+func globalIndices(mask *ts.Tensor, device gotch.Device) (index, valid, write *ts.Tensor) {
+	size := mask.MustSize()
+	bs, seqLen := size[0], size[1]
+	values := mask.Float64Values()
+
+	positions := make([][]int64, bs)
+	var numGlobal int
+	for i := int64(0); i < bs; i++ {
+		for j := int64(0); j < seqLen; j++ {
+			if values[i*seqLen+j] > 0 {
+				positions[i] = append(positions[i], j)
+			}
+		}
+		if len(positions[i]) > numGlobal {
+			numGlobal = len(positions[i])
+		}
+	}
+
+	idxData := make([]int64, 0, int(bs)*numGlobal)
+	validData := make([]float32, 0, int(bs)*numGlobal)
+	writeData := make([]float32, bs)
+	for i, pos := range positions {
+		var pad int64
+		if len(pos) > 0 {
+			pad = pos[0]
+			writeData[i] = 1
+		}
+		for k := 0; k < numGlobal; k++ {
+			if k < len(pos) {
+				idxData = append(idxData, pos[k])
+				validData = append(validData, 1)
+			} else {
+				idxData = append(idxData, pad)
+				validData = append(validData, 0)
+			}
+		}
+	}
+
+	shape := []int64{bs, int64(numGlobal)}
+	index = ts.MustOfSlice(idxData).MustView(shape, true).MustTo(device, true)
+	valid = ts.MustOfSlice(validData).MustView(shape, true).MustTotype(mask.DType(), true).MustTo(device, true)
+	write = ts.MustOfSlice(writeData).MustTotype(mask.DType(), true).MustTo(device, true)
+
+	return index, valid, write
+}
+
+// isSlidingWindow returns whether encoder layers use sliding window attention.
+func (be *BertEncoder) isSlidingWindow() bool {
+	return len(be.Layers) > 0 && be.Layers[0].Attention.Bsa.AttentionWindow > 0
+}
+
+// ExtendPositionEmbeddings copies weights of pretrained model `src` to model `dst` which has more
+// position embeddings (e.g. 4096), as in Longformer conversion of BERT and RoBERTa checkpoints.
+//
+// All variables of `dst` must be in `src` with the same shape except position embeddings
+// (variables named "position_embeddings.weight") which are filled by repeating pretrained
+// position embeddings. The first `offset` positions are copied once (e.g. 2 for RoBERTa whose
+// positions start after padding index, 0 for BERT).
+//
+// Example:
+//
+//	config.MaxPositionEmbeddings = 4096
+//	config.AttentionWindow = 512
+//	longVs := nn.NewVarStore(device)
+//	longModel := bert.NewBertForMaskedLM(longVs.Root(), config)
+//	err := bert.ExtendPositionEmbeddings(longVs, vs, 0)
+func ExtendPositionEmbeddings(dst, src *nn.VarStore, offset int64) error {
+	srcVars := src.Variables()
+	for name, dstTs := range dst.Variables() {
+		srcTs, ok := srcVars[name]
+		if !ok {
+			err := fmt.Errorf("ExtendPositionEmbeddings() failed: cannot find %q in source VarStore.", name)
+			return err
+		}
+
+		dstSize := dstTs.MustSize()
+		srcSize := srcTs.MustSize()
+		if strings.HasSuffix(name, "position_embeddings.weight") {
+			if err := copyPositions(&dstTs, &srcTs, offset); err != nil {
+				err = fmt.Errorf("ExtendPositionEmbeddings() failed for %q: %w", name, err)
+				return err
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(dstSize, srcSize) {
+			err := fmt.Errorf("ExtendPositionEmbeddings() failed: %q has shape %v in source and %v in destination.", name, srcSize, dstSize)
+			return err
+		}
+		srcDev := srcTs.MustTo(dstTs.MustDevice(), false)
+		ts.NoGrad(func() {
+			dstTs.Copy_(srcDev)
+		})
+		srcDev.MustDrop()
+	}
+
+	return nil
+}
+
+// copyPositions fills `dst` position embeddings by repeating `src` ones after `offset` first positions.
+func copyPositions(dst, src *ts.Tensor, offset int64) error {
+	dstSize := dst.MustSize()
+	srcSize := src.MustSize()
+	if len(dstSize) != 2 || len(srcSize) != 2 || dstSize[1] != srcSize[1] {
+		err := fmt.Errorf("incompatible shapes %v and %v.", srcSize, dstSize)
+		return err
+	}
+	if offset < 0 || offset >= srcSize[0] || dstSize[0] < srcSize[0] {
+		err := fmt.Errorf("cannot extend %v positions to %v with offset %v.", srcSize[0], dstSize[0], offset)
+		return err
+	}
+
+	s := util.NewScope()
+	defer s.Close()
+
+	srcDev := s.Track(src.MustTo(dst.MustDevice(), false))
+	ts.NoGrad(func() {
+		if offset > 0 {
+			s.Track(dst.MustNarrow(0, 0, offset, false)).Copy_(s.Track(srcDev.MustNarrow(0, 0, offset, false)))
+		}
+
+		step := srcSize[0] - offset
+		for k := offset; k < dstSize[0]; k += step {
+			n := step
+			if dstSize[0]-k < n {
+				n = dstSize[0] - k
+			}
+			s.Track(dst.MustNarrow(0, k, n, false)).Copy_(s.Track(srcDev.MustNarrow(0, offset, n, false)))
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package bert_test
+
+import (
+	"testing"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/nn"
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/bert"
+)
+
+func newSlidingModel(window, maxPos int64) (*nn.VarStore, *bert.BertModel) {
+	config := bert.NewConfig(map[string]interface{}{
+		"VocabSize":             int64(20),
+		"HiddenSize":            int64(8),
+		"NumHiddenLayers":       int64(1),
+		"NumAttentionHeads":     int64(2),
+		"IntermediateSize":      int64(16),
+		"MaxPositionEmbeddings": maxPos,
+		"AttentionWindow":       window,
+	})
+	config.OutputAttentions = true
+
+	vs := nn.NewVarStore(gotch.CPU)
+	model := bert.NewBertModel(vs.Root(), config, false)
+
+	return vs, model
+}
+
+func forwardSliding(t *testing.T, model *bert.BertModel, inputIds, mask []int64, shape []int64) *bert.ModelOutput {
+	inputTs := ts.MustOfSlice(inputIds).MustView(shape, true)
+	maskTs := ts.MustOfSlice(mask).MustView(shape, true)
+	defer inputTs.MustDrop()
+	defer maskTs.MustDrop()
+
+	var (
+		output *bert.ModelOutput
+		err    error
+	)
+	ts.NoGrad(func() {
+		output, err = model.ForwardT(inputTs, maskTs, ts.None, ts.None, ts.None, ts.None, ts.None, false)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return output
+}
+
+// A window covering the whole sequence is full attention.
+func TestBertModel_SlidingWindowFullWindow(t *testing.T) {
+	fullVs, full := newSlidingModel(0, 16)
+	slidingVs, sliding := newSlidingModel(12, 16)
+	if err := slidingVs.Copy(fullVs); err != nil {
+		t.Fatal(err)
+	}
+
+	inputIds := []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 0, 0}
+	// Global tokens (2) in first item, padding (0) in second item.
+	mask := []int64{2, 1, 1, 2, 1, 1, 1, 1, 1, 1, 0, 0}
+	shape := []int64{2, 6}
+
+	want := forwardSliding(t, full, inputIds, mask, shape)
+	got := forwardSliding(t, sliding, inputIds, mask, shape)
+
+	wantVals := want.LastHiddenState.Float64Values()
+	gotVals := got.LastHiddenState.Float64Values()
+	for i := range wantVals {
+		// Outputs of padding positions are not compared.
+		if mask[i/8] == 0 {
+			continue
+		}
+		if d := wantVals[i] - gotVals[i]; d > 1e-4 || d < -1e-4 {
+			t.Errorf("Want hidden state[%v]: %v\n", i, wantVals[i])
+			t.Errorf("Got hidden state[%v]: %v\n", i, gotVals[i])
+		}
+	}
+
+	// Local window of 13 keys followed by 2 global keys.
+	gotSize := got.Attentions[0].MustSize()
+	wantSize := []int64{2, 2, 6, 15}
+	for i := range wantSize {
+		if gotSize[i] != wantSize[i] {
+			t.Errorf("Want attention weights shape: %v\n", wantSize)
+			t.Errorf("Got attention weights shape: %v\n", gotSize)
+			break
+		}
+	}
+
+	want.Drop()
+	got.Drop()
+}
+
+// Local tokens only see their window, global tokens see the whole sequence.
+func TestBertModel_SlidingWindowLocality(t *testing.T) {
+	_, model := newSlidingModel(2, 16)
+
+	inputIds := []int64{1, 2, 3, 4, 5, 6, 7, 8}
+	changed := []int64{1, 2, 3, 4, 5, 6, 7, 9}
+	shape := []int64{1, 8}
+
+	for _, global := range []bool{false, true} {
+		mask := []int64{1, 1, 1, 1, 1, 1, 1, 1}
+		if global {
+			mask[0] = 2
+		}
+		out1 := forwardSliding(t, model, inputIds, mask, shape)
+		out2 := forwardSliding(t, model, changed, mask, shape)
+
+		// With a single layer and window 2, position 1 depends on positions 0 to 2 only.
+		for _, pos := range []int64{0, 1} {
+			h1 := out1.LastHiddenState.MustSelect(1, pos, false)
+			h2 := out2.LastHiddenState.MustSelect(1, pos, false)
+			same := h1.MustAllclose(h2, 1e-5, 1e-6, false, true)
+			h2.MustDrop()
+
+			wantSame := !(global && pos == 0)
+			if same != wantSame {
+				t.Errorf("Global: %v, position %v - want unchanged output: %v\n", global, pos, wantSame)
+				t.Errorf("Global: %v, position %v - got unchanged output: %v\n", global, pos, same)
+			}
+		}
+
+		out1.Drop()
+		out2.Drop()
+	}
+}
+
+func TestExtendPositionEmbeddings(t *testing.T) {
+	srcVs, _ := newSlidingModel(0, 5)
+	dstVs, _ := newSlidingModel(4, 12)
+
+	if err := bert.ExtendPositionEmbeddings(dstVs, srcVs, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	src := srcVs.Variables()["embeddings.position_embeddings.weight"]
+	dst := dstVs.Variables()["embeddings.position_embeddings.weight"]
+	srcVals := src.Float64Values()
+	dstVals := dst.Float64Values()
+	// Positions 0, 1 copied once, then 2, 3, 4 repeated.
+	wantRows := []int{0, 1, 2, 3, 4, 2, 3, 4, 2, 3, 4, 2}
+	for i, row := range wantRows {
+		for j := 0; j < 8; j++ {
+			if dstVals[i*8+j] != srcVals[row*8+j] {
+				t.Errorf("Want position %v equal to pretrained position %v\n", i, row)
+				break
+			}
+		}
+	}
+
+	srcWord := srcVs.Variables()["embeddings.word_embeddings.weight"]
+	dstWord := dstVs.Variables()["embeddings.word_embeddings.weight"]
+	if !srcWord.MustAllclose(&dstWord, 0, 0, false, false) {
+		t.Errorf("Want word embeddings copied\n")
+	}
+
+	// A smaller destination can not be filled.
+	if err := bert.ExtendPositionEmbeddings(srcVs, dstVs, 2); err == nil {
+		t.Errorf("Want error when destination has fewer positions\n")
+	}
+}
+
+func TestBertConfig_LoadAttentionWindow(t *testing.T) {
+	config := new(bert.BertConfig)
+	if err := config.Load(writeConfig(t, `{"attention_window": 512}`), nil); err != nil {
+		t.Fatal(err)
+	}
+	if config.AttentionWindow != 512 {
+		t.Errorf("Want attention_window: 512\n")
+		t.Errorf("Got attention_window: %v\n", config.AttentionWindow)
+	}
+
+	config = new(bert.BertConfig)
+	if err := config.Load(writeConfig(t, `{"attention_window": 511}`), nil); err == nil {
+		t.Errorf("Want error for odd attention_window\n")
+	}
+}
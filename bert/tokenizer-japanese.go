@@ -0,0 +1,119 @@
+package bert
+
+import (
+	"fmt"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sugarme/tokenizer"
+	"github.com/sugarme/tokenizer/normalizer"
+	"github.com/sugarme/tokenizer/pretokenizer"
+)
+
+// WordTokenizer splits text into words. It is the first (word-level) stage
+// of tokenization for languages without whitespace between words (e.g. Japanese).
+type WordTokenizer interface {
+	// Tokenize returns byte offsets `[start, end)` of words in text.
+	// Text not covered by any word (e.g. whitespaces) is dropped.
+	Tokenize(text string) [][]int
+}
+
+// CharacterTokenizer splits text into characters, dropping whitespaces.
+// It implements `WordTokenizer` interface.
+type CharacterTokenizer struct{}
+
+// NewCharacterTokenizer creates a new CharacterTokenizer.
+func NewCharacterTokenizer() *CharacterTokenizer {
+	return new(CharacterTokenizer)
+}
+
+// Tokenize implements `WordTokenizer` interface.
+func (ct *CharacterTokenizer) Tokenize(text string) [][]int {
+	var words [][]int
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		words = append(words, []int{i, i + utf8.RuneLen(r)})
+	}
+
+	return words
+}
+
+// WordPreTokenizer wraps a WordTokenizer as a `tokenizer.PreTokenizer`.
+type WordPreTokenizer struct {
+	WordTokenizer WordTokenizer
+}
+
+var _ tokenizer.PreTokenizer = new(WordPreTokenizer)
+
+// NewWordPreTokenizer creates a pre-tokenizer from a WordTokenizer.
+func NewWordPreTokenizer(wt WordTokenizer) *WordPreTokenizer {
+	return &WordPreTokenizer{wt}
+}
+
+// PreTokenize implements `tokenizer.PreTokenizer` interface.
+func (wp *WordPreTokenizer) PreTokenize(pretokenized *tokenizer.PreTokenizedString) (*tokenizer.PreTokenizedString, error) {
+	pretok := pretokenized.Split(func(noop int, normalized *normalizer.NormalizedString) []tokenizer.SplitIdx {
+		pattern := &wordPattern{wp.WordTokenizer}
+		splits := normalized.Split(pattern, normalizer.RemovedBehavior)
+
+		var splitIdxs []tokenizer.SplitIdx
+		for _, s := range splits {
+			normalized := s
+			splitIdxs = append(splitIdxs, tokenizer.SplitIdx{Normalized: &normalized, Tokens: nil})
+		}
+
+		return splitIdxs
+	})
+
+	return pretok, nil
+}
+
+// wordPattern implements `normalizer.Pattern`. Words are non-matches so that
+// gaps between them are removed with `normalizer.RemovedBehavior`.
+type wordPattern struct {
+	wt WordTokenizer
+}
+
+func (p *wordPattern) FindMatches(inside string) []normalizer.OffsetsMatch {
+	if len(inside) == 0 {
+		return []normalizer.OffsetsMatch{{Offsets: []int{0, 0}, Match: false}}
+	}
+
+	var matches []normalizer.OffsetsMatch
+	prev := 0
+	for _, w := range p.wt.Tokenize(inside) {
+		if w[0] > prev {
+			matches = append(matches, normalizer.OffsetsMatch{Offsets: []int{prev, w[0]}, Match: true})
+		}
+		matches = append(matches, normalizer.OffsetsMatch{Offsets: []int{w[0], w[1]}, Match: false})
+		prev = w[1]
+	}
+	if prev < len(inside) {
+		matches = append(matches, normalizer.OffsetsMatch{Offsets: []int{prev, len(inside)}, Match: true})
+	}
+
+	return matches
+}
+
+// newJapaneseWordPreTokenizer creates word-level pre-tokenizer for BERT Japanese tokenizer.
+//
+// `wordTokenizerType` is one of "basic", "character" or "mecab".
+func newJapaneseWordPreTokenizer(wordTokenizerType string, mecabDicDir string) (tokenizer.PreTokenizer, error) {
+	switch wordTokenizerType {
+	case "basic":
+		return pretokenizer.NewBertPreTokenizer(), nil
+	case "character":
+		return NewWordPreTokenizer(NewCharacterTokenizer()), nil
+	case "mecab":
+		mt, err := NewMecabTokenizer(mecabDicDir)
+		if err != nil {
+			return nil, err
+		}
+		return NewWordPreTokenizer(mt), nil
+	default:
+		err := fmt.Errorf("Unsupported word tokenizer type: %q", wordTokenizerType)
+		return nil, err
+	}
+}
@@ -1,7 +1,9 @@
 package bert
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 
 	"github.com/sugarme/tokenizer"
 	"github.com/sugarme/tokenizer/model/wordpiece"
@@ -15,12 +17,115 @@ import (
 
 type BertTokenizerFast = tokenizer.Tokenizer
 
+// japaneseTokenizerConfig holds fields of `tokenizer_config.json` for BERT Japanese models.
+type japaneseTokenizerConfig struct {
+	DoLowerCase          bool   `json:"do_lower_case"`
+	WordTokenizerType    string `json:"word_tokenizer_type"`
+	SubwordTokenizerType string `json:"subword_tokenizer_type"`
+}
+
 // BertJapaneseTokenizerFromPretrained initiate BERT tokenizer for Japanese language from pretrained file.
-func BertJapaneseTokenizerFromPretrained(pretrainedModelNameOrPath string, customParams map[string]interface{}) *tokenizer.Tokenizer {
+//
+// Tokenization has 2 stages:
+//   - word tokenizer: "mecab" (default), "character" or "basic" (BERT pre-tokenizer)
+//   - subword tokenizer: "wordpiece" (default) or "character"
+//
+// Stages are read from `tokenizer_config.json` of pretrained model (e.g., `cl-tohoku/bert-base-japanese`)
+// if any and can be overridden with custom params:
+//   - `WordTokenizerType` (string)
+//   - `SubwordTokenizerType` (string)
+//   - `DoLowerCase` (bool, default false)
+//   - `MecabDicDir` (string): path to a local MeCab dictionary (e.g. IPADIC in UTF-8). Required for "mecab".
+//
+// It returns an error if vocab can not be loaded, `tokenizer_config.json` is invalid or a tokenizer
+// type is not supported.
+func BertJapaneseTokenizerFromPretrained(pretrainedModelNameOrPath string, customParams map[string]interface{}) (*tokenizer.Tokenizer, error) {
+	config := japaneseTokenizerConfig{
+		DoLowerCase:          false,
+		WordTokenizerType:    "mecab",
+		SubwordTokenizerType: "wordpiece",
+	}
+	if configFile, err := util.CachedPath(pretrainedModelNameOrPath, "tokenizer_config.json"); err == nil {
+		buff, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			err = fmt.Errorf("BertJapaneseTokenizerFromPretrained() failed: %w", err)
+			return nil, err
+		}
+		if err := json.Unmarshal(buff, &config); err != nil {
+			err = fmt.Errorf("BertJapaneseTokenizerFromPretrained() failed: could not parse tokenizer configuration: %w", err)
+			return nil, err
+		}
+	}
+
+	if v, ok := customParams["WordTokenizerType"].(string); ok {
+		config.WordTokenizerType = v
+	}
+	if v, ok := customParams["SubwordTokenizerType"].(string); ok {
+		config.SubwordTokenizerType = v
+	}
+	if v, ok := customParams["DoLowerCase"].(bool); ok {
+		config.DoLowerCase = v
+	}
+	mecabDicDir, _ := customParams["MecabDicDir"].(string)
+
+	vocabFile, err := util.CachedPath(pretrainedModelNameOrPath, "vocab.txt")
+	if err != nil {
+		err = fmt.Errorf("BertJapaneseTokenizerFromPretrained() failed: %w", err)
+		return nil, err
+	}
+	model, err := wordpiece.NewWordPieceFromFile(vocabFile, "[UNK]")
+	if err != nil {
+		err = fmt.Errorf("BertJapaneseTokenizerFromPretrained() failed: %w", err)
+		return nil, err
+	}
+
+	tk := tokenizer.NewTokenizer(model)
+
+	normalizers := []normalizer.Normalizer{
+		normalizer.NewNFKC(),
+		normalizer.NewBertNormalizer(true, config.DoLowerCase, false, false),
+	}
+	tk.WithNormalizer(normalizer.NewSequence(normalizers))
 
-	// TODO: implement it
+	wordPreTokenizer, err := newJapaneseWordPreTokenizer(config.WordTokenizerType, mecabDicDir)
+	if err != nil {
+		err = fmt.Errorf("BertJapaneseTokenizerFromPretrained() failed: %w", err)
+		return nil, err
+	}
+	switch config.SubwordTokenizerType {
+	case "wordpiece":
+		tk.WithPreTokenizer(wordPreTokenizer)
+	case "character":
+		// Each character is looked up in vocab by the WordPiece model.
+		charPreTokenizer := NewWordPreTokenizer(NewCharacterTokenizer())
+		tk.WithPreTokenizer(pretokenizer.NewSequence([]tokenizer.PreTokenizer{wordPreTokenizer, charPreTokenizer}))
+	default:
+		err := fmt.Errorf("BertJapaneseTokenizerFromPretrained() failed: unsupported subword tokenizer type %q.", config.SubwordTokenizerType)
+		return nil, err
+	}
+
+	var specialTokens []tokenizer.AddedToken
+	specialTokens = append(specialTokens, tokenizer.NewAddedToken("[MASK]", true))
+	tk.AddSpecialTokens(specialTokens)
+
+	sepId, ok := tk.TokenToId("[SEP]")
+	if !ok {
+		err := fmt.Errorf("BertJapaneseTokenizerFromPretrained() failed: cannot find ID for [SEP] token.")
+		return nil, err
+	}
+	sep := processor.PostToken{Id: sepId, Value: "[SEP]"}
+
+	clsId, ok := tk.TokenToId("[CLS]")
+	if !ok {
+		err := fmt.Errorf("BertJapaneseTokenizerFromPretrained() failed: cannot find ID for [CLS] token.")
+		return nil, err
+	}
+	cls := processor.PostToken{Id: clsId, Value: "[CLS]"}
+
+	postProcess := processor.NewBertProcessing(sep, cls)
+	tk.WithPostProcessor(postProcess)
 
-	panic("Not implemented yet.")
+	return tk, nil
 }
 
 type Tokenizer struct {
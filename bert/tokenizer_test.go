@@ -1,10 +1,13 @@
 package bert_test
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 
 	"github.com/yinziyang/transformer/bert"
+	"github.com/yinziyang/transformer/util"
 )
 
 func TestBertTokenizer(t *testing.T) {
@@ -22,3 +25,56 @@ func TestBertTokenizer(t *testing.T) {
 		t.Errorf("Got %v\n", gotVocabSize)
 	}
 }
+
+// writeJapaneseModel writes vocab and tokenizer config of a tiny BERT Japanese model and returns its directory.
+func writeJapaneseModel(t *testing.T, tokenizerConfig string) string {
+	dir := t.TempDir()
+	vocab := "[PAD]\n[UNK]\n[CLS]\n[SEP]\n[MASK]\n東\n京\n"
+	if err := os.WriteFile(filepath.Join(dir, "vocab.txt"), []byte(vocab), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tokenizer_config.json"), []byte(tokenizerConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func TestBertJapaneseTokenizerFromPretrained(t *testing.T) {
+	cachedDir := util.CachedDir
+	util.CachedDir = t.TempDir()
+	defer func() {
+		util.CachedDir = cachedDir
+	}()
+
+	dir := writeJapaneseModel(t, `{"word_tokenizer_type": "basic", "subword_tokenizer_type": "character"}`)
+	tk, err := bert.BertJapaneseTokenizerFromPretrained(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoding, err := tk.EncodeSingle("東京", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantTokens := []string{"[CLS]", "東", "京", "[SEP]"}
+	if !reflect.DeepEqual(wantTokens, encoding.Tokens) {
+		t.Errorf("Want tokens: %q\n", wantTokens)
+		t.Errorf("Got tokens: %q\n", encoding.Tokens)
+	}
+
+	invalidConfigs := []struct {
+		name   string
+		config string
+	}{
+		{"invalid json", `{"word_tokenizer_type": `},
+		{"unsupported word tokenizer", `{"word_tokenizer_type": "jumanpp"}`},
+		{"unsupported subword tokenizer", `{"word_tokenizer_type": "basic", "subword_tokenizer_type": "sentencepiece"}`},
+		{"mecab without dictionary", `{"word_tokenizer_type": "mecab"}`},
+	}
+	for _, tt := range invalidConfigs {
+		dir := writeJapaneseModel(t, tt.config)
+		if _, err := bert.BertJapaneseTokenizerFromPretrained(dir, nil); err == nil {
+			t.Errorf("%v - want error\n", tt.name)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package data
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// conllStream reads token classification examples from CoNLL files.
+type conllStream struct {
+	scanner *bufio.Scanner
+	line    int
+	eof     bool
+}
+
+// NewCoNLLStream creates a stream of token classification examples from CoNLL-2003 data:
+// one word per line with whitespace separated columns, the first column being the word and the
+// last one its tag (e.g. BIO named entity tag). Sentences are separated by empty lines and
+// "-DOCSTART-" lines are skipped.
+func NewCoNLLStream(r io.Reader) Stream {
+	return &conllStream{scanner: bufio.NewScanner(r)}
+}
+
+func (s *conllStream) Next() (*Example, error) {
+	e := new(Example)
+	for !s.eof {
+		if !s.scanner.Scan() {
+			if err := s.scanner.Err(); err != nil {
+				return nil, err
+			}
+			s.eof = true
+			break
+		}
+		s.line++
+
+		fields := strings.Fields(s.scanner.Text())
+		if len(fields) == 0 {
+			if len(e.Words) > 0 {
+				return e, nil
+			}
+			continue
+		}
+		if fields[0] == "-DOCSTART-" {
+			continue
+		}
+		if len(fields) < 2 {
+			err := fmt.Errorf("Reading CoNLL failed at line %v: want word and tag columns, got %q.", s.line, s.scanner.Text())
+			return nil, err
+		}
+
+		e.Words = append(e.Words, fields[0])
+		e.Tags = append(e.Tags, fields[len(fields)-1])
+	}
+
+	if len(e.Words) > 0 {
+		return e, nil
+	}
+
+	return nil, io.EOF
+}
+
+// LoadCoNLL loads token classification examples from a CoNLL file.
+func LoadCoNLL(path string) (*MapDataset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Collect(NewCoNLLStream(f))
+}
+
+// IgnoreIndex is the label id of tokens which are not labeled. It is equal to `bert.IgnoreIndex`
+// so that these tokens are ignored by task losses.
+const IgnoreIndex int64 = -100
+
+// AlignLabels aligns word labels to sub-word tokens of an encoding.
+//
+// Params:
+//   - wordIds: word index of each token, -1 for special and padding tokens (`Encoding.Words`).
+//   - labels: label id of each word.
+//   - labelAllTokens: whether continuation sub-words of a word get the word label. Otherwise only
+//     the first sub-word is labeled.
+//
+// Returns label id of each token, `IgnoreIndex` for tokens which are not labeled.
+func AlignLabels(wordIds []int, labels []int64, labelAllTokens bool) ([]int64, error) {
+	aligned := make([]int64, len(wordIds))
+	previous := -1
+	for i, word := range wordIds {
+		switch {
+		case word < 0:
+			aligned[i] = IgnoreIndex
+		case word >= len(labels):
+			err := fmt.Errorf("AlignLabels() failed: word index %v out of %v labels.", word, len(labels))
+			return nil, err
+		case word != previous || labelAllTokens:
+			aligned[i] = labels[word]
+		default:
+			aligned[i] = IgnoreIndex
+		}
+		previous = word
+	}
+
+	return aligned, nil
+}
@@ -0,0 +1,68 @@
+package data_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yinziyang/transformer/data"
+)
+
+func TestNewCoNLLStream(t *testing.T) {
+	input := `-DOCSTART- -X- -X- O
+
+EU NNP B-NP B-ORG
+rejects VBZ B-VP O
+German JJ B-NP B-MISC
+
+Peter NNP B-NP B-PER
+Blackburn NNP I-NP I-PER
+`
+	d, err := data.Collect(data.NewCoNLLStream(strings.NewReader(input)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []data.Example{
+		{Words: []string{"EU", "rejects", "German"}, Tags: []string{"B-ORG", "O", "B-MISC"}},
+		{Words: []string{"Peter", "Blackburn"}, Tags: []string{"B-PER", "I-PER"}},
+	}
+	if d.Len() != len(want) {
+		t.Fatalf("Want %v examples, got %v\n", len(want), d.Len())
+	}
+	for i := range want {
+		if got := *d.Example(i); !reflect.DeepEqual(want[i], got) {
+			t.Errorf("Want example: %+v\n", want[i])
+			t.Errorf("Got example: %+v\n", got)
+		}
+	}
+}
+
+func TestAlignLabels(t *testing.T) {
+	// [CLS] EU re ##ject ##s German [SEP] [PAD]
+	wordIds := []int{-1, 0, 1, 1, 1, 2, -1, -1}
+	labels := []int64{3, 0, 7}
+	ignore := data.IgnoreIndex
+
+	tests := []struct {
+		labelAllTokens bool
+		want           []int64
+	}{
+		{false, []int64{ignore, 3, 0, ignore, ignore, 7, ignore, ignore}},
+		{true, []int64{ignore, 3, 0, 0, 0, 7, ignore, ignore}},
+	}
+	for _, tt := range tests {
+		got, err := data.AlignLabels(wordIds, labels, tt.labelAllTokens)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(tt.want, got) {
+			t.Errorf("Want aligned labels (all tokens: %v): %v\n", tt.labelAllTokens, tt.want)
+			t.Errorf("Got aligned labels: %v\n", got)
+		}
+	}
+
+	if _, err := data.AlignLabels([]int{0, 3}, labels, false); err == nil {
+		t.Errorf("Want error for word index out of labels\n")
+	}
+}
@@ -0,0 +1,234 @@
+package data
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+)
+
+// Datasets:
+// =========
+//
+// Examples are held by datasets of two kinds:
+//   - map datasets (`Dataset`): examples are in memory and accessed by index, e.g. to be
+//     shuffled and batched by `Batches` or `BucketBatches`.
+//   - streaming datasets (`Stream`): examples are read one by one, e.g. from a large file.
+//     They can be shuffled with a buffer (`NewShuffleStream`) and batched with `ReadBatch`.
+//
+// Readers (`NewJSONLStream`, `NewCSVStream`, `ReadSQuAD`, `NewCoNLLStream`) create examples of
+// text classification, question answering and token classification tasks.
+
+// Answer is an answer span of a question answering example.
+type Answer struct {
+	Text  string // answer text.
+	Start int    // byte offset of answer in context.
+}
+
+// Example is an example of a text classification, question answering or token classification
+// dataset. Fields which are not used by a task are empty.
+type Example struct {
+	Id string
+
+	// Text classification.
+	Text     string
+	TextPair string // optional second sentence, e.g. hypothesis of natural language inference.
+	Label    string // class name or float target for regression.
+
+	// Question answering.
+	Question string
+	Context  string
+	Answers  []Answer // empty for unanswerable questions (SQuAD v2).
+
+	// Token classification.
+	Words []string
+	Tags  []string // one tag per word, e.g. BIO tags.
+}
+
+// Dataset is a map dataset of examples accessed by index.
+type Dataset interface {
+	// Len returns number of examples.
+	Len() int
+	// Example returns example at index `i`.
+	Example(i int) *Example
+}
+
+// MapDataset is an in-memory dataset.
+type MapDataset struct {
+	examples []*Example
+}
+
+var _ Dataset = new(MapDataset)
+
+// NewMapDataset creates a MapDataset of examples.
+func NewMapDataset(examples []*Example) *MapDataset {
+	return &MapDataset{examples}
+}
+
+// Len returns number of examples.
+func (d *MapDataset) Len() int {
+	return len(d.examples)
+}
+
+// Example returns example at index `i`.
+func (d *MapDataset) Example(i int) *Example {
+	return d.examples[i]
+}
+
+// Shuffle returns a dataset of the same examples in an order shuffled with `seed`.
+func (d *MapDataset) Shuffle(seed int64) *MapDataset {
+	examples := make([]*Example, len(d.examples))
+	for i, j := range rand.New(rand.NewSource(seed)).Perm(len(d.examples)) {
+		examples[i] = d.examples[j]
+	}
+
+	return &MapDataset{examples}
+}
+
+// Split splits dataset into its first `n` examples and the remaining ones.
+func (d *MapDataset) Split(n int) (*MapDataset, *MapDataset, error) {
+	if n < 0 || n > len(d.examples) {
+		err := fmt.Errorf("Split() failed: invalid size %v for dataset of %v examples.", n, len(d.examples))
+		return nil, nil, err
+	}
+
+	return &MapDataset{d.examples[:n]}, &MapDataset{d.examples[n:]}, nil
+}
+
+// Stream returns a stream over examples of dataset.
+func (d *MapDataset) Stream() Stream {
+	return &sliceStream{examples: d.examples}
+}
+
+// LabelList returns sorted distinct labels of text classification examples or tags of
+// token classification examples of dataset.
+func LabelList(d Dataset) []string {
+	seen := make(map[string]bool)
+	for i := 0; i < d.Len(); i++ {
+		e := d.Example(i)
+		if e.Label != "" {
+			seen[e.Label] = true
+		}
+		for _, tag := range e.Tags {
+			seen[tag] = true
+		}
+	}
+
+	labels := make([]string, 0, len(seen))
+	for label := range seen {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+
+	return labels
+}
+
+// Stream is a streaming dataset of examples read one by one.
+type Stream interface {
+	// Next returns next example, or `io.EOF` at the end of stream.
+	Next() (*Example, error)
+}
+
+// Collect reads all remaining examples of stream into a MapDataset.
+func Collect(s Stream) (*MapDataset, error) {
+	var examples []*Example
+	for {
+		e, err := s.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		examples = append(examples, e)
+	}
+
+	return &MapDataset{examples}, nil
+}
+
+// ReadBatch reads up to `batchSize` examples from stream. The last batch may be smaller.
+// It returns `io.EOF` when stream has no more examples.
+func ReadBatch(s Stream, batchSize int) ([]*Example, error) {
+	var batch []*Example
+	for len(batch) < batchSize {
+		e, err := s.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		batch = append(batch, e)
+	}
+
+	if len(batch) == 0 {
+		return nil, io.EOF
+	}
+
+	return batch, nil
+}
+
+// sliceStream streams examples of a slice.
+type sliceStream struct {
+	examples []*Example
+	next     int
+}
+
+func (s *sliceStream) Next() (*Example, error) {
+	if s.next >= len(s.examples) {
+		return nil, io.EOF
+	}
+	s.next++
+
+	return s.examples[s.next-1], nil
+}
+
+// shuffleStream shuffles a stream with a buffer of examples.
+type shuffleStream struct {
+	stream Stream
+	buffer []*Example
+	size   int
+	rng    *rand.Rand
+	eof    bool
+}
+
+// NewShuffleStream shuffles examples of stream `s` with a buffer of `bufferSize` examples:
+// the buffer is filled from stream, then each example is drawn at random from buffer and
+// replaced with the next example of stream. Larger buffers give better shuffling.
+func NewShuffleStream(s Stream, bufferSize int, seed int64) Stream {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+
+	return &shuffleStream{
+		stream: s,
+		size:   bufferSize,
+		rng:    rand.New(rand.NewSource(seed)),
+	}
+}
+
+func (s *shuffleStream) Next() (*Example, error) {
+	for !s.eof && len(s.buffer) < s.size {
+		e, err := s.stream.Next()
+		if err == io.EOF {
+			s.eof = true
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.buffer = append(s.buffer, e)
+	}
+
+	if len(s.buffer) == 0 {
+		return nil, io.EOF
+	}
+
+	i := s.rng.Intn(len(s.buffer))
+	e := s.buffer[i]
+	last := len(s.buffer) - 1
+	s.buffer[i] = s.buffer[last]
+	s.buffer = s.buffer[:last]
+
+	return e, nil
+}
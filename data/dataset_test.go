@@ -0,0 +1,99 @@
+package data_test
+
+import (
+	"io"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/yinziyang/transformer/data"
+)
+
+func newTestDataset(n int) *data.MapDataset {
+	var examples []*data.Example
+	for i := 0; i < n; i++ {
+		examples = append(examples, &data.Example{Id: string(rune('a' + i))})
+	}
+
+	return data.NewMapDataset(examples)
+}
+
+func ids(d data.Dataset) []string {
+	var ids []string
+	for i := 0; i < d.Len(); i++ {
+		ids = append(ids, d.Example(i).Id)
+	}
+
+	return ids
+}
+
+func TestMapDataset_Shuffle(t *testing.T) {
+	d := newTestDataset(10)
+
+	shuffled := ids(d.Shuffle(1))
+	if again := ids(d.Shuffle(1)); !reflect.DeepEqual(shuffled, again) {
+		t.Errorf("Want same order with same seed: %v\n", shuffled)
+		t.Errorf("Got: %v\n", again)
+	}
+	if reflect.DeepEqual(shuffled, ids(d)) {
+		t.Errorf("Want shuffled order, got: %v\n", shuffled)
+	}
+
+	sort.Strings(shuffled)
+	if !reflect.DeepEqual(shuffled, ids(d)) {
+		t.Errorf("Want same examples: %v\n", ids(d))
+		t.Errorf("Got: %v\n", shuffled)
+	}
+}
+
+func TestShuffleStream(t *testing.T) {
+	d := newTestDataset(10)
+
+	shuffled, err := data.Collect(data.NewShuffleStream(d.Stream(), 4, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := ids(shuffled)
+	if reflect.DeepEqual(got, ids(d)) {
+		t.Errorf("Want shuffled order, got: %v\n", got)
+	}
+	sort.Strings(got)
+	if !reflect.DeepEqual(got, ids(d)) {
+		t.Errorf("Want same examples: %v\n", ids(d))
+		t.Errorf("Got: %v\n", got)
+	}
+}
+
+func TestReadBatch(t *testing.T) {
+	s := newTestDataset(5).Stream()
+
+	var sizes []int
+	for {
+		batch, err := data.ReadBatch(s, 2)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, len(batch))
+	}
+
+	want := []int{2, 2, 1}
+	if !reflect.DeepEqual(want, sizes) {
+		t.Errorf("Want batch sizes: %v\n", want)
+		t.Errorf("Got batch sizes: %v\n", sizes)
+	}
+}
+
+func TestLabelList(t *testing.T) {
+	d := data.NewMapDataset([]*data.Example{
+		{Label: "pos"}, {Label: "neg"}, {Tags: []string{"O", "B-PER"}}, {Label: "pos"},
+	})
+
+	want := []string{"B-PER", "O", "neg", "pos"}
+	if got := data.LabelList(d); !reflect.DeepEqual(want, got) {
+		t.Errorf("Want labels: %v\n", want)
+		t.Errorf("Got labels: %v\n", got)
+	}
+}
@@ -0,0 +1,92 @@
+package data
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// DefaultBucketMultiplier is the number of batches of a bucket sorted by length in `BucketBatches`.
+const DefaultBucketMultiplier int = 50
+
+// Batches splits indices of `n` examples into batches of `batchSize`.
+//
+// Params:
+//   - n: number of examples.
+//   - batchSize: number of examples of a batch.
+//   - shuffle: whether to shuffle indices with `seed`, otherwise batches are in order.
+//   - seed: shuffling seed.
+//   - dropLast: whether to drop the last batch if it is smaller than `batchSize`.
+func Batches(n, batchSize int, shuffle bool, seed int64, dropLast bool) ([][]int, error) {
+	if batchSize < 1 {
+		err := fmt.Errorf("Batches() failed: invalid batch size (%v).", batchSize)
+		return nil, err
+	}
+
+	var indices []int
+	if shuffle {
+		indices = rand.New(rand.NewSource(seed)).Perm(n)
+	} else {
+		indices = make([]int, n)
+		for i := range indices {
+			indices[i] = i
+		}
+	}
+
+	return split(indices, batchSize, dropLast), nil
+}
+
+// BucketBatches splits indices of examples into batches of examples of similar length to
+// reduce padding, as `group_by_length` of HuggingFace trainer does.
+//
+// Indices are shuffled with `seed` and grouped into buckets of `bucketMultiplier * batchSize`
+// examples. Each bucket is sorted by decreasing length and split into batches, then batches
+// are shuffled so that the order of batch lengths is random.
+//
+// Params:
+//   - lengths: length (e.g. number of tokens) of each example.
+//   - batchSize: number of examples of a batch.
+//   - bucketMultiplier: number of batches of a bucket. If < 1, `DefaultBucketMultiplier` is used.
+//   - seed: shuffling seed.
+func BucketBatches(lengths []int, batchSize, bucketMultiplier int, seed int64) ([][]int, error) {
+	if batchSize < 1 {
+		err := fmt.Errorf("BucketBatches() failed: invalid batch size (%v).", batchSize)
+		return nil, err
+	}
+	if bucketMultiplier < 1 {
+		bucketMultiplier = DefaultBucketMultiplier
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	indices := rng.Perm(len(lengths))
+
+	var batches [][]int
+	for _, bucket := range split(indices, bucketMultiplier*batchSize, false) {
+		sort.SliceStable(bucket, func(i, j int) bool {
+			return lengths[bucket[i]] > lengths[bucket[j]]
+		})
+		batches = append(batches, split(bucket, batchSize, false)...)
+	}
+	rng.Shuffle(len(batches), func(i, j int) {
+		batches[i], batches[j] = batches[j], batches[i]
+	})
+
+	return batches, nil
+}
+
+// split splits indices into chunks of `size`.
+func split(indices []int, size int, dropLast bool) [][]int {
+	var chunks [][]int
+	for start := 0; start < len(indices); start += size {
+		end := start + size
+		if end > len(indices) {
+			if dropLast {
+				break
+			}
+			end = len(indices)
+		}
+		chunks = append(chunks, indices[start:end])
+	}
+
+	return chunks
+}
@@ -0,0 +1,70 @@
+package data_test
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/yinziyang/transformer/data"
+)
+
+func TestBatches(t *testing.T) {
+	batches, err := data.Batches(5, 2, false, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]int{{0, 1}, {2, 3}, {4}}
+	if !reflect.DeepEqual(want, batches) {
+		t.Errorf("Want batches: %v\n", want)
+		t.Errorf("Got batches: %v\n", batches)
+	}
+
+	batches, err = data.Batches(5, 2, true, 1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 2 {
+		t.Errorf("Want 2 batches without last one, got: %v\n", batches)
+	}
+
+	if _, err := data.Batches(5, 0, false, 0, false); err == nil {
+		t.Errorf("Want error for invalid batch size\n")
+	}
+}
+
+func TestBucketBatches(t *testing.T) {
+	lengths := make([]int, 64)
+	for i := range lengths {
+		lengths[i] = (i * 37) % 64
+	}
+
+	batches, err := data.BucketBatches(lengths, 8, 8, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// With a single bucket, each batch holds 8 consecutive lengths.
+	var all []int
+	for _, batch := range batches {
+		minLen, maxLen := lengths[batch[0]], lengths[batch[0]]
+		for _, i := range batch {
+			if lengths[i] < minLen {
+				minLen = lengths[i]
+			}
+			if lengths[i] > maxLen {
+				maxLen = lengths[i]
+			}
+		}
+		if maxLen-minLen != 7 {
+			t.Errorf("Want batch of similar lengths, got lengths from %v to %v\n", minLen, maxLen)
+		}
+		all = append(all, batch...)
+	}
+
+	sort.Ints(all)
+	for i, index := range all {
+		if index != i {
+			t.Fatalf("Want each example in exactly one batch, got: %v\n", all)
+		}
+	}
+}
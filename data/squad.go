@@ -0,0 +1,94 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// squadFile is the JSON layout of SQuAD v1.1 and v2.0 files.
+type squadFile struct {
+	Data []struct {
+		Title      string `json:"title"`
+		Paragraphs []struct {
+			Context string `json:"context"`
+			Qas     []struct {
+				Id           string `json:"id"`
+				Question     string `json:"question"`
+				IsImpossible bool   `json:"is_impossible"`
+				Answers      []struct {
+					Text        string `json:"text"`
+					AnswerStart int    `json:"answer_start"`
+				} `json:"answers"`
+			} `json:"qas"`
+		} `json:"paragraphs"`
+	} `json:"data"`
+}
+
+// ReadSQuAD reads question answering examples from SQuAD v1.1 or v2.0 JSON.
+//
+// Each question is an example with its paragraph as context. Unanswerable questions of
+// SQuAD v2.0 (`is_impossible`) have no answers. Answer starts are converted from character
+// offsets of SQuAD to byte offsets of Go strings, as tokenizer offsets are.
+func ReadSQuAD(r io.Reader) (*MapDataset, error) {
+	var file squadFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		err = fmt.Errorf("Reading SQuAD failed: %w", err)
+		return nil, err
+	}
+
+	var examples []*Example
+	for _, article := range file.Data {
+		for _, paragraph := range article.Paragraphs {
+			for _, qa := range paragraph.Qas {
+				e := &Example{
+					Id:       qa.Id,
+					Question: qa.Question,
+					Context:  paragraph.Context,
+				}
+				if !qa.IsImpossible {
+					for _, answer := range qa.Answers {
+						start, ok := byteOffset(paragraph.Context, answer.AnswerStart)
+						if !ok || start+len(answer.Text) > len(paragraph.Context) {
+							err := fmt.Errorf("Reading SQuAD failed: answer %q of question %q is out of context.", answer.Text, qa.Id)
+							return nil, err
+						}
+						e.Answers = append(e.Answers, Answer{Text: answer.Text, Start: start})
+					}
+				}
+				examples = append(examples, e)
+			}
+		}
+	}
+
+	return NewMapDataset(examples), nil
+}
+
+// LoadSQuAD loads question answering examples from a SQuAD JSON file.
+func LoadSQuAD(path string) (*MapDataset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadSQuAD(f)
+}
+
+// byteOffset returns byte offset of character at index `i` of `s`.
+func byteOffset(s string, i int) (int, bool) {
+	if i < 0 {
+		return 0, false
+	}
+
+	var n int
+	for offset := range s {
+		if n == i {
+			return offset, true
+		}
+		n++
+	}
+
+	return len(s), n == i
+}
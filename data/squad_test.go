@@ -0,0 +1,42 @@
+package data_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yinziyang/transformer/data"
+)
+
+func TestReadSQuAD(t *testing.T) {
+	input := `{"version": "v2.0", "data": [{"title": "t", "paragraphs": [{
+		"context": "Café Müller is in Paris.",
+		"qas": [
+			{"id": "q1", "question": "Where?", "answers": [{"text": "Paris", "answer_start": 18}]},
+			{"id": "q2", "question": "When?", "is_impossible": true, "answers": []}
+		]}]}]}`
+
+	d, err := data.ReadSQuAD(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Len() != 2 {
+		t.Fatalf("Want 2 examples, got %v\n", d.Len())
+	}
+
+	e := d.Example(0)
+	// Character offset 18 is byte offset 20 after "é" and "ü".
+	want := []data.Answer{{Text: "Paris", Start: 20}}
+	if !reflect.DeepEqual(want, e.Answers) {
+		t.Errorf("Want answers: %+v\n", want)
+		t.Errorf("Got answers: %+v\n", e.Answers)
+	}
+	if got := e.Context[e.Answers[0].Start : e.Answers[0].Start+len(e.Answers[0].Text)]; got != "Paris" {
+		t.Errorf("Want answer span: Paris\n")
+		t.Errorf("Got answer span: %v\n", got)
+	}
+
+	if e := d.Example(1); e.Id != "q2" || len(e.Answers) != 0 {
+		t.Errorf("Want unanswerable question q2 without answers, got: %+v\n", e)
+	}
+}
@@ -0,0 +1,196 @@
+package data
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// TextColumns names fields (JSONL) or header columns (CSV) of text classification data.
+type TextColumns struct {
+	Text     string
+	TextPair string // optional, empty if examples are single sentences.
+	Label    string // optional, empty for unlabeled data.
+}
+
+// DefaultTextColumns returns columns "text" and "label".
+func DefaultTextColumns() TextColumns {
+	return TextColumns{Text: "text", Label: "label"}
+}
+
+// jsonlStream reads text classification examples from JSON lines.
+type jsonlStream struct {
+	scanner *bufio.Scanner
+	columns TextColumns
+	line    int
+}
+
+// NewJSONLStream creates a stream of text classification examples from JSON lines, one
+// JSON object per line. Empty lines are skipped. Labels may be strings, numbers or booleans.
+func NewJSONLStream(r io.Reader, columns TextColumns) Stream {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	return &jsonlStream{scanner: scanner, columns: columns}
+}
+
+func (s *jsonlStream) Next() (*Example, error) {
+	for s.scanner.Scan() {
+		s.line++
+		line := s.scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var record map[string]interface{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			err = fmt.Errorf("Reading JSONL failed at line %v: %w", s.line, err)
+			return nil, err
+		}
+
+		get := func(name string) (string, error) {
+			if name == "" {
+				return "", nil
+			}
+			value, ok := record[name]
+			if !ok {
+				err := fmt.Errorf("Reading JSONL failed at line %v: missing field %q.", s.line, name)
+				return "", err
+			}
+			return stringValue(value)
+		}
+
+		e := new(Example)
+		var err error
+		if e.Text, err = get(s.columns.Text); err != nil {
+			return nil, err
+		}
+		if e.TextPair, err = get(s.columns.TextPair); err != nil {
+			return nil, err
+		}
+		if e.Label, err = get(s.columns.Label); err != nil {
+			return nil, err
+		}
+		if id, ok := record["id"]; ok {
+			e.Id, _ = stringValue(id)
+		}
+
+		return e, nil
+	}
+
+	if err := s.scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, io.EOF
+}
+
+// stringValue converts a JSON value to string.
+func stringValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+
+	err := fmt.Errorf("Unsupported value %v of type %T.", value, value)
+	return "", err
+}
+
+// csvStream reads text classification examples from CSV records.
+type csvStream struct {
+	reader  *csv.Reader
+	columns []int // indices of text, text pair and label columns, -1 if not used.
+}
+
+// NewCSVStream creates a stream of text classification examples from CSV data with a header
+// row naming columns. Use `comma` '\t' for TSV data, or 0 for the default ','.
+func NewCSVStream(r io.Reader, columns TextColumns, comma rune) (Stream, error) {
+	reader := csv.NewReader(r)
+	if comma != 0 {
+		reader.Comma = comma
+	}
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		err = fmt.Errorf("Reading CSV header failed: %w", err)
+		return nil, err
+	}
+
+	s := &csvStream{reader: reader}
+	for _, name := range []string{columns.Text, columns.TextPair, columns.Label} {
+		index := -1
+		if name != "" {
+			for i, column := range header {
+				if column == name {
+					index = i
+				}
+			}
+			if index < 0 {
+				err := fmt.Errorf("Reading CSV failed: missing column %q.", name)
+				return nil, err
+			}
+		}
+		s.columns = append(s.columns, index)
+	}
+
+	return s, nil
+}
+
+func (s *csvStream) Next() (*Example, error) {
+	record, err := s.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]string, len(s.columns))
+	for i, index := range s.columns {
+		if index < 0 {
+			continue
+		}
+		if index >= len(record) {
+			line, _ := s.reader.FieldPos(0)
+			err := fmt.Errorf("Reading CSV failed at line %v: missing column %v.", line, index)
+			return nil, err
+		}
+		values[i] = record[index]
+	}
+
+	return &Example{Text: values[0], TextPair: values[1], Label: values[2]}, nil
+}
+
+// LoadJSONL loads text classification examples from a JSON lines file.
+func LoadJSONL(path string, columns TextColumns) (*MapDataset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Collect(NewJSONLStream(f, columns))
+}
+
+// LoadCSV loads text classification examples from a CSV file with a header row. Use `comma`
+// '\t' for TSV files, or 0 for the default ','.
+func LoadCSV(path string, columns TextColumns, comma rune) (*MapDataset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s, err := NewCSVStream(f, columns, comma)
+	if err != nil {
+		return nil, err
+	}
+
+	return Collect(s)
+}
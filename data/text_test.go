@@ -0,0 +1,64 @@
+package data_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yinziyang/transformer/data"
+)
+
+func TestNewJSONLStream(t *testing.T) {
+	input := `{"id": "1", "sentence1": "a b", "sentence2": "c", "label": 1}
+
+{"id": "2", "sentence1": "d", "sentence2": "e f", "label": 0.5}
+`
+	columns := data.TextColumns{Text: "sentence1", TextPair: "sentence2", Label: "label"}
+	d, err := data.Collect(data.NewJSONLStream(strings.NewReader(input), columns))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []data.Example{
+		{Id: "1", Text: "a b", TextPair: "c", Label: "1"},
+		{Id: "2", Text: "d", TextPair: "e f", Label: "0.5"},
+	}
+	if d.Len() != len(want) {
+		t.Fatalf("Want %v examples, got %v\n", len(want), d.Len())
+	}
+	for i := range want {
+		if got := *d.Example(i); !reflect.DeepEqual(want[i], got) {
+			t.Errorf("Want example: %+v\n", want[i])
+			t.Errorf("Got example: %+v\n", got)
+		}
+	}
+
+	_, err = data.Collect(data.NewJSONLStream(strings.NewReader(`{"text": "a"}`), data.DefaultTextColumns()))
+	if err == nil {
+		t.Errorf("Want error for missing label field\n")
+	}
+}
+
+func TestNewCSVStream(t *testing.T) {
+	input := "label\ttext\npos\t\"a, b\"\nneg\tc\n"
+	s, err := data.NewCSVStream(strings.NewReader(input), data.DefaultTextColumns(), '\t')
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := data.Collect(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []data.Example{{Text: "a, b", Label: "pos"}, {Text: "c", Label: "neg"}}
+	for i := range want {
+		if got := *d.Example(i); !reflect.DeepEqual(want[i], got) {
+			t.Errorf("Want example: %+v\n", want[i])
+			t.Errorf("Got example: %+v\n", got)
+		}
+	}
+
+	if _, err := data.NewCSVStream(strings.NewReader("a,b\n"), data.DefaultTextColumns(), 0); err == nil {
+		t.Errorf("Want error for missing columns\n")
+	}
+}
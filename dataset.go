@@ -0,0 +1,203 @@
+package transformer
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/ts"
+	"github.com/sugarme/tokenizer"
+
+	"github.com/yinziyang/transformer/data"
+	"github.com/yinziyang/transformer/pipeline"
+)
+
+// EncodedDataset is a dataset of tokenized examples and their labels. It implements `Dataset`:
+// batches are padded to their longest example, so that batching examples of similar length (see
+// `data.BucketBatches` and `Lengths`) reduces padding.
+type EncodedDataset struct {
+	tk        *pipeline.TokenizerOption
+	encodings []tokenizer.Encoding
+
+	classLabels    []int64   // class ids of text classification.
+	targets        []float64 // float targets of regression.
+	wordLabels     [][]int64 // word label ids of token classification.
+	labelAllTokens bool
+}
+
+var _ Dataset = new(EncodedDataset)
+
+// NewTextClassificationDataset encodes text classification examples (with their text pair
+// if any) with truncation options of tokenizer.
+//
+// Params:
+//   - tk: tokenizer.
+//   - d: examples with `Text`, optional `TextPair` and `Label`.
+//   - label2Id: class id of labels. If nil, labels are parsed as float targets of regression.
+//
+// Examples must be all labeled or all unlabeled (e.g. test data).
+func NewTextClassificationDataset(tk *pipeline.TokenizerOption, d data.Dataset, label2Id map[string]int64) (*EncodedDataset, error) {
+	ds := &EncodedDataset{tk: tk}
+	labeled := d.Len() > 0 && d.Example(0).Label != ""
+	for i := 0; i < d.Len(); i++ {
+		e := d.Example(i)
+
+		var (
+			encodings []tokenizer.Encoding
+			err       error
+		)
+		if e.TextPair != "" {
+			encodings, err = tk.EncodePairList([]string{e.Text}, []string{e.TextPair})
+		} else {
+			encodings, err = tk.EncodeList([]string{e.Text})
+		}
+		if err != nil {
+			return nil, err
+		}
+		ds.encodings = append(ds.encodings, encodings[0])
+
+		if labeled != (e.Label != "") {
+			err := fmt.Errorf("NewTextClassificationDataset() failed: example %v is not labeled as other examples are.", i)
+			return nil, err
+		}
+		if !labeled {
+			continue
+		}
+
+		if label2Id == nil {
+			target, err := strconv.ParseFloat(e.Label, 64)
+			if err != nil {
+				err = fmt.Errorf("NewTextClassificationDataset() failed: invalid regression target of example %v: %w", i, err)
+				return nil, err
+			}
+			ds.targets = append(ds.targets, target)
+			continue
+		}
+
+		id, ok := label2Id[e.Label]
+		if !ok {
+			err := fmt.Errorf("NewTextClassificationDataset() failed: unknown label %q of example %v.", e.Label, i)
+			return nil, err
+		}
+		ds.classLabels = append(ds.classLabels, id)
+	}
+
+	return ds, nil
+}
+
+// NewTokenClassificationDataset encodes pre-tokenized words of token classification examples
+// with truncation options of tokenizer. Word tags are aligned to sub-word tokens with `data.AlignLabels`.
+//
+// Params:
+//   - tk: tokenizer.
+//   - d: examples with `Words` and `Tags`.
+//   - label2Id: label id of tags.
+//   - labelAllTokens: whether continuation sub-words get the tag of their word. Otherwise they
+//     are ignored by loss.
+func NewTokenClassificationDataset(tk *pipeline.TokenizerOption, d data.Dataset, label2Id map[string]int64, labelAllTokens bool) (*EncodedDataset, error) {
+	ds := &EncodedDataset{tk: tk, labelAllTokens: labelAllTokens}
+	for i := 0; i < d.Len(); i++ {
+		e := d.Example(i)
+		if len(e.Tags) != len(e.Words) {
+			err := fmt.Errorf("NewTokenClassificationDataset() failed: example %v has %v words and %v tags.", i, len(e.Words), len(e.Tags))
+			return nil, err
+		}
+
+		encodings, err := tk.EncodeWordsList([][]string{e.Words})
+		if err != nil {
+			return nil, err
+		}
+		ds.encodings = append(ds.encodings, encodings[0])
+
+		labels := make([]int64, len(e.Tags))
+		for j, tag := range e.Tags {
+			id, ok := label2Id[tag]
+			if !ok {
+				err := fmt.Errorf("NewTokenClassificationDataset() failed: unknown tag %q of example %v.", tag, i)
+				return nil, err
+			}
+			labels[j] = id
+		}
+		ds.wordLabels = append(ds.wordLabels, labels)
+	}
+
+	return ds, nil
+}
+
+// Len returns number of examples.
+func (ds *EncodedDataset) Len() int {
+	return len(ds.encodings)
+}
+
+// Lengths returns number of tokens of each example, e.g. for `data.BucketBatches`.
+func (ds *EncodedDataset) Lengths() []int {
+	lengths := make([]int, len(ds.encodings))
+	for i, e := range ds.encodings {
+		lengths[i] = e.Len()
+	}
+
+	return lengths
+}
+
+// Encoding returns encoding of example at index `i`.
+func (ds *EncodedDataset) Encoding(i int) tokenizer.Encoding {
+	return ds.encodings[i]
+}
+
+// Batch collates examples at given indices into a batch on `device`.
+//
+// `Labels` are class ids or float targets of shape (batch size) for text classification, and
+// label ids of shape (batch size, sequence length) for token classification. Unlabeled
+// datasets have no labels.
+func (ds *EncodedDataset) Batch(indices []int, device gotch.Device) (*Batch, error) {
+	encodings := make([]tokenizer.Encoding, len(indices))
+	for i, index := range indices {
+		if index < 0 || index >= len(ds.encodings) {
+			err := fmt.Errorf("Batch() failed: index %v out of dataset of %v examples.", index, len(ds.encodings))
+			return nil, err
+		}
+		encodings[i] = ds.encodings[index]
+	}
+
+	collated, err := ds.tk.Collate(encodings, device)
+	if err != nil {
+		return nil, err
+	}
+	batch := &Batch{
+		InputIds:      collated.InputIds,
+		AttentionMask: collated.AttentionMask,
+		TokenTypeIds:  collated.TokenTypeIds,
+		PositionIds:   collated.PositionIds,
+	}
+
+	switch {
+	case ds.classLabels != nil:
+		labels := make([]int64, len(indices))
+		for i, index := range indices {
+			labels[i] = ds.classLabels[index]
+		}
+		batch.Labels = ts.MustOfSlice(labels).MustTo(device, true)
+
+	case ds.targets != nil:
+		targets := make([]float32, len(indices))
+		for i, index := range indices {
+			targets[i] = float32(ds.targets[index])
+		}
+		batch.Labels = ts.MustOfSlice(targets).MustTo(device, true)
+
+	case ds.wordLabels != nil:
+		var labels []int64
+		for i, index := range indices {
+			aligned, err := data.AlignLabels(collated.WordIds[i], ds.wordLabels[index], ds.labelAllTokens)
+			if err != nil {
+				batch.Drop()
+				return nil, err
+			}
+			labels = append(labels, aligned...)
+		}
+		shape := collated.InputIds.MustSize()
+		batch.Labels = ts.MustOfSlice(labels).MustView(shape, true).MustTo(device, true)
+	}
+
+	return batch, nil
+}
@@ -0,0 +1,100 @@
+package transformer_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sugarme/gotch"
+
+	"github.com/yinziyang/transformer"
+	"github.com/yinziyang/transformer/bert"
+	"github.com/yinziyang/transformer/data"
+	"github.com/yinziyang/transformer/pipeline"
+)
+
+func newTestTokenizer(t *testing.T) *pipeline.TokenizerOption {
+	vocab := []string{"[PAD]", "[UNK]", "[CLS]", "[SEP]", "[MASK]", "a", "b", "##b", "c"}
+	vocabFile := filepath.Join(t.TempDir(), "vocab.txt")
+	err := os.WriteFile(vocabFile, []byte(strings.Join(vocab, "\n")), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pipeline.TokenizerOptionFromFile(pipeline.Bert, vocabFile)
+}
+
+func TestNewTextClassificationDataset(t *testing.T) {
+	tk := newTestTokenizer(t)
+	d := data.NewMapDataset([]*data.Example{
+		{Text: "a b c", Label: "pos"},
+		{Text: "a", TextPair: "c", Label: "neg"},
+	})
+
+	ds, err := transformer.NewTextClassificationDataset(tk, d, map[string]int64{"neg": 0, "pos": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{5, 5}; !reflect.DeepEqual(want, ds.Lengths()) {
+		t.Errorf("Want lengths: %v\n", want)
+		t.Errorf("Got lengths: %v\n", ds.Lengths())
+	}
+
+	batch, err := ds.Batch([]int{1, 0}, gotch.CPU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer batch.Drop()
+
+	wantTypeIds := []int64{0, 0, 0, 1, 1, 0, 0, 0, 0, 0}
+	if got := batch.TokenTypeIds.Int64Values(); !reflect.DeepEqual(wantTypeIds, got) {
+		t.Errorf("Want token type ids: %v\n", wantTypeIds)
+		t.Errorf("Got token type ids: %v\n", got)
+	}
+	wantLabels := []int64{0, 1}
+	if got := batch.Labels.Int64Values(); !reflect.DeepEqual(wantLabels, got) {
+		t.Errorf("Want labels: %v\n", wantLabels)
+		t.Errorf("Got labels: %v\n", got)
+	}
+
+	if _, err := transformer.NewTextClassificationDataset(tk, d, map[string]int64{"pos": 1}); err == nil {
+		t.Errorf("Want error for unknown label\n")
+	}
+}
+
+func TestNewTokenClassificationDataset(t *testing.T) {
+	tk := newTestTokenizer(t)
+	d := data.NewMapDataset([]*data.Example{
+		{Words: []string{"ab", "c"}, Tags: []string{"B-X", "O"}},
+		{Words: []string{"a"}, Tags: []string{"B-X"}},
+	})
+
+	ds, err := transformer.NewTokenClassificationDataset(tk, d, map[string]int64{"O": 0, "B-X": 1}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch, err := ds.Batch([]int{0, 1}, gotch.CPU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer batch.Drop()
+
+	// [CLS] a ##b c [SEP] and [CLS] a [SEP] [PAD] [PAD]
+	ignore := bert.IgnoreIndex
+	if data.IgnoreIndex != ignore {
+		t.Errorf("Want data.IgnoreIndex equal to bert.IgnoreIndex (%v), got %v\n", ignore, data.IgnoreIndex)
+	}
+	wantIds := []int64{2, 5, 7, 8, 3, 2, 5, 3, 0, 0}
+	wantLabels := []int64{ignore, 1, ignore, 0, ignore, ignore, 1, ignore, ignore, ignore}
+	if got := batch.InputIds.Int64Values(); !reflect.DeepEqual(wantIds, got) {
+		t.Errorf("Want input ids: %v\n", wantIds)
+		t.Errorf("Got input ids: %v\n", got)
+	}
+	if got := batch.Labels.Int64Values(); !reflect.DeepEqual(wantLabels, got) {
+		t.Errorf("Want labels: %v\n", wantLabels)
+		t.Errorf("Got labels: %v\n", got)
+	}
+}
@@ -119,26 +119,30 @@ func bertForMaskedLM() {
 		}
 	}
 
-	var tensors []ts.Tensor
+	var tensors []*ts.Tensor
 	for _, en := range encodings {
 		var tokInput []int64 = make([]int64, maxLen)
 		for i := 0; i < len(en.Ids); i++ {
 			tokInput[i] = int64(en.Ids[i])
 		}
 
-		tensors = append(tensors, *ts.TensorFrom(tokInput))
+		tensors = append(tensors, ts.TensorFrom(tokInput))
 	}
 
 	inputTensor := ts.MustStack(tensors, 0).MustTo(device, true)
 	// inputTensor.Print()
 
-	var output *ts.Tensor
+	var output *bert.ModelOutput
 	ts.NoGrad(func() {
-		output, _, _ = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, ts.None, ts.None, false)
+		output, err = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, ts.None, ts.None, ts.None, false)
 	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer output.Drop()
 
-	index1 := output.MustGet(0).MustGet(4).MustArgmax([]int64{0}, false, false).Int64Values()[0]
-	index2 := output.MustGet(1).MustGet(7).MustArgmax([]int64{0}, false, false).Int64Values()[0]
+	index1 := output.Logits.MustGet(0).MustGet(4).MustArgmax([]int64{0}, false, false).Int64Values()[0]
+	index2 := output.Logits.MustGet(1).MustGet(7).MustArgmax([]int64{0}, false, false).Int64Values()[0]
 
 	word1, ok := tk.IdToToken(int(index1))
 	if !ok {
@@ -197,32 +201,33 @@ func bertForSequenceClassification() {
 	}
 
 	fmt.Printf("encodings: %v\n", encodings)
-	var tensors []ts.Tensor
+	var tensors []*ts.Tensor
 	for _, en := range encodings {
 		var tokInput []int64 = make([]int64, maxLen)
 		for i := 0; i < len(en.Ids); i++ {
 			tokInput[i] = int64(en.Ids[i])
 		}
 
-		tensors = append(tensors, *ts.TensorFrom(tokInput))
+		tensors = append(tensors, ts.TensorFrom(tokInput))
 	}
 
 	inputTensor := ts.MustStack(tensors, 0).MustTo(device, true)
 	// inputTensor.Print()
 
-	var (
-		output                         *ts.Tensor
-		allHiddenStates, allAttentions []ts.Tensor
-	)
+	var output *bert.ModelOutput
 
 	ts.NoGrad(func() {
-		output, allHiddenStates, allAttentions = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, false)
+		output, err = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, ts.None, false)
 	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer output.Drop()
 
-	fmt.Printf("output size: %v\n", output.MustSize())
+	fmt.Printf("output size: %v\n", output.Logits.MustSize())
 
 	fmt.Printf("NumHiddenLayers: %v\n", config.NumHiddenLayers)
-	fmt.Printf("allHiddenStates length: %v\n", len(allHiddenStates))
-	fmt.Printf("allAttentions length: %v\n", len(allAttentions))
+	fmt.Printf("allHiddenStates length: %v\n", len(output.HiddenStates))
+	fmt.Printf("allAttentions length: %v\n", len(output.Attentions))
 
 }
@@ -0,0 +1,75 @@
+package generation
+
+import (
+	"math"
+	"sort"
+)
+
+// beamHypothesis is a finished sequence of beam search.
+type beamHypothesis struct {
+	tokens []int64
+	score  float64 // sum of log probabilities normalized by length penalty
+}
+
+// beamHypotheses keeps `numBeams` best finished sequences.
+type beamHypotheses struct {
+	numBeams      int
+	lengthPenalty float64
+	earlyStopping bool
+	hyps          []beamHypothesis
+	worstScore    float64
+}
+
+func newBeamHypotheses(numBeams int, lengthPenalty float64, earlyStopping bool) *beamHypotheses {
+	return &beamHypotheses{
+		numBeams:      numBeams,
+		lengthPenalty: lengthPenalty,
+		earlyStopping: earlyStopping,
+		worstScore:    1e9,
+	}
+}
+
+// normalize returns score of a sequence of `length` tokens with sum of log probabilities `sumLogProbs`.
+func (bh *beamHypotheses) normalize(sumLogProbs float64, length int) float64 {
+	return sumLogProbs / math.Pow(float64(length), bh.lengthPenalty)
+}
+
+// add adds a finished sequence, keeping only `numBeams` best ones.
+func (bh *beamHypotheses) add(tokens []int64, sumLogProbs float64) {
+	score := bh.normalize(sumLogProbs, len(tokens))
+	if len(bh.hyps) >= bh.numBeams && score <= bh.worstScore {
+		return
+	}
+
+	bh.hyps = append(bh.hyps, beamHypothesis{tokens: tokens, score: score})
+	sort.SliceStable(bh.hyps, func(i, j int) bool {
+		return bh.hyps[i].score > bh.hyps[j].score
+	})
+	if len(bh.hyps) > bh.numBeams {
+		bh.hyps = bh.hyps[:bh.numBeams]
+	}
+	bh.worstScore = bh.hyps[len(bh.hyps)-1].score
+}
+
+// isDone returns whether no running beam can beat finished sequences any more.
+//
+// `bestSumLogProbs` is the highest sum of log probabilities of running beams of `curLen` tokens.
+func (bh *beamHypotheses) isDone(bestSumLogProbs float64, curLen int) bool {
+	if len(bh.hyps) < bh.numBeams {
+		return false
+	}
+	if bh.earlyStopping {
+		return true
+	}
+
+	return bh.worstScore >= bh.normalize(bestSumLogProbs, curLen)
+}
+
+// best returns the best finished sequence.
+func (bh *beamHypotheses) best() []int64 {
+	if len(bh.hyps) == 0 {
+		return nil
+	}
+
+	return bh.hyps[0].tokens
+}
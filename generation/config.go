@@ -0,0 +1,65 @@
+package generation
+
+import (
+	"fmt"
+)
+
+// GenerateConfig holds options for text generation.
+type GenerateConfig struct {
+	MaxLength int // max length of generated sequence including prompt
+	MinLength int // min length of generated sequence including prompt before EOS is allowed
+
+	DoSample    bool    // sample next token instead of choosing the most likely one
+	Temperature float64 // divides logits before sampling. Lower is more deterministic.
+	TopK        int     // if > 0, sample from `TopK` most likely tokens only
+	TopP        float64 // if < 1, sample from the smallest set of most likely tokens with cumulative probability >= `TopP` (nucleus sampling)
+	Seed        int64   // seed of random number generator used for sampling
+
+	NumBeams      int     // number of beams for beam search. 1 means no beam search.
+	LengthPenalty float64 // exponent of length to divide beam scores by. > 0 favours longer sequences.
+	EarlyStopping bool    // stop beam search as soon as `NumBeams` sequences are finished
+
+	RepetitionPenalty float64 // penalty for tokens already in sequence. 1 means no penalty.
+	NoRepeatNgramSize int     // if > 0, ngrams of this size can only occur once
+
+	EosTokenId int64 // end of sequence token id. -1 if none.
+}
+
+// DefaultGenerateConfig returns default generation config: greedy decoding up to 20 tokens.
+func DefaultGenerateConfig() *GenerateConfig {
+	return &GenerateConfig{
+		MaxLength:         20,
+		MinLength:         0,
+		DoSample:          false,
+		Temperature:       1.0,
+		TopK:              0,
+		TopP:              1.0,
+		Seed:              0,
+		NumBeams:          1,
+		LengthPenalty:     1.0,
+		EarlyStopping:     false,
+		RepetitionPenalty: 1.0,
+		NoRepeatNgramSize: 0,
+		EosTokenId:        -1,
+	}
+}
+
+// validate checks generation config.
+func (c *GenerateConfig) validate() error {
+	switch {
+	case c.MaxLength <= 0:
+		return fmt.Errorf("Invalid generation config: MaxLength must be positive, got %v.", c.MaxLength)
+	case c.NumBeams < 1:
+		return fmt.Errorf("Invalid generation config: NumBeams must be at least 1, got %v.", c.NumBeams)
+	case c.NumBeams > 1 && c.DoSample:
+		return fmt.Errorf("Invalid generation config: sampling with beam search is not supported.")
+	case c.Temperature <= 0:
+		return fmt.Errorf("Invalid generation config: Temperature must be positive, got %v.", c.Temperature)
+	case c.TopP <= 0 || c.TopP > 1:
+		return fmt.Errorf("Invalid generation config: TopP must be in (0, 1], got %v.", c.TopP)
+	case c.RepetitionPenalty <= 0:
+		return fmt.Errorf("Invalid generation config: RepetitionPenalty must be positive, got %v.", c.RepetitionPenalty)
+	}
+
+	return nil
+}
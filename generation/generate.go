@@ -0,0 +1,268 @@
+package generation
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/ts"
+)
+
+// Cache is a model state (e.g. past keys and values) carried between decoding steps.
+type Cache interface {
+	// Reorder selects batch items by `index` (e.g. surviving beams) and returns
+	// new cache. The current cache is consumed.
+	Reorder(index *ts.Tensor) Cache
+	// Drop drops cached tensors.
+	Drop()
+}
+
+// LanguageModel is a model producing next-token logits, e.g. a decoder with language model head.
+type LanguageModel interface {
+	// ForwardStep forwards `inputIds` of shape (batch size, sequence length) and returns logits of
+	// next token of shape (batch size, vocab size) and updated cache.
+	//
+	// At first step, `cache` is nil and `inputIds` are the prompt. If the returned cache is not nil,
+	// next steps only pass new tokens with the returned cache. Otherwise, full sequences are passed.
+	ForwardStep(inputIds *ts.Tensor, cache Cache) (logits *ts.Tensor, next Cache, err error)
+}
+
+// Generate generates a sequence for each prompt.
+//
+// Params:
+//   - `model`: language model producing next-token logits.
+//   - `prompts`: token ids of prompts. Each prompt is generated separately (batch items of
+//     model inputs are beams).
+//   - `config`: generation config. If nil, `DefaultGenerateConfig()` is used.
+//   - `device`: device of model.
+//
+// Returns generated sequences including prompts (and EOS token if generated).
+func Generate(model LanguageModel, prompts [][]int64, config *GenerateConfig, device gotch.Device) ([][]int64, error) {
+	if config == nil {
+		config = DefaultGenerateConfig()
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewSource(config.Seed))
+
+	var outputs [][]int64
+	for _, prompt := range prompts {
+		if len(prompt) == 0 {
+			err := fmt.Errorf("Generate() failed: empty prompt.")
+			return nil, err
+		}
+
+		var (
+			output []int64
+			err    error
+		)
+		if config.NumBeams > 1 {
+			output, err = beamSearch(model, prompt, config, device)
+		} else {
+			output, err = sampleOrGreedy(model, prompt, config, rng, device)
+		}
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, output)
+	}
+
+	return outputs, nil
+}
+
+// processScores applies logits processors that are used by all decoding strategies.
+func processScores(scores []float64, sequence []int64, config *GenerateConfig) {
+	applyRepetitionPenalty(scores, sequence, config.RepetitionPenalty)
+	applyNoRepeatNgram(scores, sequence, config.NoRepeatNgramSize)
+	applyMinLength(scores, len(sequence), config.MinLength, config.EosTokenId)
+}
+
+// toTensor creates a tensor of shape (len(sequences), len(sequences[0])).
+func toTensor(sequences [][]int64, device gotch.Device) *ts.Tensor {
+	var data []int64
+	for _, s := range sequences {
+		data = append(data, s...)
+	}
+	shape := []int64{int64(len(sequences)), int64(len(sequences[0]))}
+
+	return ts.MustOfSlice(data).MustView(shape, true).MustTo(device, true)
+}
+
+// step forwards inputs and returns next-token logits per batch item.
+func step(model LanguageModel, input *ts.Tensor, cache Cache) ([][]float64, Cache, error) {
+	logits, next, err := model.ForwardStep(input, cache)
+	input.MustDrop()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	size := logits.MustSize()
+	values := logits.Float64Values(true)
+	vocabSize := int(size[len(size)-1])
+
+	var rows [][]float64
+	for i := 0; i < len(values); i += vocabSize {
+		rows = append(rows, values[i:i+vocabSize])
+	}
+
+	return rows, next, nil
+}
+
+// sampleOrGreedy generates a sequence by choosing the most likely token or sampling at each step.
+func sampleOrGreedy(model LanguageModel, prompt []int64, config *GenerateConfig, rng *rand.Rand, device gotch.Device) ([]int64, error) {
+	sequence := append([]int64{}, prompt...)
+
+	var cache Cache
+	for len(sequence) < config.MaxLength {
+		// Only new token is passed if model has cache.
+		newTokens := sequence
+		if cache != nil {
+			newTokens = sequence[len(sequence)-1:]
+		}
+		input := toTensor([][]int64{newTokens}, device)
+		rows, next, err := step(model, input, cache)
+		if err != nil {
+			return nil, err
+		}
+		cache = next
+
+		scores := rows[0]
+		processScores(scores, sequence, config)
+
+		var token int64
+		if config.DoSample {
+			applyTemperature(scores, config.Temperature)
+			applyTopK(scores, config.TopK)
+			applyTopP(scores, config.TopP)
+			token = sample(scores, rng)
+		} else {
+			token = argmax(scores)
+		}
+
+		sequence = append(sequence, token)
+		if token == config.EosTokenId {
+			break
+		}
+	}
+
+	if cache != nil {
+		cache.Drop()
+	}
+
+	return sequence, nil
+}
+
+// beamCandidate is a candidate token extending a beam.
+type beamCandidate struct {
+	beam  int
+	token int64
+	score float64 // sum of log probabilities
+}
+
+// beamSearch generates a sequence with beam search.
+func beamSearch(model LanguageModel, prompt []int64, config *GenerateConfig, device gotch.Device) ([]int64, error) {
+	numBeams := config.NumBeams
+
+	beams := make([][]int64, numBeams)
+	beamScores := make([]float64, numBeams)
+	for i := range beams {
+		beams[i] = append([]int64{}, prompt...)
+		// Only the first beam is active at first step as all beams are identical.
+		if i > 0 {
+			beamScores[i] = -1e9
+		}
+	}
+	hyps := newBeamHypotheses(numBeams, config.LengthPenalty, config.EarlyStopping)
+
+	input := toTensor(beams, device)
+	var (
+		cache Cache
+		done  bool
+	)
+	for curLen := len(prompt); curLen < config.MaxLength && !done; curLen++ {
+		rows, next, err := step(model, input, cache)
+		if err != nil {
+			return nil, err
+		}
+		cache = next
+
+		var candidates []beamCandidate
+		for b, row := range rows {
+			logProbs := logSoftmax(row)
+			processScores(logProbs, beams[b], config)
+			for tok, lp := range logProbs {
+				candidates = append(candidates, beamCandidate{b, int64(tok), beamScores[b] + lp})
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].score > candidates[j].score
+		})
+
+		// Keep the best `numBeams` non-EOS candidates as next beams. EOS candidates
+		// among the best `numBeams` finish their sequences.
+		var (
+			nextBeams  [][]int64
+			nextScores []float64
+			beamIdx    []int64
+		)
+		if len(candidates) > 2*numBeams {
+			candidates = candidates[:2*numBeams]
+		}
+		for rank, c := range candidates {
+			sequence := append(append([]int64{}, beams[c.beam]...), c.token)
+			if c.token == config.EosTokenId {
+				if rank < numBeams {
+					hyps.add(sequence, c.score)
+				}
+				continue
+			}
+			nextBeams = append(nextBeams, sequence)
+			nextScores = append(nextScores, c.score)
+			beamIdx = append(beamIdx, int64(c.beam))
+			if len(nextBeams) == numBeams {
+				break
+			}
+		}
+
+		// All kept candidates finished their sequences: no beam is left to extend.
+		if len(nextBeams) == 0 {
+			if cache != nil {
+				cache.Drop()
+			}
+			return hyps.best(), nil
+		}
+
+		done = hyps.isDone(nextScores[0], curLen+1)
+		beams, beamScores = nextBeams, nextScores
+
+		if cache != nil {
+			index := ts.MustOfSlice(beamIdx).MustTo(device, true)
+			cache = cache.Reorder(index)
+			index.MustDrop()
+
+			var tokens [][]int64
+			for _, b := range beams {
+				tokens = append(tokens, b[len(b)-1:])
+			}
+			input = toTensor(tokens, device)
+		} else {
+			input = toTensor(beams, device)
+		}
+	}
+	input.MustDrop()
+	if cache != nil {
+		cache.Drop()
+	}
+
+	// Running beams compete with finished sequences when max length is reached.
+	if !done {
+		for b, beam := range beams {
+			hyps.add(beam, beamScores[b])
+		}
+	}
+
+	return hyps.best(), nil
+}
@@ -0,0 +1,152 @@
+package generation_test
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/generation"
+)
+
+// bigramModel is a toy language model whose next-token probabilities only
+// depend on the last token. Vocab: 0 (start), 1, 2, 3 (EOS).
+type bigramModel struct{}
+
+var bigramProbs = [][]float64{
+	{0.01, 0.5, 0.4, 0.09},
+	{0.01, 0.33, 0.33, 0.33},
+	{0.02, 0.03, 0.05, 0.9},
+	{0.25, 0.25, 0.25, 0.25},
+}
+
+func (m *bigramModel) ForwardStep(inputIds *ts.Tensor, cache generation.Cache) (*ts.Tensor, generation.Cache, error) {
+	size := inputIds.MustSize()
+	ids := inputIds.Int64Values()
+
+	var logits []float64
+	for b := int64(0); b < size[0]; b++ {
+		last := ids[(b+1)*size[1]-1]
+		for _, p := range bigramProbs[last] {
+			logits = append(logits, math.Log(p))
+		}
+	}
+
+	return ts.MustOfSlice(logits).MustView([]int64{size[0], 4}, true), nil, nil
+}
+
+func TestGenerate(t *testing.T) {
+	newConfig := func(update func(c *generation.GenerateConfig)) *generation.GenerateConfig {
+		c := generation.DefaultGenerateConfig()
+		c.EosTokenId = 3
+		update(c)
+		return c
+	}
+
+	tests := []struct {
+		name   string
+		prompt []int64
+		config *generation.GenerateConfig
+		want   []int64
+	}{
+		{
+			name:   "greedy",
+			prompt: []int64{0},
+			config: newConfig(func(c *generation.GenerateConfig) { c.MaxLength = 3 }),
+			want:   []int64{0, 1, 1},
+		},
+		{
+			// 0-2-EOS (0.4*0.9) beats greedy path 0-1-x (0.5*0.33)
+			name:   "beam search",
+			prompt: []int64{0},
+			config: newConfig(func(c *generation.GenerateConfig) { c.MaxLength = 3; c.NumBeams = 2; c.LengthPenalty = 0 }),
+			want:   []int64{0, 2, 3},
+		},
+		{
+			name:   "no repeat ngram",
+			prompt: []int64{0},
+			config: newConfig(func(c *generation.GenerateConfig) { c.MaxLength = 5; c.NoRepeatNgramSize = 1 }),
+			want:   []int64{0, 1, 2, 3},
+		},
+		{
+			name:   "min length",
+			prompt: []int64{0, 2},
+			config: newConfig(func(c *generation.GenerateConfig) { c.MaxLength = 6; c.MinLength = 4 }),
+			want:   []int64{0, 2, 2, 2, 3},
+		},
+		{
+			name:   "repetition penalty",
+			prompt: []int64{0, 1},
+			config: newConfig(func(c *generation.GenerateConfig) { c.MaxLength = 3; c.RepetitionPenalty = 2.0 }),
+			want:   []int64{0, 1, 2},
+		},
+		{
+			name:   "top-k sampling with k=1 is greedy",
+			prompt: []int64{0},
+			config: newConfig(func(c *generation.GenerateConfig) { c.MaxLength = 3; c.DoSample = true; c.TopK = 1 }),
+			want:   []int64{0, 1, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := generation.Generate(new(bigramModel), [][]int64{tt.prompt}, tt.config, gotch.CPU)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(tt.want, got[0]) {
+			t.Errorf("%v - Want: %v\n", tt.name, tt.want)
+			t.Errorf("%v - Got: %v\n", tt.name, got[0])
+		}
+	}
+}
+
+// eosModel is a toy language model whose only token is EOS (0).
+type eosModel struct{}
+
+func (m *eosModel) ForwardStep(inputIds *ts.Tensor, cache generation.Cache) (*ts.Tensor, generation.Cache, error) {
+	size := inputIds.MustSize()
+	return ts.MustZeros([]int64{size[0], 1}, gotch.Double, gotch.CPU), nil, nil
+}
+
+// Beam search stops when every kept candidate is EOS.
+func TestGenerate_BeamSearchAllEos(t *testing.T) {
+	config := generation.DefaultGenerateConfig()
+	config.EosTokenId = 0
+	config.NumBeams = 2
+	config.MaxLength = 5
+
+	got, err := generation.Generate(new(eosModel), [][]int64{{0}}, config, gotch.CPU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int64{0, 0}
+	if !reflect.DeepEqual(want, got[0]) {
+		t.Errorf("Want: %v\n", want)
+		t.Errorf("Got: %v\n", got[0])
+	}
+}
+
+func TestGenerate_SeededSampling(t *testing.T) {
+	config := generation.DefaultGenerateConfig()
+	config.DoSample = true
+	config.TopP = 0.9
+	config.Temperature = 0.7
+	config.Seed = 42
+
+	prompts := [][]int64{{0}, {0}, {0}}
+	out1, err := generation.Generate(new(bigramModel), prompts, config, gotch.CPU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out2, err := generation.Generate(new(bigramModel), prompts, config, gotch.CPU)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(out1, out2) {
+		t.Errorf("Want same samples with same seed\n")
+		t.Errorf("Got: %v and %v\n", out1, out2)
+	}
+}
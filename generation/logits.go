@@ -0,0 +1,202 @@
+package generation
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Logits processing:
+// ==================
+//
+// Processors modify next-token scores (logits or log probabilities) of a
+// sequence in place. Banned tokens get a score of -Inf.
+
+var negInf = math.Inf(-1)
+
+// applyRepetitionPenalty penalizes tokens already in sequence (CTRL paper):
+// positive scores are divided and negative ones multiplied by `penalty`.
+func applyRepetitionPenalty(scores []float64, sequence []int64, penalty float64) {
+	if penalty == 1.0 {
+		return
+	}
+	seen := make(map[int64]bool, len(sequence))
+	for _, tok := range sequence {
+		if seen[tok] || int(tok) >= len(scores) {
+			continue
+		}
+		seen[tok] = true
+		if scores[tok] < 0 {
+			scores[tok] *= penalty
+		} else {
+			scores[tok] /= penalty
+		}
+	}
+}
+
+// bannedNgramTokens returns tokens that would repeat an ngram of size `n` already in sequence.
+func bannedNgramTokens(sequence []int64, n int) []int64 {
+	if n <= 0 || len(sequence)+1 < n {
+		return nil
+	}
+
+	prefix := sequence[len(sequence)-n+1:]
+	var banned []int64
+	for i := 0; i+n <= len(sequence); i++ {
+		match := true
+		for j := 0; j < n-1; j++ {
+			if sequence[i+j] != prefix[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			banned = append(banned, sequence[i+n-1])
+		}
+	}
+
+	return banned
+}
+
+// applyNoRepeatNgram bans tokens completing an ngram of size `n` already in sequence.
+func applyNoRepeatNgram(scores []float64, sequence []int64, n int) {
+	for _, tok := range bannedNgramTokens(sequence, n) {
+		scores[tok] = negInf
+	}
+}
+
+// applyMinLength bans EOS until sequence reaches `minLength`.
+func applyMinLength(scores []float64, curLen, minLength int, eosTokenId int64) {
+	if eosTokenId >= 0 && curLen < minLength {
+		scores[eosTokenId] = negInf
+	}
+}
+
+// applyTemperature divides scores by `temperature`.
+func applyTemperature(scores []float64, temperature float64) {
+	if temperature == 1.0 {
+		return
+	}
+	for i := range scores {
+		scores[i] /= temperature
+	}
+}
+
+// sortedIndices returns indices of scores sorted in descending order.
+func sortedIndices(scores []float64) []int {
+	idx := make([]int, len(scores))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		return scores[idx[a]] > scores[idx[b]]
+	})
+
+	return idx
+}
+
+// applyTopK keeps only `k` highest scores.
+func applyTopK(scores []float64, k int) {
+	if k <= 0 || k >= len(scores) {
+		return
+	}
+	for _, i := range sortedIndices(scores)[k:] {
+		scores[i] = negInf
+	}
+}
+
+// applyTopP keeps the smallest set of highest scores whose cumulative probability is at least `p`.
+// At least one token is always kept.
+func applyTopP(scores []float64, p float64) {
+	if p >= 1.0 {
+		return
+	}
+	probs := softmax(scores)
+	var cumProb float64
+	for rank, i := range sortedIndices(scores) {
+		if rank > 0 && cumProb >= p {
+			scores[i] = negInf
+			continue
+		}
+		cumProb += probs[i]
+	}
+}
+
+// softmax returns probabilities of scores.
+func softmax(scores []float64) []float64 {
+	max := negInf
+	for _, s := range scores {
+		if s > max {
+			max = s
+		}
+	}
+
+	probs := make([]float64, len(scores))
+	var sum float64
+	for i, s := range scores {
+		probs[i] = math.Exp(s - max)
+		sum += probs[i]
+	}
+	for i := range probs {
+		probs[i] /= sum
+	}
+
+	return probs
+}
+
+// logSoftmax returns log probabilities of scores.
+func logSoftmax(scores []float64) []float64 {
+	max := negInf
+	for _, s := range scores {
+		if s > max {
+			max = s
+		}
+	}
+
+	var sum float64
+	for _, s := range scores {
+		sum += math.Exp(s - max)
+	}
+	logSum := max + math.Log(sum)
+
+	out := make([]float64, len(scores))
+	for i, s := range scores {
+		out[i] = s - logSum
+	}
+
+	return out
+}
+
+// argmax returns index of the highest score.
+func argmax(scores []float64) int64 {
+	best := 0
+	for i, s := range scores {
+		if s > scores[best] {
+			best = i
+		}
+	}
+
+	return int64(best)
+}
+
+// sample draws a token from softmax distribution of scores.
+func sample(scores []float64, rng *rand.Rand) int64 {
+	probs := softmax(scores)
+	r := rng.Float64()
+	var cumProb float64
+	for i, p := range probs {
+		cumProb += p
+		if r < cumProb {
+			return int64(i)
+		}
+	}
+
+	// rounding error: return the last possible token.
+	for i := len(probs) - 1; i >= 0; i-- {
+		if probs[i] > 0 {
+			return int64(i)
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,207 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Average is an averaging method of per class scores.
+type Average int
+
+const (
+	AverageMicro    Average = iota // scores of all examples.
+	AverageMacro                   // mean of scores of classes.
+	AverageWeighted                // mean of scores of classes weighted by support.
+)
+
+// Accuracy returns the fraction of predictions equal to labels.
+func Accuracy(preds, labels []int) (float64, error) {
+	if err := checkLengths(len(preds), len(labels)); err != nil {
+		return 0, err
+	}
+	if len(labels) == 0 {
+		return 0, nil
+	}
+
+	var correct int
+	for i := range labels {
+		if preds[i] == labels[i] {
+			correct++
+		}
+	}
+
+	return float64(correct) / float64(len(labels)), nil
+}
+
+// ClassScores returns precision, recall and F1 of each class of single label classification.
+// Classes are those of labels and predictions.
+func ClassScores(preds, labels []int) (map[int]Score, error) {
+	if err := checkLengths(len(preds), len(labels)); err != nil {
+		return nil, err
+	}
+
+	var (
+		nTrue    = make(map[int]int)
+		nPred    = make(map[int]int)
+		nCorrect = make(map[int]int)
+	)
+	for i := range labels {
+		nTrue[labels[i]]++
+		nPred[preds[i]]++
+		if preds[i] == labels[i] {
+			nCorrect[labels[i]]++
+		}
+	}
+
+	scores := make(map[int]Score)
+	for _, counts := range []map[int]int{nTrue, nPred} {
+		for c := range counts {
+			scores[c] = prf(nCorrect[c], nPred[c], nTrue[c])
+		}
+	}
+
+	return scores, nil
+}
+
+// F1 returns F1 of single label classification averaged over classes with `average`.
+// Micro F1 equals accuracy.
+func F1(preds, labels []int, average Average) (float64, error) {
+	scores, err := ClassScores(preds, labels)
+	if err != nil {
+		return 0, err
+	}
+
+	switch average {
+	case AverageMicro:
+		return Accuracy(preds, labels)
+	case AverageMacro, AverageWeighted:
+		byName := make(map[string]Score)
+		for c, s := range scores {
+			byName[fmt.Sprint(c)] = s
+		}
+		macro, weighted := averages(byName)
+		if average == AverageMacro {
+			return macro.F1, nil
+		}
+		return weighted.F1, nil
+	}
+
+	err = fmt.Errorf("Unknown average %v.", average)
+	return 0, err
+}
+
+// MatthewsCorrCoef returns Matthews correlation coefficient of single label (binary or multiclass)
+// classification, in [-1, 1]. It is 0 if undefined, e.g. when all predictions are of a class.
+func MatthewsCorrCoef(preds, labels []int) (float64, error) {
+	if err := checkLengths(len(preds), len(labels)); err != nil {
+		return 0, err
+	}
+
+	var (
+		nTrue   = make(map[int]float64)
+		nPred   = make(map[int]float64)
+		correct float64
+		n       = float64(len(labels))
+	)
+	for i := range labels {
+		nTrue[labels[i]]++
+		nPred[preds[i]]++
+		if preds[i] == labels[i] {
+			correct++
+		}
+	}
+
+	var predTrue, predPred, trueTrue float64
+	for c, t := range nTrue {
+		predTrue += nPred[c] * t
+		trueTrue += t * t
+	}
+	for _, p := range nPred {
+		predPred += p * p
+	}
+
+	cov := correct*n - predTrue
+	denominator := math.Sqrt((n*n - predPred) * (n*n - trueTrue))
+	if denominator == 0 {
+		return 0, nil
+	}
+
+	return cov / denominator, nil
+}
+
+// Pearson returns Pearson correlation coefficient of `x` and `y`. It is NaN if either is constant.
+func Pearson(x, y []float64) (float64, error) {
+	if err := checkLengths(len(x), len(y)); err != nil {
+		return 0, err
+	}
+	if len(x) < 2 {
+		err := fmt.Errorf("Correlation needs at least 2 values, got %v.", len(x))
+		return 0, err
+	}
+
+	var meanX, meanY float64
+	for i := range x {
+		meanX += x[i]
+		meanY += y[i]
+	}
+	meanX /= float64(len(x))
+	meanY /= float64(len(y))
+
+	var cov, varX, varY float64
+	for i := range x {
+		dx, dy := x[i]-meanX, y[i]-meanY
+		cov += dx * dy
+		varX += dx * dx
+		varY += dy * dy
+	}
+
+	return cov / math.Sqrt(varX*varY), nil
+}
+
+// Spearman returns Spearman rank correlation coefficient of `x` and `y`: Pearson correlation
+// of their ranks. Tied values get the average of their ranks.
+func Spearman(x, y []float64) (float64, error) {
+	if err := checkLengths(len(x), len(y)); err != nil {
+		return 0, err
+	}
+
+	return Pearson(ranks(x), ranks(y))
+}
+
+// ranks returns ranks (from 1) of values, tied values getting their average rank.
+func ranks(values []float64) []float64 {
+	order := make([]int, len(values))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return values[order[i]] < values[order[j]]
+	})
+
+	r := make([]float64, len(values))
+	for start := 0; start < len(order); {
+		end := start + 1
+		for end < len(order) && values[order[end]] == values[order[start]] {
+			end++
+		}
+		// Ranks start+1 to end are averaged.
+		rank := float64(start+1+end) / 2
+		for _, i := range order[start:end] {
+			r[i] = rank
+		}
+		start = end
+	}
+
+	return r
+}
+
+// checkLengths checks that predictions and labels have the same length.
+func checkLengths(nPreds, nLabels int) error {
+	if nPreds != nLabels {
+		err := fmt.Errorf("Mismatched number of predictions (%v) and labels (%v).", nPreds, nLabels)
+		return err
+	}
+
+	return nil
+}
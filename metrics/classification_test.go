@@ -0,0 +1,65 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/yinziyang/transformer/metrics"
+)
+
+// Reference numbers of scikit-learn documentation.
+func TestClassificationMetrics(t *testing.T) {
+	accuracy, err := metrics.Accuracy([]int{0, 2, 1, 3}, []int{0, 1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkScore(t, "accuracy", accuracy, 0.5)
+
+	labels := []int{0, 1, 2, 0, 1, 2}
+	preds := []int{0, 2, 1, 0, 0, 1}
+	for _, tt := range []struct {
+		name    string
+		average metrics.Average
+		want    float64
+	}{
+		{"macro F1", metrics.AverageMacro, 0.26666666666666666},
+		{"micro F1", metrics.AverageMicro, 0.3333333333333333},
+		{"weighted F1", metrics.AverageWeighted, 0.26666666666666666},
+	} {
+		got, err := metrics.F1(preds, labels, tt.average)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkScore(t, tt.name, got, tt.want)
+	}
+
+	mcc, err := metrics.MatthewsCorrCoef([]int{1, -1, 1, 1}, []int{1, 1, 1, -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkScore(t, "Matthews correlation", mcc, -0.3333333333333333)
+
+	mcc, err = metrics.MatthewsCorrCoef([]int{1, 1, 1}, []int{1, 0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkScore(t, "undefined Matthews correlation", mcc, 0)
+
+	if _, err := metrics.Accuracy([]int{0}, []int{0, 1}); err == nil {
+		t.Errorf("Want error for mismatched lengths\n")
+	}
+}
+
+// Reference numbers of SciPy documentation.
+func TestCorrelations(t *testing.T) {
+	pearson, err := metrics.Pearson([]float64{1, 2, 3, 4, 5, 6, 7}, []float64{10, 9, 2.5, 6, 4, 3, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkScore(t, "Pearson correlation", pearson, -0.828503883588428)
+
+	spearman, err := metrics.Spearman([]float64{1, 2, 3, 4, 5}, []float64{5, 6, 7, 8, 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkScore(t, "Spearman correlation", spearman, 0.8207826816681233)
+}
@@ -0,0 +1,302 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Entity-level metrics:
+// =====================
+//
+// Token classification predictions are evaluated on entities (chunks of tokens), as seqeval does:
+// an entity is correctly predicted if its type and span match a true entity.
+//
+// Entities are extracted from tags with a scheme:
+//   - `SchemeDefault`: conlleval compatible extraction (seqeval default mode). It accepts BIO
+//     (IOB1 and IOB2) and BIOES tags and is lenient, e.g. an entity may start with "I-".
+//   - `SchemeIOB2`, `SchemeIOBES`: strict extraction (seqeval strict mode). Only well formed
+//     entities of the scheme are kept, e.g. an entity must start with "B-" with IOB2.
+
+// Scheme is a tagging scheme to extract entities from tags.
+type Scheme int
+
+const (
+	SchemeDefault Scheme = iota
+	SchemeIOB2
+	SchemeIOBES
+)
+
+// Entity is a chunk of tokens [Start, End) of a type.
+type Entity struct {
+	Type  string
+	Start int
+	End   int
+}
+
+// Score holds precision, recall and F1 of a class and its number of true examples.
+type Score struct {
+	Precision float64
+	Recall    float64
+	F1        float64
+	Support   int
+}
+
+// EntityScores holds entity-level scores per entity type and their averages.
+type EntityScores struct {
+	PerType  map[string]Score
+	Micro    Score // scores of all entities.
+	Macro    Score // mean of scores of entity types.
+	Weighted Score // mean of scores of entity types weighted by support.
+}
+
+// Entities extracts entities from tags of a sequence with `scheme`.
+func Entities(tags []string, scheme Scheme) ([]Entity, error) {
+	switch scheme {
+	case SchemeDefault:
+		return defaultEntities(tags), nil
+	case SchemeIOB2, SchemeIOBES:
+		return strictEntities(tags, scheme)
+	}
+
+	err := fmt.Errorf("Unknown scheme %v.", scheme)
+	return nil, err
+}
+
+// EntityF1 computes entity-level precision, recall and F1 of predicted tags `yPred` against
+// true tags `yTrue` of sequences.
+func EntityF1(yTrue, yPred [][]string, scheme Scheme) (*EntityScores, error) {
+	if len(yTrue) != len(yPred) {
+		err := fmt.Errorf("EntityF1() failed: mismatched number of true (%v) and predicted (%v) sequences.", len(yTrue), len(yPred))
+		return nil, err
+	}
+
+	type key struct {
+		sequence int
+		entity   Entity
+	}
+	var (
+		trueEntities = make(map[key]bool)
+		predEntities = make(map[key]bool)
+		types        = make(map[string]bool)
+	)
+	for i := range yTrue {
+		if len(yTrue[i]) != len(yPred[i]) {
+			err := fmt.Errorf("EntityF1() failed: mismatched length of true (%v) and predicted (%v) tags of sequence %v.", len(yTrue[i]), len(yPred[i]), i)
+			return nil, err
+		}
+
+		for _, m := range []struct {
+			tags     []string
+			entities map[key]bool
+		}{{yTrue[i], trueEntities}, {yPred[i], predEntities}} {
+			entities, err := Entities(m.tags, scheme)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range entities {
+				m.entities[key{i, e}] = true
+				types[e.Type] = true
+			}
+		}
+	}
+
+	var (
+		nTrue    = make(map[string]int)
+		nPred    = make(map[string]int)
+		nCorrect = make(map[string]int)
+	)
+	for k := range trueEntities {
+		nTrue[k.entity.Type]++
+		if predEntities[k] {
+			nCorrect[k.entity.Type]++
+		}
+	}
+	for k := range predEntities {
+		nPred[k.entity.Type]++
+	}
+
+	scores := &EntityScores{PerType: make(map[string]Score)}
+	var totalTrue, totalPred, totalCorrect int
+	for t := range types {
+		score := prf(nCorrect[t], nPred[t], nTrue[t])
+		scores.PerType[t] = score
+		totalTrue += nTrue[t]
+		totalPred += nPred[t]
+		totalCorrect += nCorrect[t]
+	}
+	scores.Micro = prf(totalCorrect, totalPred, totalTrue)
+	scores.Macro, scores.Weighted = averages(scores.PerType)
+
+	return scores, nil
+}
+
+// prf computes precision, recall and F1 from counts. Undefined scores (zero division) are 0.
+func prf(correct, predicted, support int) Score {
+	s := Score{Support: support}
+	if predicted > 0 {
+		s.Precision = float64(correct) / float64(predicted)
+	}
+	if support > 0 {
+		s.Recall = float64(correct) / float64(support)
+	}
+	if s.Precision+s.Recall > 0 {
+		s.F1 = 2 * s.Precision * s.Recall / (s.Precision + s.Recall)
+	}
+
+	return s
+}
+
+// averages returns macro and support weighted averages of scores.
+func averages(scores map[string]Score) (macro, weighted Score) {
+	if len(scores) == 0 {
+		return macro, weighted
+	}
+
+	// Sorted for deterministic floating point sums.
+	var keys []string
+	for k := range scores {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := scores[k]
+		macro.Precision += s.Precision
+		macro.Recall += s.Recall
+		macro.F1 += s.F1
+		macro.Support += s.Support
+
+		w := float64(s.Support)
+		weighted.Precision += w * s.Precision
+		weighted.Recall += w * s.Recall
+		weighted.F1 += w * s.F1
+	}
+
+	n := float64(len(scores))
+	macro.Precision /= n
+	macro.Recall /= n
+	macro.F1 /= n
+
+	weighted.Support = macro.Support
+	if weighted.Support > 0 {
+		w := float64(weighted.Support)
+		weighted.Precision /= w
+		weighted.Recall /= w
+		weighted.F1 /= w
+	}
+
+	return macro, weighted
+}
+
+// splitTag splits a tag into its prefix (e.g. "B") and entity type (e.g. "PER").
+// Tags without type (e.g. "O") have type "_".
+func splitTag(tag string) (prefix, typ string) {
+	if tag == "" {
+		return "O", "_"
+	}
+
+	prefix = tag[:1]
+	typ = tag[1:]
+	if i := strings.Index(typ, "-"); i >= 0 {
+		typ = typ[i+1:]
+	}
+	if typ == "" {
+		typ = "_"
+	}
+
+	return prefix, typ
+}
+
+// defaultEntities extracts entities as conlleval and seqeval default mode do.
+func defaultEntities(tags []string) []Entity {
+	var (
+		entities []Entity
+		prevTag  = "O"
+		prevType = ""
+		begin    int
+	)
+	for i := 0; i <= len(tags); i++ {
+		tag, typ := "O", "_"
+		if i < len(tags) {
+			tag, typ = splitTag(tags[i])
+		}
+
+		if endOfChunk(prevTag, tag, prevType, typ) {
+			entities = append(entities, Entity{Type: prevType, Start: begin, End: i})
+		}
+		if startOfChunk(prevTag, tag, prevType, typ) {
+			begin = i
+		}
+		prevTag, prevType = tag, typ
+	}
+
+	return entities
+}
+
+// endOfChunk returns whether a chunk ended between the previous and current tags.
+func endOfChunk(prevTag, tag, prevType, typ string) bool {
+	switch {
+	case prevTag == "E", prevTag == "S":
+		return true
+	case (prevTag == "B" || prevTag == "I") && (tag == "B" || tag == "S" || tag == "O"):
+		return true
+	case prevTag != "O" && prevTag != "." && prevType != typ:
+		return true
+	}
+
+	return false
+}
+
+// startOfChunk returns whether a chunk started between the previous and current tags.
+func startOfChunk(prevTag, tag, prevType, typ string) bool {
+	switch {
+	case tag == "B", tag == "S":
+		return true
+	case (prevTag == "E" || prevTag == "S" || prevTag == "O") && (tag == "E" || tag == "I"):
+		return true
+	case tag != "O" && tag != "." && prevType != typ:
+		return true
+	}
+
+	return false
+}
+
+// strictEntities extracts well formed entities of IOB2 or IOBES scheme.
+func strictEntities(tags []string, scheme Scheme) ([]Entity, error) {
+	var entities []Entity
+	for i := 0; i < len(tags); i++ {
+		prefix, typ := splitTag(tags[i])
+		switch prefix {
+		case "O", "B", "I":
+		case "E", "S":
+			if scheme == SchemeIOBES {
+				break
+			}
+			fallthrough
+		default:
+			err := fmt.Errorf("Invalid tag %q for scheme.", tags[i])
+			return nil, err
+		}
+
+		switch {
+		case prefix == "S":
+			entities = append(entities, Entity{Type: typ, Start: i, End: i + 1})
+
+		case prefix == "B":
+			j := i + 1
+			for j < len(tags) && tags[j] == "I-"+typ {
+				j++
+			}
+			if scheme == SchemeIOB2 {
+				entities = append(entities, Entity{Type: typ, Start: i, End: j})
+				i = j - 1
+			} else if j < len(tags) && tags[j] == "E-"+typ {
+				entities = append(entities, Entity{Type: typ, Start: i, End: j + 1})
+				i = j
+			}
+		}
+	}
+
+	return entities, nil
+}
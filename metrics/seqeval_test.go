@@ -0,0 +1,103 @@
+package metrics_test
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/yinziyang/transformer/metrics"
+)
+
+func checkScore(t *testing.T, name string, got, want float64) {
+	if math.Abs(got-want) > 1e-6 {
+		t.Errorf("Want %v: %v\n", name, want)
+		t.Errorf("Got %v: %v\n", name, got)
+	}
+}
+
+// Reference numbers of seqeval README.
+func TestEntityF1(t *testing.T) {
+	yTrue := [][]string{{"O", "O", "O", "B-MISC", "I-MISC", "I-MISC", "O"}, {"B-PER", "I-PER", "O"}}
+	yPred := [][]string{{"O", "O", "B-MISC", "I-MISC", "I-MISC", "I-MISC", "O"}, {"B-PER", "I-PER", "O"}}
+
+	scores, err := metrics.EntityF1(yTrue, yPred, metrics.SchemeDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkScore(t, "MISC F1", scores.PerType["MISC"].F1, 0)
+	checkScore(t, "PER F1", scores.PerType["PER"].F1, 1)
+	checkScore(t, "micro precision", scores.Micro.Precision, 0.5)
+	checkScore(t, "micro recall", scores.Micro.Recall, 0.5)
+	checkScore(t, "micro F1", scores.Micro.F1, 0.5)
+	checkScore(t, "macro F1", scores.Macro.F1, 0.5)
+	checkScore(t, "weighted F1", scores.Weighted.F1, 0.5)
+	if scores.Micro.Support != 2 {
+		t.Errorf("Want support: 2\n")
+		t.Errorf("Got support: %v\n", scores.Micro.Support)
+	}
+}
+
+// Reference numbers of seqeval README: strict mode rejects entities starting with "I-".
+func TestEntityF1_Strict(t *testing.T) {
+	yTrue := [][]string{{"B-NP", "I-NP", "O"}}
+	yPred := [][]string{{"I-NP", "I-NP", "O"}}
+
+	tests := []struct {
+		scheme metrics.Scheme
+		want   float64
+	}{
+		{metrics.SchemeDefault, 1},
+		{metrics.SchemeIOB2, 0},
+	}
+	for _, tt := range tests {
+		scores, err := metrics.EntityF1(yTrue, yPred, tt.scheme)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkScore(t, "NP F1", scores.PerType["NP"].F1, tt.want)
+	}
+
+	if _, err := metrics.EntityF1([][]string{{"S-NP"}}, [][]string{{"O"}}, metrics.SchemeIOB2); err == nil {
+		t.Errorf("Want error for tag invalid for IOB2 scheme\n")
+	}
+}
+
+func TestEntityF1_IOBES(t *testing.T) {
+	yTrue := [][]string{{"B-PER", "I-PER", "E-PER", "O", "S-LOC"}}
+	yPred := [][]string{{"B-PER", "I-PER", "I-PER", "O", "S-LOC"}}
+
+	// Lenient extraction accepts the unterminated PER entity.
+	scores, err := metrics.EntityF1(yTrue, yPred, metrics.SchemeDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkScore(t, "default micro F1", scores.Micro.F1, 1)
+
+	scores, err = metrics.EntityF1(yTrue, yPred, metrics.SchemeIOBES)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkScore(t, "strict micro precision", scores.Micro.Precision, 1)
+	checkScore(t, "strict micro recall", scores.Micro.Recall, 0.5)
+	checkScore(t, "strict micro F1", scores.Micro.F1, 2.0/3)
+}
+
+func TestEntities(t *testing.T) {
+	tags := []string{"B-PER", "I-PER", "O", "I-LOC", "B-LOC", "I-ORG"}
+	want := []metrics.Entity{
+		{Type: "PER", Start: 0, End: 2},
+		{Type: "LOC", Start: 3, End: 4},
+		{Type: "LOC", Start: 4, End: 5},
+		{Type: "ORG", Start: 5, End: 6},
+	}
+
+	got, err := metrics.Entities(tags, metrics.SchemeDefault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Want entities: %v\n", want)
+		t.Errorf("Got entities: %v\n", got)
+	}
+}
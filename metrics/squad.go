@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"regexp"
+	"strings"
+)
+
+// SQuADScores holds exact match and F1 scores (in percent) of question answering predictions,
+// as the official SQuAD v2.0 evaluation script reports them. For SQuAD v1.1, all questions have
+// answers and only `ExactMatch`, `F1` and `Total` are relevant.
+type SQuADScores struct {
+	ExactMatch float64
+	F1         float64
+	Total      int
+
+	// Questions with answers.
+	HasAnsExactMatch float64
+	HasAnsF1         float64
+	HasAnsTotal      int
+
+	// Unanswerable questions (SQuAD v2.0): predictions must be empty.
+	NoAnsExactMatch float64
+	NoAnsF1         float64
+	NoAnsTotal      int
+}
+
+var (
+	articles    = regexp.MustCompile(`\b(a|an|the)\b`)
+	punctuation = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+)
+
+// NormalizeAnswer normalizes an answer as the SQuAD evaluation script does: lower case,
+// punctuation and articles removed and white spaces collapsed.
+func NormalizeAnswer(s string) string {
+	s = strings.ToLower(s)
+	s = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(punctuation, r) {
+			return -1
+		}
+		return r
+	}, s)
+	s = articles.ReplaceAllString(s, " ")
+
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// AnswerExactMatch returns whether normalized prediction and answer are equal.
+func AnswerExactMatch(prediction, answer string) bool {
+	return NormalizeAnswer(prediction) == NormalizeAnswer(answer)
+}
+
+// AnswerF1 returns F1 of common tokens of normalized prediction and answer. If either is empty
+// (unanswerable question), it is 1 if both are empty and 0 otherwise.
+func AnswerF1(prediction, answer string) float64 {
+	predTokens := strings.Fields(NormalizeAnswer(prediction))
+	answerTokens := strings.Fields(NormalizeAnswer(answer))
+	if len(predTokens) == 0 || len(answerTokens) == 0 {
+		if len(predTokens) == len(answerTokens) {
+			return 1
+		}
+		return 0
+	}
+
+	counts := make(map[string]int)
+	for _, t := range answerTokens {
+		counts[t]++
+	}
+	var common int
+	for _, t := range predTokens {
+		if counts[t] > 0 {
+			counts[t]--
+			common++
+		}
+	}
+	if common == 0 {
+		return 0
+	}
+
+	precision := float64(common) / float64(len(predTokens))
+	recall := float64(common) / float64(len(answerTokens))
+
+	return 2 * precision * recall / (precision + recall)
+}
+
+// SQuAD computes exact match and F1 of predictions against answers of questions.
+//
+// Params:
+//   - predictions: predicted answer of each question id. Empty for predicted unanswerable questions.
+//   - answers: true answers of each question id. Empty for unanswerable questions (SQuAD v2.0).
+//
+// Each question is scored against its best matching answer. Questions without prediction score 0.
+func SQuAD(predictions map[string]string, answers map[string][]string) *SQuADScores {
+	scores := new(SQuADScores)
+	for id, texts := range answers {
+		// Answers normalized to empty strings are ignored, as in the evaluation script.
+		var golds []string
+		for _, text := range texts {
+			if NormalizeAnswer(text) != "" {
+				golds = append(golds, text)
+			}
+		}
+		if len(golds) == 0 {
+			golds = []string{""}
+		}
+
+		var exact, f1 float64
+		if prediction, ok := predictions[id]; ok {
+			for _, gold := range golds {
+				if AnswerExactMatch(prediction, gold) {
+					exact = 1
+				}
+				if s := AnswerF1(prediction, gold); s > f1 {
+					f1 = s
+				}
+			}
+		}
+
+		scores.ExactMatch += exact
+		scores.F1 += f1
+		scores.Total++
+		if len(texts) == 0 {
+			scores.NoAnsExactMatch += exact
+			scores.NoAnsF1 += f1
+			scores.NoAnsTotal++
+		} else {
+			scores.HasAnsExactMatch += exact
+			scores.HasAnsF1 += f1
+			scores.HasAnsTotal++
+		}
+	}
+
+	percent := func(sum *float64, n int) {
+		if n > 0 {
+			*sum = 100 * *sum / float64(n)
+		}
+	}
+	percent(&scores.ExactMatch, scores.Total)
+	percent(&scores.F1, scores.Total)
+	percent(&scores.HasAnsExactMatch, scores.HasAnsTotal)
+	percent(&scores.HasAnsF1, scores.HasAnsTotal)
+	percent(&scores.NoAnsExactMatch, scores.NoAnsTotal)
+	percent(&scores.NoAnsF1, scores.NoAnsTotal)
+
+	return scores
+}
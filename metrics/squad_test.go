@@ -0,0 +1,51 @@
+package metrics_test
+
+import (
+	"testing"
+
+	"github.com/yinziyang/transformer/metrics"
+)
+
+func TestNormalizeAnswer(t *testing.T) {
+	want := "denver broncos"
+	if got := metrics.NormalizeAnswer("  The Denver-Broncos! "); got != "denverbroncos" {
+		t.Errorf("Want normalized answer: denverbroncos\n")
+		t.Errorf("Got normalized answer: %v\n", got)
+	}
+	if got := metrics.NormalizeAnswer("the Denver, Broncos."); got != want {
+		t.Errorf("Want normalized answer: %v\n", want)
+		t.Errorf("Got normalized answer: %v\n", got)
+	}
+}
+
+// Reference numbers of the official SQuAD v2.0 evaluation script.
+func TestSQuAD(t *testing.T) {
+	answers := map[string][]string{
+		"q1": {"Denver Broncos", "The Denver Broncos!"},
+		"q2": {"Santa Clara, California", "Levi's Stadium"},
+		"q3": {},
+		"q4": {},
+		"q5": {"in 1976"},
+	}
+	predictions := map[string]string{
+		"q1": "the Denver Broncos",
+		"q2": "Levi's Stadium in the San Francisco Bay Area",
+		"q3": "",
+		"q4": "Paris",
+		"q5": "1976",
+	}
+
+	scores := metrics.SQuAD(predictions, answers)
+	checkScore(t, "exact match", scores.ExactMatch, 40)
+	checkScore(t, "F1", scores.F1, 62.22222222222223)
+	checkScore(t, "has answer F1", scores.HasAnsF1, 70.37037037037037)
+	checkScore(t, "no answer exact match", scores.NoAnsExactMatch, 50)
+	if scores.Total != 5 || scores.HasAnsTotal != 3 || scores.NoAnsTotal != 2 {
+		t.Errorf("Want totals: 5, 3 with answers, 2 without\n")
+		t.Errorf("Got totals: %v, %v with answers, %v without\n", scores.Total, scores.HasAnsTotal, scores.NoAnsTotal)
+	}
+
+	// Missing predictions score 0.
+	scores = metrics.SQuAD(map[string]string{}, map[string][]string{"q1": {"Denver"}})
+	checkScore(t, "exact match without prediction", scores.ExactMatch, 0)
+}
@@ -0,0 +1,128 @@
+package pipeline
+
+import (
+	"fmt"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/ts"
+	"github.com/sugarme/tokenizer"
+)
+
+// Batch holds model inputs collated from a batch of encodings.
+//
+// Tensors are of shape (batch size, sequence length). Mappings are kept per
+// encoding (including padded positions) for postprocessing, e.g. mapping
+// token predictions back to words or character spans.
+type Batch struct {
+	InputIds      *ts.Tensor
+	AttentionMask *ts.Tensor
+	TokenTypeIds  *ts.Tensor
+	PositionIds   *ts.Tensor // Roberta-like models only, `ts.None` otherwise.
+	Labels        *ts.Tensor // masked language modeling labels (see `MLMCollator`), `ts.None` otherwise.
+
+	Offsets          [][][]int // offsets of each token. Padded tokens are [0, 0].
+	WordIds          [][]int   // word index of each token. Special and padded tokens are -1.
+	SpecialTokenMask [][]int   // 1 for special and padded tokens.
+}
+
+// Drop drops all tensors of batch.
+func (b *Batch) Drop() {
+	for _, x := range []*ts.Tensor{b.InputIds, b.AttentionMask, b.TokenTypeIds, b.PositionIds, b.Labels} {
+		if x != nil && x.MustDefined() {
+			x.MustDrop()
+		}
+	}
+}
+
+// Collate turns a batch of encodings into model input tensors on `device`.
+//
+// Encodings are padded to the longest one with tokenizer's pad id, on the
+// side set by `WithPadding` (default right). For Roberta-like models, position
+// ids are created as `RobertaEmbeddings` does from input ids: non-padding tokens
+// are numbered from `padId + 1` and padding tokens get `padId`. Token type ids
+// are all 0 for them: Roberta and XLM-RoBERTa have a single token type, so type
+// id 1 of the second sentence of a pair is out of range of their embeddings.
+func (tk *TokenizerOption) Collate(encodings []tokenizer.Encoding, device gotch.Device) (*Batch, error) {
+	padId, ok := tk.PadId()
+	if !ok {
+		err := fmt.Errorf("Collate() failed: tokenizer has no padding token.")
+		return nil, err
+	}
+
+	var robertaLike bool
+	switch tk.model {
+	case Roberta, XLMRoberta:
+		robertaLike = true
+	}
+
+	return collate(encodings, padId, tk.options.PaddingSide, robertaLike, device)
+}
+
+func collate(encodings []tokenizer.Encoding, padId int64, side PaddingSide, robertaLike bool, device gotch.Device) (*Batch, error) {
+	if len(encodings) == 0 {
+		err := fmt.Errorf("Collate() failed: empty batch.")
+		return nil, err
+	}
+
+	var seqLen int
+	for _, e := range encodings {
+		if e.Len() > seqLen {
+			seqLen = e.Len()
+		}
+	}
+
+	batchSize := len(encodings)
+	var (
+		inputIds      = make([]int64, batchSize*seqLen)
+		attentionMask = make([]int64, batchSize*seqLen)
+		tokenTypeIds  = make([]int64, batchSize*seqLen)
+		positionIds   = make([]int64, batchSize*seqLen)
+		batch         = &Batch{PositionIds: ts.None, Labels: ts.None}
+	)
+
+	for i, e := range encodings {
+		// copy so that input encodings are untouched.
+		en := sliceEncoding(&e, 0, e.Len())
+		if len(en.Words) == 0 {
+			en.Words = make([]int, en.Len())
+			for j := range en.Words {
+				en.Words[j] = -1
+			}
+		}
+		padEncoding(en, seqLen, int(padId), "", side)
+
+		var position int64 = padId
+		for j := 0; j < seqLen; j++ {
+			n := i*seqLen + j
+			inputIds[n] = int64(en.Ids[j])
+			attentionMask[n] = int64(en.AttentionMask[j])
+			if !robertaLike {
+				tokenTypeIds[n] = int64(en.TypeIds[j])
+			}
+			if en.Ids[j] != int(padId) {
+				position++
+				positionIds[n] = position
+			} else {
+				positionIds[n] = padId
+			}
+		}
+
+		batch.Offsets = append(batch.Offsets, en.Offsets)
+		batch.WordIds = append(batch.WordIds, en.Words)
+		batch.SpecialTokenMask = append(batch.SpecialTokenMask, en.SpecialTokenMask)
+	}
+
+	shape := []int64{int64(batchSize), int64(seqLen)}
+	toTensor := func(data []int64) *ts.Tensor {
+		return ts.MustOfSlice(data).MustView(shape, true).MustTo(device, true)
+	}
+
+	batch.InputIds = toTensor(inputIds)
+	batch.AttentionMask = toTensor(attentionMask)
+	batch.TokenTypeIds = toTensor(tokenTypeIds)
+	if robertaLike {
+		batch.PositionIds = toTensor(positionIds)
+	}
+
+	return batch, nil
+}
@@ -0,0 +1,139 @@
+package pipeline_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/tokenizer"
+	"github.com/sugarme/tokenizer/model/wordpiece"
+	"github.com/sugarme/tokenizer/pretokenizer"
+	"github.com/sugarme/tokenizer/processor"
+
+	"github.com/yinziyang/transformer/pipeline"
+)
+
+func TestTokenizerOption_Collate(t *testing.T) {
+	tk := newTestTokenizer(t)
+	encodings, err := tk.EncodePairList([]string{"a b", "a"}, []string{"c", "d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch, err := tk.Collate(encodings, gotch.CPU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer batch.Drop()
+
+	wantInputIds := []int64{2, 5, 6, 3, 7, 3, 2, 5, 3, 8, 3, 0}
+	wantMask := []int64{1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0}
+	wantTypeIds := []int64{0, 0, 0, 0, 1, 1, 0, 0, 0, 1, 1, 0}
+	if got := batch.InputIds.Int64Values(); !reflect.DeepEqual(wantInputIds, got) {
+		t.Errorf("Want input ids: %v\n", wantInputIds)
+		t.Errorf("Got input ids: %v\n", got)
+	}
+	if got := batch.AttentionMask.Int64Values(); !reflect.DeepEqual(wantMask, got) {
+		t.Errorf("Want attention mask: %v\n", wantMask)
+		t.Errorf("Got attention mask: %v\n", got)
+	}
+	if got := batch.TokenTypeIds.Int64Values(); !reflect.DeepEqual(wantTypeIds, got) {
+		t.Errorf("Want token type ids: %v\n", wantTypeIds)
+		t.Errorf("Got token type ids: %v\n", got)
+	}
+	if batch.PositionIds.MustDefined() {
+		t.Errorf("Want no position ids for Bert\n")
+	}
+
+	wantWordIds := []int{-1, 0, 1, -1, 0, -1, -1, 0, -1, 0, -1, -1}
+	var gotWordIds []int
+	for _, w := range batch.WordIds {
+		gotWordIds = append(gotWordIds, w...)
+	}
+	if !reflect.DeepEqual(wantWordIds, gotWordIds) {
+		t.Errorf("Want word ids: %v\n", wantWordIds)
+		t.Errorf("Got word ids: %v\n", gotWordIds)
+	}
+}
+
+// newRobertaTestTokenizer returns a Roberta tokenizer with vocabulary <s>=0, <pad>=1, </s>=2, a=3, b=4, c=5.
+// Special tokens are only added if `withProcessor`.
+func newRobertaTestTokenizer(t *testing.T, withProcessor bool) *pipeline.TokenizerOption {
+	vocabFile := filepath.Join(t.TempDir(), "vocab.txt")
+	err := os.WriteFile(vocabFile, []byte(strings.Join([]string{"<s>", "<pad>", "</s>", "a", "b", "c"}, "\n")), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	model, err := wordpiece.NewWordPieceFromFile(vocabFile, "<s>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tk := tokenizer.NewTokenizer(model)
+	tk.WithPreTokenizer(pretokenizer.NewBertPreTokenizer())
+	if withProcessor {
+		sep := processor.PostToken{Id: 2, Value: "</s>"}
+		cls := processor.PostToken{Id: 0, Value: "<s>"}
+		tk.WithPostProcessor(processor.NewRobertaProcessing(sep, cls, true, false))
+	}
+
+	return pipeline.NewTokenizerOption(pipeline.Roberta, tk)
+}
+
+// Position ids must match `RobertaEmbeddings.createPositionIdsFromInputIds`.
+func TestTokenizerOption_CollateRobertaPositionIds(t *testing.T) {
+	tkOpt := newRobertaTestTokenizer(t, false)
+	tkOpt.WithPadding(pipeline.PadLongest, pipeline.PadLeft, 0)
+	encodings, err := tkOpt.EncodeList([]string{"a b c", "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	batch, err := tkOpt.Collate(encodings, gotch.CPU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer batch.Drop()
+
+	wantInputIds := []int64{3, 4, 5, 1, 1, 3}
+	wantPositionIds := []int64{2, 3, 4, 1, 1, 2}
+	if got := batch.InputIds.Int64Values(); !reflect.DeepEqual(wantInputIds, got) {
+		t.Errorf("Want input ids: %v\n", wantInputIds)
+		t.Errorf("Got input ids: %v\n", got)
+	}
+	if got := batch.PositionIds.Int64Values(); !reflect.DeepEqual(wantPositionIds, got) {
+		t.Errorf("Want position ids: %v\n", wantPositionIds)
+		t.Errorf("Got position ids: %v\n", got)
+	}
+}
+
+// Roberta has a single token type: type ids of pairs (1 for the second sentence) must not reach the model.
+func TestTokenizerOption_CollateRobertaPair(t *testing.T) {
+	tkOpt := newRobertaTestTokenizer(t, true)
+	encodings, err := tkOpt.EncodePairList([]string{"a b", "a"}, []string{"c", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := encodings[0].TypeIds; !reflect.DeepEqual([]int{0, 0, 0, 0, 1, 1, 1}, got) {
+		t.Fatalf("Want encoding type ids of pair: [0 0 0 0 1 1 1], got %v\n", got)
+	}
+
+	batch, err := tkOpt.Collate(encodings, gotch.CPU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer batch.Drop()
+
+	wantInputIds := []int64{0, 3, 4, 2, 2, 5, 2, 0, 3, 2, 2, 4, 2, 1}
+	wantTypeIds := make([]int64, len(wantInputIds))
+	if got := batch.InputIds.Int64Values(); !reflect.DeepEqual(wantInputIds, got) {
+		t.Errorf("Want input ids: %v\n", wantInputIds)
+		t.Errorf("Got input ids: %v\n", got)
+	}
+	if got := batch.TokenTypeIds.Int64Values(); !reflect.DeepEqual(wantTypeIds, got) {
+		t.Errorf("Want token type ids: %v\n", wantTypeIds)
+		t.Errorf("Got token type ids: %v\n", got)
+	}
+}
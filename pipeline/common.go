@@ -1,8 +1,8 @@
 package pipeline
 
 import (
+	"fmt"
 	"log"
-	"reflect"
 
 	"github.com/sugarme/tokenizer"
 	"github.com/sugarme/tokenizer/model/wordpiece"
@@ -66,6 +66,7 @@ const (
 type TokenizerOption struct {
 	model     ModelType
 	tokenizer *tokenizer.Tokenizer
+	options   EncodeOptions
 }
 
 // ConfigOption methods:
@@ -76,18 +77,21 @@ func ConfigOptionFromFile(modelType ModelType, path string) *ConfigOption {
 
 	var configOpt *ConfigOption
 
-	switch reflect.TypeOf(modelType).Kind().String() {
-	case "Bert":
-		config := bert.ConfigFromFile(path)
+	switch modelType {
+	case Bert:
+		config, err := bert.ConfigFromFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
 		configOpt = &ConfigOption{
 			model:  Bert,
-			config: config,
+			config: *config,
 		}
 
 	// TODO: implement others
-	// case "DistilBert":
+	// case DistilBert:
 	default:
-		log.Fatalf("Invalid modelType: '%v'\n", reflect.TypeOf(modelType).Kind().String())
+		log.Fatalf("Invalid modelType: '%v'\n", modelType)
 	}
 
 	return configOpt
@@ -98,14 +102,13 @@ func (co *ConfigOption) GetLabelMapping() map[int64]string {
 
 	var labelMap map[int64]string = make(map[int64]string)
 
-	modelTypeStr := reflect.TypeOf(co.model).Kind().String()
-	switch modelTypeStr {
-	case "Bert":
+	switch co.model {
+	case Bert:
 		labelMap = co.config.(bert.BertConfig).Id2Label
 
 	// TODO: implement others
 	default:
-		log.Fatalf("ConfigOption GetLabelMapping error: invalid model type ('%v')\n", modelTypeStr)
+		log.Fatalf("ConfigOption GetLabelMapping error: invalid model type ('%v')\n", co.model)
 	}
 
 	return labelMap
@@ -113,11 +116,9 @@ func (co *ConfigOption) GetLabelMapping() map[int64]string {
 
 // TOkenizerOptionFromFile loads TokenizerOption from file corresponding to model type.
 func TokenizerOptionFromFile(modelType ModelType, path string) *TokenizerOption {
-	modelTypeStr := reflect.TypeOf(modelType).Kind().String()
-
 	var tk *TokenizerOption
-	switch modelTypeStr {
-	case "Bert":
+	switch modelType {
+	case Bert:
 		tk = &TokenizerOption{
 			model:     modelType,
 			tokenizer: getBert(path),
@@ -126,12 +127,20 @@ func TokenizerOptionFromFile(modelType ModelType, path string) *TokenizerOption
 	// TODO: implement others
 
 	default:
-		log.Fatalf("Unsupported model type: '%v'", modelTypeStr)
+		log.Fatalf("Unsupported model type: '%v'", modelType)
 	}
 
 	return tk
 }
 
+// NewTokenizerOption wraps a loaded tokenizer (e.g. `roberta.Tokenizer`) of corresponding model type.
+func NewTokenizerOption(modelType ModelType, tk *tokenizer.Tokenizer) *TokenizerOption {
+	return &TokenizerOption{
+		model:     modelType,
+		tokenizer: tk,
+	}
+}
+
 func getBert(path string) (retVal *tokenizer.Tokenizer) {
 	model, err := wordpiece.NewWordPieceFromFile(path, "[UNK]")
 	if err != nil {
@@ -174,14 +183,224 @@ func (tk *TokenizerOption) ModelType() ModelType {
 	return tk.model
 }
 
+// WithEncodeOptions sets truncation and padding options used by `EncodeList` and `EncodePairList`.
+func (tk *TokenizerOption) WithEncodeOptions(opts EncodeOptions) {
+	tk.options = opts
+}
+
+// WithTruncation sets truncation options.
+//
+// Params:
+//   - maxLength: max number of tokens of an encoding including special tokens.
+//   - strategy: which sequence(s) to truncate.
+//   - stride: number of overlapping tokens between overflowing windows.
+//   - overflowing: whether to return truncated tokens as windows in `Encoding.Overflowing`.
+func (tk *TokenizerOption) WithTruncation(maxLength int, strategy TruncationStrategy, stride int, overflowing bool) {
+	tk.options.MaxLength = maxLength
+	tk.options.Truncation = strategy
+	tk.options.Stride = stride
+	tk.options.ReturnOverflowing = overflowing
+}
+
+// WithPadding sets padding options.
+//
+// Params:
+//   - strategy: pad to the longest encoding in batch or to max length.
+//   - side: pad on the right or on the left.
+//   - padToMultipleOf: if > 0, round padded length up to a multiple of it.
+func (tk *TokenizerOption) WithPadding(strategy PaddingStrategy, side PaddingSide, padToMultipleOf int) {
+	tk.options.Padding = strategy
+	tk.options.PaddingSide = side
+	tk.options.PadToMultipleOf = padToMultipleOf
+}
+
+// EncodeOptions returns current truncation and padding options.
+func (tk *TokenizerOption) EncodeOptions() EncodeOptions {
+	return tk.options
+}
+
 // EncodeList encodes a slice of input string
 func (tk *TokenizerOption) EncodeList(sentences []string) ([]tokenizer.Encoding, error) {
-	var input []tokenizer.EncodeInput
+	var encodings []tokenizer.Encoding
 	for _, sentence := range sentences {
-		input = append(input, tokenizer.NewSingleEncodeInput(tokenizer.NewInputSequence(sentence)))
+		encoding, err := tk.encode(tokenizer.NewInputSequence(sentence), nil)
+		if err != nil {
+			return nil, err
+		}
+		encodings = append(encodings, *encoding)
+	}
+
+	return tk.pad(encodings)
+}
+
+// EncodeWordsList encodes a slice of pre-tokenized sentences (e.g. words of token classification
+// datasets). Word ids of encodings are indices of words in their sentence.
+func (tk *TokenizerOption) EncodeWordsList(sentences [][]string) ([]tokenizer.Encoding, error) {
+	var encodings []tokenizer.Encoding
+	for _, words := range sentences {
+		encoding, err := tk.encode(tokenizer.NewInputSequence(words), nil)
+		if err != nil {
+			return nil, err
+		}
+		encodings = append(encodings, *encoding)
+	}
+
+	return tk.pad(encodings)
+}
+
+// EncodePairList encodes a slice of sentence pairs (e.g. question and context).
+func (tk *TokenizerOption) EncodePairList(sentences, pairs []string) ([]tokenizer.Encoding, error) {
+	if len(sentences) != len(pairs) {
+		err := fmt.Errorf("EncodePairList() failed: mismatched number of sentences (%v) and pairs (%v).", len(sentences), len(pairs))
+		return nil, err
+	}
+
+	var encodings []tokenizer.Encoding
+	for i, sentence := range sentences {
+		pair := tokenizer.NewInputSequence(pairs[i])
+		encoding, err := tk.encode(tokenizer.NewInputSequence(sentence), &pair)
+		if err != nil {
+			return nil, err
+		}
+		encodings = append(encodings, *encoding)
+	}
+
+	return tk.pad(encodings)
+}
+
+// encode encodes a sentence or a sentence pair with truncation. Overflowing
+// windows (if any) are post-processed and stored in `Encoding.Overflowing`.
+func (tk *TokenizerOption) encode(sentence tokenizer.InputSequence, pair *tokenizer.InputSequence) (*tokenizer.Encoding, error) {
+	encoding, err := tk.tokenizer.EncodeSingleSequence(sentence, 0, tokenizer.Byte)
+	if err != nil {
+		return nil, err
+	}
+	var pairEncoding *tokenizer.Encoding
+	if pair != nil {
+		pairEncoding, err = tk.tokenizer.EncodeSingleSequence(*pair, 1, tokenizer.Byte)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	opts := tk.options
+	if opts.Truncation == DoNotTruncate || opts.MaxLength <= 0 {
+		return tk.tokenizer.PostProcess(encoding, pairEncoding, true), nil
+	}
+
+	// Number of tokens available for input sequences.
+	maxLength := opts.MaxLength
+	if processor := tk.tokenizer.GetPostProcessor(); processor != nil {
+		maxLength -= processor.AddedTokens(pairEncoding != nil)
+	}
+
+	n1 := encoding.Len()
+	var n2 int
+	if pairEncoding != nil {
+		n2 = pairEncoding.Len()
+	}
+
+	var (
+		ws       []window // windows of truncated sequence
+		truncSeq int      // 0: first, 1: second sequence
+	)
+	switch {
+	case pairEncoding == nil && opts.Truncation == OnlySecond:
+		err := fmt.Errorf("Truncation failed: second sequence not provided for 'OnlySecond' strategy.")
+		return nil, err
+
+	case pairEncoding == nil:
+		ws, err = splitWindows(n1, maxLength, opts.Stride, opts.ReturnOverflowing)
+
+	case opts.Truncation == LongestFirst:
+		if opts.ReturnOverflowing && n1+n2 > maxLength {
+			err := fmt.Errorf("Truncation failed: overflowing tokens are not supported for sequence pairs with 'LongestFirst' strategy. Use 'OnlyFirst' or 'OnlySecond' instead.")
+			return nil, err
+		}
+		if maxLength < 0 {
+			err := fmt.Errorf("Truncation failed: sequence to truncate is too short to respect max length.")
+			return nil, err
+		}
+		l1, l2 := truncatePairLongestFirst(n1, n2, maxLength)
+		encoding = sliceEncoding(encoding, 0, l1)
+		pairEncoding = sliceEncoding(pairEncoding, 0, l2)
+		return tk.tokenizer.PostProcess(encoding, pairEncoding, true), nil
+
+	case opts.Truncation == OnlyFirst:
+		ws, err = splitWindows(n1, maxLength-n2, opts.Stride, opts.ReturnOverflowing)
+
+	case opts.Truncation == OnlySecond:
+		truncSeq = 1
+		ws, err = splitWindows(n2, maxLength-n1, opts.Stride, opts.ReturnOverflowing)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var processed []tokenizer.Encoding
+	for _, w := range ws {
+		first, second := encoding, pairEncoding
+		if truncSeq == 0 {
+			first = sliceEncoding(encoding, w.start, w.end)
+			if pairEncoding != nil {
+				second = sliceEncoding(pairEncoding, 0, n2)
+			}
+		} else {
+			first = sliceEncoding(encoding, 0, n1)
+			second = sliceEncoding(pairEncoding, w.start, w.end)
+		}
+		processed = append(processed, *tk.tokenizer.PostProcess(first, second, true))
 	}
 
-	return tk.tokenizer.EncodeBatch(input, true)
+	out := processed[0]
+	out.Overflowing = processed[1:]
+
+	return &out, nil
+}
+
+// pad pads encodings and their overflowing windows according to padding options.
+func (tk *TokenizerOption) pad(encodings []tokenizer.Encoding) ([]tokenizer.Encoding, error) {
+	opts := tk.options
+	if opts.Padding == DoNotPad || len(encodings) == 0 {
+		return encodings, nil
+	}
+
+	padId, ok := tk.PadId()
+	if !ok {
+		err := fmt.Errorf("Padding failed: tokenizer has no padding token.")
+		return nil, err
+	}
+	padToken, _ := tk.tokenizer.IdToToken(int(padId))
+
+	var length int
+	switch opts.Padding {
+	case PadMaxLength:
+		length = opts.MaxLength
+	case PadLongest:
+		for _, e := range encodings {
+			if e.Len() > length {
+				length = e.Len()
+			}
+			for _, o := range e.Overflowing {
+				if o.Len() > length {
+					length = o.Len()
+				}
+			}
+		}
+	}
+	if opts.PadToMultipleOf > 0 && length%opts.PadToMultipleOf != 0 {
+		length = (length/opts.PadToMultipleOf + 1) * opts.PadToMultipleOf
+	}
+
+	for i := range encodings {
+		e := &encodings[i]
+		padEncoding(e, length, int(padId), padToken, opts.PaddingSide)
+		for j := range e.Overflowing {
+			padEncoding(&e.Overflowing[j], length, int(padId), padToken, opts.PaddingSide)
+		}
+	}
+
+	return encodings, nil
 }
 
 // Tokenize tokenizes input string
@@ -222,13 +441,47 @@ func (tk *TokenizerOption) TokensToIds(tokens []string) (ids []int64, ok bool) {
 }
 
 // PadId returns a PAD id if any.
+//
+// It is taken from tokenizer padding params if set, otherwise from
+// the PAD token of model type (e.g. "[PAD]" for Bert, "<pad>" for Roberta).
 func (tk *TokenizerOption) PadId() (id int64, ok bool) {
 	paddingParam := tk.tokenizer.GetPadding()
-	if paddingParam == nil {
+	if paddingParam != nil {
+		return int64(paddingParam.PadId), true
+	}
+
+	var padToken string
+	switch tk.model {
+	case Roberta, XLMRoberta, Marian, T5:
+		padToken = "<pad>"
+	default:
+		padToken = "[PAD]"
+	}
+
+	i, ok := tk.tokenizer.TokenToId(padToken)
+	if !ok {
+		return -1, false
+	}
+
+	return int64(i), true
+}
+
+// MaskId returns the MASK id of model type if any (e.g. "[MASK]" for Bert, "<mask>" for Roberta).
+func (tk *TokenizerOption) MaskId() (id int64, ok bool) {
+	var maskToken string
+	switch tk.model {
+	case Roberta, XLMRoberta:
+		maskToken = "<mask>"
+	default:
+		maskToken = "[MASK]"
+	}
+
+	i, ok := tk.tokenizer.TokenToId(maskToken)
+	if !ok {
 		return -1, false
 	}
 
-	return int64(paddingParam.PadId), true
+	return int64(i), true
 }
 
 // SepId returns a SEP id if any.
@@ -0,0 +1,173 @@
+package pipeline_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/yinziyang/transformer/pipeline"
+)
+
+// newTestTokenizer creates a Bert TokenizerOption from a tiny vocab:
+// [PAD]=0, [UNK]=1, [CLS]=2, [SEP]=3, [MASK]=4, a=5, b=6, ... j=14.
+func newTestTokenizer(t *testing.T) *pipeline.TokenizerOption {
+	vocab := []string{"[PAD]", "[UNK]", "[CLS]", "[SEP]", "[MASK]", "a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+	vocabFile := filepath.Join(t.TempDir(), "vocab.txt")
+	err := os.WriteFile(vocabFile, []byte(strings.Join(vocab, "\n")), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pipeline.TokenizerOptionFromFile(pipeline.Bert, vocabFile)
+}
+
+func TestTokenizerOption_PadId(t *testing.T) {
+	tk := newTestTokenizer(t)
+
+	padId, ok := tk.PadId()
+	if !ok || padId != 0 {
+		t.Errorf("Want pad id: 0\n")
+		t.Errorf("Got pad id: %v (%v)\n", padId, ok)
+	}
+}
+
+func TestTokenizerOption_EncodeList(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      pipeline.EncodeOptions
+		sentences []string
+		wantIds   [][]int
+		wantMasks [][]int
+	}{
+		{
+			name:      "no truncation nor padding",
+			opts:      pipeline.EncodeOptions{},
+			sentences: []string{"a b c d e", "a"},
+			wantIds:   [][]int{{2, 5, 6, 7, 8, 9, 3}, {2, 5, 3}},
+			wantMasks: [][]int{{1, 1, 1, 1, 1, 1, 1}, {1, 1, 1}},
+		},
+		{
+			name:      "truncate and pad to longest",
+			opts:      pipeline.EncodeOptions{MaxLength: 5, Truncation: pipeline.OnlyFirst, Padding: pipeline.PadLongest},
+			sentences: []string{"a b c d e", "a"},
+			wantIds:   [][]int{{2, 5, 6, 7, 3}, {2, 5, 3, 0, 0}},
+			wantMasks: [][]int{{1, 1, 1, 1, 1}, {1, 1, 1, 0, 0}},
+		},
+		{
+			name:      "pad left to multiple of 4",
+			opts:      pipeline.EncodeOptions{Padding: pipeline.PadLongest, PadToMultipleOf: 4, PaddingSide: pipeline.PadLeft},
+			sentences: []string{"a b", "a"},
+			wantIds:   [][]int{{2, 5, 6, 3}, {0, 2, 5, 3}},
+			wantMasks: [][]int{{1, 1, 1, 1}, {0, 1, 1, 1}},
+		},
+		{
+			name:      "pad to max length",
+			opts:      pipeline.EncodeOptions{MaxLength: 6, Truncation: pipeline.LongestFirst, Padding: pipeline.PadMaxLength},
+			sentences: []string{"a"},
+			wantIds:   [][]int{{2, 5, 3, 0, 0, 0}},
+			wantMasks: [][]int{{1, 1, 1, 0, 0, 0}},
+		},
+	}
+
+	for _, tt := range tests {
+		tk := newTestTokenizer(t)
+		tk.WithEncodeOptions(tt.opts)
+		encodings, err := tk.EncodeList(tt.sentences)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var gotIds, gotMasks [][]int
+		for _, e := range encodings {
+			gotIds = append(gotIds, e.Ids)
+			gotMasks = append(gotMasks, e.AttentionMask)
+		}
+		if !reflect.DeepEqual(tt.wantIds, gotIds) {
+			t.Errorf("%v - Want ids: %v\n", tt.name, tt.wantIds)
+			t.Errorf("%v - Got ids: %v\n", tt.name, gotIds)
+		}
+		if !reflect.DeepEqual(tt.wantMasks, gotMasks) {
+			t.Errorf("%v - Want attention masks: %v\n", tt.name, tt.wantMasks)
+			t.Errorf("%v - Got attention masks: %v\n", tt.name, gotMasks)
+		}
+	}
+}
+
+func TestTokenizerOption_MaxLengthTooShort(t *testing.T) {
+	// special tokens alone exceed max length, even for empty inputs.
+	tk := newTestTokenizer(t)
+	tk.WithTruncation(1, pipeline.OnlyFirst, 0, false)
+	for _, sentence := range []string{"", "a b"} {
+		if _, err := tk.EncodeList([]string{sentence}); err == nil {
+			t.Errorf("Want error for max length shorter than special tokens, input %q\n", sentence)
+		}
+	}
+
+	tk.WithTruncation(2, pipeline.LongestFirst, 0, false)
+	if _, err := tk.EncodePairList([]string{""}, []string{""}); err == nil {
+		t.Errorf("Want error for max length shorter than special tokens of pair\n")
+	}
+}
+
+func TestTokenizerOption_Overflowing(t *testing.T) {
+	tk := newTestTokenizer(t)
+	tk.WithTruncation(6, pipeline.OnlySecond, 1, true)
+	tk.WithPadding(pipeline.PadLongest, pipeline.PadRight, 0)
+
+	// [CLS] a [SEP] + 2 tokens of context + [SEP]
+	encodings, err := tk.EncodePairList([]string{"a"}, []string{"b c d e f"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	windows, mapping := pipeline.FlattenOverflowing(encodings)
+	wantIds := [][]int{
+		{2, 5, 3, 6, 7, 3},
+		{2, 5, 3, 7, 8, 3},
+		{2, 5, 3, 8, 9, 3},
+		{2, 5, 3, 9, 10, 3},
+	}
+	var gotIds [][]int
+	for _, w := range windows {
+		gotIds = append(gotIds, w.Ids)
+	}
+	if !reflect.DeepEqual(wantIds, gotIds) {
+		t.Errorf("Want ids: %v\n", wantIds)
+		t.Errorf("Got ids: %v\n", gotIds)
+	}
+
+	wantMapping := []int{0, 0, 0, 0}
+	if !reflect.DeepEqual(wantMapping, mapping) {
+		t.Errorf("Want sample mapping: %v\n", wantMapping)
+		t.Errorf("Got sample mapping: %v\n", mapping)
+	}
+
+	wantTypeIds := []int{0, 0, 0, 1, 1, 1}
+	if !reflect.DeepEqual(wantTypeIds, windows[1].TypeIds) {
+		t.Errorf("Want type ids: %v\n", wantTypeIds)
+		t.Errorf("Got type ids: %v\n", windows[1].TypeIds)
+	}
+}
+
+func TestTokenizerOption_EncodeWordsList(t *testing.T) {
+	tk := newTestTokenizer(t)
+
+	encodings, err := tk.EncodeWordsList([][]string{{"a", "b c"}, {"d"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Words are pre-tokenized: "b c" is the second word.
+	wantIds := []int{2, 5, 6, 7, 3}
+	wantWords := []int{-1, 0, 1, 1, -1}
+	if !reflect.DeepEqual(wantIds, encodings[0].Ids) {
+		t.Errorf("Want ids: %v\n", wantIds)
+		t.Errorf("Got ids: %v\n", encodings[0].Ids)
+	}
+	if !reflect.DeepEqual(wantWords, encodings[0].Words) {
+		t.Errorf("Want word ids: %v\n", wantWords)
+		t.Errorf("Got word ids: %v\n", encodings[0].Words)
+	}
+}
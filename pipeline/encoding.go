@@ -0,0 +1,216 @@
+package pipeline
+
+import (
+	"fmt"
+
+	"github.com/sugarme/tokenizer"
+)
+
+// Truncation and padding controls for `TokenizerOption`.
+// ======================================================
+//
+// Inputs are encoded without special tokens first, then truncated so that
+// the post-processed encoding (with special tokens) fits `MaxLength`. When
+// `ReturnOverflowing` is set, truncated tokens are returned as extra windows
+// in `Encoding.Overflowing`. Consecutive windows share `Stride` tokens so that
+// long documents can be processed in chunks (e.g. question answering).
+
+// TruncationStrategy specifies which sequence(s) to truncate when inputs are longer than max length.
+type TruncationStrategy int
+
+const (
+	DoNotTruncate TruncationStrategy = iota
+	LongestFirst                     // truncate token by token from the longest sequence of a pair
+	OnlyFirst                        // truncate only the first sequence
+	OnlySecond                       // truncate only the second sequence of a pair
+)
+
+// PaddingStrategy specifies length to pad encodings to.
+type PaddingStrategy int
+
+const (
+	DoNotPad     PaddingStrategy = iota
+	PadLongest                   // pad to the longest encoding in batch
+	PadMaxLength                 // pad to `EncodeOptions.MaxLength`
+)
+
+// PaddingSide specifies which side of encodings to pad.
+type PaddingSide int
+
+const (
+	PadRight PaddingSide = iota
+	PadLeft
+)
+
+// EncodeOptions holds truncation and padding options.
+//
+// The zero value does neither truncation nor padding.
+type EncodeOptions struct {
+	MaxLength         int                // max length including special tokens. Usually `MaxPositionEmbeddings` of model config.
+	Truncation        TruncationStrategy // default=DoNotTruncate
+	Stride            int                // number of overlapping tokens between overflowing windows
+	ReturnOverflowing bool               // whether to keep truncated tokens in `Encoding.Overflowing`
+	Padding           PaddingStrategy    // default=DoNotPad
+	PadToMultipleOf   int                // if > 0, round padded length up to a multiple of it
+	PaddingSide       PaddingSide        // default=PadRight
+}
+
+// window is a range `[start, end)` of token positions.
+type window struct {
+	start, end int
+}
+
+// splitWindows splits `n` tokens into windows of at most `size` tokens. Windows after the
+// first one start `stride` tokens before the end of the previous window.
+// If `overflowing` is false, only the first window is returned.
+func splitWindows(n, size, stride int, overflowing bool) ([]window, error) {
+	if size < 0 || (size == 0 && n > 0) {
+		err := fmt.Errorf("Truncation failed: sequence to truncate is too short to respect max length.")
+		return nil, err
+	}
+	if n <= size {
+		return []window{{0, n}}, nil
+	}
+	if !overflowing {
+		return []window{{0, size}}, nil
+	}
+	if stride >= size {
+		err := fmt.Errorf("Invalid stride (%v): stride must be less than number of tokens per window (%v).", stride, size)
+		return nil, err
+	}
+
+	var ws []window
+	start := 0
+	for {
+		end := start + size
+		if end >= n {
+			ws = append(ws, window{start, n})
+			break
+		}
+		ws = append(ws, window{start, end})
+		start = end - stride
+	}
+
+	return ws, nil
+}
+
+// sliceEncoding returns a new encoding of tokens at `[start, end)` of a
+// (not yet post-processed) encoding.
+func sliceEncoding(e *tokenizer.Encoding, start, end int) *tokenizer.Encoding {
+	copyInts := func(s []int) []int {
+		return append([]int{}, s[start:end]...)
+	}
+
+	offsets := make([][]int, 0, end-start)
+	for _, o := range e.Offsets[start:end] {
+		offsets = append(offsets, []int{o[0], o[1]})
+	}
+
+	var words []int
+	if len(e.Words) > 0 {
+		words = copyInts(e.Words)
+	}
+
+	return tokenizer.NewEncoding(
+		copyInts(e.Ids),
+		copyInts(e.TypeIds),
+		append([]string{}, e.Tokens[start:end]...),
+		offsets,
+		copyInts(e.SpecialTokenMask),
+		copyInts(e.AttentionMask),
+		nil,
+		tokenizer.WithWordsEncodingOpt(words),
+	)
+}
+
+// truncatePairLongestFirst returns lengths of the first and second sequences after removing
+// tokens one by one from the longest one until their sum fits `maxLength`.
+func truncatePairLongestFirst(n1, n2, maxLength int) (int, int) {
+	for n1+n2 > maxLength {
+		if n1 > n2 {
+			n1--
+		} else {
+			n2--
+		}
+	}
+
+	return n1, n2
+}
+
+// padEncoding pads an encoding to `length` tokens. Padded tokens are
+// masked out in attention mask and have no offsets nor word ids.
+func padEncoding(e *tokenizer.Encoding, length, padId int, padToken string, side PaddingSide) *tokenizer.Encoding {
+	n := length - len(e.Ids)
+	if n <= 0 {
+		return e
+	}
+
+	var (
+		ids      = make([]int, n)
+		typeIds  = make([]int, n)
+		tokens   = make([]string, n)
+		offsets  = make([][]int, n)
+		specials = make([]int, n)
+		masks    = make([]int, n)
+		words    = make([]int, n)
+	)
+	for i := 0; i < n; i++ {
+		ids[i] = padId
+		tokens[i] = padToken
+		offsets[i] = []int{0, 0}
+		specials[i] = 1
+		words[i] = -1
+	}
+
+	switch side {
+	case PadLeft:
+		e.Ids = append(ids, e.Ids...)
+		e.TypeIds = append(typeIds, e.TypeIds...)
+		e.Tokens = append(tokens, e.Tokens...)
+		e.Offsets = append(offsets, e.Offsets...)
+		e.SpecialTokenMask = append(specials, e.SpecialTokenMask...)
+		e.AttentionMask = append(masks, e.AttentionMask...)
+		if len(e.Words) > 0 {
+			e.Words = append(words, e.Words...)
+		}
+
+		// shift sequence ranges
+		for seqId, r := range e.SequenceRanges {
+			shifted := make(tokenizer.Range, len(r))
+			for i, v := range r {
+				shifted[i] = v + n
+			}
+			e.SequenceRanges[seqId] = shifted
+		}
+
+	default:
+		e.Ids = append(e.Ids, ids...)
+		e.TypeIds = append(e.TypeIds, typeIds...)
+		e.Tokens = append(e.Tokens, tokens...)
+		e.Offsets = append(e.Offsets, offsets...)
+		e.SpecialTokenMask = append(e.SpecialTokenMask, specials...)
+		e.AttentionMask = append(e.AttentionMask, masks...)
+		if len(e.Words) > 0 {
+			e.Words = append(e.Words, words...)
+		}
+	}
+
+	return e
+}
+
+// FlattenOverflowing flattens encodings and their overflowing windows into a single batch.
+// It also returns index of the input sample each window comes from.
+func FlattenOverflowing(encodings []tokenizer.Encoding) (windows []tokenizer.Encoding, sampleMapping []int) {
+	for i, e := range encodings {
+		overflowing := e.Overflowing
+		e.Overflowing = nil
+		windows = append(windows, e)
+		sampleMapping = append(sampleMapping, i)
+		for _, o := range overflowing {
+			windows = append(windows, o)
+			sampleMapping = append(sampleMapping, i)
+		}
+	}
+
+	return windows, sampleMapping
+}
@@ -0,0 +1,160 @@
+package pipeline
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/ts"
+	"github.com/sugarme/tokenizer"
+
+	"github.com/yinziyang/transformer/bert"
+)
+
+// Masked language modeling collator:
+// ==================================
+//
+// MLMCollator collates encodings as `Collate` does and masks tokens for masked language
+// modeling as BERT pretraining does:
+//   - each non-special token is selected with probability `MLMProbability`.
+//   - of selected tokens, 80% are replaced with the mask token, 10% with a random token and
+//     10% are kept unchanged.
+//   - labels are the original ids of selected tokens and `bert.IgnoreIndex` elsewhere, as
+//     expected by `BertForMaskedLM` and `RobertaForMaskedLM`.
+//
+// With whole word masking, all tokens of a word are selected together. Words are made of a
+// first token and its WordPiece continuation tokens ("##" prefixed) for Bert-like tokenizers,
+// and of tokens sharing the same word id for the others (e.g. BPE).
+
+// DefaultMLMProbability is the probability of selecting a token used by BERT pretraining.
+const DefaultMLMProbability float64 = 0.15
+
+// MLMCollator collates and masks batches for masked language modeling.
+type MLMCollator struct {
+	MLMProbability float64 // probability of selecting a token (or a word).
+	WholeWordMask  bool    // whether to select all tokens of a word together.
+
+	tk        *TokenizerOption
+	maskId    int64
+	vocabSize int
+	rng       *rand.Rand
+}
+
+// NewMLMCollator creates a MLMCollator.
+//
+// Params:
+//   - tk: tokenizer used to encode inputs. It must have padding and mask tokens.
+//   - mlmProbability: probability of selecting a token, in [0, 1].
+//   - wholeWordMask: whether to select all tokens of a word together.
+//   - seed: seed of random masking.
+func NewMLMCollator(tk *TokenizerOption, mlmProbability float64, wholeWordMask bool, seed int64) (*MLMCollator, error) {
+	if mlmProbability < 0 || mlmProbability > 1 {
+		err := fmt.Errorf("NewMLMCollator() failed: invalid MLM probability (%v), must be in [0, 1].", mlmProbability)
+		return nil, err
+	}
+
+	maskId, ok := tk.MaskId()
+	if !ok {
+		err := fmt.Errorf("NewMLMCollator() failed: tokenizer has no mask token.")
+		return nil, err
+	}
+
+	return &MLMCollator{
+		MLMProbability: mlmProbability,
+		WholeWordMask:  wholeWordMask,
+		tk:             tk,
+		maskId:         maskId,
+		vocabSize:      tk.tokenizer.GetVocabSize(true),
+		rng:            rand.New(rand.NewSource(seed)),
+	}, nil
+}
+
+// Collate turns a batch of encodings into masked model inputs on `device`.
+//
+// `Batch.InputIds` holds masked input ids and `Batch.Labels` the masked language modeling labels.
+func (c *MLMCollator) Collate(encodings []tokenizer.Encoding, device gotch.Device) (*Batch, error) {
+	batch, err := c.tk.Collate(encodings, device)
+	if err != nil {
+		return nil, err
+	}
+
+	shape := batch.InputIds.MustSize()
+	seqLen := int(shape[1])
+	inputIds := batch.InputIds.Int64Values()
+	labels := make([]int64, len(inputIds))
+	for i := range batch.WordIds {
+		row := inputIds[i*seqLen : (i+1)*seqLen]
+		c.mask(row, labels[i*seqLen:(i+1)*seqLen], batch.WordIds[i], batch.SpecialTokenMask[i])
+	}
+
+	toTensor := func(data []int64) *ts.Tensor {
+		return ts.MustOfSlice(data).MustView(shape, true).MustTo(device, true)
+	}
+	batch.InputIds.MustDrop()
+	batch.InputIds = toTensor(inputIds)
+	batch.Labels = toTensor(labels)
+
+	return batch, nil
+}
+
+// mask masks `ids` of an encoding in place and fills its `labels`.
+func (c *MLMCollator) mask(ids, labels []int64, wordIds, specialTokenMask []int) {
+	for _, word := range c.words(ids, wordIds, specialTokenMask) {
+		selected := c.rng.Float64() < c.MLMProbability
+		for _, j := range word {
+			labels[j] = bert.IgnoreIndex
+			if !selected {
+				continue
+			}
+
+			labels[j] = ids[j]
+			switch r := c.rng.Float64(); {
+			case r < 0.8:
+				ids[j] = c.maskId
+			case r < 0.9:
+				ids[j] = int64(c.rng.Intn(c.vocabSize))
+			}
+		}
+	}
+
+	for j := range ids {
+		if specialTokenMask[j] == 1 {
+			labels[j] = bert.IgnoreIndex
+		}
+	}
+}
+
+// words groups positions of non-special tokens into units selected together: single tokens,
+// or whole words with `WholeWordMask`.
+func (c *MLMCollator) words(ids []int64, wordIds, specialTokenMask []int) [][]int {
+	var (
+		words [][]int
+		prev  = -1 // previous non-special position.
+	)
+	for j := range ids {
+		if specialTokenMask[j] == 1 {
+			continue
+		}
+
+		if c.WholeWordMask && prev == j-1 && c.isContinuation(ids, wordIds, j) {
+			words[len(words)-1] = append(words[len(words)-1], j)
+		} else {
+			words = append(words, []int{j})
+		}
+		prev = j
+	}
+
+	return words
+}
+
+// isContinuation returns whether token at position `j` continues the word of token at `j-1`.
+func (c *MLMCollator) isContinuation(ids []int64, wordIds []int, j int) bool {
+	switch c.tk.model {
+	case Bert, DistilBert, Electra:
+		token, ok := c.tk.tokenizer.IdToToken(int(ids[j]))
+		return ok && strings.HasPrefix(token, "##")
+	default:
+		return wordIds[j] >= 0 && wordIds[j] == wordIds[j-1]
+	}
+}
@@ -0,0 +1,133 @@
+package pipeline_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sugarme/gotch"
+
+	"github.com/yinziyang/transformer/bert"
+	"github.com/yinziyang/transformer/pipeline"
+)
+
+func TestMLMCollator_Collate(t *testing.T) {
+	tk := newTestTokenizer(t)
+	collator, err := pipeline.NewMLMCollator(tk, 1.0, false, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sentences := make([]string, 64)
+	for i := range sentences {
+		sentences[i] = "a b c d e f g h i j"
+	}
+	sentences[0] = "a b"
+	encodings, err := tk.EncodeList(sentences)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original, err := tk.Collate(encodings, gotch.CPU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer original.Drop()
+
+	batch, err := collator.Collate(encodings, gotch.CPU)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer batch.Drop()
+
+	var (
+		wantIds  = original.InputIds.Int64Values()
+		inputIds = batch.InputIds.Int64Values()
+		labels   = batch.Labels.Int64Values()
+		seqLen   = len(wantIds) / len(sentences)
+		selected int
+		masked   int
+		kept     int
+	)
+	for n := range wantIds {
+		i, j := n/seqLen, n%seqLen
+		if original.SpecialTokenMask[i][j] == 1 {
+			// Special and padded tokens are neither masked nor labeled.
+			if labels[n] != bert.IgnoreIndex || inputIds[n] != wantIds[n] {
+				t.Errorf("Want special token %v at (%v, %v) unchanged and ignored\n", wantIds[n], i, j)
+				t.Errorf("Got input id %v and label %v\n", inputIds[n], labels[n])
+			}
+			continue
+		}
+
+		// All other tokens are selected with probability 1.
+		if labels[n] != wantIds[n] {
+			t.Errorf("Want label at (%v, %v): %v\n", i, j, wantIds[n])
+			t.Errorf("Got label at (%v, %v): %v\n", i, j, labels[n])
+		}
+		selected++
+		switch inputIds[n] {
+		case 4: // [MASK]
+			masked++
+		case wantIds[n]:
+			kept++
+		}
+	}
+
+	if ratio := float64(masked) / float64(selected); ratio < 0.7 || ratio > 0.9 {
+		t.Errorf("Want about 80%% masked tokens\n")
+		t.Errorf("Got %v masked tokens of %v\n", masked, selected)
+	}
+	if ratio := float64(kept) / float64(selected); ratio < 0.05 || ratio > 0.2 {
+		t.Errorf("Want about 10%% kept tokens (and random tokens equal to original ones)\n")
+		t.Errorf("Got %v kept tokens of %v\n", kept, selected)
+	}
+}
+
+func TestMLMCollator_WholeWordMask(t *testing.T) {
+	vocab := []string{"[PAD]", "[UNK]", "[CLS]", "[SEP]", "[MASK]", "a", "b", "##b", "##c"}
+	vocabFile := filepath.Join(t.TempDir(), "vocab.txt")
+	err := os.WriteFile(vocabFile, []byte(strings.Join(vocab, "\n")), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tk := pipeline.TokenizerOptionFromFile(pipeline.Bert, vocabFile)
+
+	collator, err := pipeline.NewMLMCollator(tk, 0.5, true, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// [CLS] a ##b a b a ##b ##c [SEP]
+	encodings, err := tk.EncodeList([]string{"ab a b abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := [][]int{{1, 2}, {3}, {4}, {5, 6, 7}}
+
+	for step := 0; step < 20; step++ {
+		batch, err := collator.Collate(encodings, gotch.CPU)
+		if err != nil {
+			t.Fatal(err)
+		}
+		labels := batch.Labels.Int64Values()
+		batch.Drop()
+
+		for _, word := range words {
+			for _, j := range word[1:] {
+				if (labels[j] == bert.IgnoreIndex) != (labels[word[0]] == bert.IgnoreIndex) {
+					t.Errorf("Want word %v entirely selected or not\n", word)
+					t.Errorf("Got labels: %v\n", labels)
+				}
+			}
+		}
+	}
+}
+
+func TestNewMLMCollator_Invalid(t *testing.T) {
+	tk := newTestTokenizer(t)
+	if _, err := pipeline.NewMLMCollator(tk, 1.5, false, 1); err == nil {
+		t.Errorf("Want error for invalid MLM probability\n")
+	}
+}
@@ -22,23 +22,26 @@ type Entity struct {
 
 // NERModel is a model to extract entities
 type NERModel struct {
-	tokenClassificationModel TokenClassificationModel
+	tokenClassificationModel *TokenClassificationModel
 }
 
 // NewNERModel creates a NERModel from input config
-func NewNERModel(config TokenClassificationModel) *NERModel {
+func NewNERModel(config *TokenClassificationModel) *NERModel {
 	return &NERModel{
 		tokenClassificationModel: config,
 	}
 }
 
 // Predict extracts entities from input text and returns slice of entities with score
-func (nm *NERModel) Predict(input []string) []Entity {
-	tokens := nm.tokenClassificationModel.Predict(input, true, false)
+func (nm *NERModel) Predict(input []string) ([]Entity, error) {
+	tokens, err := nm.tokenClassificationModel.Predict(input, true, false)
+	if err != nil {
+		return nil, err
+	}
 
 	var entities []Entity
 	for _, tok := range tokens {
-		if tok.Label != "0" {
+		if tok.Label != "O" {
 			entities = append(entities, Entity{
 				Word:  tok.Text,
 				Score: tok.Score,
@@ -47,5 +50,5 @@ func (nm *NERModel) Predict(input []string) []Entity {
 		}
 	}
 
-	return entities
+	return entities, nil
 }
@@ -0,0 +1,136 @@
+package pipeline
+
+// Text generation pipeline
+// Generates continuation of prompts with a decoder language model
+// (e.g. `BertForMaskedLM` with `IsDecoder` config) using greedy decoding,
+// beam search or sampling (see `generation.GenerateConfig`).
+
+import (
+	"fmt"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/ts"
+	"github.com/sugarme/tokenizer"
+
+	"github.com/yinziyang/transformer/bert"
+	"github.com/yinziyang/transformer/generation"
+)
+
+// TextGenerationModel generates text from prompts.
+type TextGenerationModel struct {
+	model     generation.LanguageModel
+	tokenizer *TokenizerOption
+	config    *generation.GenerateConfig
+	device    gotch.Device
+}
+
+// NewTextGenerationModel creates a TextGenerationModel.
+//
+// Params:
+//   - `model`: language model, e.g. created by `NewBertLanguageModel`.
+//   - `tk`: tokenizer of model.
+//   - `config`: generation config. If nil, `generation.DefaultGenerateConfig()` is used.
+//   - `device`: device of model.
+func NewTextGenerationModel(model generation.LanguageModel, tk *TokenizerOption, config *generation.GenerateConfig, device gotch.Device) *TextGenerationModel {
+	if config == nil {
+		config = generation.DefaultGenerateConfig()
+	}
+
+	return &TextGenerationModel{
+		model:     model,
+		tokenizer: tk,
+		config:    config,
+		device:    device,
+	}
+}
+
+// Generate generates text for each prompt. Returned texts include prompts.
+func (tg *TextGenerationModel) Generate(prompts []string) ([]string, error) {
+	var inputs [][]int64
+	for _, prompt := range prompts {
+		input := tokenizer.NewSingleEncodeInput(tokenizer.NewInputSequence(prompt))
+		encoding, err := tg.tokenizer.tokenizer.Encode(input, false)
+		if err != nil {
+			return nil, err
+		}
+		if encoding.Len() == 0 {
+			err := fmt.Errorf("Generate() failed: prompt %q has no tokens.", prompt)
+			return nil, err
+		}
+
+		var ids []int64
+		for _, id := range encoding.Ids {
+			ids = append(ids, int64(id))
+		}
+		inputs = append(inputs, ids)
+	}
+
+	outputs, err := generation.Generate(tg.model, inputs, tg.config, tg.device)
+	if err != nil {
+		return nil, err
+	}
+
+	var texts []string
+	for _, output := range outputs {
+		ids := make([]int, len(output))
+		for i, id := range output {
+			ids[i] = int(id)
+		}
+		texts = append(texts, tg.tokenizer.tokenizer.Decode(ids, true))
+	}
+
+	return texts, nil
+}
+
+// bertLanguageModel wraps a decoder `BertForMaskedLM` as `generation.LanguageModel`.
+type bertLanguageModel struct {
+	model *bert.BertForMaskedLM
+}
+
+// bertCache wraps `bert.Cache` as `generation.Cache`.
+type bertCache struct {
+	cache *bert.Cache
+}
+
+func (c *bertCache) Reorder(index *ts.Tensor) generation.Cache {
+	return &bertCache{c.cache.Reorder(index)}
+}
+
+func (c *bertCache) Drop() {
+	c.cache.Drop()
+}
+
+// NewBertLanguageModel wraps a `BertForMaskedLM` built with `IsDecoder` config as a language model
+// for generation. Keys and values of previous steps are cached.
+func NewBertLanguageModel(model *bert.BertForMaskedLM) generation.LanguageModel {
+	return &bertLanguageModel{model}
+}
+
+// ForwardStep implements `generation.LanguageModel` interface.
+func (m *bertLanguageModel) ForwardStep(inputIds *ts.Tensor, cache generation.Cache) (*ts.Tensor, generation.Cache, error) {
+	var past *bert.Cache
+	if cache != nil {
+		past = cache.(*bertCache).cache
+	}
+
+	var (
+		logits  *ts.Tensor
+		present *bert.Cache
+		err     error
+	)
+	ts.NoGrad(func() {
+		var output *bert.ModelOutput
+		output, present, err = m.model.ForwardCachedT(inputIds, ts.None, ts.None, ts.None, ts.None, ts.None, ts.None, past, false)
+		if err != nil {
+			return
+		}
+		seqLen := output.Logits.MustSize()[1]
+		logits = output.Logits.MustSelect(1, seqLen-1, false)
+		output.Drop()
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return logits, &bertCache{present}, nil
+}
@@ -0,0 +1,101 @@
+package pipeline_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/nn"
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/bert"
+	"github.com/yinziyang/transformer/generation"
+	"github.com/yinziyang/transformer/pipeline"
+)
+
+// newDecoderMLM creates a `BertForMaskedLM` decoder with vocabulary of `newTestTokenizer`.
+func newDecoderMLM(t *testing.T) *bert.BertForMaskedLM {
+	config := bert.NewConfig(map[string]interface{}{
+		"VocabSize":         int64(15),
+		"HiddenSize":        int64(8),
+		"NumHiddenLayers":   int64(2),
+		"NumAttentionHeads": int64(2),
+		"IntermediateSize":  int64(16),
+	})
+	config.IsDecoder = true
+	vs := nn.NewVarStore(gotch.CPU)
+	mlm, err := bert.NewBertForMaskedLM(vs.Root(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return mlm
+}
+
+func TestTextGenerationModel(t *testing.T) {
+	tk := newTestTokenizer(t)
+	mlm := newDecoderMLM(t)
+
+	genConfig := generation.DefaultGenerateConfig()
+	genConfig.MaxLength = 6
+	genConfig.NumBeams = 2
+	model := pipeline.NewTextGenerationModel(pipeline.NewBertLanguageModel(mlm), tk, genConfig, gotch.CPU)
+
+	texts, err := model.Generate([]string{"a b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(texts) != 2 || !strings.HasPrefix(texts[0], "a b") || !strings.HasPrefix(texts[1], "c") {
+		t.Errorf("Want 2 texts starting with prompts\n")
+		t.Errorf("Got: %q\n", texts)
+	}
+}
+
+// uncachedModel hides cache of a language model: full sequences are passed at each step.
+type uncachedModel struct {
+	model generation.LanguageModel
+}
+
+func (m *uncachedModel) ForwardStep(inputIds *ts.Tensor, cache generation.Cache) (*ts.Tensor, generation.Cache, error) {
+	logits, next, err := m.model.ForwardStep(inputIds, nil)
+	if next != nil {
+		next.Drop()
+	}
+
+	return logits, nil, err
+}
+
+// Decoding with cached keys and values (reordered between beams in beam search) must match
+// decoding of full sequences.
+func TestBertLanguageModel_Cache(t *testing.T) {
+	model := pipeline.NewBertLanguageModel(newDecoderMLM(t))
+	prompts := [][]int64{{2, 5, 6}, {2, 7}}
+
+	tests := []struct {
+		name     string
+		numBeams int
+	}{
+		{"greedy", 1},
+		{"beam search", 3},
+	}
+	for _, tt := range tests {
+		config := generation.DefaultGenerateConfig()
+		config.MaxLength = 10
+		config.NumBeams = tt.numBeams
+
+		want, err := generation.Generate(&uncachedModel{model}, prompts, config, gotch.CPU)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := generation.Generate(model, prompts, config, gotch.CPU)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("%v - Want (without cache): %v\n", tt.name, want)
+			t.Errorf("%v - Got (with cache): %v\n", tt.name, got)
+		}
+	}
+}
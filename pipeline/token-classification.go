@@ -4,8 +4,145 @@ package pipeline
 // More generic token classification pipeline, works with multiple models (Bert, Roberta).
 
 import (
+	"fmt"
+	"strings"
 
-// "github.com/sugarme/gotch/nn"
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/bert"
 )
 
-type TokenClassificationModel struct{}
+// TokenClassifier is a token classification head, e.g. `bert.BertForTokenClassification` or
+// `roberta.RobertaForTokenClassification`.
+type TokenClassifier interface {
+	ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, labels *ts.Tensor, train bool) (*bert.ModelOutput, error)
+}
+
+// Token holds a token of input text with its predicted label.
+type Token struct {
+	Text       string  // token (or word if sub-tokens are consolidated).
+	Score      float64 // probability of label.
+	Label      string  // label, e.g. "B-PER".
+	LabelIndex int64   // label id.
+	Sentence   int     // index of input sentence.
+	Index      int     // position of token in encoding.
+	WordIndex  int     // index of word in sentence, -1 for special tokens.
+	Offset     []int   // start and end offsets of token in sentence.
+}
+
+// TokenClassificationModel labels tokens of input texts.
+type TokenClassificationModel struct {
+	model        TokenClassifier
+	tokenizer    *TokenizerOption
+	labelMapping map[int64]string
+	device       gotch.Device
+}
+
+// NewTokenClassificationModel creates a TokenClassificationModel.
+//
+// Params:
+//   - `model`: token classification head.
+//   - `tk`: tokenizer of model.
+//   - `labelMapping`: label of each label id, e.g. `ConfigOption.GetLabelMapping()`.
+//   - `device`: device of model.
+func NewTokenClassificationModel(model TokenClassifier, tk *TokenizerOption, labelMapping map[int64]string, device gotch.Device) *TokenClassificationModel {
+	return &TokenClassificationModel{
+		model:        model,
+		tokenizer:    tk,
+		labelMapping: labelMapping,
+		device:       device,
+	}
+}
+
+// Predict labels tokens of input sentences.
+//
+// Params:
+//   - `input`: sentences.
+//   - `consolidateSubTokens`: whether to merge sub-tokens of a word into a single token labeled
+//     as the first sub-token.
+//   - `returnSpecial`: whether to return special tokens (e.g. "[CLS]").
+func (tc *TokenClassificationModel) Predict(input []string, consolidateSubTokens, returnSpecial bool) ([]Token, error) {
+	encodings, err := tc.tokenizer.EncodeList(input)
+	if err != nil {
+		err = fmt.Errorf("Predict() failed: %w", err)
+		return nil, err
+	}
+	batch, err := tc.tokenizer.Collate(encodings, tc.device)
+	if err != nil {
+		err = fmt.Errorf("Predict() failed: %w", err)
+		return nil, err
+	}
+	defer batch.Drop()
+
+	var (
+		probs []float64
+		shape []int64
+	)
+	ts.NoGrad(func() {
+		var output *bert.ModelOutput
+		output, err = tc.model.ForwardT(batch.InputIds, batch.AttentionMask, batch.TokenTypeIds, batch.PositionIds, ts.None, ts.None, false)
+		if err != nil {
+			return
+		}
+		defer output.Drop()
+
+		x := output.Logits.MustSoftmax(-1, gotch.Double, false)
+		probs = x.Float64Values()
+		shape = x.MustSize()
+		x.MustDrop()
+	})
+	if err != nil {
+		err = fmt.Errorf("Predict() failed: %w", err)
+		return nil, err
+	}
+
+	seqLen, numLabels := int(shape[1]), int(shape[2])
+	var tokens []Token
+	for i, e := range encodings {
+		// position of first token of encoding in padded batch.
+		var shift int
+		if tc.tokenizer.options.PaddingSide == PadLeft {
+			shift = seqLen - e.Len()
+		}
+
+		prev := -1 // index of previous token of sentence in `tokens`, -1 if none.
+		for j := 0; j < e.Len(); j++ {
+			if e.AttentionMask[j] == 0 || (!returnSpecial && e.SpecialTokenMask[j] == 1) {
+				continue
+			}
+
+			wordIndex := -1
+			if len(e.Words) > 0 && e.SpecialTokenMask[j] == 0 {
+				wordIndex = e.Words[j]
+			}
+			if consolidateSubTokens && prev >= 0 && wordIndex >= 0 && tokens[prev].WordIndex == wordIndex {
+				tokens[prev].Text += strings.TrimPrefix(e.Tokens[j], "##")
+				tokens[prev].Offset[1] = e.Offsets[j][1]
+				continue
+			}
+
+			row := probs[((i*seqLen)+j+shift)*numLabels : ((i*seqLen)+j+shift+1)*numLabels]
+			var labelIndex int64
+			for k, p := range row {
+				if p > row[labelIndex] {
+					labelIndex = int64(k)
+				}
+			}
+
+			tokens = append(tokens, Token{
+				Text:       e.Tokens[j],
+				Score:      row[labelIndex],
+				Label:      tc.labelMapping[labelIndex],
+				LabelIndex: labelIndex,
+				Sentence:   i,
+				Index:      j,
+				WordIndex:  wordIndex,
+				Offset:     []int{e.Offsets[j][0], e.Offsets[j][1]},
+			})
+			prev = len(tokens) - 1
+		}
+	}
+
+	return tokens, nil
+}
@@ -0,0 +1,79 @@
+package pipeline_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/bert"
+	"github.com/yinziyang/transformer/pipeline"
+)
+
+// fakeTokenClassifier labels token of id `i` with label `i % 3`.
+type fakeTokenClassifier struct{}
+
+func (m *fakeTokenClassifier) ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, labels *ts.Tensor, train bool) (*bert.ModelOutput, error) {
+	shape := inputIds.MustSize()
+	var logits []float32
+	for _, id := range inputIds.Int64Values() {
+		row := make([]float32, 3)
+		row[id%3] = 10
+		logits = append(logits, row...)
+	}
+	x := ts.MustOfSlice(logits).MustView([]int64{shape[0], shape[1], 3}, true)
+
+	return &bert.ModelOutput{Logits: x}, nil
+}
+
+func TestTokenClassificationModel_Predict(t *testing.T) {
+	tk := newTestTokenizer(t)
+	labels := map[int64]string{0: "O", 1: "B-PER", 2: "I-PER"}
+	model := pipeline.NewTokenClassificationModel(&fakeTokenClassifier{}, tk, labels, gotch.CPU)
+
+	tokens, err := model.Predict([]string{"a b c", "c"}, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a=5, b=6, c=7
+	type token struct {
+		text     string
+		label    string
+		sentence int
+		index    int
+	}
+	want := []token{{"a", "I-PER", 0, 1}, {"b", "O", 0, 2}, {"c", "B-PER", 0, 3}, {"c", "B-PER", 1, 1}}
+	var got []token
+	for _, tok := range tokens {
+		got = append(got, token{tok.Text, tok.Label, tok.Sentence, tok.Index})
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Want tokens: %v\n", want)
+		t.Errorf("Got tokens: %v\n", got)
+	}
+
+	tokens, err = model.Predict([]string{"c"}, true, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 3 || tokens[0].Text != "[CLS]" || tokens[0].WordIndex != -1 {
+		t.Errorf("Want 3 tokens with special tokens, got %v\n", tokens)
+	}
+
+	entities, err := pipeline.NewNERModel(model).Predict([]string{"a b c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantEntities := []pipeline.Entity{{Word: "a", Score: 1, Label: "I-PER"}, {Word: "c", Score: 1, Label: "B-PER"}}
+	if len(entities) != len(wantEntities) {
+		t.Fatalf("Want entities: %v\nGot entities: %v\n", wantEntities, entities)
+	}
+	for i, e := range entities {
+		if e.Word != wantEntities[i].Word || e.Label != wantEntities[i].Label || e.Score < 0.99 {
+			t.Errorf("Want entity: %v\n", wantEntities[i])
+			t.Errorf("Got entity: %v\n", e)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package roberta
+
+// Gradient checkpointing is enabled with `GradientCheckpointing` of `bert.BertConfig`.
+// See `bert.BertEncoder.BackwardCheckpoints`.
+
+// BackwardCheckpoints completes the backward pass through checkpointed encoder layers.
+func (mlm *RobertaForMaskedLM) BackwardCheckpoints() error {
+	return mlm.roberta.BackwardCheckpoints()
+}
+
+// BackwardCheckpoints completes the backward pass through checkpointed encoder layers.
+func (sc *RobertaForSequenceClassification) BackwardCheckpoints() error {
+	return sc.roberta.BackwardCheckpoints()
+}
+
+// BackwardCheckpoints completes the backward pass through checkpointed encoder layers.
+func (mc *RobertaForMultipleChoice) BackwardCheckpoints() error {
+	return mc.roberta.BackwardCheckpoints()
+}
+
+// BackwardCheckpoints completes the backward pass through checkpointed encoder layers.
+func (tc *RobertaForTokenClassification) BackwardCheckpoints() error {
+	return tc.roberta.BackwardCheckpoints()
+}
+
+// BackwardCheckpoints completes the backward pass through checkpointed encoder layers.
+func (qa *RobertaForQuestionAnswering) BackwardCheckpoints() error {
+	return qa.roberta.BackwardCheckpoints()
+}
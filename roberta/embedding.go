@@ -20,16 +20,18 @@ type RobertaEmbeddings struct {
 	layerNorm           *nn.LayerNorm
 	dropout             *util.Dropout
 	paddingIndex        int64
+	absolutePosition    bool // whether position embeddings are added, see `bert.BertConfig.IsAbsolutePosition`
 }
 
 func (re *RobertaEmbeddings) createPositionIdsFromInputIds(x *ts.Tensor) *ts.Tensor {
-	mask := x.MustNe(ts.IntScalar(re.paddingIndex), false).MustTotype(gotch.Int64, true)
-	cumSum := mask.MustCumsum(1, gotch.Int64, false)
-	mul := cumSum.MustMul(mask, true)
-	retVal := mul.MustAddScalar(ts.IntScalar(re.paddingIndex), false)
-	mul.MustDrop()
+	s := util.NewScope()
+	defer s.Close()
 
-	return retVal
+	mask := s.Track(s.Track(x.MustNe(ts.IntScalar(re.paddingIndex), false)).MustTotype(gotch.Int64, false))
+	cumSum := s.Track(mask.MustCumsum(1, gotch.Int64, false))
+	mul := s.Track(cumSum.MustMul(mask, false))
+
+	return mul.MustAddScalar(ts.IntScalar(re.paddingIndex), false)
 }
 
 func (re *RobertaEmbeddings) createPositionIdsFromEmbeddings(x *ts.Tensor) *ts.Tensor {
@@ -53,12 +55,15 @@ func NewRobertaEmbeddings(p nn.Path, config *bert.BertConfig) *RobertaEmbeddings
 	embeddingConfig.PaddingIdx = 1
 
 	wordEmbeddings := nn.NewEmbedding(p.Sub("word_embeddings"), config.VocabSize, config.HiddenSize, embeddingConfig)
-	positionEmbeddings := nn.NewEmbedding(p.Sub("position_embeddings"), config.MaxPositionEmbeddings, config.HiddenSize, nn.DefaultEmbeddingConfig())
+	var positionEmbeddings *nn.Embedding
+	if config.HasPositionEmbeddings() {
+		positionEmbeddings = nn.NewEmbedding(p.Sub("position_embeddings"), config.MaxPositionEmbeddings, config.HiddenSize, nn.DefaultEmbeddingConfig())
+	}
 	tokenTypeEmbeddings := nn.NewEmbedding(p.Sub("token_type_embeddings"), config.TypeVocabSize, config.HiddenSize, nn.DefaultEmbeddingConfig())
 
 	layerNormConfig := nn.DefaultLayerNormConfig()
 	layerNormConfig.Eps = 1e-12
-	layerNorm := nn.NewLayerNorm(p.Sub("LayerNorm"), []int64{config.HiddenSize}, layerNormConfig)
+	layerNorm := util.NewLayerNorm(p.Sub("LayerNorm"), []int64{config.HiddenSize}, layerNormConfig)
 	dropout := util.NewDropout(config.HiddenDropoutProb)
 
 	return &RobertaEmbeddings{
@@ -67,6 +72,7 @@ func NewRobertaEmbeddings(p nn.Path, config *bert.BertConfig) *RobertaEmbeddings
 		tokenTypeEmbeddings: tokenTypeEmbeddings,
 		layerNorm:           layerNorm,
 		dropout:             dropout,
+		absolutePosition:    config.IsAbsolutePosition(),
 	}
 }
 
@@ -114,34 +120,40 @@ func (re *RobertaEmbeddings) ForwardT(inputIds, tokenTypeIds, positionIds, input
 		}
 	}
 
-	var posIds *ts.Tensor
-	if positionIds.MustDefined() {
-		posIds = positionIds
-	} else {
-		if inputIds.MustDefined() {
-			posIds = re.createPositionIdsFromInputIds(inputIds)
-		} else {
-			posIds = re.createPositionIdsFromEmbeddings(inputEmbeds)
-		}
-	}
+	s := util.NewScope()
+	defer s.Close()
 
-	var tokTypeIds *ts.Tensor
-	if tokenTypeIds.MustDefined() {
-		tokTypeIds = tokenTypeIds
-	} else {
-		tokTypeIds = ts.MustZeros(inputShape, gotch.Int64, inputEmbeddings.MustDevice())
+	// NOTE. only tensors created here are tracked, caller's tensors are left untouched.
+	if inputEmbeddings != inputEmbeds {
+		s.Track(inputEmbeddings)
 	}
 
-	positionEmbeddings := posIds.Apply(re.positionEmbeddings)
-	tokenTypeEmbeddings := tokTypeIds.Apply(re.tokenTypeEmbeddings)
+	tokTypeIds := tokenTypeIds
+	if !tokenTypeIds.MustDefined() {
+		tokTypeIds = s.Track(ts.MustZeros(inputShape, gotch.Int64, inputEmbeddings.MustDevice()))
+	}
+	tokenTypeEmbeddings := s.Track(tokTypeIds.Apply(re.tokenTypeEmbeddings))
+
+	// Other position strategies are applied in attention.
+	var newInputEmbeddings *ts.Tensor
+	if re.absolutePosition {
+		posIds := positionIds
+		if !positionIds.MustDefined() {
+			if inputIds.MustDefined() {
+				posIds = s.Track(re.createPositionIdsFromInputIds(inputIds))
+			} else {
+				posIds = s.Track(re.createPositionIdsFromEmbeddings(inputEmbeds))
+			}
+		}
+		positionEmbeddings := s.Track(posIds.Apply(re.positionEmbeddings))
 
-	add1 := inputEmbeddings.MustAdd(positionEmbeddings, true)
-	newInputEmbeddings := add1.MustAdd(tokenTypeEmbeddings, true)
-	inputEmbeddings.MustDrop()
+		add1 := s.Track(inputEmbeddings.MustAdd(positionEmbeddings, false))
+		newInputEmbeddings = s.Track(add1.MustAdd(tokenTypeEmbeddings, false))
+	} else {
+		newInputEmbeddings = s.Track(inputEmbeddings.MustAdd(tokenTypeEmbeddings, false))
+	}
 
-	appliedLN := newInputEmbeddings.Apply(re.layerNorm)
-	appliedDropout := appliedLN.ApplyT(re.dropout, train)
-	appliedLN.MustDrop()
+	appliedLN := s.Track(util.ApplyLayerNorm(re.layerNorm, newInputEmbeddings))
 
-	return appliedDropout, nil
+	return appliedLN.ApplyT(re.dropout, train), nil
 }
@@ -0,0 +1,52 @@
+package roberta_test
+
+import (
+	"testing"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/nn"
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/bert"
+	"github.com/yinziyang/transformer/roberta"
+	"github.com/yinziyang/transformer/util"
+)
+
+func TestRobertaForSequenceClassification_NoLeak(t *testing.T) {
+	config := bert.NewConfig(map[string]interface{}{
+		"VocabSize":         int64(20),
+		"HiddenSize":        int64(8),
+		"NumHiddenLayers":   int64(2),
+		"NumAttentionHeads": int64(2),
+		"IntermediateSize":  int64(16),
+	})
+	config.Id2Label = map[int64]string{0: "negative", 1: "positive"}
+
+	vs := nn.NewVarStore(gotch.CPU)
+	model := roberta.NewRobertaForSequenceClassification(vs.Root(), config)
+
+	inputIds := ts.MustOfSlice([]int64{0, 5, 6, 2, 0, 7, 2, 1}).MustView([]int64{2, 4}, true)
+
+	forward := func() {
+		ts.NoGrad(func() {
+			output, err := model.ForwardT(inputIds, ts.None, ts.None, ts.None, ts.None, ts.None, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			output.Drop()
+		})
+	}
+
+	forward()
+	want := util.NumLiveTensors()
+
+	for i := 0; i < 50; i++ {
+		forward()
+	}
+
+	got := util.NumLiveTensors()
+	if got > want {
+		t.Errorf("Want live tensors to stay at: %v\n", want)
+		t.Errorf("Got live tensors: %v\n", got)
+	}
+}
@@ -0,0 +1,32 @@
+package roberta
+
+import (
+	"github.com/yinziyang/transformer/bert"
+)
+
+// LoRA adapters are added with `bert.AddLoRA`, see `bert.LoRAConfig`.
+
+// BaseModel returns the underlying RoBERTa model.
+func (mlm *RobertaForMaskedLM) BaseModel() *bert.BertModel {
+	return mlm.roberta
+}
+
+// BaseModel returns the underlying RoBERTa model.
+func (sc *RobertaForSequenceClassification) BaseModel() *bert.BertModel {
+	return sc.roberta
+}
+
+// BaseModel returns the underlying RoBERTa model.
+func (mc *RobertaForMultipleChoice) BaseModel() *bert.BertModel {
+	return mc.roberta
+}
+
+// BaseModel returns the underlying RoBERTa model.
+func (tc *RobertaForTokenClassification) BaseModel() *bert.BertModel {
+	return tc.roberta
+}
+
+// BaseModel returns the underlying RoBERTa model.
+func (qa *RobertaForQuestionAnswering) BaseModel() *bert.BertModel {
+	return qa.roberta
+}
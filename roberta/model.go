@@ -29,7 +29,7 @@ func NewRobertaLMHead(p *nn.Path, config *bert.BertConfig) (*RobertaLMHead, erro
 
 	layerNormConfig := nn.DefaultLayerNormConfig()
 	layerNormConfig.Eps = 1e-12
-	layerNorm := nn.NewLayerNorm(p.Sub("layer_norm"), []int64{config.HiddenSize}, layerNormConfig)
+	layerNorm := util.NewLayerNorm(p.Sub("layer_norm"), []int64{config.HiddenSize}, layerNormConfig)
 
 	decoder, err := util.NewLinearNoBias(p.Sub("decoder"), config.HiddenSize, config.VocabSize, util.DefaultLinearNoBiasConfig())
 	if err != nil {
@@ -51,18 +51,16 @@ func NewRobertaLMHead(p *nn.Path, config *bert.BertConfig) (*RobertaLMHead, erro
 
 // Foward forwards pass through RobertaLMHead model.
 func (rh *RobertaLMHead) Forward(hiddenStates *ts.Tensor) *ts.Tensor {
-	gelu := util.NewGelu()
-	appliedDense := hiddenStates.Apply(rh.dense)
-	geluFwd := gelu.Fwd(appliedDense)
-	appliedLN := geluFwd.Apply(rh.layerNorm)
-	appliedDecoder := appliedLN.Apply(rh.decoder)
-	appliedBias := appliedDecoder.MustAdd(rh.bias, true)
+	s := util.NewScope()
+	defer s.Close()
 
-	geluFwd.MustDrop()
-	appliedDense.MustDrop()
-	appliedLN.MustDrop()
+	gelu := util.NewGelu()
+	appliedDense := s.Track(hiddenStates.Apply(rh.dense))
+	geluFwd := s.Track(gelu.Fwd(appliedDense))
+	appliedLN := s.Track(util.ApplyLayerNorm(rh.layerNorm, geluFwd))
+	appliedDecoder := s.Track(appliedLN.Apply(rh.decoder))
 
-	return appliedBias
+	return appliedDecoder.MustAdd(rh.bias, false)
 }
 
 // RobertaForMaskedLM holds data for Roberta masked language model.
@@ -109,8 +107,10 @@ func (mlm *RobertaForMaskedLM) Load(modelNameOrPath string, config interface{ pr
 	vs := nn.NewVarStore(device)
 	p := vs.Root()
 
-	mlm.roberta = bert.NewBertModel(p.Sub("roberta"), config.(*bert.BertConfig), false)
-	mlm.lmHead, err = NewRobertaLMHead(p.Sub("lm_head"), config.(*bert.BertConfig))
+	util.WithDType(config.(*bert.BertConfig).ModelDType(), func() {
+		mlm.roberta = bert.NewBertModel(p.Sub("roberta"), config.(*bert.BertConfig), false)
+		mlm.lmHead, err = NewRobertaLMHead(p.Sub("lm_head"), config.(*bert.BertConfig))
+	})
 
 	// err = vs.Load(cachedFile)
 	err = pickle.LoadAll(vs, cachedFile)
@@ -142,27 +142,33 @@ func (mlm *RobertaForMaskedLM) Load(modelNameOrPath string, config interface{ pr
 //   - `encoderMask`: Optional encoder attention mask of shape (batch size, encoder sequence length).
 //     If the model is defined as a decoder and the *encoder_hidden_states* is not None,
 //     used to mask encoder values. Positions with value 0 will be masked.
+//   - `labels`: Optional token ids of shape (batch size, sequence length) to compute masked
+//     language modeling loss. Positions with value -100 (non-masked tokens) are ignored.
 //   - `train`: boolean flag to turn on/off the dropout layers in the model.
 //     Should be set to false for inference.
 //
-// Returns:
-//   - `output`: tensor of shape (batch size, numLabels, vocab size)
-//   - `hiddenStates`: optional slice of tensors of length numHiddenLayers with shape
-//     (batch size, sequence length, hidden size).
-//   - `attentions`:  optional slice of tensors of length num hidden layers with shape
+// Returns model output with:
+//   - `Logits`: prediction scores of shape (batch size, sequence length, vocab size)
+//   - `Loss`: cross-entropy loss if `labels` are given
+//   - `HiddenStates`: optional slice of tensors of length numHiddenLayers with shape
 //     (batch size, sequence length, hidden size).
-//   - `err`: error
-func (mlm *RobertaForMaskedLM) Forward(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, encoderHiddenStates, encoderMask *ts.Tensor, train bool) (output *ts.Tensor, hiddenStates, attentions []ts.Tensor, err error) {
-
-	hiddenState, _, allHiddenStates, allAttentions, err := mlm.roberta.ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, encoderHiddenStates, encoderMask, train)
+//   - `Attentions`:  optional slice of tensors of length num hidden layers with shape
+//     (batch size, num heads, sequence length, sequence length).
+func (mlm *RobertaForMaskedLM) Forward(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, encoderHiddenStates, encoderMask, labels *ts.Tensor, train bool) (*bert.ModelOutput, error) {
 
+	output, err := mlm.roberta.ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, encoderHiddenStates, encoderMask, train)
 	if err != nil {
-		return ts.None, nil, nil, err
+		return nil, err
 	}
 
-	predictionScores := mlm.lmHead.Forward(hiddenState)
+	output.Logits = mlm.lmHead.Forward(output.LastHiddenState)
+	output.DropBase()
 
-	return predictionScores, allHiddenStates, allAttentions, nil
+	if hasLabels(labels) {
+		output.Loss = bert.CrossEntropyLoss(output.Logits, labels, bert.IgnoreIndex)
+	}
+
+	return output, nil
 }
 
 // RoberatClassificationHead holds data for Roberta classification head.
@@ -188,25 +194,24 @@ func NewRobertaClassificationHead(p *nn.Path, config *bert.BertConfig) *RobertaC
 
 // ForwardT forwards pass through model.
 func (ch *RobertaClassificationHead) ForwardT(hiddenStates *ts.Tensor, train bool) *ts.Tensor {
-	appliedDO1 := hiddenStates.MustSelect(1, 0, false).ApplyT(ch.dropout, train)
-	appliedDense := appliedDO1.Apply(ch.dense)
-	tanhTs := appliedDense.MustTanh(false)
-	appliedDO2 := tanhTs.ApplyT(ch.dropout, train)
-	retVal := appliedDO2.Apply(ch.outProj)
-
-	appliedDO1.MustDrop()
-	appliedDense.MustDrop()
-	tanhTs.MustDrop()
-	appliedDO2.MustDrop()
-
-	return retVal
+	s := util.NewScope()
+	defer s.Close()
+
+	firstToken := s.Track(hiddenStates.MustSelect(1, 0, false))
+	appliedDO1 := s.Track(firstToken.ApplyT(ch.dropout, train))
+	appliedDense := s.Track(appliedDO1.Apply(ch.dense))
+	tanhTs := s.Track(appliedDense.MustTanh(false))
+	appliedDO2 := s.Track(tanhTs.ApplyT(ch.dropout, train))
+
+	return appliedDO2.Apply(ch.outProj)
 }
 
 // RobertaForSequenceClassification holds data for Roberta sequence classification model.
 // It's used for performing sentence or document-level classification.
 type RobertaForSequenceClassification struct {
-	roberta    *bert.BertModel
-	classifier *RobertaClassificationHead
+	roberta     *bert.BertModel
+	classifier  *RobertaClassificationHead
+	problemType string
 }
 
 // NewRobertaForSequenceClassification creates a new RobertaForSequenceClassification model.
@@ -215,8 +220,9 @@ func NewRobertaForSequenceClassification(p *nn.Path, config *bert.BertConfig) *R
 	classifier := NewRobertaClassificationHead(p.Sub("classifier"), config)
 
 	return &RobertaForSequenceClassification{
-		roberta:    roberta,
-		classifier: classifier,
+		roberta:     roberta,
+		classifier:  classifier,
+		problemType: config.ProblemType,
 	}
 }
 
@@ -241,8 +247,11 @@ func (sc *RobertaForSequenceClassification) Load(modelNameOrPath string, config
 	vs := nn.NewVarStore(device)
 	p := vs.Root()
 
-	sc.roberta = bert.NewBertModel(p.Sub("roberta"), config.(*bert.BertConfig), false)
-	sc.classifier = NewRobertaClassificationHead(p.Sub("classifier"), config.(*bert.BertConfig))
+	util.WithDType(config.(*bert.BertConfig).ModelDType(), func() {
+		sc.roberta = bert.NewBertModel(p.Sub("roberta"), config.(*bert.BertConfig), false)
+		sc.classifier = NewRobertaClassificationHead(p.Sub("classifier"), config.(*bert.BertConfig))
+		sc.problemType = config.(*bert.BertConfig).ProblemType
+	})
 
 	// err = vs.Load(cachedFile)
 	err = pickle.LoadAll(vs, cachedFile)
@@ -254,17 +263,29 @@ func (sc *RobertaForSequenceClassification) Load(modelNameOrPath string, config
 }
 
 // Forward forwards pass through the model.
-func (sc *RobertaForSequenceClassification) ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds *ts.Tensor, train bool) (labels *ts.Tensor, hiddenStates, attentions []ts.Tensor, err error) {
+//
+// It returns model output with `Logits` of shape (batch size, num labels) and optional
+// hidden states and attentions. If `labels` are given, `Loss` is computed as in
+// `BertForSequenceClassification`.
+func (sc *RobertaForSequenceClassification) ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, labels *ts.Tensor, train bool) (*bert.ModelOutput, error) {
 
-	hiddenState, _, hiddenStates, attentions, err := sc.roberta.ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, ts.None, ts.None, train)
+	output, err := sc.roberta.ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, ts.None, ts.None, train)
 	if err != nil {
-		return ts.None, nil, nil, err
+		return nil, err
 	}
 
-	labels = sc.classifier.ForwardT(hiddenState, train)
-	hiddenState.MustDrop()
+	output.Logits = sc.classifier.ForwardT(output.LastHiddenState, train)
+	output.DropBase()
+
+	if hasLabels(labels) {
+		output.Loss, err = bert.SequenceClassificationLoss(output.Logits, labels, sc.problemType)
+		if err != nil {
+			output.Drop()
+			return nil, err
+		}
+	}
 
-	return labels, hiddenStates, attentions, nil
+	return output, nil
 }
 
 // RobertaForMultipleChoice holds data for Roberta multiple choice model.
@@ -312,12 +333,14 @@ func (mc *RobertaForMultipleChoice) Load(modelNameOrPath string, config interfac
 	vs := nn.NewVarStore(device)
 	p := vs.Root()
 
-	mc.roberta = bert.NewBertModel(p.Sub("roberta"), config.(*bert.BertConfig), false)
-	mc.dropout = util.NewDropout(config.(*bert.BertConfig).HiddenDropoutProb)
-	classifier := nn.NewLinear(p.Sub("classifier"), config.(*bert.BertConfig).HiddenSize, 1, nn.DefaultLinearConfig())
-	mc.classifier = classifier
+	util.WithDType(config.(*bert.BertConfig).ModelDType(), func() {
+		mc.roberta = bert.NewBertModel(p.Sub("roberta"), config.(*bert.BertConfig), false)
+		mc.dropout = util.NewDropout(config.(*bert.BertConfig).HiddenDropoutProb)
+		classifier := nn.NewLinear(p.Sub("classifier"), config.(*bert.BertConfig).HiddenSize, 1, nn.DefaultLinearConfig())
+		mc.classifier = classifier
+	})
 
-	err = vs.Load(cachedFile)
+	err = pickle.LoadAll(vs, cachedFile)
 	if err != nil {
 		return err
 	}
@@ -326,44 +349,53 @@ func (mc *RobertaForMultipleChoice) Load(modelNameOrPath string, config interfac
 }
 
 // ForwardT forwards pass through the model.
-func (mc *RobertaForMultipleChoice) ForwardT(inputIds, mask, tokenTypeIds, positionIds *ts.Tensor, train bool) (output *ts.Tensor, hiddenStates, attentions []ts.Tensor, err error) {
+//
+// It returns model output with `Logits` of shape (batch size, num choices) and optional
+// hidden states and attentions. If `labels` (index of the correct choice of shape (batch size))
+// are given, `Loss` is their cross-entropy.
+func (mc *RobertaForMultipleChoice) ForwardT(inputIds, mask, tokenTypeIds, positionIds, labels *ts.Tensor, train bool) (*bert.ModelOutput, error) {
+
+	s := util.NewScope()
+	defer s.Close()
 
 	numChoices := inputIds.MustSize()[1]
 
 	inputIdsSize := inputIds.MustSize()
-	flatInputIds := inputIds.MustView([]int64{-1, inputIdsSize[len(inputIdsSize)-1]}, false)
+	flatInputIds := s.Track(inputIds.MustView([]int64{-1, inputIdsSize[len(inputIdsSize)-1]}, false))
 
 	flatPositionIds := ts.None
 	if positionIds.MustDefined() {
 		positionIdsSize := positionIds.MustSize()
-		flatPositionIds = positionIds.MustView([]int64{-1, positionIdsSize[len(positionIdsSize)-1]}, false)
+		flatPositionIds = s.Track(positionIds.MustView([]int64{-1, positionIdsSize[len(positionIdsSize)-1]}, false))
 	}
 
 	flatTokenTypeIds := ts.None
 	if tokenTypeIds.MustDefined() {
 		tokenTypeIdsSize := tokenTypeIds.MustSize()
-		flatTokenTypeIds = tokenTypeIds.MustView([]int64{-1, tokenTypeIdsSize[len(tokenTypeIdsSize)-1]}, false)
+		flatTokenTypeIds = s.Track(tokenTypeIds.MustView([]int64{-1, tokenTypeIdsSize[len(tokenTypeIdsSize)-1]}, false))
 	}
 
 	flatMask := ts.None
 	if mask.MustDefined() {
-		flatMaskSize := flatMask.MustSize()
-		flatMask = mask.MustView([]int64{-1, flatMaskSize[len(flatMaskSize)-1]}, false)
+		maskSize := mask.MustSize()
+		flatMask = s.Track(mask.MustView([]int64{-1, maskSize[len(maskSize)-1]}, false))
 	}
 
-	var pooledOutput *ts.Tensor
-	_, pooledOutput, hiddenStates, attentions, err = mc.roberta.ForwardT(flatInputIds, flatMask, flatTokenTypeIds, flatPositionIds, ts.None, ts.None, ts.None, train)
+	output, err := mc.roberta.ForwardT(flatInputIds, flatMask, flatTokenTypeIds, flatPositionIds, ts.None, ts.None, ts.None, train)
 	if err != nil {
-		return ts.None, nil, nil, err
+		return nil, err
 	}
 
-	appliedDO := pooledOutput.ApplyT(mc.dropout, train)
-	appliedCls := appliedDO.Apply(mc.classifier)
-	output = appliedCls.MustView([]int64{-1, numChoices}, true)
+	appliedDO := s.Track(output.PooledOutput.ApplyT(mc.dropout, train))
+	appliedCls := s.Track(appliedDO.Apply(mc.classifier))
+	output.Logits = appliedCls.MustView([]int64{-1, numChoices}, false)
+	output.DropBase()
 
-	appliedDO.MustDrop()
+	if hasLabels(labels) {
+		output.Loss = bert.CrossEntropyLoss(output.Logits, labels, bert.IgnoreIndex)
+	}
 
-	return output, hiddenStates, attentions, nil
+	return output, nil
 }
 
 // RobertaForTokenClassification holds data for Roberta token classification model.
@@ -408,16 +440,18 @@ func (tc *RobertaForTokenClassification) Load(modelNameOrPath string, config int
 	vs := nn.NewVarStore(device)
 	p := vs.Root()
 
-	roberta := bert.NewBertModel(p.Sub("roberta"), config.(*bert.BertConfig), false)
-	dropout := util.NewDropout(config.(*bert.BertConfig).HiddenDropoutProb)
-	numLabels := int64(len(config.(*bert.BertConfig).Id2Label))
-	classifier := nn.NewLinear(p.Sub("classifier"), config.(*bert.BertConfig).HiddenSize, numLabels, nn.DefaultLinearConfig())
+	util.WithDType(config.(*bert.BertConfig).ModelDType(), func() {
+		roberta := bert.NewBertModel(p.Sub("roberta"), config.(*bert.BertConfig), false)
+		dropout := util.NewDropout(config.(*bert.BertConfig).HiddenDropoutProb)
+		numLabels := int64(len(config.(*bert.BertConfig).Id2Label))
+		classifier := nn.NewLinear(p.Sub("classifier"), config.(*bert.BertConfig).HiddenSize, numLabels, nn.DefaultLinearConfig())
 
-	tc.roberta = roberta
-	tc.dropout = dropout
-	tc.classifier = classifier
+		tc.roberta = roberta
+		tc.dropout = dropout
+		tc.classifier = classifier
+	})
 
-	err = vs.Load(cachedFile)
+	err = pickle.LoadAll(vs, cachedFile)
 	if err != nil {
 		return err
 	}
@@ -426,18 +460,28 @@ func (tc *RobertaForTokenClassification) Load(modelNameOrPath string, config int
 }
 
 // ForwardT forwards pass through the model.
-func (tc *RobertaForTokenClassification) ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds *ts.Tensor, train bool) (output *ts.Tensor, hiddenStates, attentions []ts.Tensor, err error) {
-	hiddenState, _, hiddenStates, attentions, err := tc.roberta.ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, ts.None, ts.None, train)
+//
+// It returns model output with `Logits` of shape (batch size, sequence length, num labels)
+// and optional hidden states and attentions. If `labels` of shape (batch size, sequence length)
+// are given, `Loss` is their cross-entropy, ignoring positions with value -100.
+func (tc *RobertaForTokenClassification) ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, labels *ts.Tensor, train bool) (*bert.ModelOutput, error) {
+	output, err := tc.roberta.ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, ts.None, ts.None, train)
 	if err != nil {
-		return ts.None, nil, nil, err
+		return nil, err
 	}
 
-	appliedDO := hiddenState.ApplyT(tc.dropout, train)
-	output = appliedDO.Apply(tc.classifier)
+	s := util.NewScope()
+	defer s.Close()
+
+	appliedDO := s.Track(output.LastHiddenState.ApplyT(tc.dropout, train))
+	output.Logits = appliedDO.Apply(tc.classifier)
+	output.DropBase()
 
-	appliedDO.MustDrop()
+	if hasLabels(labels) {
+		output.Loss = bert.CrossEntropyLoss(output.Logits, labels, bert.IgnoreIndex)
+	}
 
-	return output, hiddenStates, attentions, nil
+	return output, nil
 }
 
 // RobertaForQuestionAnswering constructs layers for Roberta question answering model.
@@ -479,14 +523,16 @@ func (qa *RobertaForQuestionAnswering) Load(modelNameOrPath string, config inter
 	vs := nn.NewVarStore(device)
 	p := vs.Root()
 
-	roberta := bert.NewBertModel(p.Sub("roberta"), config.(*bert.BertConfig), false)
-	numLabels := int64(2)
-	qaOutputs := nn.NewLinear(p.Sub("qa_outputs"), config.(*bert.BertConfig).HiddenSize, numLabels, nn.DefaultLinearConfig())
+	util.WithDType(config.(*bert.BertConfig).ModelDType(), func() {
+		roberta := bert.NewBertModel(p.Sub("roberta"), config.(*bert.BertConfig), false)
+		numLabels := int64(2)
+		qaOutputs := nn.NewLinear(p.Sub("qa_outputs"), config.(*bert.BertConfig).HiddenSize, numLabels, nn.DefaultLinearConfig())
 
-	qa.roberta = roberta
-	qa.qaOutputs = qaOutputs
+		qa.roberta = roberta
+		qa.qaOutputs = qaOutputs
+	})
 
-	err = vs.Load(cachedFile)
+	err = pickle.LoadAll(vs, cachedFile)
 	if err != nil {
 		return err
 	}
@@ -495,20 +541,34 @@ func (qa *RobertaForQuestionAnswering) Load(modelNameOrPath string, config inter
 }
 
 // ForwadT forwards pass through the model.
-func (qa *RobertaForQuestionAnswering) ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds *ts.Tensor, train bool) (startScores, endScores *ts.Tensor, hiddenStates, attentions []ts.Tensor, err error) {
-	hiddenState, _, hiddenStates, attentions, err := qa.roberta.ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, ts.None, ts.None, train)
+//
+// It returns model output with `StartLogits` and `EndLogits` of shape (batch size, sequence length)
+// and optional hidden states and attentions. If `startPositions` and `endPositions` of shape
+// (batch size) are given, `Loss` is the mean of start and end cross-entropy.
+func (qa *RobertaForQuestionAnswering) ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, startPositions, endPositions *ts.Tensor, train bool) (*bert.ModelOutput, error) {
+	output, err := qa.roberta.ForwardT(inputIds, mask, tokenTypeIds, positionIds, inputEmbeds, ts.None, ts.None, train)
 	if err != nil {
-		return ts.None, ts.None, nil, nil, err
+		return nil, err
 	}
 
-	sequenceOutput := hiddenState.Apply(qa.qaOutputs)
-	logits := sequenceOutput.MustSplit(1, -1, true)
-	startScores = logits[0].MustSqueezeDim(-1, false)
-	endScores = logits[1].MustSqueezeDim(-1, false)
+	s := util.NewScope()
+	defer s.Close()
+
+	sequenceOutput := s.Track(output.LastHiddenState.Apply(qa.qaOutputs))
+	logits := sequenceOutput.MustSplit(1, -1, false)
+	s.TrackAll(logits...)
+	output.StartLogits = logits[0].MustSqueezeDim(-1, false)
+	output.EndLogits = logits[1].MustSqueezeDim(-1, false)
+	output.DropBase()
 
-	for _, x := range logits {
-		x.MustDrop()
+	if hasLabels(startPositions) && hasLabels(endPositions) {
+		output.Loss = bert.QuestionAnsweringLoss(output.StartLogits, output.EndLogits, startPositions, endPositions)
 	}
 
-	return startScores, endScores, hiddenStates, attentions, nil
+	return output, nil
+}
+
+// hasLabels returns whether optional labels are given.
+func hasLabels(labels *ts.Tensor) bool {
+	return labels != nil && labels.MustDefined()
 }
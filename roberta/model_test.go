@@ -127,28 +127,28 @@ func TestRobertaForMaskedLM(t *testing.T) {
 		}
 	}
 
-	var tensors []ts.Tensor
+	var tensors []*ts.Tensor
 	for _, en := range encodings {
 		var tokInput []int64 = make([]int64, maxLen)
 		for i := 0; i < len(en.Ids); i++ {
 			tokInput[i] = int64(en.Ids[i])
 		}
 
-		tensors = append(tensors, *ts.TensorFrom(tokInput))
+		tensors = append(tensors, ts.TensorFrom(tokInput))
 	}
 
 	inputTensor := ts.MustStack(tensors, 0).MustTo(device, true)
 
-	var output *ts.Tensor
+	var output *bert.ModelOutput
 	ts.NoGrad(func() {
-		output, _, _, err = model.Forward(inputTensor, ts.None, ts.None, ts.None, ts.None, ts.None, ts.None, false)
+		output, err = model.Forward(inputTensor, ts.None, ts.None, ts.None, ts.None, ts.None, ts.None, ts.None, false)
 		if err != nil {
 			log.Fatal(err)
 		}
 	})
 
-	index1 := output.MustGet(0).MustGet(4).MustArgmax([]int64{0}, false, false).Int64Values()[0]
-	index2 := output.MustGet(1).MustGet(5).MustArgmax([]int64{0}, false, false).Int64Values()[0]
+	index1 := output.Logits.MustGet(0).MustGet(4).MustArgmax([]int64{0}, false, false).Int64Values()[0]
+	index2 := output.Logits.MustGet(1).MustGet(5).MustArgmax([]int64{0}, false, false).Int64Values()[0]
 	gotMask1 := tk.Decode([]int{int(index1)}, false)
 	gotMask2 := tk.Decode([]int{int(index2)}, false)
 
@@ -230,38 +230,35 @@ func TestRobertaForSequenceClassification(t *testing.T) {
 		}
 	}
 
-	var tensors []ts.Tensor
+	var tensors []*ts.Tensor
 	for _, en := range encodings {
 		var tokInput []int64 = make([]int64, maxLen)
 		for i := 0; i < len(en.Ids); i++ {
 			tokInput[i] = int64(en.Ids[i])
 		}
 
-		tensors = append(tensors, *ts.TensorFrom(tokInput))
+		tensors = append(tensors, ts.TensorFrom(tokInput))
 	}
 
 	inputTensor := ts.MustStack(tensors, 0).MustTo(device, true)
 
-	var (
-		output                   *ts.Tensor
-		hiddenStates, attentions []ts.Tensor
-	)
+	var output *bert.ModelOutput
 
 	ts.NoGrad(func() {
-		output, hiddenStates, attentions, err = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, false)
+		output, err = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, ts.None, false)
 		if err != nil {
 			log.Fatal(err)
 		}
 	})
 
 	wantOutput := []int64{2, 3}
-	gotOutput := output.MustSize()
+	gotOutput := output.Logits.MustSize()
 
 	wantNumHiddenLayers := config.NumHiddenLayers
-	gotNumHiddenLayers := int64(len(hiddenStates))
+	gotNumHiddenLayers := int64(len(output.HiddenStates))
 
 	wantAttentions := config.NumHiddenLayers
-	gotAttentions := int64(len(attentions))
+	gotAttentions := int64(len(output.Attentions))
 
 	if !reflect.DeepEqual(wantOutput, gotOutput) {
 		t.Errorf("want %v - got %v\n", wantOutput, gotOutput)
@@ -332,37 +329,34 @@ func TestRobertaForMultipleChoice(t *testing.T) {
 		}
 	}
 
-	var tensors []ts.Tensor
+	var tensors []*ts.Tensor
 	for _, en := range encodings {
 		var tokInput []int64 = make([]int64, maxLen)
 		for i := 0; i < len(en.Ids); i++ {
 			tokInput[i] = int64(en.Ids[i])
 		}
 
-		tensors = append(tensors, *ts.TensorFrom(tokInput))
+		tensors = append(tensors, ts.TensorFrom(tokInput))
 	}
 
 	inputTensor := ts.MustStack(tensors, 0).MustTo(device, true).MustUnsqueeze(0, true)
 
-	var (
-		output                   *ts.Tensor
-		hiddenStates, attentions []ts.Tensor
-	)
+	var output *bert.ModelOutput
 	ts.NoGrad(func() {
-		output, hiddenStates, attentions, err = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, false)
+		output, err = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, false)
 		if err != nil {
 			log.Fatal(err)
 		}
 	})
 
 	wantOutput := []int64{1, 2}
-	gotOutput := output.MustSize()
+	gotOutput := output.Logits.MustSize()
 
 	wantHiddenStates := config.NumHiddenLayers
-	gotHiddenStates := int64(len(hiddenStates))
+	gotHiddenStates := int64(len(output.HiddenStates))
 
 	wantAttentions := config.NumHiddenLayers
-	gotAttentions := int64(len(attentions))
+	gotAttentions := int64(len(output.Attentions))
 
 	if !reflect.DeepEqual(wantOutput, gotOutput) {
 		t.Errorf("want %v - got %v\n", wantOutput, gotOutput)
@@ -441,38 +435,35 @@ func TestRobertaForTokenClassification(t *testing.T) {
 		}
 	}
 
-	var tensors []ts.Tensor
+	var tensors []*ts.Tensor
 	for _, en := range encodings {
 		var tokInput []int64 = make([]int64, maxLen)
 		for i := 0; i < len(en.Ids); i++ {
 			tokInput[i] = int64(en.Ids[i])
 		}
 
-		tensors = append(tensors, *ts.TensorFrom(tokInput))
+		tensors = append(tensors, ts.TensorFrom(tokInput))
 	}
 
 	inputTensor := ts.MustStack(tensors, 0).MustTo(device, true)
 
-	var (
-		output                   *ts.Tensor
-		hiddenStates, attentions []ts.Tensor
-	)
+	var output *bert.ModelOutput
 
 	ts.NoGrad(func() {
-		output, hiddenStates, attentions, err = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, false)
+		output, err = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, ts.None, false)
 		if err != nil {
 			log.Fatal(err)
 		}
 	})
 
 	wantOutput := []int64{2, 9, 4}
-	gotOutput := output.MustSize()
+	gotOutput := output.Logits.MustSize()
 
 	wantNumHiddenLayers := config.NumHiddenLayers
-	gotNumHiddenLayers := int64(len(hiddenStates))
+	gotNumHiddenLayers := int64(len(output.HiddenStates))
 
 	wantAttentions := config.NumHiddenLayers
-	gotAttentions := int64(len(attentions))
+	gotAttentions := int64(len(output.Attentions))
 
 	if !reflect.DeepEqual(wantOutput, gotOutput) {
 		t.Errorf("want %v - got %v\n", wantOutput, gotOutput)
@@ -551,41 +542,38 @@ func TestRobertaForQuestionAnswering(t *testing.T) {
 		}
 	}
 
-	var tensors []ts.Tensor
+	var tensors []*ts.Tensor
 	for _, en := range encodings {
 		var tokInput []int64 = make([]int64, maxLen)
 		for i := 0; i < len(en.Ids); i++ {
 			tokInput[i] = int64(en.Ids[i])
 		}
 
-		tensors = append(tensors, *ts.TensorFrom(tokInput))
+		tensors = append(tensors, ts.TensorFrom(tokInput))
 	}
 
 	inputTensor := ts.MustStack(tensors, 0).MustTo(device, true)
 
-	var (
-		startScores, endScores   *ts.Tensor
-		hiddenStates, attentions []ts.Tensor
-	)
+	var output *bert.ModelOutput
 
 	ts.NoGrad(func() {
-		startScores, endScores, hiddenStates, attentions, err = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, false)
+		output, err = model.ForwardT(inputTensor, ts.None, ts.None, ts.None, ts.None, ts.None, ts.None, false)
 		if err != nil {
 			log.Fatal(err)
 		}
 	})
 
 	wantStartScores := []int64{2, 9}
-	gotStartScores := startScores.MustSize()
+	gotStartScores := output.StartLogits.MustSize()
 
 	wantEndScores := []int64{2, 9}
-	gotEndScores := endScores.MustSize()
+	gotEndScores := output.EndLogits.MustSize()
 
 	wantNumHiddenLayers := config.NumHiddenLayers
-	gotNumHiddenLayers := int64(len(hiddenStates))
+	gotNumHiddenLayers := int64(len(output.HiddenStates))
 
 	wantAttentions := config.NumHiddenLayers
-	gotAttentions := int64(len(attentions))
+	gotAttentions := int64(len(output.Attentions))
 
 	if !reflect.DeepEqual(wantStartScores, gotStartScores) {
 		t.Errorf("want %v - got %v\n", wantStartScores, gotStartScores)
@@ -1,11 +1,10 @@
 package roberta
 
 import (
-	// "fmt"
+	"fmt"
 
 	"github.com/sugarme/tokenizer"
 	"github.com/sugarme/tokenizer/model/bpe"
-	"github.com/sugarme/tokenizer/normalizer"
 	"github.com/sugarme/tokenizer/pretokenizer"
 	"github.com/sugarme/tokenizer/processor"
 
@@ -24,12 +23,30 @@ func NewTokenizer() *Tokenizer {
 }
 
 // Load loads Roberta tokenizer from pretrain vocab and merges files.
+//
+// Unlike BERT, Roberta uses a byte-level BPE without any normalization, so
+// casing of the input is preserved.
+//
+// Optional params:
+//   - `AddPrefixSpace` (bool, default false): whether to add a leading space to the
+//     first word so that it is treated as any other word.
+//   - `TrimOffsets` (bool, default true): whether the post-processing step trims offsets
+//     so that they do not include the leading `Ġ` whitespace.
 func (t *Tokenizer) Load(modelNameOrPath string, params map[string]interface{}) error {
-	vocabFile, err := util.CachedPath("roberta-base", "vocab.json")
+	addPrefixSpace := false
+	trimOffsets := true
+	if v, ok := params["AddPrefixSpace"].(bool); ok {
+		addPrefixSpace = v
+	}
+	if v, ok := params["TrimOffsets"].(bool); ok {
+		trimOffsets = v
+	}
+
+	vocabFile, err := util.CachedPath(modelNameOrPath, "vocab.json")
 	if err != nil {
 		return err
 	}
-	mergesFile, err := util.CachedPath("roberta-base", "merges.txt")
+	mergesFile, err := util.CachedPath(modelNameOrPath, "merges.txt")
 	if err != nil {
 		return err
 	}
@@ -41,23 +58,62 @@ func (t *Tokenizer) Load(modelNameOrPath string, params map[string]interface{})
 
 	t.WithModel(model)
 
-	bertNormalizer := normalizer.NewBertNormalizer(true, true, true, true)
-	t.WithNormalizer(bertNormalizer)
-
 	blPreTokenizer := pretokenizer.NewByteLevel()
-	// blPreTokenizer.SetAddPrefixSpace(false)
+	blPreTokenizer.SetAddPrefixSpace(addPrefixSpace)
+	blPreTokenizer.SetTrimOffsets(trimOffsets)
 	t.WithPreTokenizer(blPreTokenizer)
+	t.WithDecoder(blPreTokenizer)
 
 	var specialTokens []tokenizer.AddedToken
 	specialTokens = append(specialTokens, tokenizer.NewAddedToken("<s>", true))
 	specialTokens = append(specialTokens, tokenizer.NewAddedToken("<pad>", true))
 	specialTokens = append(specialTokens, tokenizer.NewAddedToken("</s>", true))
 	specialTokens = append(specialTokens, tokenizer.NewAddedToken("<unk>", true))
-	specialTokens = append(specialTokens, tokenizer.NewAddedToken("<mask>", true))
+	specialTokens = append(specialTokens, tokenizer.NewAddedToken("<mask>", true).SetLStrip(true))
 	t.AddSpecialTokens(specialTokens)
 
-	postProcess := processor.DefaultRobertaProcessing()
+	postProcess, err := t.postProcessor(addPrefixSpace, trimOffsets)
+	if err != nil {
+		return err
+	}
 	t.WithPostProcessor(postProcess)
 
 	return nil
 }
+
+// postProcessor builds `<s> A </s>` and `<s> A </s></s> B </s>` post-processing.
+//
+// NOTE. `processor.RobertaProcessing` only works with `trimOffsets=true`, so a
+// template processor with the same special tokens is used otherwise.
+func (t *Tokenizer) postProcessor(addPrefixSpace, trimOffsets bool) (tokenizer.PostProcessor, error) {
+	sepId, ok := t.TokenToId("</s>")
+	if !ok {
+		return nil, fmt.Errorf("Cannot find ID for </s> token.\n")
+	}
+	clsId, ok := t.TokenToId("<s>")
+	if !ok {
+		return nil, fmt.Errorf("Cannot find ID for <s> token.\n")
+	}
+
+	if trimOffsets {
+		sep := processor.PostToken{Id: sepId, Value: "</s>"}
+		cls := processor.PostToken{Id: clsId, Value: "<s>"}
+		return processor.NewRobertaProcessing(sep, cls, trimOffsets, addPrefixSpace), nil
+	}
+
+	single, err := processor.NewTemplateFromOne("<s> $A </s>")
+	if err != nil {
+		return nil, err
+	}
+	// Type ids of pairs are those of `processor.RobertaProcessing`.
+	pair, err := processor.NewTemplateFromOne("<s> $A </s> </s>:1 $B:1 </s>:1")
+	if err != nil {
+		return nil, err
+	}
+	specialTokens := processor.NewTokensFrom([]processor.SpecialToken{
+		*processor.NewSpecialTokenFrom("<s>", clsId),
+		*processor.NewSpecialTokenFrom("</s>", sepId),
+	})
+
+	return processor.NewTemplateProcessing(single, pair, specialTokens), nil
+}
@@ -0,0 +1,99 @@
+package roberta_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sugarme/tokenizer"
+
+	"github.com/yinziyang/transformer/roberta"
+)
+
+// Reference values generated with HF `RobertaTokenizerFast.from_pretrained("roberta-base")`.
+func TestRobertaTokenizer(t *testing.T) {
+	tests := []struct {
+		name        string
+		params      map[string]interface{}
+		input       string
+		pair        string // second sequence if not empty
+		wantIds     []int
+		wantTypeIds []int
+		wantOffsets [][]int
+	}{
+		{
+			name:        "default",
+			params:      nil,
+			input:       "Hello world",
+			wantIds:     []int{0, 31414, 232, 2},
+			wantTypeIds: []int{0, 0, 0, 0},
+			wantOffsets: [][]int{{0, 0}, {0, 5}, {6, 11}, {0, 0}},
+		},
+		{
+			name:        "add prefix space",
+			params:      map[string]interface{}{"AddPrefixSpace": true},
+			input:       "Hello world",
+			wantIds:     []int{0, 20920, 232, 2},
+			wantTypeIds: []int{0, 0, 0, 0},
+			wantOffsets: [][]int{{0, 0}, {0, 5}, {6, 11}, {0, 0}},
+		},
+		{
+			name:        "no trim offsets",
+			params:      map[string]interface{}{"TrimOffsets": false},
+			input:       "Hello world",
+			wantIds:     []int{0, 31414, 232, 2},
+			wantTypeIds: []int{0, 0, 0, 0},
+			wantOffsets: [][]int{{0, 0}, {0, 5}, {5, 11}, {0, 0}},
+		},
+		// Type ids of pairs do not depend on post-processing (`TrimOffsets`).
+		{
+			name:        "pair",
+			params:      nil,
+			input:       "Hello world",
+			pair:        "Hello",
+			wantIds:     []int{0, 31414, 232, 2, 2, 31414, 2},
+			wantTypeIds: []int{0, 0, 0, 0, 1, 1, 1},
+			wantOffsets: [][]int{{0, 0}, {0, 5}, {6, 11}, {0, 0}, {0, 0}, {0, 5}, {0, 0}},
+		},
+		{
+			name:        "pair no trim offsets",
+			params:      map[string]interface{}{"TrimOffsets": false},
+			input:       "Hello world",
+			pair:        "Hello",
+			wantIds:     []int{0, 31414, 232, 2, 2, 31414, 2},
+			wantTypeIds: []int{0, 0, 0, 0, 1, 1, 1},
+			wantOffsets: [][]int{{0, 0}, {0, 5}, {5, 11}, {0, 0}, {0, 0}, {0, 5}, {0, 0}},
+		},
+	}
+
+	for _, tt := range tests {
+		tk := roberta.NewTokenizer()
+		err := tk.Load("roberta-base", tt.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		input := tokenizer.NewSingleEncodeInput(tokenizer.NewInputSequence(tt.input))
+		if tt.pair != "" {
+			input = tokenizer.NewDualEncodeInput(tokenizer.NewInputSequence(tt.input), tokenizer.NewInputSequence(tt.pair))
+		}
+		encoding, err := tk.Encode(input, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(tt.wantIds, encoding.Ids) {
+			t.Errorf("%v - Want ids: %v\n", tt.name, tt.wantIds)
+			t.Errorf("%v - Got ids: %v\n", tt.name, encoding.Ids)
+		}
+
+		if !reflect.DeepEqual(tt.wantTypeIds, encoding.TypeIds) {
+			t.Errorf("%v - Want type ids: %v\n", tt.name, tt.wantTypeIds)
+			t.Errorf("%v - Got type ids: %v\n", tt.name, encoding.TypeIds)
+		}
+
+		if !reflect.DeepEqual(tt.wantOffsets, encoding.Offsets) {
+			t.Errorf("%v - Want offsets: %v\n", tt.name, tt.wantOffsets)
+			t.Errorf("%v - Got offsets: %v\n", tt.name, encoding.Offsets)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package sentencepiece
+
+// sentencepiece package reads SentencePiece model files (`*.model`) and
+// provides a Unigram model implementing `tokenizer.Model`.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"math"
+)
+
+// PieceType is type of a piece in SentencePiece model.
+type PieceType int
+
+const (
+	Normal      PieceType = 1 // normal symbol
+	Unknown     PieceType = 2 // unknown symbol. Only <unk> for now.
+	Control     PieceType = 3 // control symbols. </s>, <s>, <2ja> etc.
+	UserDefined PieceType = 4 // user defined symbols.
+	Unused      PieceType = 5 // this piece is not used.
+	Byte        PieceType = 6 // byte symbols. Used when `byte_fallback` is true.
+)
+
+// ModelType is algorithm used to train SentencePiece model.
+type ModelType int
+
+const (
+	UnigramType ModelType = 1
+	BpeType     ModelType = 2
+	WordType    ModelType = 3
+	CharType    ModelType = 4
+)
+
+// Piece holds a vocab entry of SentencePiece model.
+type Piece struct {
+	Value string
+	Score float64
+	Type  PieceType
+}
+
+// Model holds data loaded from a SentencePiece model file.
+//
+// Only fields needed for tokenization are kept. They are read from
+// `ModelProto` (pieces), `TrainerSpec` (model type, special token ids) and
+// `NormalizerSpec` (normalization rules) messages of `sentencepiece_model.proto`.
+type Model struct {
+	Pieces    []Piece
+	ModelType ModelType
+
+	UnkId int
+	BosId int
+	EosId int
+	PadId int
+
+	PrecompiledCharsmap    []byte
+	AddDummyPrefix         bool
+	RemoveExtraWhitespaces bool
+	EscapeWhitespaces      bool
+}
+
+// newModel creates a Model with default values as specified in `sentencepiece_model.proto`.
+func newModel() *Model {
+	return &Model{
+		ModelType:              UnigramType,
+		UnkId:                  0,
+		BosId:                  1,
+		EosId:                  2,
+		PadId:                  -1,
+		AddDummyPrefix:         true,
+		RemoveExtraWhitespaces: true,
+		EscapeWhitespaces:      true,
+	}
+}
+
+// ModelFromFile loads SentencePiece model from file.
+func ModelFromFile(filename string) (*Model, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseModel(data)
+}
+
+// ParseModel parses serialized `ModelProto` message.
+func ParseModel(data []byte) (*Model, error) {
+	m := newModel()
+
+	err := readMessage(data, func(field int, wireType int, value []byte, num uint64) error {
+		switch field {
+		case 1: // pieces
+			p, err := parsePiece(value)
+			if err != nil {
+				return err
+			}
+			m.Pieces = append(m.Pieces, *p)
+		case 2: // trainer_spec
+			return m.parseTrainerSpec(value)
+		case 3: // normalizer_spec
+			return m.parseNormalizerSpec(value)
+		}
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("Parsing SentencePiece model failed: %w", err)
+		return nil, err
+	}
+
+	if len(m.Pieces) == 0 {
+		err := fmt.Errorf("Parsing SentencePiece model failed: no pieces found.")
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func parsePiece(data []byte) (*Piece, error) {
+	p := &Piece{Type: Normal}
+	err := readMessage(data, func(field int, wireType int, value []byte, num uint64) error {
+		switch field {
+		case 1:
+			p.Value = string(value)
+		case 2:
+			p.Score = float64(math.Float32frombits(uint32(num)))
+		case 3:
+			p.Type = PieceType(num)
+		}
+		return nil
+	})
+
+	return p, err
+}
+
+func (m *Model) parseTrainerSpec(data []byte) error {
+	return readMessage(data, func(field int, wireType int, value []byte, num uint64) error {
+		switch field {
+		case 3:
+			m.ModelType = ModelType(num)
+		case 40:
+			m.UnkId = int(int32(num))
+		case 41:
+			m.BosId = int(int32(num))
+		case 42:
+			m.EosId = int(int32(num))
+		case 43:
+			m.PadId = int(int32(num))
+		}
+		return nil
+	})
+}
+
+func (m *Model) parseNormalizerSpec(data []byte) error {
+	return readMessage(data, func(field int, wireType int, value []byte, num uint64) error {
+		switch field {
+		case 2:
+			m.PrecompiledCharsmap = append([]byte{}, value...)
+		case 3:
+			m.AddDummyPrefix = num != 0
+		case 4:
+			m.RemoveExtraWhitespaces = num != 0
+		case 5:
+			m.EscapeWhitespaces = num != 0
+		}
+		return nil
+	})
+}
+
+// readMessage walks through fields of a protobuf encoded message and calls `fn`
+// for each of them. Length-delimited fields are passed in `value`, others in `num`.
+func readMessage(data []byte, fn func(field int, wireType int, value []byte, num uint64) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return fmt.Errorf("invalid field key")
+		}
+		data = data[n:]
+
+		field := int(key >> 3)
+		wireType := int(key & 0x7)
+
+		var (
+			value []byte
+			num   uint64
+		)
+		switch wireType {
+		case 0: // varint
+			num, n = binary.Uvarint(data)
+			if n <= 0 {
+				return fmt.Errorf("invalid varint at field %v", field)
+			}
+			data = data[n:]
+		case 1: // 64-bit
+			if len(data) < 8 {
+				return fmt.Errorf("unexpected EOF at field %v", field)
+			}
+			num = binary.LittleEndian.Uint64(data[:8])
+			data = data[8:]
+		case 2: // length-delimited
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return fmt.Errorf("invalid length at field %v", field)
+			}
+			value = data[n : n+int(length)]
+			data = data[n+int(length):]
+		case 5: // 32-bit
+			if len(data) < 4 {
+				return fmt.Errorf("unexpected EOF at field %v", field)
+			}
+			num = uint64(binary.LittleEndian.Uint32(data[:4]))
+			data = data[4:]
+		default:
+			return fmt.Errorf("unsupported wire type %v at field %v", wireType, field)
+		}
+
+		if err := fn(field, wireType, value, num); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package sentencepiece_test
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/yinziyang/transformer/sentencepiece"
+)
+
+// protobuf encoding helpers to build a tiny `ModelProto` in memory.
+func pbVarint(field int, v uint64) []byte {
+	buf := binary.AppendUvarint(nil, uint64(field<<3|0))
+	return binary.AppendUvarint(buf, v)
+}
+
+func pbBytes(field int, v []byte) []byte {
+	buf := binary.AppendUvarint(nil, uint64(field<<3|2))
+	buf = binary.AppendUvarint(buf, uint64(len(v)))
+	return append(buf, v...)
+}
+
+func pbFloat(field int, v float32) []byte {
+	buf := binary.AppendUvarint(nil, uint64(field<<3|5))
+	return binary.LittleEndian.AppendUint32(buf, math.Float32bits(v))
+}
+
+func pbPiece(piece string, score float32, typ sentencepiece.PieceType) []byte {
+	var msg []byte
+	msg = append(msg, pbBytes(1, []byte(piece))...)
+	msg = append(msg, pbFloat(2, score)...)
+	msg = append(msg, pbVarint(3, uint64(typ))...)
+	return pbBytes(1, msg)
+}
+
+func testModelData() []byte {
+	var data []byte
+	data = append(data, pbPiece("<unk>", 0, sentencepiece.Unknown)...)
+	data = append(data, pbPiece("<s>", 0, sentencepiece.Control)...)
+	data = append(data, pbPiece("</s>", 0, sentencepiece.Control)...)
+	data = append(data, pbPiece("▁", -2, sentencepiece.Normal)...)
+	data = append(data, pbPiece("▁he", -3, sentencepiece.Normal)...)
+	data = append(data, pbPiece("llo", -3, sentencepiece.Normal)...)
+	data = append(data, pbPiece("▁hello", -4, sentencepiece.Normal)...)
+	data = append(data, pbPiece("h", -5, sentencepiece.Normal)...)
+	data = append(data, pbPiece("e", -5, sentencepiece.Normal)...)
+	data = append(data, pbPiece("l", -5, sentencepiece.Normal)...)
+	data = append(data, pbPiece("o", -5, sentencepiece.Normal)...)
+
+	trainerSpec := pbVarint(3, uint64(sentencepiece.UnigramType))
+	trainerSpec = append(trainerSpec, pbVarint(40, 0)...)
+	data = append(data, pbBytes(2, trainerSpec)...)
+
+	normalizerSpec := pbBytes(1, []byte("nmt_nfkc"))
+	normalizerSpec = append(normalizerSpec, pbVarint(3, 1)...)
+	data = append(data, pbBytes(3, normalizerSpec)...)
+
+	return data
+}
+
+func TestParseModel(t *testing.T) {
+	m, err := sentencepiece.ParseModel(testModelData())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Pieces) != 11 {
+		t.Errorf("Want 11 pieces, got %v\n", len(m.Pieces))
+	}
+
+	want := sentencepiece.Piece{Value: "▁hello", Score: -4, Type: sentencepiece.Normal}
+	if !reflect.DeepEqual(want, m.Pieces[6]) {
+		t.Errorf("Want: %+v\n", want)
+		t.Errorf("Got: %+v\n", m.Pieces[6])
+	}
+
+	if m.ModelType != sentencepiece.UnigramType || m.UnkId != 0 || !m.AddDummyPrefix {
+		t.Errorf("Unexpected model spec: %+v\n", m)
+	}
+}
+
+func TestUnigram_Tokenize(t *testing.T) {
+	m, err := sentencepiece.ParseModel(testModelData())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	model, err := sentencepiece.UnigramFromModel(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input       string
+		wantIds     []int
+		wantOffsets [][]int
+	}{
+		// "▁hello" (-4) beats "▁he" + "llo" (-6)
+		{"▁hello", []int{6}, [][]int{{0, 8}}},
+		{"▁hell", []int{4, 9, 9}, [][]int{{0, 5}, {5, 6}, {6, 7}}},
+		// unknown characters are fused into one `<unk>`
+		{"▁xyzo", []int{3, 0, 10}, [][]int{{0, 3}, {3, 6}, {6, 7}}},
+	}
+
+	for _, tt := range tests {
+		toks, err := model.Tokenize(tt.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var (
+			gotIds     []int
+			gotOffsets [][]int
+		)
+		for _, tok := range toks {
+			gotIds = append(gotIds, tok.Id)
+			gotOffsets = append(gotOffsets, tok.Offsets)
+		}
+
+		if !reflect.DeepEqual(tt.wantIds, gotIds) {
+			t.Errorf("%q - Want ids: %v\n", tt.input, tt.wantIds)
+			t.Errorf("%q - Got ids: %v\n", tt.input, gotIds)
+		}
+		if !reflect.DeepEqual(tt.wantOffsets, gotOffsets) {
+			t.Errorf("%q - Want offsets: %v\n", tt.input, tt.wantOffsets)
+			t.Errorf("%q - Got offsets: %v\n", tt.input, gotOffsets)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package sentencepiece
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+
+	"github.com/sugarme/tokenizer"
+)
+
+// unkPenalty is penalty added to the minimum piece score for unknown characters.
+const unkPenalty float64 = 10.0
+
+// Unigram is a Unigram language model tokenizer. It segments input sequence
+// into pieces of highest total score using the Viterbi algorithm.
+//
+// It implements `tokenizer.Model` interface.
+type Unigram struct {
+	pieces      []Piece
+	vocab       map[string]int
+	unkId       int
+	unkScore    float64
+	maxPieceLen int // in bytes
+}
+
+var _ tokenizer.Model = new(Unigram)
+
+// NewUnigram creates a Unigram model from vocab pieces. Id of a piece is its index in `pieces`.
+func NewUnigram(pieces []Piece, unkId int) (*Unigram, error) {
+	if len(pieces) == 0 {
+		err := fmt.Errorf("NewUnigram() failed: empty vocab.")
+		return nil, err
+	}
+	if unkId < 0 || unkId >= len(pieces) {
+		err := fmt.Errorf("NewUnigram() failed: unk id %v is out of vocab (size %v).", unkId, len(pieces))
+		return nil, err
+	}
+
+	vocab := make(map[string]int, len(pieces))
+	minScore := math.Inf(1)
+	maxPieceLen := 0
+	for id, p := range pieces {
+		if _, ok := vocab[p.Value]; !ok {
+			vocab[p.Value] = id
+		}
+		if p.Score < minScore {
+			minScore = p.Score
+		}
+		if len(p.Value) > maxPieceLen {
+			maxPieceLen = len(p.Value)
+		}
+	}
+
+	return &Unigram{
+		pieces:      pieces,
+		vocab:       vocab,
+		unkId:       unkId,
+		unkScore:    minScore - unkPenalty,
+		maxPieceLen: maxPieceLen,
+	}, nil
+}
+
+// UnigramFromModel creates a Unigram model from a loaded SentencePiece model.
+func UnigramFromModel(m *Model) (*Unigram, error) {
+	if m.ModelType != UnigramType {
+		err := fmt.Errorf("UnigramFromModel() failed: unsupported model type %v.", m.ModelType)
+		return nil, err
+	}
+
+	return NewUnigram(m.Pieces, m.UnkId)
+}
+
+// matchable returns whether a piece can be a segmentation candidate.
+// Control, unknown and unused pieces never match input text.
+func (u *Unigram) matchable(id int) bool {
+	switch u.pieces[id].Type {
+	case Normal, UserDefined:
+		return true
+	default:
+		return false
+	}
+}
+
+// Tokenize implements `tokenizer.Model` interface.
+//
+// Offsets of returned tokens are byte offsets in `sequence`. Consecutive
+// unknown characters are fused into a single unknown token.
+func (u *Unigram) Tokenize(sequence string) ([]tokenizer.Token, error) {
+	n := len(sequence)
+	if n == 0 {
+		return nil, nil
+	}
+
+	// best[i] is the best segmentation of `sequence[:i]` ending with piece `id`
+	// starting at `start`.
+	type node struct {
+		score float64
+		start int
+		id    int
+		ok    bool
+	}
+	best := make([]node, n+1)
+	best[0].ok = true
+
+	for start := 0; start < n; {
+		_, size := utf8.DecodeRuneInString(sequence[start:])
+		if !best[start].ok {
+			start += size
+			continue
+		}
+
+		hasSingle := false
+		for end := start + size; end <= n && end-start <= u.maxPieceLen; {
+			if id, ok := u.vocab[sequence[start:end]]; ok && u.matchable(id) {
+				score := best[start].score + u.pieces[id].Score
+				if !best[end].ok || score > best[end].score {
+					best[end] = node{score, start, id, true}
+				}
+				if end == start+size {
+					hasSingle = true
+				}
+			}
+
+			if end == n {
+				break
+			}
+			_, s := utf8.DecodeRuneInString(sequence[end:])
+			end += s
+		}
+
+		if !hasSingle {
+			end := start + size
+			score := best[start].score + u.unkScore
+			if !best[end].ok || score > best[end].score {
+				best[end] = node{score, start, u.unkId, true}
+			}
+		}
+
+		start += size
+	}
+
+	// Backtrack from the end of sequence
+	var reversed []tokenizer.Token
+	for end := n; end > 0; {
+		nd := best[end]
+		reversed = append(reversed, tokenizer.Token{
+			Id:      nd.id,
+			Value:   sequence[nd.start:end],
+			Offsets: []int{nd.start, end},
+		})
+		end = nd.start
+	}
+
+	var tokens []tokenizer.Token
+	for i := len(reversed) - 1; i >= 0; i-- {
+		tok := reversed[i]
+		last := len(tokens) - 1
+		if tok.Id == u.unkId && last >= 0 && tokens[last].Id == u.unkId {
+			tokens[last].Offsets[1] = tok.Offsets[1]
+			tokens[last].Value = sequence[tokens[last].Offsets[0]:tok.Offsets[1]]
+			continue
+		}
+		tokens = append(tokens, tok)
+	}
+
+	return tokens, nil
+}
+
+// TokenToId implements `tokenizer.Model` interface.
+func (u *Unigram) TokenToId(token string) (int, bool) {
+	id, ok := u.vocab[token]
+	return id, ok
+}
+
+// IdToToken implements `tokenizer.Model` interface.
+func (u *Unigram) IdToToken(id int) (string, bool) {
+	if id < 0 || id >= len(u.pieces) {
+		return "", false
+	}
+	return u.pieces[id].Value, true
+}
+
+// GetVocab implements `tokenizer.Model` interface.
+func (u *Unigram) GetVocab() map[string]int {
+	vocab := make(map[string]int, len(u.vocab))
+	for k, v := range u.vocab {
+		vocab[k] = v
+	}
+	return vocab
+}
+
+// GetVocabSize implements `tokenizer.Model` interface.
+func (u *Unigram) GetVocabSize() int {
+	return len(u.pieces)
+}
+
+// GetUnkId returns id of unknown token.
+func (u *Unigram) GetUnkId() int {
+	return u.unkId
+}
+
+// Save implements `tokenizer.Model` interface. It saves vocab and scores
+// to `unigram.json` file in HF tokenizers format.
+func (u *Unigram) Save(dir string, prefixOpt ...string) error {
+	filename := "unigram.json"
+	if len(prefixOpt) > 0 {
+		filename = fmt.Sprintf("%v-unigram.json", prefixOpt[0])
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	var vocab [][]interface{}
+	for _, p := range u.pieces {
+		vocab = append(vocab, []interface{}{p.Value, p.Score})
+	}
+
+	data, err := json.Marshal(map[string]interface{}{
+		"unk_id": u.unkId,
+		"vocab":  vocab,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, filename), data, 0644)
+}
@@ -1 +1,650 @@
 package transformer
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/nn"
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/bert"
+	"github.com/yinziyang/transformer/roberta"
+	"github.com/yinziyang/transformer/util"
+)
+
+// TrainingArguments holds hyperparameters of `Trainer`.
+//
+// Steps are optimizer steps, i.e. a step covers `GradientAccumulationSteps` batches.
+type TrainingArguments struct {
+	OutputDir                 string  // directory of checkpoints. No checkpoint is saved if empty.
+	NumEpochs                 int     // number of passes over training dataset.
+	BatchSize                 int     // training batch size.
+	EvalBatchSize             int     // evaluation batch size. Default to `BatchSize` if 0.
+	LearningRate              float64 // peak learning rate.
+	WeightDecay               float64 // decoupled weight decay of AdamW, not applied to biases and LayerNorm weights.
+	LayerLRDecay              float64 // layer-wise learning rate decay, e.g. 0.9, see `util.LayerwiseParamGroups`. Disabled if 0.
+	LRSchedulerType           string  // learning rate schedule, see `util.GetSchedule`.
+	WarmupSteps               int     // steps of linear warmup from 0 to `LearningRate`.
+	GradientAccumulationSteps int     // batches accumulated before an optimizer step.
+	MaxGradNorm               float64 // max L2 norm of gradients. No clipping if 0.
+	LoggingSteps              int     // steps between logs of training loss. No log if 0.
+	EvalSteps                 int     // steps between evaluations. Evaluate at end of each epoch if 0.
+	SaveSteps                 int     // steps between checkpoints. Save at each evaluation (or epoch) if 0.
+	MetricForBestModel        string  // evaluation metric of best model and early stopping, e.g. "eval_loss".
+	GreaterIsBetter           bool    // whether higher `MetricForBestModel` is better.
+	EarlyStoppingPatience     int     // evaluations without improvement before stopping. Disabled if 0.
+	EarlyStoppingThreshold    float64 // min improvement of `MetricForBestModel` to reset patience.
+	LoadBestModelAtEnd        bool    // load best checkpoint at end of training.
+	Seed                      int64   // seed of training dataset shuffling.
+}
+
+// DefaultTrainingArguments returns training arguments with default values
+// commonly used for fine-tuning BERT.
+func DefaultTrainingArguments() *TrainingArguments {
+	return &TrainingArguments{
+		NumEpochs:                 3,
+		BatchSize:                 8,
+		LearningRate:              5e-5,
+		WeightDecay:               0.0,
+		LRSchedulerType:           util.ScheduleLinear,
+		GradientAccumulationSteps: 1,
+		MaxGradNorm:               1.0,
+		LoggingSteps:              500,
+		MetricForBestModel:        "eval_loss",
+		Seed:                      42,
+	}
+}
+
+func (args *TrainingArguments) validate() error {
+	switch {
+	case args.NumEpochs <= 0:
+		return fmt.Errorf("Invalid NumEpochs: must be positive, got %v.", args.NumEpochs)
+	case args.BatchSize <= 0:
+		return fmt.Errorf("Invalid BatchSize: must be positive, got %v.", args.BatchSize)
+	case args.EvalBatchSize < 0:
+		return fmt.Errorf("Invalid EvalBatchSize: must not be negative, got %v.", args.EvalBatchSize)
+	case args.GradientAccumulationSteps <= 0:
+		return fmt.Errorf("Invalid GradientAccumulationSteps: must be positive, got %v.", args.GradientAccumulationSteps)
+	case args.LearningRate < 0, args.WeightDecay < 0, args.MaxGradNorm < 0:
+		return fmt.Errorf("Invalid LearningRate, WeightDecay or MaxGradNorm: must not be negative.")
+	case args.LoadBestModelAtEnd && args.OutputDir == "":
+		return fmt.Errorf("Invalid LoadBestModelAtEnd: OutputDir must be set to save best model.")
+	case args.LayerLRDecay < 0, args.LayerLRDecay > 1:
+		return fmt.Errorf("Invalid LayerLRDecay: must be in [0, 1], got %v.", args.LayerLRDecay)
+	case args.WarmupSteps < 0, args.LoggingSteps < 0, args.EvalSteps < 0, args.SaveSteps < 0, args.EarlyStoppingPatience < 0:
+		return fmt.Errorf("Invalid WarmupSteps, LoggingSteps, EvalSteps, SaveSteps or EarlyStoppingPatience: must not be negative.")
+	}
+	if _, err := util.GetSchedule(args.LRSchedulerType, args.WarmupSteps, 0); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Batch holds model inputs and labels of a training or evaluation batch.
+//
+// Inputs which are not used are nil or `ts.None`. Labels depend on the task head:
+//   - sequence classification and multiple choice: `Labels` of shape (batch size), class ids
+//     or float targets for regression (one label). Multi-hot float labels of shape (batch size,
+//     num labels) for multi-label classification.
+//   - token classification and masked language modeling: `Labels` of shape (batch size, sequence length).
+//     Positions labeled -100 are ignored.
+//   - next sentence prediction: `Labels` of shape (batch size), 0 if sentence B follows sentence A.
+//   - pretraining: masked language modeling `Labels` and `NextSentenceLabels` of shape (batch size).
+//   - question answering: `StartPositions` and `EndPositions` of shape (batch size).
+type Batch struct {
+	InputIds           *ts.Tensor
+	AttentionMask      *ts.Tensor
+	TokenTypeIds       *ts.Tensor
+	PositionIds        *ts.Tensor
+	Labels             *ts.Tensor
+	NextSentenceLabels *ts.Tensor
+	StartPositions     *ts.Tensor
+	EndPositions       *ts.Tensor
+}
+
+// Drop drops all tensors of batch.
+func (b *Batch) Drop() {
+	for _, x := range []*ts.Tensor{b.InputIds, b.AttentionMask, b.TokenTypeIds, b.PositionIds, b.Labels, b.NextSentenceLabels, b.StartPositions, b.EndPositions} {
+		if x != nil && x.MustDefined() {
+			x.MustDrop()
+		}
+	}
+}
+
+// Dataset is a dataset of `Trainer`.
+type Dataset interface {
+	// Len returns number of examples.
+	Len() int
+	// Batch collates examples at given indices into a batch on `device`.
+	Batch(indices []int, device gotch.Device) (*Batch, error)
+}
+
+// Metrics computes evaluation metrics of `Trainer` over batches of evaluation dataset.
+type Metrics interface {
+	// Reset clears state before an evaluation.
+	Reset()
+	// Update accumulates model output of a batch.
+	Update(batch *Batch, output *bert.ModelOutput) error
+	// Compute returns metrics of all accumulated batches.
+	Compute() map[string]float64
+}
+
+// TrainerState holds training progress. It is saved with each checkpoint.
+type TrainerState struct {
+	GlobalStep     int                  `json:"global_step"`
+	Epoch          float64              `json:"epoch"`
+	BestMetric     *float64             `json:"best_metric"`
+	BestCheckpoint string               `json:"best_model_checkpoint"`
+	LogHistory     []map[string]float64 `json:"log_history"`
+}
+
+// TrainOutput is returned by `Trainer.Train`.
+type TrainOutput struct {
+	GlobalStep   int
+	TrainingLoss float64            // mean training loss over all steps.
+	Metrics      map[string]float64 // metrics of last evaluation, nil if none.
+}
+
+// Trainer fine-tunes a task head of `bert` or `roberta` package.
+//
+// Supported heads are ForSequenceClassification, ForMultipleChoice, ForTokenClassification,
+// ForQuestionAnswering and ForMaskedLM. They minimize the loss computed by the head from batch labels
+// with `util.AdamW` and a learning rate schedule of `LRSchedulerType` (by default linear warmup over
+// `WarmupSteps` then linear decay to 0).
+//
+// Models of float16 variables (see `util.ConvertVarStore`) are trained with loss scaling
+// (`util.GradScaler`): optimizer steps whose gradients overflow are skipped.
+//
+// Example:
+//
+//	vs := nn.NewVarStore(device)
+//	model := bert.NewBertForSequenceClassification(vs.Root(), config)
+//	args := transformer.DefaultTrainingArguments()
+//	args.OutputDir = "output"
+//	trainer, err := transformer.NewTrainer(vs, model, args, trainData, evalData)
+//	output, err := trainer.Train()
+type Trainer struct {
+	VarStore     *nn.VarStore
+	Model        interface{}
+	Args         *TrainingArguments
+	TrainDataset Dataset
+	EvalDataset  Dataset // optional
+	Metrics      Metrics // optional, metrics computed along with "eval_loss".
+	State        *TrainerState
+
+	optimizer *util.AdamW
+	scheduler *util.LRScheduler
+	scaler    *util.GradScaler // loss scaling of float16 models, nil otherwise.
+	patience  int
+}
+
+// NewTrainer creates a Trainer of `model` whose variables are in `vs`.
+//
+// Params:
+//   - `vs`: VarStore of model variables. Trainable variables are optimized.
+//   - `model`: a task head of `bert` or `roberta` package.
+//   - `args`: training arguments.
+//   - `trainDataset`: training dataset.
+//   - `evalDataset`: optional evaluation dataset (nil for no evaluation).
+func NewTrainer(vs *nn.VarStore, model interface{}, args *TrainingArguments, trainDataset, evalDataset Dataset) (*Trainer, error) {
+	if err := args.validate(); err != nil {
+		err = fmt.Errorf("NewTrainer() failed: %w", err)
+		return nil, err
+	}
+	if !isTrainable(model) {
+		err := fmt.Errorf("NewTrainer() failed: unsupported model type %T.", model)
+		return nil, err
+	}
+	if trainDataset == nil || trainDataset.Len() == 0 {
+		err := fmt.Errorf("NewTrainer() failed: empty training dataset.")
+		return nil, err
+	}
+
+	return &Trainer{
+		VarStore:     vs,
+		Model:        model,
+		Args:         args,
+		TrainDataset: trainDataset,
+		EvalDataset:  evalDataset,
+		State:        new(TrainerState),
+	}, nil
+}
+
+// Train runs the training loop.
+func (t *Trainer) Train() (*TrainOutput, error) {
+	args := t.Args
+	device := t.VarStore.Device()
+
+	numBatches := (t.TrainDataset.Len() + args.BatchSize - 1) / args.BatchSize
+	stepsPerEpoch := (numBatches + args.GradientAccumulationSteps - 1) / args.GradientAccumulationSteps
+	totalSteps := stepsPerEpoch * args.NumEpochs
+
+	schedule, err := util.GetSchedule(args.LRSchedulerType, args.WarmupSteps, totalSteps)
+	if err != nil {
+		err = fmt.Errorf("Train() failed: %w", err)
+		return nil, err
+	}
+	groups := util.ParamGroups(t.VarStore, args.WeightDecay)
+	if args.LayerLRDecay > 0 {
+		m, ok := t.Model.(bert.HasBaseModel)
+		if !ok {
+			err := fmt.Errorf("Train() failed: LayerLRDecay is not supported by model %T.", t.Model)
+			return nil, err
+		}
+		groups = util.LayerwiseParamGroups(t.VarStore, args.WeightDecay, args.LayerLRDecay, bert.LayerPaths(m))
+	}
+	t.optimizer = util.NewAdamW(groups, args.LearningRate, util.DefaultAdamWConfig())
+	defer t.optimizer.Drop()
+	t.scheduler = util.NewLRScheduler(t.optimizer, schedule)
+	t.scaler = nil
+	for _, p := range t.optimizer.Params() {
+		if p.DType() == gotch.Half {
+			t.scaler = util.NewGradScaler()
+			break
+		}
+	}
+
+	rng := rand.New(rand.NewSource(args.Seed))
+	var (
+		output   = new(TrainOutput)
+		totalSum float64 // sum of losses of all steps
+		logSum   float64 // sum of losses since last log
+		logSteps int
+		stop     bool
+	)
+
+	for epoch := 0; epoch < args.NumEpochs && !stop; epoch++ {
+		perm := rng.Perm(t.TrainDataset.Len())
+		var stepLoss float64
+		for b := 0; b < numBatches && !stop; b++ {
+			end := (b + 1) * args.BatchSize
+			if end > len(perm) {
+				end = len(perm)
+			}
+			loss, err := t.trainBatch(perm[b*args.BatchSize:end], device)
+			if err != nil {
+				err = fmt.Errorf("Train() failed at epoch %v: %w", epoch, err)
+				return nil, err
+			}
+			stepLoss += loss / float64(args.GradientAccumulationSteps)
+
+			if (b+1)%args.GradientAccumulationSteps != 0 && b != numBatches-1 {
+				continue
+			}
+
+			lr := t.scheduler.LR()
+			if err := t.optimizerStep(); err != nil {
+				err = fmt.Errorf("Train() failed at epoch %v: %w", epoch, err)
+				return nil, err
+			}
+			t.State.GlobalStep++
+			t.State.Epoch = float64(epoch) + float64(b+1)/float64(numBatches)
+			totalSum += stepLoss
+			logSum += stepLoss
+			logSteps++
+			stepLoss = 0
+
+			if args.LoggingSteps > 0 && t.State.GlobalStep%args.LoggingSteps == 0 {
+				t.log(map[string]float64{"loss": logSum / float64(logSteps), "learning_rate": lr})
+				logSum, logSteps = 0, 0
+			}
+
+			evaluate := t.EvalDataset != nil && args.EvalSteps > 0 && t.State.GlobalStep%args.EvalSteps == 0
+			save := args.SaveSteps > 0 && t.State.GlobalStep%args.SaveSteps == 0
+			if stop, err = t.maybeEvaluateAndSave(evaluate, save, output); err != nil {
+				return nil, err
+			}
+		}
+
+		if !stop && args.EvalSteps == 0 {
+			evaluate := t.EvalDataset != nil
+			if stop, err = t.maybeEvaluateAndSave(evaluate, args.SaveSteps == 0, output); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if args.LoadBestModelAtEnd && t.State.BestCheckpoint != "" {
+		if err := t.VarStore.Load(filepath.Join(t.State.BestCheckpoint, modelFile)); err != nil {
+			err = fmt.Errorf("Train() failed to load best model: %w", err)
+			return nil, err
+		}
+	}
+
+	output.GlobalStep = t.State.GlobalStep
+	if t.State.GlobalStep > 0 {
+		output.TrainingLoss = totalSum / float64(t.State.GlobalStep)
+	}
+
+	return output, nil
+}
+
+// trainBatch runs forward and backward passes of a batch and returns its loss.
+func (t *Trainer) trainBatch(indices []int, device gotch.Device) (float64, error) {
+	batch, err := t.TrainDataset.Batch(indices, device)
+	if err != nil {
+		return 0, err
+	}
+	defer batch.Drop()
+
+	output, err := forward(t.Model, batch, true)
+	if err != nil {
+		return 0, err
+	}
+	defer output.Drop()
+
+	loss, err := outputLoss(output)
+	if err != nil {
+		return 0, err
+	}
+	scaled := loss.MustDivScalar(ts.IntScalar(int64(t.Args.GradientAccumulationSteps)), false)
+	if t.scaler != nil {
+		unscaled := scaled
+		scaled = t.scaler.Scale(unscaled)
+		unscaled.MustDrop()
+	}
+	defer scaled.MustDrop()
+	if err := scaled.Backward(); err != nil {
+		return 0, err
+	}
+	if m, ok := t.Model.(bert.Checkpointed); ok {
+		if err := m.BackwardCheckpoints(); err != nil {
+			return 0, err
+		}
+	}
+
+	return loss.Float64Values()[0], nil
+}
+
+// optimizerStep clips accumulated gradients, updates variables, moves learning rate
+// schedule to next step and zeroes gradients. With loss scaling, gradients are unscaled
+// first and variables are not updated if gradients overflow.
+func (t *Trainer) optimizerStep() error {
+	finite := true
+	if t.scaler != nil {
+		finite = t.scaler.Unscale(t.optimizer.Params())
+		t.scaler.Update()
+	}
+	if finite {
+		if t.Args.MaxGradNorm > 0 {
+			t.optimizer.ClipGradNorm(t.Args.MaxGradNorm)
+		}
+		if err := t.optimizer.Step(); err != nil {
+			return err
+		}
+	}
+	t.scheduler.Step()
+	t.optimizer.ZeroGrad()
+
+	return nil
+}
+
+// maybeEvaluateAndSave evaluates model and saves a checkpoint as requested. It returns
+// whether training should stop early.
+func (t *Trainer) maybeEvaluateAndSave(evaluate, save bool, output *TrainOutput) (bool, error) {
+	var stop, improved bool
+	if evaluate {
+		metrics, err := t.Evaluate()
+		if err != nil {
+			err = fmt.Errorf("Train() failed at step %v: %w", t.State.GlobalStep, err)
+			return false, err
+		}
+		t.log(metrics)
+		output.Metrics = metrics
+
+		improved, err = t.updateBest(metrics)
+		if err != nil {
+			return false, err
+		}
+		if improved {
+			t.patience = 0
+		} else {
+			t.patience++
+			stop = t.Args.EarlyStoppingPatience > 0 && t.patience >= t.Args.EarlyStoppingPatience
+		}
+		// Checkpoints are saved at evaluations unless `SaveSteps` is set. An improved model is
+		// always saved if it is loaded at end of training.
+		save = save || t.Args.SaveSteps == 0 || (improved && t.Args.LoadBestModelAtEnd)
+	}
+
+	if improved {
+		// Best model has no checkpoint unless it is saved below.
+		t.State.BestCheckpoint = ""
+	}
+	if save && t.Args.OutputDir != "" {
+		dir, err := t.SaveCheckpoint()
+		if err != nil {
+			err = fmt.Errorf("Train() failed at step %v: %w", t.State.GlobalStep, err)
+			return false, err
+		}
+		if improved {
+			t.State.BestCheckpoint = dir
+		}
+	}
+
+	return stop, nil
+}
+
+// updateBest updates best metric and returns whether it was improved.
+func (t *Trainer) updateBest(metrics map[string]float64) (bool, error) {
+	value, ok := metrics[t.Args.MetricForBestModel]
+	if !ok {
+		err := fmt.Errorf("Train() failed: metric %q is not computed by evaluation.", t.Args.MetricForBestModel)
+		return false, err
+	}
+
+	best := t.State.BestMetric
+	improved := best == nil
+	if best != nil {
+		if t.Args.GreaterIsBetter {
+			improved = value > *best+t.Args.EarlyStoppingThreshold
+		} else {
+			improved = value < *best-t.Args.EarlyStoppingThreshold
+		}
+	}
+	if improved {
+		t.State.BestMetric = &value
+	}
+
+	return improved, nil
+}
+
+func (t *Trainer) log(entry map[string]float64) {
+	entry["step"] = float64(t.State.GlobalStep)
+	entry["epoch"] = t.State.Epoch
+	t.State.LogHistory = append(t.State.LogHistory, entry)
+	log.Printf("%v\n", entry)
+}
+
+// Evaluate computes "eval_loss" and metrics of `Metrics` (prefixed with "eval_") on
+// evaluation dataset.
+func (t *Trainer) Evaluate() (map[string]float64, error) {
+	if t.EvalDataset == nil || t.EvalDataset.Len() == 0 {
+		err := fmt.Errorf("Evaluate() failed: empty evaluation dataset.")
+		return nil, err
+	}
+
+	batchSize := t.Args.EvalBatchSize
+	if batchSize == 0 {
+		batchSize = t.Args.BatchSize
+	}
+	if t.Metrics != nil {
+		t.Metrics.Reset()
+	}
+
+	var (
+		lossSum float64
+		err     error
+		n       = t.EvalDataset.Len()
+		device  = t.VarStore.Device()
+	)
+	ts.NoGrad(func() {
+		for start := 0; start < n; start += batchSize {
+			end := start + batchSize
+			if end > n {
+				end = n
+			}
+			indices := make([]int, 0, end-start)
+			for i := start; i < end; i++ {
+				indices = append(indices, i)
+			}
+
+			var loss float64
+			loss, err = t.evalBatch(indices, device)
+			if err != nil {
+				return
+			}
+			lossSum += loss * float64(end-start)
+		}
+	})
+	if err != nil {
+		err = fmt.Errorf("Evaluate() failed: %w", err)
+		return nil, err
+	}
+
+	metrics := map[string]float64{"eval_loss": lossSum / float64(n)}
+	if t.Metrics != nil {
+		for name, value := range t.Metrics.Compute() {
+			metrics["eval_"+name] = value
+		}
+	}
+
+	return metrics, nil
+}
+
+func (t *Trainer) evalBatch(indices []int, device gotch.Device) (float64, error) {
+	batch, err := t.EvalDataset.Batch(indices, device)
+	if err != nil {
+		return 0, err
+	}
+	defer batch.Drop()
+
+	output, err := forward(t.Model, batch, false)
+	if err != nil {
+		return 0, err
+	}
+	defer output.Drop()
+
+	loss, err := outputLoss(output)
+	if err != nil {
+		return 0, err
+	}
+
+	if t.Metrics != nil {
+		if err := t.Metrics.Update(batch, output); err != nil {
+			return 0, err
+		}
+	}
+
+	return loss.Float64Values()[0], nil
+}
+
+const (
+	modelFile        = "model.gt"
+	trainerStateFile = "trainer_state.json"
+)
+
+// SaveCheckpoint saves model variables and trainer state to "checkpoint-<global step>"
+// directory of `OutputDir` and returns the checkpoint directory.
+func (t *Trainer) SaveCheckpoint() (string, error) {
+	dir := filepath.Join(t.Args.OutputDir, fmt.Sprintf("checkpoint-%d", t.State.GlobalStep))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	if err := t.VarStore.Save(filepath.Join(dir, modelFile)); err != nil {
+		return "", err
+	}
+
+	data, err := json.MarshalIndent(t.State, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, trainerStateFile), data, 0644); err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// isTrainable returns whether `Trainer` supports `model`.
+func isTrainable(model interface{}) bool {
+	switch model.(type) {
+	case *bert.BertForSequenceClassification, *bert.BertForMultipleChoice, *bert.BertForTokenClassification,
+		*bert.BertForQuestionAnswering, *bert.BertForMaskedLM, *bert.BertForNextSentencePrediction, *bert.BertForPreTraining,
+		*roberta.RobertaForSequenceClassification, *roberta.RobertaForMultipleChoice, *roberta.RobertaForTokenClassification,
+		*roberta.RobertaForQuestionAnswering, *roberta.RobertaForMaskedLM:
+		return true
+	}
+
+	return false
+}
+
+// forward runs forward pass of a task head on batch inputs.
+func forward(model interface{}, batch *Batch, train bool) (*bert.ModelOutput, error) {
+	var (
+		inputIds           = batch.InputIds
+		mask               = optional(batch.AttentionMask)
+		tokenTypeIds       = optional(batch.TokenTypeIds)
+		positionIds        = optional(batch.PositionIds)
+		labels             = optional(batch.Labels)
+		nextSentenceLabels = optional(batch.NextSentenceLabels)
+		startPositions     = optional(batch.StartPositions)
+		endPositions       = optional(batch.EndPositions)
+	)
+
+	switch m := model.(type) {
+	case *bert.BertForSequenceClassification:
+		return m.ForwardT(inputIds, mask, tokenTypeIds, positionIds, ts.None, labels, train)
+	case *bert.BertForMultipleChoice:
+		return m.ForwardT(inputIds, mask, tokenTypeIds, positionIds, labels, train)
+	case *bert.BertForTokenClassification:
+		return m.ForwardT(inputIds, mask, tokenTypeIds, positionIds, ts.None, labels, train)
+	case *bert.BertForQuestionAnswering:
+		return m.ForwardT(inputIds, mask, tokenTypeIds, positionIds, ts.None, startPositions, endPositions, train)
+	case *bert.BertForMaskedLM:
+		return m.ForwardT(inputIds, mask, tokenTypeIds, positionIds, ts.None, ts.None, ts.None, labels, train)
+	case *bert.BertForNextSentencePrediction:
+		return m.ForwardT(inputIds, mask, tokenTypeIds, positionIds, ts.None, labels, train)
+	case *bert.BertForPreTraining:
+		return m.ForwardT(inputIds, mask, tokenTypeIds, positionIds, ts.None, labels, nextSentenceLabels, train)
+	case *roberta.RobertaForSequenceClassification:
+		return m.ForwardT(inputIds, mask, tokenTypeIds, positionIds, ts.None, labels, train)
+	case *roberta.RobertaForMultipleChoice:
+		return m.ForwardT(inputIds, mask, tokenTypeIds, positionIds, labels, train)
+	case *roberta.RobertaForTokenClassification:
+		return m.ForwardT(inputIds, mask, tokenTypeIds, positionIds, ts.None, labels, train)
+	case *roberta.RobertaForQuestionAnswering:
+		return m.ForwardT(inputIds, mask, tokenTypeIds, positionIds, ts.None, startPositions, endPositions, train)
+	case *roberta.RobertaForMaskedLM:
+		return m.Forward(inputIds, mask, tokenTypeIds, positionIds, ts.None, ts.None, ts.None, labels, train)
+	}
+
+	err := fmt.Errorf("unsupported model type %T.", model)
+	return nil, err
+}
+
+// outputLoss returns loss computed by task head.
+func outputLoss(output *bert.ModelOutput) (*ts.Tensor, error) {
+	if output.Loss == nil || !output.Loss.MustDefined() {
+		err := fmt.Errorf("model returned no loss: batch has no labels.")
+		return nil, err
+	}
+
+	return output.Loss, nil
+}
+
+// optional returns `ts.None` for a nil tensor.
+func optional(x *ts.Tensor) *ts.Tensor {
+	if x == nil {
+		return ts.None
+	}
+
+	return x
+}
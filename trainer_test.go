@@ -0,0 +1,213 @@
+package transformer_test
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/nn"
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer"
+	"github.com/yinziyang/transformer/bert"
+)
+
+// syntheticDataset is a binary classification task: label is 1 if the sequence
+// contains token 5.
+type syntheticDataset struct {
+	inputs [][]int64
+	labels []int64
+}
+
+func newSyntheticDataset(n int, seed int64) *syntheticDataset {
+	rng := rand.New(rand.NewSource(seed))
+	d := new(syntheticDataset)
+	for i := 0; i < n; i++ {
+		input := []int64{1} // [CLS]
+		var label int64
+		for j := 0; j < 6; j++ {
+			token := int64(3 + rng.Intn(5))
+			if token == 5 {
+				label = 1
+			}
+			input = append(input, token)
+		}
+		d.inputs = append(d.inputs, input)
+		d.labels = append(d.labels, label)
+	}
+
+	return d
+}
+
+func (d *syntheticDataset) Len() int {
+	return len(d.inputs)
+}
+
+func (d *syntheticDataset) Batch(indices []int, device gotch.Device) (*transformer.Batch, error) {
+	var (
+		inputs []int64
+		labels []int64
+	)
+	for _, i := range indices {
+		inputs = append(inputs, d.inputs[i]...)
+		labels = append(labels, d.labels[i])
+	}
+	shape := []int64{int64(len(indices)), int64(len(d.inputs[0]))}
+
+	return &transformer.Batch{
+		InputIds: ts.MustOfSlice(inputs).MustView(shape, true).MustTo(device, true),
+		Labels:   ts.MustOfSlice(labels).MustTo(device, true),
+	}, nil
+}
+
+func newTinyClassifier() (*nn.VarStore, *bert.BertForSequenceClassification) {
+	config := bert.NewConfig(map[string]interface{}{
+		"VocabSize":             int64(10),
+		"HiddenSize":            int64(16),
+		"NumHiddenLayers":       int64(2),
+		"NumAttentionHeads":     int64(2),
+		"IntermediateSize":      int64(32),
+		"MaxPositionEmbeddings": int64(16),
+	})
+	config.Id2Label = map[int64]string{0: "NEG", 1: "POS"}
+
+	vs := nn.NewVarStore(gotch.CPU)
+	model := bert.NewBertForSequenceClassification(vs.Root(), config)
+
+	return vs, model
+}
+
+func TestTrainer_Train(t *testing.T) {
+	vs, model := newTinyClassifier()
+
+	args := transformer.DefaultTrainingArguments()
+	args.OutputDir = t.TempDir()
+	args.NumEpochs = 20
+	args.BatchSize = 16
+	args.LearningRate = 1e-3
+	args.WeightDecay = 0.01
+	args.WarmupSteps = 10
+	args.GradientAccumulationSteps = 2
+	args.LoggingSteps = 10
+
+	trainer, err := transformer.NewTrainer(vs, model, args, newSyntheticDataset(128, 1), newSyntheticDataset(64, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := trainer.Evaluate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := trainer.Train()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 128 examples, 8 batches, 4 steps per epoch.
+	if output.GlobalStep != 80 {
+		t.Errorf("Want global step: 80\n")
+		t.Errorf("Got global step: %v\n", output.GlobalStep)
+	}
+
+	if output.Metrics["eval_loss"] >= before["eval_loss"]/2 {
+		t.Errorf("Want eval loss lower than: %v\n", before["eval_loss"]/2)
+		t.Errorf("Got eval loss: %v\n", output.Metrics["eval_loss"])
+	}
+
+	// A checkpoint is saved at each evaluation (end of epoch).
+	for _, file := range []string{"model.gt", "trainer_state.json"} {
+		if _, err := os.Stat(filepath.Join(args.OutputDir, "checkpoint-80", file)); err != nil {
+			t.Errorf("Want checkpoint file %q: %v\n", file, err)
+		}
+	}
+}
+
+func TestTrainer_EarlyStopping(t *testing.T) {
+	vs, model := newTinyClassifier()
+
+	args := transformer.DefaultTrainingArguments()
+	args.NumEpochs = 10
+	args.BatchSize = 16
+	args.LearningRate = 0 // evaluation loss never improves.
+	args.EvalSteps = 1
+	args.EarlyStoppingPatience = 2
+
+	trainer, err := transformer.NewTrainer(vs, model, args, newSyntheticDataset(64, 1), newSyntheticDataset(32, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := trainer.Train()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Best metric at first evaluation, then 2 evaluations without improvement.
+	if output.GlobalStep != 3 {
+		t.Errorf("Want global step: 3\n")
+		t.Errorf("Got global step: %v\n", output.GlobalStep)
+	}
+}
+
+func TestTrainer_LoadBestModelAtEnd(t *testing.T) {
+	vs, model := newTinyClassifier()
+
+	args := transformer.DefaultTrainingArguments()
+	args.OutputDir = t.TempDir()
+	args.NumEpochs = 1
+	args.BatchSize = 16
+	args.LearningRate = 0 // evaluation loss only improves at first evaluation.
+	args.EvalSteps = 1
+	args.SaveSteps = 3
+	args.LoadBestModelAtEnd = true
+
+	trainer, err := transformer.NewTrainer(vs, model, args, newSyntheticDataset(64, 1), newSyntheticDataset(32, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := trainer.Train(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Best model of step 1 is saved even if step 1 is not a multiple of `SaveSteps`.
+	want := filepath.Join(args.OutputDir, "checkpoint-1")
+	if trainer.State.BestCheckpoint != want {
+		t.Errorf("Want best checkpoint: %q\n", want)
+		t.Errorf("Got best checkpoint: %q\n", trainer.State.BestCheckpoint)
+	}
+	if _, err := os.Stat(filepath.Join(want, "model.gt")); err != nil {
+		t.Errorf("Want best model file: %v\n", err)
+	}
+}
+
+func TestNewTrainer_Invalid(t *testing.T) {
+	vs, model := newTinyClassifier()
+	data := newSyntheticDataset(8, 1)
+
+	args := transformer.DefaultTrainingArguments()
+	args.GradientAccumulationSteps = 0
+	if _, err := transformer.NewTrainer(vs, model, args, data, nil); err == nil {
+		t.Errorf("Want error for invalid training arguments\n")
+	}
+
+	args = transformer.DefaultTrainingArguments()
+	args.LoadBestModelAtEnd = true
+	if _, err := transformer.NewTrainer(vs, model, args, data, nil); err == nil {
+		t.Errorf("Want error for LoadBestModelAtEnd without OutputDir\n")
+	}
+
+	args = transformer.DefaultTrainingArguments()
+	args.LayerLRDecay = 1.5
+	if _, err := transformer.NewTrainer(vs, model, args, data, nil); err == nil {
+		t.Errorf("Want error for invalid LayerLRDecay\n")
+	}
+
+	args = transformer.DefaultTrainingArguments()
+	if _, err := transformer.NewTrainer(vs, vs, args, data, nil); err == nil {
+		t.Errorf("Want error for unsupported model\n")
+	}
+}
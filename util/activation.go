@@ -1,6 +1,11 @@
 package util
 
 import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
 	"github.com/sugarme/gotch/ts"
 )
 
@@ -111,7 +116,7 @@ func NewMish() MishActivation {
 func (m MishActivation) Fwd(x *ts.Tensor) (retVal *ts.Tensor) {
 	softplus := x.MustSoftplus(false)
 	tanh := softplus.MustTanh(true)
-	retVal = x.MustMm(tanh, false)
+	retVal = x.MustMul(tanh, false)
 	tanh.MustDrop()
 	return retVal
 }
@@ -120,16 +125,235 @@ func (m MishActivation) Name() (retVal string) {
 	return m.name
 }
 
+// GeLU new activation:
+// ====================
+// Tanh approximation of GeLU as in Google BERT and OpenAI GPT repos.
+// See https://arxiv.org/abs/1606.08415
+
+type GeluNewActivation struct {
+	name string
+}
+
+var GeluNew = GeluNewActivation{}
+
+func NewGeluNew() GeluNewActivation {
+	return GeluNewActivation{"gelu_new"}
+}
+
+func (g GeluNewActivation) Fwd(x *ts.Tensor) (retVal *ts.Tensor) {
+	return geluNew(x)
+}
+
+func (g GeluNewActivation) Name() (retVal string) {
+	return g.name
+}
+
+// geluNew computes x * 0.5 * (1 + tanh(sqrt(2/PI) * (x + 0.044715 * x^3))).
 func geluNew(xs *ts.Tensor) (retVal *ts.Tensor) {
-	// TODO: implement
-	// x * 0.5 * (((x.pow(3.0f64) * 0.044715 + x) * ((2f64 / PI).sqrt())).tanh() + 1)
+	// Out-of-place ops only: tanh backward needs its output, which in-place ops would overwrite.
+	x3 := xs.MustPowTensorScalar(ts.FloatScalar(3.0), false)
+	inner := x3.MustMulScalar(ts.FloatScalar(0.044715), true)
+	inner = inner.MustAdd(xs, true)
+	inner = inner.MustMulScalar(ts.FloatScalar(math.Sqrt(2.0/math.Pi)), true)
+	inner = inner.MustTanh(true)
+	inner = inner.MustAddScalar(ts.FloatScalar(1.0), true)
+	inner = inner.MustMulScalar(ts.FloatScalar(0.5), true)
+	retVal = xs.MustMul(inner, false)
+	inner.MustDrop()
+
+	return retVal
+}
+
+// GeLU fast activation:
+// =====================
+// Faster (less accurate) form of tanh approximation of GeLU.
+
+type GeluFastActivation struct {
+	name string
+}
+
+var GeluFast = GeluFastActivation{}
+
+func NewGeluFast() GeluFastActivation {
+	return GeluFastActivation{"gelu_fast"}
+}
+
+// Fwd computes 0.5 * x * (1 + tanh(x * 0.7978845608 * (1 + 0.044715 * x * x))).
+func (g GeluFastActivation) Fwd(x *ts.Tensor) (retVal *ts.Tensor) {
+	// Out-of-place ops only, see `geluNew`.
+	inner := x.MustMul(x, false)
+	inner = inner.MustMulScalar(ts.FloatScalar(0.044715), true)
+	inner = inner.MustAddScalar(ts.FloatScalar(1.0), true)
+	inner = inner.MustMul(x, true)
+	inner = inner.MustMulScalar(ts.FloatScalar(0.7978845608), true)
+	inner = inner.MustTanh(true)
+	inner = inner.MustAddScalar(ts.FloatScalar(1.0), true)
+	inner = inner.MustMulScalar(ts.FloatScalar(0.5), true)
+	retVal = x.MustMul(inner, false)
+	inner.MustDrop()
+
+	return retVal
+}
+
+func (g GeluFastActivation) Name() (retVal string) {
+	return g.name
+}
+
+// GeLU Pytorch tanh activation:
+// =============================
+// Tanh approximation of GeLU computed by libtorch. It is numerically equivalent to `gelu_new`.
+
+type GeluPytorchTanhActivation struct {
+	name string
+}
+
+var GeluPytorchTanh = GeluPytorchTanhActivation{}
+
+func NewGeluPytorchTanh() GeluPytorchTanhActivation {
+	return GeluPytorchTanhActivation{"gelu_pytorch_tanh"}
+}
+
+func (g GeluPytorchTanhActivation) Fwd(x *ts.Tensor) (retVal *ts.Tensor) {
+	return x.MustGelu("tanh", false)
+}
+
+func (g GeluPytorchTanhActivation) Name() (retVal string) {
+	return g.name
+}
+
+// Quick GeLU activation:
+// ======================
+// Sigmoid approximation of GeLU: x * sigmoid(1.702 * x).
+
+type QuickGeluActivation struct {
+	name string
+}
+
+var QuickGelu = QuickGeluActivation{}
+
+func NewQuickGelu() QuickGeluActivation {
+	return QuickGeluActivation{"quick_gelu"}
+}
+
+func (q QuickGeluActivation) Fwd(x *ts.Tensor) (retVal *ts.Tensor) {
+	sig := x.MustMulScalar(ts.FloatScalar(1.702), false)
+	sig = sig.MustSigmoid(true)
+	retVal = x.MustMul(sig, false)
+	sig.MustDrop()
+
 	return retVal
 }
 
+func (q QuickGeluActivation) Name() (retVal string) {
+	return q.name
+}
+
+// SiLU activation:
+// ================
+// Sigmoid linear unit: x * sigmoid(x). Same as swish.
+
+type SiluActivation struct {
+	name string
+}
+
+var Silu = SiluActivation{}
+
+func NewSilu() SiluActivation {
+	return SiluActivation{"silu"}
+}
+
+func (s SiluActivation) Fwd(x *ts.Tensor) (retVal *ts.Tensor) {
+	return x.MustSilu(false)
+}
+
+func (s SiluActivation) Name() (retVal string) {
+	return s.name
+}
+
+// Custom activation:
+// ==================
+
+// FuncActivation wraps a function as an `ActivationFn`.
+type FuncActivation struct {
+	name string
+	fn   func(x *ts.Tensor) *ts.Tensor
+}
+
+// NewFuncActivation creates an activation named `name` which forwards pass through `fn`.
+// NOTE. `fn` must return a new tensor and must not drop its input.
+func NewFuncActivation(name string, fn func(x *ts.Tensor) *ts.Tensor) FuncActivation {
+	return FuncActivation{name, fn}
+}
+
+func (f FuncActivation) Fwd(x *ts.Tensor) (retVal *ts.Tensor) {
+	return f.fn(x)
+}
+
+func (f FuncActivation) Name() (retVal string) {
+	return f.name
+}
+
+// Activation registry:
+// ====================
+
+// ActivationFnMap maps `hidden_act` names of model configurations to activation functions.
+// Use `RegisterActivation` to add custom activations and `GetActivation` to look them up.
 var ActivationFnMap map[string]ActivationFn = map[string]ActivationFn{
-	"gelu":  NewGelu(),
-	"relu":  NewRelu(),
-	"tanh":  NewTanh(),
-	"swish": NewSwish(),
-	"mish":  NewMish(),
+	"gelu":              NewGelu(),
+	"gelu_new":          NewGeluNew(),
+	"gelu_fast":         NewGeluFast(),
+	"gelu_pytorch_tanh": NewGeluPytorchTanh(),
+	"quick_gelu":        NewQuickGelu(),
+	"relu":              NewRelu(),
+	"tanh":              NewTanh(),
+	"swish":             NewSwish(),
+	"silu":              NewSilu(),
+	"mish":              NewMish(),
+}
+
+var activationMu sync.RWMutex
+
+// RegisterActivation registers activation function `fn` under `name` so that it can be
+// selected with `hidden_act` in model configurations. An existing activation with the
+// same name is replaced.
+//
+// Example:
+//
+//	util.RegisterActivation("leaky_relu", util.NewFuncActivation("leaky_relu", func(x *ts.Tensor) *ts.Tensor {
+//		return x.MustLeakyRelu(false)
+//	}))
+func RegisterActivation(name string, fn ActivationFn) error {
+	if name == "" {
+		err := fmt.Errorf("RegisterActivation() failed: activation name is empty.")
+		return err
+	}
+	if fn == nil {
+		err := fmt.Errorf("RegisterActivation() failed: activation function %q is nil.", name)
+		return err
+	}
+
+	activationMu.Lock()
+	defer activationMu.Unlock()
+	ActivationFnMap[name] = fn
+
+	return nil
+}
+
+// GetActivation returns activation function registered under `name`.
+func GetActivation(name string) (ActivationFn, error) {
+	activationMu.RLock()
+	defer activationMu.RUnlock()
+
+	fn, ok := ActivationFnMap[name]
+	if !ok {
+		names := make([]string, 0, len(ActivationFnMap))
+		for k := range ActivationFnMap {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		err := fmt.Errorf("Unsupported activation function %q. Supported activations: %v", name, names)
+		return nil, err
+	}
+
+	return fn, nil
 }
@@ -0,0 +1,104 @@
+package util_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/util"
+)
+
+var activationInput = []float64{-3.0, -1.0, -0.5, 0.0, 0.5, 1.0, 3.0}
+
+type activationTest struct {
+	name string
+	want func(x float64) float64
+}
+
+// activationTests returns activations with their reference functions.
+func activationTests() []activationTest {
+	gelu := func(x float64) float64 { return 0.5 * x * (1 + math.Erf(x/math.Sqrt2)) }
+	geluTanh := func(x float64) float64 {
+		return 0.5 * x * (1 + math.Tanh(math.Sqrt(2/math.Pi)*(x+0.044715*x*x*x)))
+	}
+	sigmoid := func(x float64) float64 { return 1 / (1 + math.Exp(-x)) }
+
+	return []activationTest{
+		{"gelu", gelu},
+		{"gelu_new", geluTanh},
+		{"gelu_fast", geluTanh},
+		{"gelu_pytorch_tanh", geluTanh},
+		{"quick_gelu", func(x float64) float64 { return x * sigmoid(1.702*x) }},
+		{"silu", func(x float64) float64 { return x * sigmoid(x) }},
+		{"swish", func(x float64) float64 { return x * sigmoid(x) }},
+		{"mish", func(x float64) float64 { return x * math.Tanh(math.Log1p(math.Exp(x))) }},
+		{"relu", func(x float64) float64 { return math.Max(x, 0) }},
+		{"tanh", math.Tanh},
+	}
+}
+
+func TestActivations(t *testing.T) {
+	input := activationInput
+	xs := ts.MustOfSlice(input)
+	for _, tt := range activationTests() {
+		act, err := util.GetActivation(tt.name)
+		if err != nil {
+			t.Errorf("%v - got error: %v\n", tt.name, err)
+			continue
+		}
+
+		got := act.Fwd(xs).Float64Values(true)
+		for i, x := range input {
+			want := tt.want(x)
+			if math.Abs(got[i]-want) > 1e-6 {
+				t.Errorf("%v(%v) - want: %v\n", tt.name, x, want)
+				t.Errorf("%v(%v) - got: %v\n", tt.name, x, got[i])
+			}
+		}
+	}
+	xs.MustDrop()
+
+	if _, err := util.GetActivation("gelu_unknown"); err == nil {
+		t.Errorf("Want error for unknown activation\n")
+	}
+}
+
+// Gradients of activations are checked against central differences of reference functions,
+// so activations must be differentiable by autograd (e.g. no in-place op overwriting a tensor
+// needed by backward pass).
+func TestActivations_Backward(t *testing.T) {
+	const h = 1e-6
+	for _, tt := range activationTests() {
+		act, err := util.GetActivation(tt.name)
+		if err != nil {
+			t.Errorf("%v - got error: %v\n", tt.name, err)
+			continue
+		}
+
+		xs := ts.MustOfSlice(activationInput).MustSetRequiresGrad(true, true)
+		ys := act.Fwd(xs)
+		loss := ys.MustSum(gotch.Double, false)
+		if err := loss.Backward(); err != nil {
+			t.Errorf("%v - got backward error: %v\n", tt.name, err)
+		} else {
+			grad := xs.MustGrad(false)
+			got := grad.Float64Values()
+			grad.MustDrop()
+			for i, x := range activationInput {
+				if tt.name == "relu" && x == 0 {
+					continue // not differentiable
+				}
+				want := (tt.want(x+h) - tt.want(x-h)) / (2 * h)
+				if math.Abs(got[i]-want) > 1e-5 {
+					t.Errorf("%v'(%v) - want: %v\n", tt.name, x, want)
+					t.Errorf("%v'(%v) - got: %v\n", tt.name, x, got[i])
+				}
+			}
+		}
+		loss.MustDrop()
+		ys.MustDrop()
+		xs.MustDrop()
+	}
+}
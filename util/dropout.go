@@ -4,8 +4,22 @@ import (
 	"github.com/sugarme/gotch/ts"
 )
 
+// Dropout masks:
+// ==============
+//
+// Torch RNG state is not exposed by gotch, so a forward pass cannot be run again with the same
+// dropout masks by restoring the RNG state (as `preserve_rng_state` of PyTorch checkpointing does).
+// Instead, a `Dropout` can record masks it draws in training. Its position in recorded masks is
+// saved with `Pos` and restored with `Seek`: masks are then replayed in the same order and new
+// masks are drawn (and recorded) once recorded ones are exhausted.
+//
+// NOTE. Recorded masks are kept until `StopRecording`, so memory of masks adds up over forward passes.
+
 type Dropout struct {
 	dropoutProb float64
+	recording   bool
+	masks       []*ts.Tensor // recorded masks scaled by 1/(1 - p)
+	next        int          // index of next mask to apply
 }
 
 func NewDropout(p float64) *Dropout {
@@ -15,5 +29,51 @@ func NewDropout(p float64) *Dropout {
 }
 
 func (d *Dropout) ForwardT(input *ts.Tensor, train bool) (retVal *ts.Tensor) {
-	return ts.MustDropout(input, d.dropoutProb, train)
+	if !d.recording || !train || d.dropoutProb == 0 {
+		return ts.MustDropout(input, d.dropoutProb, train)
+	}
+
+	if d.next == len(d.masks) {
+		ones := input.MustOnesLike(false)
+		d.masks = append(d.masks, ts.MustDropout(ones, d.dropoutProb, true))
+		ones.MustDrop()
+	}
+	mask := d.masks[d.next]
+	d.next++
+
+	return input.MustMul(mask, false)
+}
+
+// Record makes dropout record masks it draws in training. It is a no-op if dropout is already recording.
+func (d *Dropout) Record() {
+	d.recording = true
+}
+
+// Recording returns whether dropout records its masks.
+func (d *Dropout) Recording() bool {
+	return d.recording
+}
+
+// StopRecording drops recorded masks. Dropout draws new masks on each forward pass again.
+func (d *Dropout) StopRecording() {
+	for _, mask := range d.masks {
+		mask.MustDrop()
+	}
+	d.recording = false
+	d.masks = nil
+	d.next = 0
+}
+
+// Pos returns position of the next mask to apply in recorded masks.
+func (d *Dropout) Pos() int {
+	return d.next
+}
+
+// Seek makes the next forward passes replay recorded masks from position `pos`. Positions out
+// of recorded masks seek to the end: new masks are drawn.
+func (d *Dropout) Seek(pos int) {
+	if pos < 0 || pos > len(d.masks) {
+		pos = len(d.masks)
+	}
+	d.next = pos
 }
@@ -0,0 +1,62 @@
+package util_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/util"
+)
+
+func TestDropout_Seek(t *testing.T) {
+	d := util.NewDropout(0.5)
+	d.Record()
+	defer d.StopRecording()
+
+	xs := ts.MustOnes([]int64{64}, gotch.Float, gotch.CPU)
+	defer xs.MustDrop()
+
+	forward := func() []float64 {
+		ys := d.ForwardT(xs, true)
+		defer ys.MustDrop()
+		return ys.Float64Values()
+	}
+
+	want1 := forward()
+	want2 := forward()
+	if d.Pos() != 2 {
+		t.Errorf("Want position: 2\n")
+		t.Errorf("Got position: %v\n", d.Pos())
+	}
+
+	d.Seek(0)
+	if got := forward(); !reflect.DeepEqual(want1, got) {
+		t.Errorf("Want replayed first mask: %v\n", want1)
+		t.Errorf("Got: %v\n", got)
+	}
+	if got := forward(); !reflect.DeepEqual(want2, got) {
+		t.Errorf("Want replayed second mask: %v\n", want2)
+		t.Errorf("Got: %v\n", got)
+	}
+
+	// Masks are drawn again once recorded masks are exhausted.
+	forward()
+	if d.Pos() != 3 {
+		t.Errorf("Want position: 3\n")
+		t.Errorf("Got position: %v\n", d.Pos())
+	}
+
+	// Dropout is a no-op out of training.
+	d.Seek(0)
+	ys := d.ForwardT(xs, false)
+	defer ys.MustDrop()
+	if !reflect.DeepEqual(xs.Float64Values(), ys.Float64Values()) {
+		t.Errorf("Want input unchanged out of training\n")
+	}
+	if d.Pos() != 0 {
+		t.Errorf("Want position unchanged out of training: 0\n")
+		t.Errorf("Got position: %v\n", d.Pos())
+	}
+}
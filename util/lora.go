@@ -0,0 +1,170 @@
+package util
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sugarme/gotch/nn"
+	"github.com/sugarme/gotch/ts"
+)
+
+// LoRA:
+// =====
+//
+// Low-rank adaptation (https://arxiv.org/abs/2106.09685) fine-tunes a frozen linear layer of
+// weight W (out dim, in dim) by adding a low-rank update: y = W x + b + Scaling * B A dropout(x),
+// with A of shape (rank, in dim), B of shape (out dim, rank) and Scaling = alpha / rank.
+// B is initialized to zeros so that the adapted layer is equal to the base layer at start.
+//
+// Adapter variables are named "lora_A.weight" and "lora_B.weight" under the path of the adapted
+// linear layer (as PEFT does), so that they can be saved and loaded apart from base weights
+// (`SaveLoRA`, `LoadLoRA`).
+
+// LoRA is a low-rank adapter of a linear layer.
+type LoRA struct {
+	A       *ts.Tensor // (rank, in dim)
+	B       *ts.Tensor // (out dim, rank)
+	Scaling float64    // alpha / rank
+	Dropout *Dropout   // dropout of adapter input
+}
+
+// NewLoRA creates an adapter of a linear layer of `inDim` inputs and `outDim` outputs with
+// variables under path `p` of the linear layer.
+func NewLoRA(p *nn.Path, inDim, outDim, rank int64, alpha, dropout float64) (*LoRA, error) {
+	a, err := p.Sub("lora_A").NewVar("weight", []int64{rank, inDim}, nn.NewKaimingUniformInit())
+	if err != nil {
+		return nil, err
+	}
+	b, err := p.Sub("lora_B").NewVar("weight", []int64{outDim, rank}, nn.NewConstInit(0))
+	if err != nil {
+		return nil, err
+	}
+
+	return &LoRA{
+		A:       a,
+		B:       b,
+		Scaling: alpha / float64(rank),
+		Dropout: NewDropout(dropout),
+	}, nil
+}
+
+// ApplyLoRA forwards `xs` through linear layer `lin` and its adapter `lora` if not nil.
+func ApplyLoRA(lin *nn.Linear, lora *LoRA, xs *ts.Tensor, train bool) *ts.Tensor {
+	if lora == nil {
+		return lin.Forward(xs)
+	}
+
+	s := NewScope()
+	defer s.Close()
+
+	out := s.Track(lin.Forward(xs))
+	dropped := s.Track(xs.ApplyT(lora.Dropout, train))
+	// Adapters may be float32 on float16 or bfloat16 base weights.
+	if dropped.DType() != lora.A.DType() {
+		dropped = s.Track(dropped.MustTotype(lora.A.DType(), false))
+	}
+	down := s.Track(dropped.MustMatmul(s.Track(lora.A.MustT(false)), false))
+	up := s.Track(down.MustMatmul(s.Track(lora.B.MustT(false)), false))
+	update := s.Track(up.MustMulScalar(ts.FloatScalar(lora.Scaling), false))
+	if update.DType() != out.DType() {
+		update = s.Track(update.MustTotype(out.DType(), false))
+	}
+
+	return s.Keep(s.Track(out.MustAdd(update, false)))
+}
+
+// Merge adds the adapter update `Scaling * B A` to weights of `lin`. The adapter must not be
+// used with `lin` afterwards.
+func (l *LoRA) Merge(lin *nn.Linear) {
+	ts.NoGrad(func() {
+		delta := l.B.MustMm(l.A, false).MustMulScalar(ts.FloatScalar(l.Scaling), true)
+		if delta.DType() != lin.Ws.DType() {
+			delta = delta.MustTotype(lin.Ws.DType(), true)
+		}
+		lin.Ws.MustAdd_(delta)
+		delta.MustDrop()
+	})
+}
+
+// Drop frees adapter variables.
+func (l *LoRA) Drop() {
+	l.A.MustDrop()
+	l.B.MustDrop()
+}
+
+// IsLoRAVariable returns whether a variable name is of a LoRA adapter.
+func IsLoRAVariable(name string) bool {
+	return strings.Contains(name, "lora_A.") || strings.Contains(name, "lora_B.")
+}
+
+// SaveLoRA saves LoRA adapter variables of `vs` to file, without base weights.
+func SaveLoRA(vs *nn.VarStore, file string) error {
+	vars := vs.Variables()
+	var names []string
+	for name := range vars {
+		if IsLoRAVariable(name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		err := fmt.Errorf("SaveLoRA() failed: VarStore has no LoRA adapter.")
+		return err
+	}
+	sort.Strings(names)
+
+	namedTensors := make([]ts.NamedTensor, len(names))
+	for i, name := range names {
+		x := vars[name]
+		namedTensors[i] = ts.NamedTensor{Name: name, Tensor: &x}
+	}
+
+	return ts.SaveMultiNew(namedTensors, file)
+}
+
+// LoadLoRA loads LoRA adapter variables of `vs` from a file saved with `SaveLoRA`. Adapters must
+// be added to the model first, with the same targets and rank.
+func LoadLoRA(vs *nn.VarStore, file string) error {
+	namedTensors, err := ts.LoadMultiWithDevice(file, vs.Device())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, x := range namedTensors {
+			x.Tensor.MustDrop()
+		}
+	}()
+
+	loaded := make(map[string]*ts.Tensor, len(namedTensors))
+	for _, x := range namedTensors {
+		loaded[x.Name] = x.Tensor
+	}
+
+	vars := vs.Variables()
+	for name := range loaded {
+		if _, ok := vars[name]; !ok || !IsLoRAVariable(name) {
+			err := fmt.Errorf("LoadLoRA() failed: %q is not a LoRA adapter variable of VarStore.", name)
+			return err
+		}
+	}
+
+	for name, x := range vars {
+		if !IsLoRAVariable(name) {
+			continue
+		}
+		src, ok := loaded[name]
+		if !ok {
+			err := fmt.Errorf("LoadLoRA() failed: cannot find %q in file.", name)
+			return err
+		}
+		if got, want := src.MustSize(), x.MustSize(); fmt.Sprint(got) != fmt.Sprint(want) {
+			err := fmt.Errorf("LoadLoRA() failed: mismatched shape of %q: want %v, got %v.", name, want, got)
+			return err
+		}
+		ts.NoGrad(func() {
+			x.Copy_(src)
+		})
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package util_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/nn"
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/util"
+)
+
+func TestLoRA(t *testing.T) {
+	vs := nn.NewVarStore(gotch.CPU)
+	p := vs.Root().Sub("dense")
+	lin := nn.NewLinear(p, 4, 3, nn.DefaultLinearConfig())
+	lora, err := util.NewLoRA(p, 4, 3, 2, 4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lora.Scaling != 2 {
+		t.Errorf("Want scaling: 2\n")
+		t.Errorf("Got scaling: %v\n", lora.Scaling)
+	}
+
+	xs := ts.MustRandn([]int64{2, 4}, gotch.Float, gotch.CPU)
+	base := lin.Forward(xs)
+
+	// B is initialized to zeros: adapted layer equals base layer.
+	got := util.ApplyLoRA(lin, lora, xs, false)
+	assertClose(t, base, got, 1e-6)
+	got.MustDrop()
+
+	ts.NoGrad(func() {
+		b := ts.MustRandn([]int64{3, 2}, gotch.Float, gotch.CPU)
+		lora.B.Copy_(b)
+		b.MustDrop()
+	})
+
+	// y = W x + b + scaling * B A x
+	delta := xs.MustMatmul(lora.A.MustT(false), false).MustMatmul(lora.B.MustT(false), true).MustMulScalar(ts.FloatScalar(2), true)
+	want := base.MustAdd(delta, false)
+	adapted := util.ApplyLoRA(lin, lora, xs, false)
+	assertClose(t, want, adapted, 1e-5)
+
+	// Adapters are saved and loaded apart from base weights.
+	file := filepath.Join(t.TempDir(), "adapter.gt")
+	if err := util.SaveLoRA(vs, file); err != nil {
+		t.Fatal(err)
+	}
+	ts.NoGrad(func() {
+		lora.B.MustZero_()
+	})
+	if err := util.LoadLoRA(vs, file); err != nil {
+		t.Fatal(err)
+	}
+	loaded := util.ApplyLoRA(lin, lora, xs, false)
+	assertClose(t, adapted, loaded, 1e-6)
+	loaded.MustDrop()
+
+	// Merged linear layer equals adapted layer.
+	lora.Merge(lin)
+	merged := lin.Forward(xs)
+	assertClose(t, adapted, merged, 1e-5)
+	merged.MustDrop()
+
+	for _, x := range []*ts.Tensor{xs, base, delta, want, adapted} {
+		x.MustDrop()
+	}
+}
+
+func TestLoadLoRA_Mismatch(t *testing.T) {
+	vs := nn.NewVarStore(gotch.CPU)
+	p := vs.Root().Sub("dense")
+	if _, err := util.NewLoRA(p, 4, 3, 2, 4, 0); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "adapter.gt")
+	if err := util.SaveLoRA(vs, file); err != nil {
+		t.Fatal(err)
+	}
+
+	// Adapter of another rank.
+	other := nn.NewVarStore(gotch.CPU)
+	if _, err := util.NewLoRA(other.Root().Sub("dense"), 4, 3, 4, 4, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := util.LoadLoRA(other, file); err == nil {
+		t.Errorf("Want error for mismatched adapter rank\n")
+	}
+
+	// No adapter to save.
+	empty := nn.NewVarStore(gotch.CPU)
+	nn.NewLinear(empty.Root(), 4, 3, nn.DefaultLinearConfig())
+	if err := util.SaveLoRA(empty, file); err == nil {
+		t.Errorf("Want error for VarStore without adapter\n")
+	}
+}
@@ -1 +1,492 @@
 package util
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/nn"
+	"github.com/sugarme/gotch/ts"
+)
+
+// Optimization:
+// =============
+//
+// AdamW with decoupled weight decay (https://arxiv.org/abs/1711.05101) as used to pretrain and
+// fine-tune BERT. Parameters are split into groups with their own weight decay, e.g. no weight
+// decay for biases and LayerNorm weights:
+//
+//	groups := util.ParamGroups(vs, 0.01)
+//	opt := util.NewAdamW(groups, 5e-5, util.DefaultAdamWConfig())
+//	scheduler := util.NewLRScheduler(opt, util.LinearSchedule(warmupSteps, totalSteps))
+//	for ... {
+//		loss.MustBackward()
+//		opt.ClipGradNorm(1.0)
+//		opt.Step()
+//		scheduler.Step()
+//		opt.ZeroGrad()
+//	}
+//
+// Fine-tuning may also decay learning rate from top to bottom layers (`LayerwiseParamGroups`) or
+// freeze lower layers (`Freeze`).
+
+// DefaultNoDecay holds name patterns of parameters excluded from weight decay.
+var DefaultNoDecay = []string{"bias", "LayerNorm"}
+
+// ParamGroup is a group of parameters sharing optimizer settings.
+type ParamGroup struct {
+	Names       []string
+	Params      []*ts.Tensor
+	WeightDecay float64
+	LRScale     float64 // multiplier of optimizer learning rate.
+}
+
+// ParamGroups splits trainable variables of `vs` into a group with weight decay `weightDecay`
+// and a group without weight decay. Variables whose name contains one of `noDecay` patterns
+// (`DefaultNoDecay` if none) are not decayed. Empty groups are omitted.
+func ParamGroups(vs *nn.VarStore, weightDecay float64, noDecay ...string) []*ParamGroup {
+	return LayerwiseParamGroups(vs, weightDecay, 1, nil, noDecay...)
+}
+
+// LayerwiseParamGroups splits trainable variables of `vs` as `ParamGroups` does, with layer-wise
+// learning rate decay (LLRD): learning rate decreases from top to bottom layers.
+//
+// Params:
+//   - vs: VarStore of model. Frozen variables are skipped.
+//   - weightDecay: weight decay of decayed groups.
+//   - lrDecay: learning rate multiplier between a layer and the layer above, e.g. 0.9.
+//   - layers: variable path prefixes of layers from bottom to top, e.g. "bert.embeddings",
+//     "bert.encoder.layer.0", ..., "bert.encoder.layer.11" (see `bert.LayerPaths`).
+//   - noDecay: name patterns of variables without weight decay (`DefaultNoDecay` if none).
+//
+// Returns groups ordered from bottom to top layer. Variables of `layers[i]` have learning rate
+// multiplier `lrDecay^(len(layers)-i)`, other variables (e.g. pooler and task head) have
+// multiplier 1. Empty groups are omitted.
+func LayerwiseParamGroups(vs *nn.VarStore, weightDecay, lrDecay float64, layers []string, noDecay ...string) []*ParamGroup {
+	if len(noDecay) == 0 {
+		noDecay = DefaultNoDecay
+	}
+
+	// Groups of layer i are decay[i] and noDecayGroups[i], top groups are the last ones.
+	numLayers := len(layers)
+	decay := make([]*ParamGroup, numLayers+1)
+	noDecayGroups := make([]*ParamGroup, numLayers+1)
+	for i := range decay {
+		lrScale := math.Pow(lrDecay, float64(numLayers-i))
+		decay[i] = &ParamGroup{WeightDecay: weightDecay, LRScale: lrScale}
+		noDecayGroups[i] = &ParamGroup{WeightDecay: 0, LRScale: lrScale}
+	}
+
+	vars := vs.Variables()
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		x := vars[name]
+		if !x.MustRequiresGrad() {
+			continue
+		}
+		layer := numLayers
+		for i, prefix := range layers {
+			if HasPathPrefix(name, prefix) {
+				layer = i
+				break
+			}
+		}
+		group := decay[layer]
+		for _, pattern := range noDecay {
+			if strings.Contains(name, pattern) {
+				group = noDecayGroups[layer]
+				break
+			}
+		}
+		group.Names = append(group.Names, name)
+		group.Params = append(group.Params, &x)
+	}
+
+	var groups []*ParamGroup
+	for i := range decay {
+		for _, group := range []*ParamGroup{decay[i], noDecayGroups[i]} {
+			if len(group.Params) > 0 {
+				groups = append(groups, group)
+			}
+		}
+	}
+
+	return groups
+}
+
+// AdamWConfig holds hyperparameters of AdamW.
+type AdamWConfig struct {
+	Beta1       float64
+	Beta2       float64
+	Eps         float64
+	CorrectBias bool // bias correction of moment estimates. BERT TensorFlow implementation has none.
+}
+
+// DefaultAdamWConfig returns default AdamW hyperparameters.
+func DefaultAdamWConfig() *AdamWConfig {
+	return &AdamWConfig{
+		Beta1:       0.9,
+		Beta2:       0.999,
+		Eps:         1e-8,
+		CorrectBias: true,
+	}
+}
+
+// AdamW is Adam optimizer with decoupled weight decay and per-group settings.
+//
+// Float16 and bfloat16 parameters are updated from float32 master weights and moment estimates,
+// so that small updates are not rounded off.
+type AdamW struct {
+	Groups []*ParamGroup
+	Config *AdamWConfig
+
+	lr        float64
+	stepCount int
+	expAvg    map[*ts.Tensor]*ts.Tensor
+	expAvgSq  map[*ts.Tensor]*ts.Tensor
+	master    map[*ts.Tensor]*ts.Tensor // float32 copies of float16 and bfloat16 parameters.
+}
+
+// NewAdamW creates AdamW optimizer of parameter groups with learning rate `lr`.
+func NewAdamW(groups []*ParamGroup, lr float64, config *AdamWConfig) *AdamW {
+	if config == nil {
+		config = DefaultAdamWConfig()
+	}
+
+	return &AdamW{
+		Groups:   groups,
+		Config:   config,
+		lr:       lr,
+		expAvg:   make(map[*ts.Tensor]*ts.Tensor),
+		expAvgSq: make(map[*ts.Tensor]*ts.Tensor),
+		master:   make(map[*ts.Tensor]*ts.Tensor),
+	}
+}
+
+// LR returns learning rate.
+func (opt *AdamW) LR() float64 {
+	return opt.lr
+}
+
+// SetLR sets learning rate. Learning rate of each group is scaled by its `LRScale`.
+func (opt *AdamW) SetLR(lr float64) {
+	opt.lr = lr
+}
+
+// StepCount returns number of optimization steps.
+func (opt *AdamW) StepCount() int {
+	return opt.stepCount
+}
+
+// Step updates parameters from their gradients. Parameters without gradient are skipped.
+func (opt *AdamW) Step() error {
+	opt.stepCount++
+	c := opt.Config
+	bias1, bias2 := 1.0, 1.0
+	if c.CorrectBias {
+		bias1 = 1 - math.Pow(c.Beta1, float64(opt.stepCount))
+		bias2 = 1 - math.Pow(c.Beta2, float64(opt.stepCount))
+	}
+
+	var err error
+	ts.NoGrad(func() {
+		for _, group := range opt.Groups {
+			lr := opt.lr * group.LRScale
+			for _, p := range group.Params {
+				if err = opt.update(p, lr, group.WeightDecay, bias1, bias2); err != nil {
+					return
+				}
+			}
+		}
+	})
+	if err != nil {
+		err = fmt.Errorf("AdamW.Step() failed: %w", err)
+		return err
+	}
+
+	return nil
+}
+
+func (opt *AdamW) update(p *ts.Tensor, lr, weightDecay, bias1, bias2 float64) error {
+	grad, err := p.Grad(false)
+	if err != nil {
+		return err
+	}
+	defer grad.MustDrop()
+	if !grad.MustDefined() {
+		return nil
+	}
+
+	s := NewScope()
+	defer s.Close()
+
+	// Reduced precision parameters are updated through their float32 master weights.
+	param := p
+	if IsReducedPrecision(p.DType()) {
+		master, ok := opt.master[p]
+		if !ok {
+			master = p.MustTotype(gotch.Float, false)
+			opt.master[p] = master
+		}
+		param = master
+		grad = s.Track(grad.MustTotype(gotch.Float, false))
+	}
+
+	c := opt.Config
+	m, ok := opt.expAvg[p]
+	if !ok {
+		m = param.MustZerosLike(false)
+		opt.expAvg[p] = m
+		opt.expAvgSq[p] = param.MustZerosLike(false)
+	}
+	v := opt.expAvgSq[p]
+
+	// Decoupled weight decay.
+	if weightDecay != 0 {
+		param.MustMulScalar_(ts.FloatScalar(1 - lr*weightDecay))
+	}
+
+	// m = beta1 * m + (1 - beta1) * grad
+	m.MustMulScalar_(ts.FloatScalar(c.Beta1))
+	m.MustAdd_(s.Track(grad.MustMulScalar(ts.FloatScalar(1-c.Beta1), false)))
+
+	// v = beta2 * v + (1 - beta2) * grad^2
+	v.MustMulScalar_(ts.FloatScalar(c.Beta2))
+	v.MustAdd_(s.Track(s.Track(grad.MustMul(grad, false)).MustMulScalar(ts.FloatScalar(1-c.Beta2), false)))
+
+	// p = p - lr / bias1 * m / (sqrt(v / bias2) + eps)
+	denom := s.Track(s.Track(v.MustSqrt(false)).MustDivScalar(ts.FloatScalar(math.Sqrt(bias2)), false))
+	denom.MustAddScalar_(ts.FloatScalar(c.Eps))
+	update := s.Track(s.Track(m.MustDiv(denom, false)).MustMulScalar(ts.FloatScalar(lr/bias1), false))
+	param.MustSub_(update)
+	if param != p {
+		p.Copy_(param)
+	}
+
+	return nil
+}
+
+// ZeroGrad zeroes gradients of all parameters.
+func (opt *AdamW) ZeroGrad() {
+	for _, group := range opt.Groups {
+		for _, p := range group.Params {
+			p.ZeroGrad()
+		}
+	}
+}
+
+// Params returns parameters of all groups.
+func (opt *AdamW) Params() []*ts.Tensor {
+	var params []*ts.Tensor
+	for _, group := range opt.Groups {
+		params = append(params, group.Params...)
+	}
+
+	return params
+}
+
+// ClipGradNorm scales gradients of all parameters so that their total L2 norm is at most
+// `maxNorm`. It returns total norm before clipping.
+func (opt *AdamW) ClipGradNorm(maxNorm float64) float64 {
+	return ClipGradNorm(opt.Params(), maxNorm)
+}
+
+// Drop frees optimizer state (moment estimates and master weights).
+func (opt *AdamW) Drop() {
+	for p, m := range opt.expAvg {
+		m.MustDrop()
+		opt.expAvgSq[p].MustDrop()
+	}
+	for _, master := range opt.master {
+		master.MustDrop()
+	}
+	opt.expAvg = make(map[*ts.Tensor]*ts.Tensor)
+	opt.expAvgSq = make(map[*ts.Tensor]*ts.Tensor)
+	opt.master = make(map[*ts.Tensor]*ts.Tensor)
+}
+
+// ClipGradNorm scales gradients of `params` so that their total L2 norm is at most `maxNorm`.
+// Parameters without gradient are skipped. It returns total norm before clipping.
+func ClipGradNorm(params []*ts.Tensor, maxNorm float64) float64 {
+	var grads []*ts.Tensor
+	for _, x := range params {
+		grad := x.MustGrad(false)
+		if !grad.MustDefined() {
+			grad.MustDrop()
+			continue
+		}
+		grads = append(grads, grad)
+	}
+	defer func() {
+		for _, grad := range grads {
+			grad.MustDrop()
+		}
+	}()
+
+	var sumSquares float64
+	for _, grad := range grads {
+		sum := grad.MustMul(grad, false).MustSum(gotch.Double, true)
+		sumSquares += sum.Float64Values()[0]
+		sum.MustDrop()
+	}
+
+	totalNorm := math.Sqrt(sumSquares)
+	coef := maxNorm / (totalNorm + 1e-6)
+	if coef < 1 {
+		for _, grad := range grads {
+			grad.MustMulScalar_(ts.FloatScalar(coef))
+		}
+	}
+
+	return totalNorm
+}
+
+// Schedule returns learning rate multiplier at a given step.
+type Schedule func(step int) float64
+
+// warmup returns multiplier of linear warmup from 0 to 1.
+func warmup(step, warmupSteps int) float64 {
+	return float64(step) / math.Max(1, float64(warmupSteps))
+}
+
+// ConstantSchedule returns a schedule with linear warmup over `warmupSteps` then
+// constant learning rate.
+func ConstantSchedule(warmupSteps int) Schedule {
+	return func(step int) float64 {
+		if step < warmupSteps {
+			return warmup(step, warmupSteps)
+		}
+		return 1
+	}
+}
+
+// LinearSchedule returns a schedule with linear warmup over `warmupSteps` then linear
+// decay to 0 at `totalSteps`.
+func LinearSchedule(warmupSteps, totalSteps int) Schedule {
+	return func(step int) float64 {
+		if step < warmupSteps {
+			return warmup(step, warmupSteps)
+		}
+		return math.Max(0, float64(totalSteps-step)/math.Max(1, float64(totalSteps-warmupSteps)))
+	}
+}
+
+// CosineSchedule returns a schedule with linear warmup over `warmupSteps` then cosine
+// decay to 0 at `totalSteps`. `numCycles` is the number of waves of the cosine
+// (0.5 to decrease from 1 to 0 following a half-cosine).
+func CosineSchedule(warmupSteps, totalSteps int, numCycles float64) Schedule {
+	return func(step int) float64 {
+		if step < warmupSteps {
+			return warmup(step, warmupSteps)
+		}
+		progress := float64(step-warmupSteps) / math.Max(1, float64(totalSteps-warmupSteps))
+		return math.Max(0, 0.5*(1+math.Cos(math.Pi*numCycles*2*progress)))
+	}
+}
+
+// PolynomialSchedule returns a schedule with linear warmup over `warmupSteps` then
+// polynomial decay of power `power` to `endRatio` (final over peak learning rate) at
+// `totalSteps`. It is constant at `endRatio` afterwards. Power 1 is linear decay.
+func PolynomialSchedule(warmupSteps, totalSteps int, endRatio, power float64) Schedule {
+	return func(step int) float64 {
+		if step < warmupSteps {
+			return warmup(step, warmupSteps)
+		}
+		if step > totalSteps {
+			return endRatio
+		}
+		remaining := 1 - float64(step-warmupSteps)/math.Max(1, float64(totalSteps-warmupSteps))
+		return (1-endRatio)*math.Pow(remaining, power) + endRatio
+	}
+}
+
+// InverseSqrtSchedule returns a schedule with linear warmup over `warmupSteps` then decay
+// proportional to the inverse square root of step. `timescale` defaults to `warmupSteps`
+// (or 10000 without warmup) if 0.
+func InverseSqrtSchedule(warmupSteps, timescale int) Schedule {
+	if timescale == 0 {
+		timescale = warmupSteps
+		if timescale == 0 {
+			timescale = 10000
+		}
+	}
+
+	return func(step int) float64 {
+		if step < warmupSteps {
+			return warmup(step, warmupSteps)
+		}
+		shift := timescale - warmupSteps
+		return 1 / math.Sqrt(float64(step+shift)/float64(timescale))
+	}
+}
+
+// Schedule names of `GetSchedule`.
+const (
+	ScheduleLinear      = "linear"
+	ScheduleCosine      = "cosine"
+	ScheduleConstant    = "constant_with_warmup"
+	SchedulePolynomial  = "polynomial"
+	ScheduleInverseSqrt = "inverse_sqrt"
+)
+
+// GetSchedule returns schedule of given name ("constant" being without warmup) with default settings: half-cosine for
+// "cosine", decay to 0 with power 1 for "polynomial" and timescale `warmupSteps` for
+// "inverse_sqrt".
+func GetSchedule(name string, warmupSteps, totalSteps int) (Schedule, error) {
+	switch name {
+	case ScheduleLinear:
+		return LinearSchedule(warmupSteps, totalSteps), nil
+	case ScheduleCosine:
+		return CosineSchedule(warmupSteps, totalSteps, 0.5), nil
+	case ScheduleConstant:
+		return ConstantSchedule(warmupSteps), nil
+	case "constant":
+		return ConstantSchedule(0), nil
+	case SchedulePolynomial:
+		return PolynomialSchedule(warmupSteps, totalSteps, 0, 1), nil
+	case ScheduleInverseSqrt:
+		return InverseSqrtSchedule(warmupSteps, 0), nil
+	}
+
+	err := fmt.Errorf("Unknown learning rate schedule %q.", name)
+	return nil, err
+}
+
+// LRScheduler sets learning rate of an optimizer to its initial learning rate times
+// a schedule multiplier.
+type LRScheduler struct {
+	opt      *AdamW
+	baseLR   float64
+	schedule Schedule
+	step     int
+}
+
+// NewLRScheduler creates a scheduler of `opt` and sets learning rate of step 0.
+func NewLRScheduler(opt *AdamW, schedule Schedule) *LRScheduler {
+	s := &LRScheduler{
+		opt:      opt,
+		baseLR:   opt.LR(),
+		schedule: schedule,
+	}
+	opt.SetLR(s.baseLR * schedule(0))
+
+	return s
+}
+
+// Step moves to next step and updates learning rate. It is called after each optimizer step.
+func (s *LRScheduler) Step() {
+	s.step++
+	s.opt.SetLR(s.baseLR * s.schedule(s.step))
+}
+
+// LR returns learning rate of current step.
+func (s *LRScheduler) LR() float64 {
+	return s.opt.LR()
+}
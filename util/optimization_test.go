@@ -0,0 +1,248 @@
+package util_test
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/nn"
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/util"
+)
+
+func TestParamGroups(t *testing.T) {
+	vs := nn.NewVarStore(gotch.CPU)
+	nn.NewLinear(vs.Root().Sub("dense"), 4, 4, nn.DefaultLinearConfig())
+	nn.NewLayerNorm(vs.Root().Sub("LayerNorm"), []int64{4}, nn.DefaultLayerNormConfig())
+
+	groups := util.ParamGroups(vs, 0.01)
+	if len(groups) != 2 {
+		t.Fatalf("Want 2 groups, got %v\n", len(groups))
+	}
+
+	wantDecay := []string{"dense.weight"}
+	if !reflect.DeepEqual(wantDecay, groups[0].Names) || groups[0].WeightDecay != 0.01 {
+		t.Errorf("Want decayed group: %v (weight decay 0.01)\n", wantDecay)
+		t.Errorf("Got decayed group: %v (weight decay %v)\n", groups[0].Names, groups[0].WeightDecay)
+	}
+
+	wantNoDecay := []string{"LayerNorm.bias", "LayerNorm.weight", "dense.bias"}
+	if !reflect.DeepEqual(wantNoDecay, groups[1].Names) || groups[1].WeightDecay != 0 {
+		t.Errorf("Want group without decay: %v\n", wantNoDecay)
+		t.Errorf("Got group without decay: %v (weight decay %v)\n", groups[1].Names, groups[1].WeightDecay)
+	}
+}
+
+func TestLayerwiseParamGroups(t *testing.T) {
+	vs := nn.NewVarStore(gotch.CPU)
+	nn.NewLinear(vs.Root().Sub("embeddings"), 4, 4, nn.DefaultLinearConfig())
+	nn.NewLinear(vs.Root().Sub("layer").Sub("0"), 4, 4, nn.DefaultLinearConfig())
+	nn.NewLinear(vs.Root().Sub("classifier"), 4, 2, nn.DefaultLinearConfig())
+	util.Freeze(vs, "embeddings.bias")
+
+	groups := util.LayerwiseParamGroups(vs, 0.01, 0.5, []string{"embeddings", "layer.0"})
+
+	type group struct {
+		names       []string
+		weightDecay float64
+		lrScale     float64
+	}
+	want := []group{
+		{[]string{"embeddings.weight"}, 0.01, 0.25},
+		{[]string{"layer.0.weight"}, 0.01, 0.5},
+		{[]string{"layer.0.bias"}, 0, 0.5},
+		{[]string{"classifier.weight"}, 0.01, 1},
+		{[]string{"classifier.bias"}, 0, 1},
+	}
+	var got []group
+	for _, g := range groups {
+		got = append(got, group{g.Names, g.WeightDecay, g.LRScale})
+	}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Want %v\n", want)
+		t.Errorf("Got %v\n", got)
+	}
+}
+
+func TestAdamW_Step(t *testing.T) {
+	var (
+		lr, wd       = 0.1, 0.1
+		beta1, beta2 = 0.9, 0.999
+		eps          = 1e-8
+	)
+	init := []float64{1.0, -2.0}
+
+	x := ts.MustOfSlice(init).MustSetRequiresGrad(true, true)
+	group := &util.ParamGroup{Params: []*ts.Tensor{x}, WeightDecay: wd, LRScale: 1}
+	opt := util.NewAdamW([]*util.ParamGroup{group}, lr, util.DefaultAdamWConfig())
+
+	want := append([]float64{}, init...)
+	m := make([]float64, len(init))
+	v := make([]float64, len(init))
+	for step := 1; step <= 3; step++ {
+		// loss = sum(x^2), grad = 2x
+		loss := x.MustMul(x, false).MustSum(gotch.Double, true)
+		loss.MustBackward()
+		loss.MustDrop()
+		if err := opt.Step(); err != nil {
+			t.Fatal(err)
+		}
+		opt.ZeroGrad()
+
+		for i := range want {
+			grad := 2 * want[i]
+			want[i] *= 1 - lr*wd
+			m[i] = beta1*m[i] + (1-beta1)*grad
+			v[i] = beta2*v[i] + (1-beta2)*grad*grad
+			mHat := m[i] / (1 - math.Pow(beta1, float64(step)))
+			vHat := v[i] / (1 - math.Pow(beta2, float64(step)))
+			want[i] -= lr * mHat / (math.Sqrt(vHat) + eps)
+		}
+	}
+
+	got := x.Float64Values()
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-6 {
+			t.Errorf("Want x[%v]: %v\n", i, want[i])
+			t.Errorf("Got x[%v]: %v\n", i, got[i])
+		}
+	}
+
+	opt.Drop()
+	x.MustDrop()
+}
+
+// Parameters without weight decay and without gradient are unchanged.
+func TestAdamW_NoDecay(t *testing.T) {
+	decayed := ts.MustOfSlice([]float64{1.0}).MustSetRequiresGrad(true, true)
+	notDecayed := ts.MustOfSlice([]float64{1.0}).MustSetRequiresGrad(true, true)
+	opt := util.NewAdamW([]*util.ParamGroup{
+		{Params: []*ts.Tensor{decayed}, WeightDecay: 0.5, LRScale: 1},
+		{Params: []*ts.Tensor{notDecayed}, WeightDecay: 0, LRScale: 1},
+	}, 0.1, nil)
+
+	// Zero gradients: only weight decay moves parameters.
+	loss := decayed.MustAdd(notDecayed, false).MustMulScalar(ts.FloatScalar(0), true).MustSum(gotch.Double, true)
+	loss.MustBackward()
+	loss.MustDrop()
+	if err := opt.Step(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := decayed.Float64Values()[0]; math.Abs(got-0.95) > 1e-9 {
+		t.Errorf("Want decayed parameter: 0.95\n")
+		t.Errorf("Got decayed parameter: %v\n", got)
+	}
+	if got := notDecayed.Float64Values()[0]; got != 1.0 {
+		t.Errorf("Want parameter without decay: 1.0\n")
+		t.Errorf("Got parameter without decay: %v\n", got)
+	}
+
+	opt.Drop()
+	decayed.MustDrop()
+	notDecayed.MustDrop()
+}
+
+// Updates smaller than bfloat16 resolution (2^-7 near 1) accumulate in float32 master weights.
+func TestAdamW_MasterWeights(t *testing.T) {
+	x := ts.MustOfSlice([]float32{1.0}).MustTotype(gotch.BFloat16, true).MustSetRequiresGrad(true, true)
+	group := &util.ParamGroup{Params: []*ts.Tensor{x}, LRScale: 1}
+	opt := util.NewAdamW([]*util.ParamGroup{group}, 1e-3, nil)
+
+	// loss = sum(x), grad = 1: each step decreases x by lr.
+	for step := 0; step < 10; step++ {
+		loss := x.MustSum(gotch.Float, false)
+		loss.MustBackward()
+		loss.MustDrop()
+		if err := opt.Step(); err != nil {
+			t.Fatal(err)
+		}
+		opt.ZeroGrad()
+	}
+
+	if got := x.DType(); got != gotch.BFloat16 {
+		t.Errorf("Want parameter dtype: %v\n", gotch.BFloat16)
+		t.Errorf("Got parameter dtype: %v\n", got)
+	}
+	xFloat := x.MustTotype(gotch.Float, false)
+	if got := xFloat.Float64Values()[0]; math.Abs(got-0.99) > 5e-3 {
+		t.Errorf("Want parameter: 0.99 (bfloat16)\n")
+		t.Errorf("Got parameter: %v\n", got)
+	}
+	xFloat.MustDrop()
+
+	opt.Drop()
+	x.MustDrop()
+}
+
+func TestClipGradNorm(t *testing.T) {
+	x := ts.MustOfSlice([]float64{3.0, 4.0}).MustSetRequiresGrad(true, true)
+	// grad = x, norm 5
+	loss := x.MustMul(x, false).MustSum(gotch.Double, true).MustDivScalar(ts.FloatScalar(2), true)
+	loss.MustBackward()
+	loss.MustDrop()
+
+	norm := util.ClipGradNorm([]*ts.Tensor{x}, 1.0)
+	if math.Abs(norm-5) > 1e-9 {
+		t.Errorf("Want total norm: 5\n")
+		t.Errorf("Got total norm: %v\n", norm)
+	}
+
+	grad := x.MustGrad(false)
+	got := grad.Float64Values()
+	want := []float64{0.6, 0.8}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-6 {
+			t.Errorf("Want clipped grad[%v]: %v\n", i, want[i])
+			t.Errorf("Got clipped grad[%v]: %v\n", i, got[i])
+		}
+	}
+
+	grad.MustDrop()
+	x.MustDrop()
+}
+
+func TestSchedules(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule util.Schedule
+		steps    []int
+		want     []float64
+	}{
+		{"constant", util.ConstantSchedule(4), []int{0, 2, 4, 100}, []float64{0, 0.5, 1, 1}},
+		{"linear", util.LinearSchedule(4, 14), []int{0, 2, 4, 9, 14, 20}, []float64{0, 0.5, 1, 0.5, 0, 0}},
+		{"cosine", util.CosineSchedule(4, 14, 0.5), []int{2, 4, 9, 14}, []float64{0.5, 1, 0.5, 0}},
+		{"polynomial", util.PolynomialSchedule(4, 14, 0.1, 2), []int{2, 4, 9, 14, 20}, []float64{0.5, 1, 0.325, 0.1, 0.1}},
+		{"inverse_sqrt", util.InverseSqrtSchedule(4, 0), []int{2, 4, 16}, []float64{0.5, 1, 0.5}},
+	}
+
+	for _, tt := range tests {
+		for i, step := range tt.steps {
+			got := tt.schedule(step)
+			if math.Abs(got-tt.want[i]) > 1e-9 {
+				t.Errorf("%v - want multiplier at step %v: %v\n", tt.name, step, tt.want[i])
+				t.Errorf("%v - got multiplier at step %v: %v\n", tt.name, step, got)
+			}
+		}
+	}
+
+	if _, err := util.GetSchedule("unknown", 0, 10); err == nil {
+		t.Errorf("Want error for unknown schedule\n")
+	}
+}
+
+func TestLRScheduler(t *testing.T) {
+	opt := util.NewAdamW(nil, 1e-3, nil)
+	scheduler := util.NewLRScheduler(opt, util.LinearSchedule(2, 4))
+
+	want := []float64{0, 5e-4, 1e-3, 5e-4, 0}
+	for i, lr := range want {
+		if math.Abs(scheduler.LR()-lr) > 1e-12 {
+			t.Errorf("Want learning rate at step %v: %v\n", i, lr)
+			t.Errorf("Got learning rate at step %v: %v\n", i, scheduler.LR())
+		}
+		scheduler.Step()
+	}
+}
@@ -0,0 +1,240 @@
+package util
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/nn"
+	"github.com/sugarme/gotch/ts"
+)
+
+// Reduced precision:
+// ==================
+//
+// Models run in float32 by default. They can run in float16 or bfloat16 to halve memory, e.g.
+// bfloat16 on CPU for large batch jobs. Numerically sensitive operations still run in float32:
+//   - LayerNorm parameters are float32 (`NewLayerNorm`) and normalization is computed in float32
+//     (`ApplyLayerNorm`).
+//   - softmax is computed in float32 (`Softmax`).
+//   - task losses are computed in float32.
+//
+// The recommended way to get a reduced precision model is to load it in float32, then convert
+// its variables with `ConvertVarStore`, which builds the model again in the target dtype:
+//
+//	var model *bert.BertForSequenceClassification
+//	vs16, err := util.ConvertVarStore(vs, gotch.BFloat16, func(p *nn.Path) error {
+//		model = bert.NewBertForSequenceClassification(p, config)
+//		return nil
+//	})
+//
+// Models can also be built directly in the target dtype with `WithDType` (e.g. by `Load` with
+// `DType` of config). Variables are created in `gotch.DefaultDType`, which gotch only has as a
+// global variable: `WithDType` and `ConvertVarStore` set it for the duration of the build, so no
+// other model may be built concurrently (see `WithDType`). Running built models concurrently is fine.
+//
+// Training in float16 needs loss scaling (`GradScaler`) so that small gradients do not underflow.
+// `AdamW` keeps float32 master weights of float16 and bfloat16 parameters.
+
+// DType names of `ParseDType`.
+const (
+	DTypeFloat32  = "float32"
+	DTypeFloat16  = "float16"
+	DTypeBFloat16 = "bfloat16"
+)
+
+// ParseDType returns dtype of a name: "float32" (or empty), "float16" or "bfloat16".
+func ParseDType(name string) (gotch.DType, error) {
+	switch name {
+	case "", DTypeFloat32:
+		return gotch.Float, nil
+	case DTypeFloat16:
+		return gotch.Half, nil
+	case DTypeBFloat16:
+		return gotch.BFloat16, nil
+	}
+
+	err := fmt.Errorf("Unsupported dtype %q: must be %q, %q or %q.", name, DTypeFloat32, DTypeFloat16, DTypeBFloat16)
+	return gotch.Float, err
+}
+
+// IsReducedPrecision returns whether dtype is float16 or bfloat16.
+func IsReducedPrecision(dtype gotch.DType) bool {
+	return dtype == gotch.Half || dtype == gotch.BFloat16
+}
+
+// WithDType runs `build` with `gotch.DefaultDType` set to `dtype`, so that variables created by
+// `build` (e.g. model constructors) are of `dtype`. `gotch.DefaultDType` is restored when `build`
+// returns or panics. Prefer `ConvertVarStore` to convert a loaded model.
+//
+// NOTE. `gotch.DefaultDType` is a global variable: `WithDType` must not run concurrently with
+// other `WithDType` or `ConvertVarStore` calls, nor with any code creating variables (e.g. model
+// constructors and `Load`) in other goroutines, which would create variables of the wrong dtype
+// and could restore the wrong default dtype.
+func WithDType(dtype gotch.DType, build func()) {
+	previous := gotch.DefaultDType
+	gotch.DefaultDType = dtype
+	defer func() {
+		gotch.DefaultDType = previous
+	}()
+
+	build()
+}
+
+// ConvertVarStore converts variables of `vs` (e.g. a loaded model) to `dtype`. It is the primary
+// way to run models in float16 or bfloat16.
+//
+// Variables are not converted in place because modules hold their tensors: `build` creates the
+// model again on given path of a new VarStore, variables being created in `dtype` (float32 for
+// LayerNorm), then variable values of `vs` are copied and cast.
+//
+// It returns the new VarStore on device of `vs`. `vs` is unchanged.
+//
+// NOTE. `build` runs within `WithDType`: models must not be built concurrently.
+func ConvertVarStore(vs *nn.VarStore, dtype gotch.DType, build func(p *nn.Path) error) (*nn.VarStore, error) {
+	converted := nn.NewVarStore(vs.Device())
+
+	var err error
+	WithDType(dtype, func() {
+		err = build(converted.Root())
+	})
+	if err != nil {
+		err = fmt.Errorf("ConvertVarStore() failed: %w", err)
+		return nil, err
+	}
+
+	if err := converted.Copy(vs); err != nil {
+		err = fmt.Errorf("ConvertVarStore() failed: %w", err)
+		return nil, err
+	}
+
+	return converted, nil
+}
+
+// NewLayerNorm creates a LayerNorm with float32 parameters whatever `gotch.DefaultDType`.
+func NewLayerNorm(p *nn.Path, normalizedShape []int64, config *nn.LayerNormConfig) *nn.LayerNorm {
+	var ln *nn.LayerNorm
+	WithDType(gotch.Float, func() {
+		ln = nn.NewLayerNorm(p, normalizedShape, config)
+	})
+
+	return ln
+}
+
+// ApplyLayerNorm applies LayerNorm `ln` to `xs`. Float16 and bfloat16 inputs are normalized in
+// float32 and the output is cast back to dtype of `xs`.
+func ApplyLayerNorm(ln *nn.LayerNorm, xs *ts.Tensor) *ts.Tensor {
+	dtype := xs.DType()
+	if !IsReducedPrecision(dtype) {
+		return ln.Forward(xs)
+	}
+
+	xsFloat := xs.MustTotype(gotch.Float, false)
+	normalized := ln.Forward(xsFloat)
+	xsFloat.MustDrop()
+
+	return normalized.MustTotype(dtype, true)
+}
+
+// Softmax computes softmax of `xs` along `dim` in float32. Output of float16 and bfloat16
+// inputs is cast back to dtype of `xs`, output is float32 otherwise.
+func Softmax(xs *ts.Tensor, dim int64) *ts.Tensor {
+	probs := xs.MustSoftmax(dim, gotch.Float, false)
+	if !IsReducedPrecision(xs.DType()) {
+		return probs
+	}
+
+	return probs.MustTotype(xs.DType(), true)
+}
+
+// GradScaler scales loss of float16 training so that small gradients do not underflow, as
+// PyTorch `GradScaler` does. Scale is decreased when gradients overflow (inf or NaN) and increased
+// after `GrowthInterval` steps without overflow.
+//
+// Example:
+//
+//	scaler := util.NewGradScaler()
+//	scaled := scaler.Scale(loss)
+//	scaled.MustBackward()
+//	if scaler.Unscale(params) {
+//		opt.Step()
+//	}
+//	scaler.Update()
+//	opt.ZeroGrad()
+type GradScaler struct {
+	GrowthFactor   float64 // scale multiplier after `GrowthInterval` steps without overflow.
+	BackoffFactor  float64 // scale multiplier after an overflow.
+	GrowthInterval int
+
+	scale      float64
+	goodSteps  int
+	foundInf   bool
+	numSkipped int
+}
+
+// NewGradScaler creates a GradScaler with PyTorch default settings: initial scale 2^16,
+// growth factor 2, backoff factor 0.5 and growth interval 2000.
+func NewGradScaler() *GradScaler {
+	return &GradScaler{
+		GrowthFactor:   2,
+		BackoffFactor:  0.5,
+		GrowthInterval: 2000,
+		scale:          65536,
+	}
+}
+
+// LossScale returns current scale.
+func (gs *GradScaler) LossScale() float64 {
+	return gs.scale
+}
+
+// SkippedSteps returns number of steps skipped because of overflow.
+func (gs *GradScaler) SkippedSteps() int {
+	return gs.numSkipped
+}
+
+// Scale returns loss multiplied by current scale.
+func (gs *GradScaler) Scale(loss *ts.Tensor) *ts.Tensor {
+	return loss.MustMulScalar(ts.FloatScalar(gs.scale), false)
+}
+
+// Unscale divides gradients of `params` by current scale in place. It returns whether all
+// gradients are finite, i.e. whether optimizer step can be taken.
+func (gs *GradScaler) Unscale(params []*ts.Tensor) bool {
+	gs.foundInf = false
+	ts.NoGrad(func() {
+		for _, p := range params {
+			grad := p.MustGrad(false)
+			if !grad.MustDefined() {
+				grad.MustDrop()
+				continue
+			}
+			grad.MustMulScalar_(ts.FloatScalar(1 / gs.scale))
+			finite := grad.MustIsfinite(false).MustAll(true)
+			if finite.Int64Values()[0] == 0 {
+				gs.foundInf = true
+			}
+			finite.MustDrop()
+			grad.MustDrop()
+		}
+	})
+
+	return !gs.foundInf
+}
+
+// Update updates scale after an optimizer step (taken or skipped) from result of last `Unscale`.
+func (gs *GradScaler) Update() {
+	if gs.foundInf {
+		gs.scale = math.Max(gs.scale*gs.BackoffFactor, math.SmallestNonzeroFloat32)
+		gs.goodSteps = 0
+		gs.numSkipped++
+		gs.foundInf = false
+		return
+	}
+
+	gs.goodSteps++
+	if gs.goodSteps >= gs.GrowthInterval {
+		gs.scale *= gs.GrowthFactor
+		gs.goodSteps = 0
+	}
+}
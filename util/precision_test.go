@@ -0,0 +1,217 @@
+package util_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/nn"
+	"github.com/sugarme/gotch/ts"
+
+	"github.com/yinziyang/transformer/util"
+)
+
+func TestParseDType(t *testing.T) {
+	tests := []struct {
+		name string
+		want gotch.DType
+	}{
+		{"", gotch.Float},
+		{"float32", gotch.Float},
+		{"float16", gotch.Half},
+		{"bfloat16", gotch.BFloat16},
+	}
+	for _, tt := range tests {
+		got, err := util.ParseDType(tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("Want dtype of %q: %v\n", tt.name, tt.want)
+			t.Errorf("Got dtype of %q: %v\n", tt.name, got)
+		}
+	}
+
+	if _, err := util.ParseDType("int8"); err == nil {
+		t.Errorf("Want error for unsupported dtype\n")
+	}
+}
+
+func TestWithDType(t *testing.T) {
+	var got gotch.DType
+	util.WithDType(gotch.BFloat16, func() {
+		got = gotch.DefaultDType
+	})
+	if got != gotch.BFloat16 {
+		t.Errorf("Want default dtype in build: %v\n", gotch.BFloat16)
+		t.Errorf("Got default dtype in build: %v\n", got)
+	}
+	if gotch.DefaultDType != gotch.Float {
+		t.Errorf("Want default dtype restored: %v\n", gotch.Float)
+		t.Errorf("Got default dtype: %v\n", gotch.DefaultDType)
+	}
+
+	// Default dtype is restored if build panics.
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Want panic of build to propagate\n")
+			}
+		}()
+		util.WithDType(gotch.Half, func() {
+			panic("build failed")
+		})
+	}()
+	if gotch.DefaultDType != gotch.Float {
+		t.Errorf("Want default dtype restored after panic: %v\n", gotch.Float)
+		t.Errorf("Got default dtype: %v\n", gotch.DefaultDType)
+	}
+}
+
+func TestConvertVarStore(t *testing.T) {
+	build := func(p *nn.Path) error {
+		nn.NewLinear(p.Sub("dense"), 4, 4, nn.DefaultLinearConfig())
+		util.NewLayerNorm(p.Sub("LayerNorm"), []int64{4}, nn.DefaultLayerNormConfig())
+		return nil
+	}
+
+	vs := nn.NewVarStore(gotch.CPU)
+	if err := build(vs.Root()); err != nil {
+		t.Fatal(err)
+	}
+
+	converted, err := util.ConvertVarStore(vs, gotch.BFloat16, build)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotch.DefaultDType != gotch.Float {
+		t.Errorf("Want default dtype restored: %v\n", gotch.Float)
+		t.Errorf("Got default dtype: %v\n", gotch.DefaultDType)
+	}
+
+	src := vs.Variables()
+	for name, x := range converted.Variables() {
+		want := gotch.BFloat16
+		if name == "LayerNorm.weight" || name == "LayerNorm.bias" {
+			want = gotch.Float
+		}
+		if got := x.DType(); got != want {
+			t.Errorf("Want %v dtype: %v\n", name, want)
+			t.Errorf("Got %v dtype: %v\n", name, got)
+		}
+
+		// Values are copied and rounded to bfloat16 (8 bits of mantissa).
+		srcX := src[name]
+		xFloat := x.MustTotype(gotch.Float, false)
+		wantValues, gotValues := srcX.Float64Values(), xFloat.Float64Values()
+		xFloat.MustDrop()
+		for i := range wantValues {
+			if math.Abs(gotValues[i]-wantValues[i]) > 1e-2*math.Abs(wantValues[i]) {
+				t.Errorf("Want %v values: %v\n", name, wantValues)
+				t.Errorf("Got %v values: %v\n", name, gotValues)
+				break
+			}
+		}
+	}
+}
+
+func TestApplyLayerNormAndSoftmax(t *testing.T) {
+	vs := nn.NewVarStore(gotch.CPU)
+	ln := util.NewLayerNorm(vs.Root(), []int64{3}, nn.DefaultLayerNormConfig())
+
+	xs := ts.MustOfSlice([]float32{1, 2, 3, 300, 100, 200}).MustView([]int64{2, 3}, true)
+	xs16 := xs.MustTotype(gotch.Half, false)
+
+	want := ln.Forward(xs)
+	got := util.ApplyLayerNorm(ln, xs16)
+	if got.DType() != gotch.Half {
+		t.Errorf("Want LayerNorm output dtype: %v\n", gotch.Half)
+		t.Errorf("Got LayerNorm output dtype: %v\n", got.DType())
+	}
+	assertClose(t, want, got, 1e-2)
+	want.MustDrop()
+	got.MustDrop()
+
+	// Exponentials of float16 scores would overflow.
+	want = xs.MustSoftmax(-1, gotch.Float, false)
+	got = util.Softmax(xs16, -1)
+	if got.DType() != gotch.Half {
+		t.Errorf("Want softmax output dtype: %v\n", gotch.Half)
+		t.Errorf("Got softmax output dtype: %v\n", got.DType())
+	}
+	assertClose(t, want, got, 1e-3)
+	want.MustDrop()
+	got.MustDrop()
+
+	xs.MustDrop()
+	xs16.MustDrop()
+}
+
+func assertClose(t *testing.T, want, got *ts.Tensor, tolerance float64) {
+	gotFloat := got.MustTotype(gotch.Float, false)
+	defer gotFloat.MustDrop()
+
+	wantValues, gotValues := want.Float64Values(), gotFloat.Float64Values()
+	for i := range wantValues {
+		if math.IsNaN(gotValues[i]) || math.Abs(gotValues[i]-wantValues[i]) > tolerance {
+			t.Errorf("Want: %v\n", wantValues)
+			t.Errorf("Got: %v\n", gotValues)
+			return
+		}
+	}
+}
+
+func TestGradScaler(t *testing.T) {
+	scaler := util.NewGradScaler()
+	scaler.GrowthInterval = 2
+	initScale := scaler.LossScale()
+
+	x := ts.MustOfSlice([]float32{1, -2}).MustSetRequiresGrad(true, true)
+	params := []*ts.Tensor{x}
+
+	// loss = sum(3x), grad = 3
+	step := func(coef float64) bool {
+		loss := x.MustMulScalar(ts.FloatScalar(coef), false).MustSum(gotch.Float, true)
+		scaled := scaler.Scale(loss)
+		scaled.MustBackward()
+		scaled.MustDrop()
+		loss.MustDrop()
+		finite := scaler.Unscale(params)
+		scaler.Update()
+		return finite
+	}
+
+	if !step(3) {
+		t.Fatalf("Want finite gradients\n")
+	}
+	grad := x.MustGrad(false)
+	if got := grad.Float64Values(); got[0] != 3 || got[1] != 3 {
+		t.Errorf("Want unscaled gradients: [3 3]\n")
+		t.Errorf("Got unscaled gradients: %v\n", got)
+	}
+	grad.MustDrop()
+	x.ZeroGrad()
+
+	// Second step without overflow doubles scale.
+	step(3)
+	x.ZeroGrad()
+	if got := scaler.LossScale(); got != 2*initScale {
+		t.Errorf("Want scale: %v\n", 2*initScale)
+		t.Errorf("Got scale: %v\n", got)
+	}
+
+	// Overflow halves scale and the step is skipped.
+	if step(math.Inf(1)) {
+		t.Errorf("Want overflowed gradients\n")
+	}
+	x.ZeroGrad()
+	if got := scaler.LossScale(); got != initScale {
+		t.Errorf("Want scale: %v\n", initScale)
+		t.Errorf("Got scale: %v\n", got)
+	}
+	if got := scaler.SkippedSteps(); got != 1 {
+		t.Errorf("Want 1 skipped step, got %v\n", got)
+	}
+
+	x.MustDrop()
+}
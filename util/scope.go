@@ -0,0 +1,79 @@
+package util
+
+import (
+	"github.com/sugarme/gotch/ts"
+)
+
+// Scope is an arena of tensors created during a computation, e.g. a forward pass.
+//
+// Every intermediate tensor is recorded with `Track` and returned outputs are marked
+// with `Keep`. `Close` then frees all recorded tensors except the kept ones, so that
+// no intermediate is leaked whichever path the computation takes.
+//
+// Example:
+//
+//	s := util.NewScope()
+//	defer s.Close()
+//
+//	x := s.Track(input.Apply(linear))
+//	y := s.Track(x.MustRelu(false))
+//
+//	return s.Keep(y)
+//
+// NOTE. Tensors dropped before `Close` (e.g. consumed with `del=true`) are skipped,
+// hence a tensor can safely be both tracked and consumed.
+type Scope struct {
+	tensors []*ts.Tensor
+	kept    map[*ts.Tensor]bool
+}
+
+// NewScope creates a new empty Scope.
+func NewScope() *Scope {
+	return &Scope{kept: make(map[*ts.Tensor]bool)}
+}
+
+// Track records tensor `x` to be freed on `Close` and returns it.
+// Nil and `ts.None` tensors are ignored.
+func (s *Scope) Track(x *ts.Tensor) *ts.Tensor {
+	if x == nil || x == ts.None {
+		return x
+	}
+	s.tensors = append(s.tensors, x)
+
+	return x
+}
+
+// TrackAll records all tensors in `xs`.
+func (s *Scope) TrackAll(xs ...*ts.Tensor) {
+	for _, x := range xs {
+		s.Track(x)
+	}
+}
+
+// Keep marks tensor `x` as an output which is not freed on `Close` and returns it.
+func (s *Scope) Keep(x *ts.Tensor) *ts.Tensor {
+	if x != nil {
+		s.kept[x] = true
+	}
+
+	return x
+}
+
+// Close frees all tracked tensors which are not kept. Scope is empty afterward
+// and can be reused.
+func (s *Scope) Close() {
+	for _, x := range s.tensors {
+		if !s.kept[x] {
+			x.MustDrop()
+		}
+	}
+	s.tensors = nil
+	s.kept = make(map[*ts.Tensor]bool)
+}
+
+// NumLiveTensors returns number of tensors which have been created and not freed yet.
+// It can be used to check for memory leaks, e.g. it should stay constant across
+// repeated forward passes once outputs are dropped.
+func NumLiveTensors() int {
+	return len(ts.ExistingTensors)
+}
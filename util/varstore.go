@@ -0,0 +1,65 @@
+package util
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/sugarme/gotch/nn"
+)
+
+// Variable selection:
+// ===================
+//
+// Variables of a VarStore are selected by path prefix, e.g. "bert.embeddings" or
+// "bert.encoder.layer.0". A prefix matches whole path components: "bert.encoder.layer.1"
+// matches "bert.encoder.layer.1.output.dense.weight" but not "bert.encoder.layer.10...".
+
+// HasPathPrefix returns whether variable `name` is under path `prefix`.
+func HasPathPrefix(name, prefix string) bool {
+	return prefix == "" || name == prefix || strings.HasPrefix(name, prefix+".")
+}
+
+// SelectVariables returns sorted names of variables of `vs` under one of path `prefixes`.
+func SelectVariables(vs *nn.VarStore, prefixes ...string) []string {
+	var names []string
+	for name := range vs.Variables() {
+		for _, prefix := range prefixes {
+			if HasPathPrefix(name, prefix) {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// SetRequiresGrad sets whether gradients of variables of `vs` under one of path `prefixes` are
+// tracked. It returns sorted names of selected variables.
+func SetRequiresGrad(vs *nn.VarStore, requiresGrad bool, prefixes ...string) []string {
+	names := SelectVariables(vs, prefixes...)
+	vars := vs.Variables()
+	for _, name := range names {
+		x := vars[name]
+		x.MustRequiresGrad_(requiresGrad)
+	}
+
+	return names
+}
+
+// Freeze freezes variables of `vs` under one of path `prefixes`: they are not trained anymore,
+// e.g. `ParamGroups` skips them. It returns sorted names of frozen variables.
+//
+// Example: freezing embeddings and the 4 lower encoder layers of BERT.
+//
+//	util.Freeze(vs, bert.LayerPaths(model)[:5]...)
+func Freeze(vs *nn.VarStore, prefixes ...string) []string {
+	return SetRequiresGrad(vs, false, prefixes...)
+}
+
+// Unfreeze makes variables of `vs` under one of path `prefixes` trainable again. It returns
+// sorted names of unfrozen variables.
+func Unfreeze(vs *nn.VarStore, prefixes ...string) []string {
+	return SetRequiresGrad(vs, true, prefixes...)
+}
@@ -0,0 +1,43 @@
+package util_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sugarme/gotch"
+	"github.com/sugarme/gotch/nn"
+
+	"github.com/yinziyang/transformer/util"
+)
+
+func TestSelectVariables(t *testing.T) {
+	vs := nn.NewVarStore(gotch.CPU)
+	nn.NewLinear(vs.Root().Sub("layer").Sub("1"), 2, 2, nn.DefaultLinearConfig())
+	nn.NewLinear(vs.Root().Sub("layer").Sub("10"), 2, 2, nn.DefaultLinearConfig())
+	nn.NewLinear(vs.Root().Sub("head"), 2, 2, nn.DefaultLinearConfig())
+
+	want := []string{"head.weight", "layer.1.bias", "layer.1.weight"}
+	got := util.SelectVariables(vs, "layer.1", "head.weight")
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("Want %v\n", want)
+		t.Errorf("Got %v\n", got)
+	}
+
+	frozen := util.Freeze(vs, "layer")
+	if len(frozen) != 4 {
+		t.Errorf("Want 4 frozen variables, got %v\n", len(frozen))
+	}
+	vars := vs.Variables()
+	for name, x := range vars {
+		want := name == "head.weight" || name == "head.bias"
+		if got := x.MustRequiresGrad(); got != want {
+			t.Errorf("Want %q requires grad %v, got %v\n", name, want, got)
+		}
+	}
+
+	util.Unfreeze(vs, "layer.10")
+	x := vars["layer.10.weight"]
+	if !x.MustRequiresGrad() {
+		t.Errorf("Want unfrozen \"layer.10.weight\" to require grad\n")
+	}
+}
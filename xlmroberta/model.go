@@ -0,0 +1,52 @@
+package xlmroberta
+
+import (
+	"github.com/sugarme/gotch/nn"
+
+	"github.com/yinziyang/transformer/bert"
+	"github.com/yinziyang/transformer/roberta"
+)
+
+// XLM-RoBERTa shares Roberta architecture and weight names (`roberta.*`),
+// only its vocab differs. Models are therefore Roberta models built from
+// a `BertConfig` loaded from XLM-RoBERTa config file.
+
+// XLMRobertaForMaskedLM is XLM-RoBERTa model with a masked language model head.
+type XLMRobertaForMaskedLM = roberta.RobertaForMaskedLM
+
+// XLMRobertaForSequenceClassification is XLM-RoBERTa model for sentence or document-level classification.
+type XLMRobertaForSequenceClassification = roberta.RobertaForSequenceClassification
+
+// XLMRobertaForMultipleChoice is XLM-RoBERTa model for multiple choices.
+type XLMRobertaForMultipleChoice = roberta.RobertaForMultipleChoice
+
+// XLMRobertaForTokenClassification is XLM-RoBERTa model for token classification (e.g. NER).
+type XLMRobertaForTokenClassification = roberta.RobertaForTokenClassification
+
+// XLMRobertaForQuestionAnswering is XLM-RoBERTa model for extractive question answering.
+type XLMRobertaForQuestionAnswering = roberta.RobertaForQuestionAnswering
+
+// NewXLMRobertaForMaskedLM creates a new XLMRobertaForMaskedLM.
+func NewXLMRobertaForMaskedLM(p *nn.Path, config *bert.BertConfig) (*XLMRobertaForMaskedLM, error) {
+	return roberta.NewRobertaForMaskedLM(p, config)
+}
+
+// NewXLMRobertaForSequenceClassification creates a new XLMRobertaForSequenceClassification.
+func NewXLMRobertaForSequenceClassification(p *nn.Path, config *bert.BertConfig) *XLMRobertaForSequenceClassification {
+	return roberta.NewRobertaForSequenceClassification(p, config)
+}
+
+// NewXLMRobertaForMultipleChoice creates a new XLMRobertaForMultipleChoice.
+func NewXLMRobertaForMultipleChoice(p *nn.Path, config *bert.BertConfig) *XLMRobertaForMultipleChoice {
+	return roberta.NewRobertaForMultipleChoice(p, config)
+}
+
+// NewXLMRobertaForTokenClassification creates a new XLMRobertaForTokenClassification.
+func NewXLMRobertaForTokenClassification(p *nn.Path, config *bert.BertConfig) *XLMRobertaForTokenClassification {
+	return roberta.NewRobertaForTokenClassification(p, config)
+}
+
+// NewXLMRobertaForQuestionAnswering creates a new XLMRobertaForQuestionAnswering.
+func NewXLMRobertaForQuestionAnswering(p *nn.Path, config *bert.BertConfig) *XLMRobertaForQuestionAnswering {
+	return roberta.NewRobertaForQuestionAnswering(p, config)
+}
@@ -0,0 +1,125 @@
+package xlmroberta
+
+// xlmroberta package implements XLM-RoBERTa tokenizer and models.
+
+import (
+	"fmt"
+
+	"github.com/sugarme/tokenizer"
+	"github.com/sugarme/tokenizer/normalizer"
+	"github.com/sugarme/tokenizer/pretokenizer"
+	"github.com/sugarme/tokenizer/processor"
+	"github.com/sugarme/tokenizer/spm"
+
+	"github.com/yinziyang/transformer/sentencepiece"
+	"github.com/yinziyang/transformer/util"
+)
+
+// FairseqOffset is the offset between SentencePiece ids and XLM-R (fairseq) ids.
+//
+// Fairseq reserves ids 0-3 for `<s>`, `<pad>`, `</s>` and `<unk>` while SentencePiece
+// model has `<unk>`, `<s>`, `</s>` at ids 0-2. Hence, a SentencePiece id `i` (i >= 3)
+// becomes `i + FairseqOffset` and `<mask>` is appended at the end of vocab.
+const FairseqOffset int = 1
+
+// Tokenizer holds data for XLM-RoBERTa tokenizer.
+type Tokenizer struct {
+	*tokenizer.Tokenizer
+}
+
+// NewTokenizer creates a new XLM-RoBERTa tokenizer.
+func NewTokenizer() *Tokenizer {
+	tk := tokenizer.NewTokenizer(nil)
+	return &Tokenizer{tk}
+}
+
+// Load loads XLM-RoBERTa tokenizer from pretrained SentencePiece model file (`sentencepiece.bpe.model`).
+//
+// This method implements `pretrained.Tokenizer` interface.
+func (t *Tokenizer) Load(modelNameOrPath string, params map[string]interface{}) error {
+	modelFile, err := util.CachedPath(modelNameOrPath, "sentencepiece.bpe.model")
+	if err != nil {
+		return err
+	}
+
+	spModel, err := sentencepiece.ModelFromFile(modelFile)
+	if err != nil {
+		return err
+	}
+
+	model, err := NewUnigramFromSentencePiece(spModel)
+	if err != nil {
+		return err
+	}
+	t.WithModel(model)
+
+	var normalizers []normalizer.Normalizer
+	if len(spModel.PrecompiledCharsmap) > 0 {
+		precompiled, err := spm.NewPrecompiledFrom(spModel.PrecompiledCharsmap)
+		if err != nil {
+			return err
+		}
+		normalizers = append(normalizers, &normalizer.Precompiled{Precompiled: precompiled})
+	}
+	normalizers = append(normalizers, normalizer.NewReplace(normalizer.Regex, " {2,}", " "))
+	t.WithNormalizer(normalizer.NewSequence(normalizers))
+
+	metaspace := pretokenizer.NewMetaspace("▁", true)
+	t.WithPreTokenizer(metaspace)
+	t.WithDecoder(metaspace)
+
+	var specialTokens []tokenizer.AddedToken
+	specialTokens = append(specialTokens, tokenizer.NewAddedToken("<s>", true))
+	specialTokens = append(specialTokens, tokenizer.NewAddedToken("<pad>", true))
+	specialTokens = append(specialTokens, tokenizer.NewAddedToken("</s>", true))
+	specialTokens = append(specialTokens, tokenizer.NewAddedToken("<unk>", true))
+	specialTokens = append(specialTokens, tokenizer.NewAddedToken("<mask>", true).SetLStrip(true))
+	t.AddSpecialTokens(specialTokens)
+
+	sepId, ok := t.TokenToId("</s>")
+	if !ok {
+		return fmt.Errorf("Cannot find ID for </s> token.\n")
+	}
+	clsId, ok := t.TokenToId("<s>")
+	if !ok {
+		return fmt.Errorf("Cannot find ID for <s> token.\n")
+	}
+
+	single, err := processor.NewTemplateFromOne("<s> $A </s>")
+	if err != nil {
+		return err
+	}
+	pair, err := processor.NewTemplateFromOne("<s> $A </s> </s> $B </s>")
+	if err != nil {
+		return err
+	}
+	postProcess := processor.NewTemplateProcessing(single, pair, processor.NewTokensFrom([]processor.SpecialToken{
+		*processor.NewSpecialTokenFrom("<s>", clsId),
+		*processor.NewSpecialTokenFrom("</s>", sepId),
+	}))
+	t.WithPostProcessor(postProcess)
+
+	return nil
+}
+
+// NewUnigramFromSentencePiece creates a Unigram model with XLM-R (fairseq) ids
+// from a SentencePiece model. See `FairseqOffset` for ids mapping.
+func NewUnigramFromSentencePiece(spModel *sentencepiece.Model) (*sentencepiece.Unigram, error) {
+	if len(spModel.Pieces) < 3 {
+		err := fmt.Errorf("Invalid SentencePiece model: expected at least 3 pieces, got %v.", len(spModel.Pieces))
+		return nil, err
+	}
+
+	pieces := []sentencepiece.Piece{
+		{Value: "<s>", Score: 0, Type: sentencepiece.Control},
+		{Value: "<pad>", Score: 0, Type: sentencepiece.Control},
+		{Value: "</s>", Score: 0, Type: sentencepiece.Control},
+		{Value: "<unk>", Score: 0, Type: sentencepiece.Unknown},
+	}
+	pieces = append(pieces, spModel.Pieces[3:]...)
+	pieces = append(pieces, sentencepiece.Piece{Value: "<mask>", Score: 0, Type: sentencepiece.UserDefined})
+
+	unkId := 3
+
+	return sentencepiece.NewUnigram(pieces, unkId)
+}
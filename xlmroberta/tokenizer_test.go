@@ -0,0 +1,45 @@
+package xlmroberta_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sugarme/tokenizer"
+
+	"github.com/yinziyang/transformer/xlmroberta"
+)
+
+// Reference values generated with HF `XLMRobertaTokenizerFast.from_pretrained("xlm-roberta-base")`.
+func TestXLMRobertaTokenizer(t *testing.T) {
+	tk := xlmroberta.NewTokenizer()
+	err := tk.Load("xlm-roberta-base", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantVocabSize := 250002
+	gotVocabSize := tk.GetVocabSize(true)
+	if !reflect.DeepEqual(wantVocabSize, gotVocabSize) {
+		t.Errorf("Want vocab size: %v\n", wantVocabSize)
+		t.Errorf("Got vocab size: %v\n", gotVocabSize)
+	}
+
+	input := tokenizer.NewSingleEncodeInput(tokenizer.NewInputSequence("Hello world"))
+	encoding, err := tk.Encode(input, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantIds := []int{0, 35378, 8999, 2}
+	if !reflect.DeepEqual(wantIds, encoding.Ids) {
+		t.Errorf("Want ids: %v\n", wantIds)
+		t.Errorf("Got ids: %v\n", encoding.Ids)
+	}
+
+	wantMaskId := 250001
+	gotMaskId, ok := tk.TokenToId("<mask>")
+	if !ok || gotMaskId != wantMaskId {
+		t.Errorf("Want <mask> id: %v\n", wantMaskId)
+		t.Errorf("Got <mask> id: %v\n", gotMaskId)
+	}
+}